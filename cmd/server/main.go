@@ -1,10 +1,12 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
@@ -14,6 +16,8 @@ import (
 	"strings"
 	"time"
 
+	"nokia_modem/internal/auth"
+	"nokia_modem/internal/certs"
 	"nokia_modem/internal/config"
 	"nokia_modem/internal/router"
 	"nokia_modem/internal/server"
@@ -65,6 +69,10 @@ func main() {
 		if err := setupCommand(args); err != nil {
 			log.Fatalf("setup: %v", err)
 		}
+	case "passwd":
+		if err := passwdCommand(args); err != nil {
+			log.Fatalf("passwd: %v", err)
+		}
 	case "version", "-v", "--version":
 		fmt.Println(appVersion)
 	case "help", "-h", "--help":
@@ -129,13 +137,46 @@ func runCommand(args []string) error {
 			Addr:    addr,
 			Handler: handler,
 		}
+		httpServer.RegisterOnShutdown(srv.CloseStreams)
+		servers := []*http.Server{httpServer}
+
+		// TLS settings are re-read on every pass so a config change picks up
+		// new certificates along with the new address.
+		if currentCfg.TLSEnabled {
+			tlsConfig, err := certs.ServerConfig(currentCfg, filepath.Dir(*cfgPath))
+			if err != nil {
+				return fmt.Errorf("tls: %w", err)
+			}
+			httpServer.TLSConfig = tlsConfig
+			if port := currentCfg.HTTPRedirectPort; port != "" {
+				servers = append(servers, &http.Server{
+					Addr:              net.JoinHostPort(currentCfg.ListenHost, port),
+					Handler:           httpsRedirectHandler(currentCfg.ListenPort),
+					ReadHeaderTimeout: 10 * time.Second,
+				})
+			}
+		}
 
-		errCh := make(chan error, 1)
+		errCh := make(chan error, len(servers))
 		go func() {
+			if httpServer.TLSConfig != nil {
+				errCh <- httpServer.ListenAndServeTLS("", "")
+				return
+			}
 			errCh <- httpServer.ListenAndServe()
 		}()
+		for _, redirect := range servers[1:] {
+			go func() {
+				errCh <- redirect.ListenAndServe()
+			}()
+			logger.Printf("Redirecting http://%s to HTTPS", redirect.Addr)
+		}
 
-		logger.Printf("Starting server on %s", addr)
+		if httpServer.TLSConfig != nil {
+			logger.Printf("Starting server on https://%s", addr)
+		} else {
+			logger.Printf("Starting server on %s", addr)
+		}
 		restartRequested := false
 
 	serverLoop:
@@ -143,6 +184,7 @@ func runCommand(args []string) error {
 			select {
 			case err := <-errCh:
 				if err != nil && !errors.Is(err, http.ErrServerClosed) {
+					shutdownServers(servers)
 					return fmt.Errorf("listen: %w", err)
 				}
 				if restartRequested {
@@ -154,17 +196,45 @@ func runCommand(args []string) error {
 				currentCfg = updatedCfg
 				restartRequested = true
 				logger.Printf("Configuration changed, reloading server...")
-				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-				if err := httpServer.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
-					cancel()
+				if err := shutdownServers(servers); err != nil {
 					return fmt.Errorf("shutdown: %w", err)
 				}
-				cancel()
 			}
 		}
 	}
 }
 
+// shutdownServers stops every listener of one pass of the reload loop.
+// Shutdown waits for each server to close, so the ports are free again when
+// it returns.
+func shutdownServers(servers []*http.Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var errs []error
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// httpsRedirectHandler sends plain HTTP requests to the same host on the
+// HTTPS port.
+func httpsRedirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		target := "https://" + host
+		if httpsPort != "443" {
+			target = "https://" + net.JoinHostPort(host, httpsPort)
+		}
+		http.Redirect(w, r, target+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
 func setupCommand(args []string) error {
 	defaultPath, err := defaultConfigPath()
 	if err != nil {
@@ -185,6 +255,84 @@ func setupCommand(args []string) error {
 	return nil
 }
 
+// passwdCommand sets the admin password for the web UI and enables
+// authentication. With -user it adds or updates an extra login with the
+// given scopes instead. The password is read from the first line of stdin so
+// it never shows up in the process list or shell history.
+func passwdCommand(args []string) error {
+	defaultPath, err := defaultConfigPath()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("passwd", flag.ExitOnError)
+	cfgPath := fs.String("config", defaultPath, "path to configuration file")
+	user := fs.String("user", "admin", "login name; anything other than admin creates an extra user")
+	scopes := fs.String("scopes", auth.ScopeRead, "comma-separated scopes for -user (read, control, admin)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	name := strings.TrimSpace(*user)
+	if name == "" {
+		return errors.New("empty user name")
+	}
+	var granted []string
+	for _, scope := range strings.Split(*scopes, ",") {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !auth.ValidScope(scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+		granted = append(granted, scope)
+	}
+
+	logger := log.New(os.Stdout, "[nokia-router] ", log.LstdFlags)
+	if err := ensureConfigFile(*cfgPath, logger); err != nil {
+		return err
+	}
+	cfg, err := config.Load(*cfgPath)
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "New password for %s: ", name)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("read password: %w", err)
+	}
+	fmt.Fprintln(os.Stderr)
+
+	hash, err := auth.HashPassword(strings.TrimRight(line, "\r\n"))
+	if err != nil {
+		return err
+	}
+	if name == "admin" {
+		cfg.Auth.Enabled = true
+		cfg.Auth.PasswordHash = hash
+		if err := config.Save(*cfgPath, cfg); err != nil {
+			return err
+		}
+		logger.Printf("Admin password updated in %s; restart the service to apply it", *cfgPath)
+		return nil
+	}
+
+	entry := config.AuthUser{Name: name, PasswordHash: hash, Scopes: granted}
+	found := false
+	for i := range cfg.Auth.Users {
+		if cfg.Auth.Users[i].Name == name {
+			cfg.Auth.Users[i] = entry
+			found = true
+		}
+	}
+	if !found {
+		cfg.Auth.Users = append(cfg.Auth.Users, entry)
+	}
+	if err := config.Save(*cfgPath, cfg); err != nil {
+		return err
+	}
+	logger.Printf("User %q (%s) saved in %s; restart the service to apply it", name, strings.Join(granted, ", "), *cfgPath)
+	return nil
+}
+
 func defaultConfigPath() (string, error) {
 	if home := strings.TrimSpace(os.Getenv("HOME")); home != "" {
 		return filepath.Join(home, ".config", "nokia", "config.json"), nil
@@ -203,6 +351,7 @@ func printUsage() {
 	fmt.Println("Commands:")
 	fmt.Println("  run     Start the web server")
 	fmt.Println("  setup   Generate default configuration and exit")
+	fmt.Println("  passwd  Set the web UI admin password, or a user's with -user/-scopes (read from stdin)")
 	fmt.Println("  version Show program version")
 	fmt.Println()
 	fmt.Println("Global options:")
@@ -0,0 +1,175 @@
+// Package auth implements the credential primitives for the web UI and API:
+// PBKDF2 password hashes stored in config and random bearer tokens of which
+// only a SHA-256 digest is kept.
+package auth
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	hashScheme = "pbkdf2-sha256"
+	// DefaultIterations follows the OWASP recommendation for PBKDF2-SHA256.
+	DefaultIterations = 600000
+	saltBytes         = 16
+	keyBytes          = 32
+
+	// TokenPrefix marks API tokens so they are easy to spot in logs and
+	// secret scanners.
+	TokenPrefix = "nmk_"
+
+	// MinPasswordLength is enforced when a password is set.
+	MinPasswordLength = 8
+)
+
+// Scopes, from least to most privileged. Each one includes those before it.
+const (
+	ScopeRead    = "read"
+	ScopeControl = "control"
+	ScopeAdmin   = "admin"
+)
+
+// Scopes lists every known scope in privilege order.
+var Scopes = []string{ScopeRead, ScopeControl, ScopeAdmin}
+
+func scopeRank(scope string) int {
+	for i, known := range Scopes {
+		if known == scope {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// ValidScope reports whether scope is one of Scopes.
+func ValidScope(scope string) bool {
+	return scopeRank(scope) > 0
+}
+
+// ScopeGranted reports whether any of granted covers required.
+func ScopeGranted(granted []string, required string) bool {
+	need := scopeRank(required)
+	if need == 0 {
+		return false
+	}
+	for _, scope := range granted {
+		if scopeRank(scope) >= need {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	ErrInvalidHash    = errors.New("auth: invalid password hash")
+	ErrPasswordLength = fmt.Errorf("auth: password must be at least %d characters", MinPasswordLength)
+)
+
+// HashPassword derives a hash in the form
+// "pbkdf2-sha256$<iterations>$<salt>$<key>" with base64 (raw std) fields.
+func HashPassword(password string) (string, error) {
+	return HashPasswordIterations(password, DefaultIterations)
+}
+
+// HashPasswordIterations is HashPassword with an explicit work factor, for
+// slow hardware and tests.
+func HashPasswordIterations(password string, iterations int) (string, error) {
+	if iterations < 1 {
+		return "", fmt.Errorf("auth: invalid iteration count %d", iterations)
+	}
+	if len(password) < MinPasswordLength {
+		return "", ErrPasswordLength
+	}
+	salt := make([]byte, saltBytes)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("auth: read salt: %w", err)
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, keyBytes)
+	if err != nil {
+		return "", fmt.Errorf("auth: derive key: %w", err)
+	}
+	return fmt.Sprintf("%s$%d$%s$%s", hashScheme, iterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword reports whether password matches encoded. A malformed hash
+// never matches.
+func VerifyPassword(encoded, password string) bool {
+	iterations, salt, want, err := parseHash(encoded)
+	if err != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// ValidHash reports whether encoded is a hash VerifyPassword understands.
+func ValidHash(encoded string) bool {
+	_, _, _, err := parseHash(encoded)
+	return err == nil
+}
+
+func parseHash(encoded string) (int, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimSpace(encoded), "$")
+	if len(parts) != 4 || parts[0] != hashScheme {
+		return 0, nil, nil, ErrInvalidHash
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return 0, nil, nil, ErrInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil || len(salt) == 0 {
+		return 0, nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return 0, nil, nil, ErrInvalidHash
+	}
+	return iterations, salt, key, nil
+}
+
+// RandomString returns n random bytes encoded as unpadded base64url.
+func RandomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("auth: read random: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// GenerateToken returns a new API token and the digest to store for it.
+func GenerateToken() (token, digest string, err error) {
+	secret, err := RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	token = TokenPrefix + secret
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hex SHA-256 digest stored in place of a token. API
+// tokens carry 256 bits of entropy, so a fast hash is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokenMatches compares a presented token against a stored digest in
+// constant time.
+func TokenMatches(digest, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(strings.ToLower(strings.TrimSpace(digest)))) == 1
+}
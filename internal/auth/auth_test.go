@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHashPasswordRoundTrip(t *testing.T) {
+	encoded, err := HashPasswordIterations("correct horse", 1000)
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	if !strings.HasPrefix(encoded, "pbkdf2-sha256$1000$") || !ValidHash(encoded) {
+		t.Fatalf("unexpected encoding %q", encoded)
+	}
+	if !VerifyPassword(encoded, "correct horse") {
+		t.Fatalf("expected password to verify")
+	}
+	if VerifyPassword(encoded, "correct horsf") {
+		t.Fatalf("wrong password verified")
+	}
+	if VerifyPassword("plaintext", "plaintext") {
+		t.Fatalf("malformed hash must never verify")
+	}
+	if _, err := HashPassword("short"); err != ErrPasswordLength {
+		t.Fatalf("expected ErrPasswordLength, got %v", err)
+	}
+}
+
+func TestGenerateToken(t *testing.T) {
+	token, digest, err := GenerateToken()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if !strings.HasPrefix(token, TokenPrefix) || strings.Contains(digest, token) {
+		t.Fatalf("unexpected token %q / digest %q", token, digest)
+	}
+	if !TokenMatches(digest, token) || TokenMatches(digest, token+"x") {
+		t.Fatalf("token comparison is wrong")
+	}
+}
+
+func TestScopeGranted(t *testing.T) {
+	cases := []struct {
+		granted  []string
+		required string
+		want     bool
+	}{
+		{[]string{ScopeRead}, ScopeRead, true},
+		{[]string{ScopeRead}, ScopeControl, false},
+		{[]string{ScopeControl}, ScopeRead, true},
+		{[]string{ScopeAdmin}, ScopeControl, true},
+		{[]string{ScopeControl}, ScopeAdmin, false},
+		{[]string{"bogus"}, ScopeRead, false},
+		{[]string{ScopeAdmin}, "bogus", false},
+	}
+	for _, tc := range cases {
+		if got := ScopeGranted(tc.granted, tc.required); got != tc.want {
+			t.Errorf("ScopeGranted(%v, %q) = %v, want %v", tc.granted, tc.required, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"nokia_modem/internal/config"
+)
+
+func TestServerConfigPersistsSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.Defaults()
+	cfg.ListenHost = "192.168.1.10"
+
+	first, err := ServerConfig(cfg, dir)
+	if err != nil {
+		t.Fatalf("ServerConfig: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(first.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if err := leaf.VerifyHostname("192.168.1.10"); err != nil {
+		t.Fatalf("certificate does not cover the listen host: %v", err)
+	}
+	if err := leaf.VerifyHostname("localhost"); err != nil {
+		t.Fatalf("certificate does not cover localhost: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, SelfSignedKey))
+	if err != nil {
+		t.Fatalf("stat key: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("key must be private, got %v", perm)
+	}
+
+	// A restart must reuse the same certificate.
+	second, err := ServerConfig(cfg, dir)
+	if err != nil {
+		t.Fatalf("ServerConfig again: %v", err)
+	}
+	if !bytes.Equal(first.Certificates[0].Certificate[0], second.Certificates[0].Certificate[0]) {
+		t.Fatalf("expected the persisted certificate to be reused")
+	}
+}
+
+func TestServerConfigUserCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "custom.crt")
+	keyFile := filepath.Join(dir, "custom.key")
+	if err := EnsureSelfSigned(certFile, keyFile, []string{"router.lan"}); err != nil {
+		t.Fatalf("EnsureSelfSigned: %v", err)
+	}
+
+	cfg := config.Defaults()
+	cfg.TLSCert, cfg.TLSKey = certFile, keyFile
+	if _, err := ServerConfig(cfg, dir); err != nil {
+		t.Fatalf("ServerConfig: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, SelfSignedCert)); !os.IsNotExist(err) {
+		t.Fatalf("no self-signed certificate should be generated when one is configured")
+	}
+
+	cfg.TLSKey = filepath.Join(dir, "missing.key")
+	if _, err := ServerConfig(cfg, dir); err == nil {
+		t.Fatalf("expected an error for a missing key")
+	}
+}
@@ -12,15 +12,35 @@ import (
 // Config holds application configuration values. All fields are optional;
 // fallbacks are applied when fields are empty.
 type Config struct {
-	RouterHost     string            `json:"router_host"`
-	RouterUser     string            `json:"router_user"`
-	RouterPassword string            `json:"router_password"`
-	ListenHost     string            `json:"listen_host"`
-	ListenPort     string            `json:"listen_port"`
-	PollIntervalMs int               `json:"poll_interval_ms"`
-	Telegram       TelegramConfig    `json:"telegram"`
-	LongPolling    LongPollingConfig `json:"long_polling"`
-	MQTT           MQTTConfig        `json:"mqtt"`
+	RouterHost     string `json:"router_host"`
+	RouterUser     string `json:"router_user"`
+	RouterPassword string `json:"router_password"`
+	ListenHost     string `json:"listen_host"`
+	ListenPort     string `json:"listen_port"`
+	// TLSEnabled serves HTTPS on ListenPort. Without TLSCert/TLSKey a
+	// self-signed certificate is generated next to config.json.
+	TLSEnabled bool   `json:"tls_enabled"`
+	TLSCert    string `json:"tls_cert"`
+	TLSKey     string `json:"tls_key"`
+	// HTTPRedirectPort, when set with TLSEnabled, answers plain HTTP on this
+	// port with a redirect to HTTPS.
+	HTTPRedirectPort string              `json:"http_redirect_port"`
+	PollIntervalMs   int                 `json:"poll_interval_ms"`
+	Telegram         TelegramConfig      `json:"telegram"`
+	LongPolling      LongPollingConfig   `json:"long_polling"`
+	MQTT             MQTTConfig          `json:"mqtt"`
+	SignalHistory    SignalHistoryConfig `json:"signal_history"`
+	Metrics          MetricsConfig       `json:"metrics"`
+	WanRenew         WanRenewConfig      `json:"wan_renew"`
+	Auth             AuthConfig          `json:"auth"`
+	RouterCache      RouterCacheConfig   `json:"router_cache"`
+	Quota            QuotaConfig         `json:"quota"`
+	Usage            UsageConfig         `json:"usage"`
+	SmsRules         SmsRulesConfig      `json:"sms_rules"`
+	Notifiers        []NotifierConfig    `json:"notifiers"`
+	Alerts           AlertsConfig        `json:"alerts"`
+	Watchdog         WatchdogConfig      `json:"watchdog"`
+	Schedules        []ScheduleConfig    `json:"schedules"`
 }
 
 type TelegramConfig struct {
@@ -29,6 +49,15 @@ type TelegramConfig struct {
 	BotToken  string `json:"bot_token"`
 	ChatID    string `json:"chat_id"`
 	ParseMode string `json:"parse_mode"`
+
+	// Commands long-polls getUpdates and answers bot commands from ChatID
+	// and AllowedChatIDs.
+	Commands       bool     `json:"commands"`
+	AllowedChatIDs []string `json:"allowed_chat_ids"`
+
+	// Alerts sends router alerts, such as quota thresholds and alert
+	// rules, to ChatID.
+	Alerts bool `json:"alerts"`
 }
 
 type LongPollingConfig struct {
@@ -44,6 +73,241 @@ type MQTTConfig struct {
 	Username  string `json:"username"`
 	Password  string `json:"password"`
 	TopicBase string `json:"topic_base"`
+
+	// HomeAssistant publishes MQTT discovery messages under DiscoveryPrefix.
+	HomeAssistant   bool     `json:"home_assistant"`
+	DiscoveryPrefix string   `json:"discovery_prefix"`
+	APNOptions      []string `json:"apn_options"`
+
+	// AllowedCommands lists the commands accepted on <topic_base>/cmd/# and
+	// the Home Assistant command topics; "*" allows all of them.
+	AllowedCommands []string `json:"allowed_commands"`
+
+	// Alerts publishes router alerts under the topic base, e.g. quota
+	// thresholds to <topic_base>/quota/alert.
+	Alerts bool `json:"alerts"`
+}
+
+// SignalHistoryConfig controls the background signal-quality sampler.
+type SignalHistoryConfig struct {
+	Enabled         bool `json:"enabled"`
+	IntervalSeconds int  `json:"interval_seconds"`
+	RetentionDays   int  `json:"retention_days"`
+}
+
+// MetricsConfig controls the Prometheus /metrics endpoint and the background
+// refresh that feeds it.
+type MetricsConfig struct {
+	Enabled         bool `json:"enabled"`
+	IntervalSeconds int  `json:"interval_seconds"`
+}
+
+// WanRenewConfig tunes the server-side WAN IP renewal job, which switches to
+// TempAPN and back until the carrier hands out a new public address.
+type WanRenewConfig struct {
+	TempAPN string `json:"temp_apn"`
+	// APN is restored when the router does not report its current APN.
+	// Left empty, a renewal is refused in that case.
+	APN            string `json:"apn"`
+	MaxAttempts    int    `json:"max_attempts"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+// RouterCacheConfig controls the response cache in front of the router.
+// TTLMs maps read endpoints to how long, in milliseconds, a response is
+// reused; 0 turns caching off for that endpoint. Concurrent identical
+// requests are coalesced either way.
+type RouterCacheConfig struct {
+	Enabled bool           `json:"enabled"`
+	TTLMs   map[string]int `json:"ttl_ms"`
+}
+
+// QuotaConfig describes the data packages on the SIM. Usage recorded in
+// daily_usage is charged to the packages whose cycle covers the day, in the
+// order they are listed, and an alert goes to the notifiers that take
+// alerts once per cycle when a package crosses one of Thresholds (percent
+// of its quota).
+type QuotaConfig struct {
+	Packages        []QuotaPackage `json:"packages"`
+	Thresholds      []int          `json:"thresholds"`
+	IntervalSeconds int            `json:"interval_seconds"`
+}
+
+// QuotaPackage is one data allowance. StartDate (YYYY-MM-DD) begins the
+// first cycle; either ValidityDays makes it a one-off package that expires,
+// or ResetDay renews it every month on that day.
+type QuotaPackage struct {
+	Name         string `json:"name"`
+	QuotaBytes   int64  `json:"quota_bytes"`
+	StartDate    string `json:"start_date"`
+	ValidityDays int    `json:"validity_days"`
+	ResetDay     int    `json:"reset_day"`
+}
+
+// UsageConfig is the retention policy for recorded traffic. Hourly buckets
+// are kept for HourlyRetentionDays, daily ones for DailyRetentionDays and
+// monthly totals for MonthlyRetentionMonths (0 keeps them forever).
+type UsageConfig struct {
+	HourlyRetentionDays    int `json:"hourly_retention_days"`
+	DailyRetentionDays     int `json:"daily_retention_days"`
+	MonthlyRetentionMonths int `json:"monthly_retention_months"`
+}
+
+// NotifierConfig is an additional destination for forwarded SMS, next to
+// Telegram and MQTT. Type is one of "ntfy", "gotify", "discord", "slack",
+// "webhook" or "smtp"; Name identifies it in the delivery state kept in
+// sms.json.
+type NotifierConfig struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Enabled bool   `json:"enabled"`
+	// Alerts also sends router alerts, such as quota thresholds, alert
+	// rules and watchdog events, to this notifier.
+	Alerts bool `json:"alerts"`
+	// URL is the ntfy or Gotify server, the Discord/Slack webhook URL or
+	// the generic webhook endpoint.
+	URL      string `json:"url"`
+	Topic    string `json:"topic"`
+	Token    string `json:"token"`
+	Priority int    `json:"priority"`
+	// Secret signs generic webhook bodies with HMAC-SHA256.
+	Secret string `json:"secret"`
+	// SMTP is used by notifiers of type "smtp" only.
+	SMTP SMTPConfig `json:"smtp,omitzero"`
+}
+
+// SMTPConfig describes the mail server and the mails an "smtp" notifier
+// sends.
+type SMTPConfig struct {
+	Host string `json:"host"`
+	// Port defaults to 587 for "starttls", 465 for "tls" and 25 for "none".
+	Port int `json:"port"`
+	// Security is "starttls" (the default), "tls" for implicit TLS or
+	// "none".
+	Security string   `json:"security"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	// Subject is a text/template rendered with .Title, .Sender, .Content
+	// and .Time. The default is "{{.Title}}".
+	Subject string `json:"subject"`
+}
+
+// AlertsConfig drives the alerting engine, which checks Rules against the
+// router every IntervalSeconds and notifies the notifiers that take alerts
+// when an alert fires or resolves.
+type AlertsConfig struct {
+	Enabled         bool        `json:"enabled"`
+	IntervalSeconds int         `json:"interval_seconds"`
+	Rules           []AlertRule `json:"rules"`
+}
+
+// AlertRule fires once Metric compared with Threshold by Op has held for
+// ForMinutes. "link_down" needs no Op, and the event metrics
+// "wan_ip_changed" and "new_device" fire once per occurrence. A rule
+// notifies at most once per CooldownMinutes.
+type AlertRule struct {
+	Name            string  `json:"name"`
+	Metric          string  `json:"metric"`
+	Op              string  `json:"op"`
+	Threshold       float64 `json:"threshold"`
+	ForMinutes      int     `json:"for_minutes"`
+	CooldownMinutes int     `json:"cooldown_minutes"`
+}
+
+// WatchdogConfig probes connectivity every IntervalSeconds. A round fails
+// when every check fails. After FailureThreshold failed rounds in a row the
+// watchdog re-applies the APN, then reboots the router, waiting
+// BackoffMinutes (doubled after each action) between steps and rebooting at
+// most MaxRebootsPerDay times in 24 hours; 0 disables reboots. APN
+// overrides the APN read from the router.
+type WatchdogConfig struct {
+	Enabled          bool            `json:"enabled"`
+	IntervalSeconds  int             `json:"interval_seconds"`
+	FailureThreshold int             `json:"failure_threshold"`
+	BackoffMinutes   int             `json:"backoff_minutes"`
+	MaxRebootsPerDay int             `json:"max_reboots_per_day"`
+	APN              string          `json:"apn"`
+	Checks           []WatchdogCheck `json:"checks"`
+}
+
+// WatchdogCheck is one reachability probe. Target is a URL for "http", a
+// host:port for "tcp" and a host name for "dns", which is resolved through
+// the DNS servers the router reports for the WAN.
+type WatchdogCheck struct {
+	Type           string `json:"type"`
+	Target         string `json:"target"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+// ScheduleConfig runs Command, one of the remote commands MQTT and the
+// chat bots accept, whenever Cron (five fields, or a macro such as @daily)
+// matches in TimeZone. An empty TimeZone means the server's local time.
+// Args are the command's parameters, as in an MQTT command payload.
+type ScheduleConfig struct {
+	Name     string                 `json:"name"`
+	Enabled  bool                   `json:"enabled"`
+	Cron     string                 `json:"cron"`
+	TimeZone string                 `json:"time_zone"`
+	Command  string                 `json:"command"`
+	Args     map[string]interface{} `json:"args,omitempty"`
+}
+
+// SmsRulesConfig lists the rules applied once to every new SMS the poller
+// archives. Rules are checked in order and every matching rule runs its
+// actions.
+type SmsRulesConfig struct {
+	Rules []SmsRule `json:"rules"`
+}
+
+// SmsRule matches on Sender and Content (regular expressions, empty matches
+// anything) and on the local time of day the message arrived, between
+// ActiveFrom and ActiveTo (HH:MM, may wrap midnight). Named groups in
+// Content are extracted into fields on the archived message.
+type SmsRule struct {
+	Name       string `json:"name"`
+	Sender     string `json:"sender"`
+	Content    string `json:"content"`
+	ActiveFrom string `json:"active_from"`
+	ActiveTo   string `json:"active_to"`
+
+	// Actions.
+	TelegramChatID  string `json:"telegram_chat_id"`
+	MQTTTopic       string `json:"mqtt_topic"`
+	MarkRead        bool   `json:"mark_read"`
+	DeleteAfterDays int    `json:"delete_after_days"`
+}
+
+// AuthConfig protects the web UI and API with an admin password, extra users
+// and bearer tokens. Users and tokens carry scopes ("read", "control",
+// "admin"); the admin password always has every scope.
+type AuthConfig struct {
+	Enabled bool `json:"enabled"`
+	// PasswordHash is a PBKDF2 hash; set it with `nokia-router passwd`.
+	PasswordHash    string     `json:"password_hash"`
+	SessionTTLHours int        `json:"session_ttl_hours"`
+	Users           []AuthUser `json:"users"`
+	Tokens          []APIToken `json:"tokens"`
+	// AllowedOrigins may call the API cross-origin; empty means same-origin
+	// only and "*" allows any origin.
+	AllowedOrigins []string `json:"allowed_origins"`
+}
+
+// APIToken is a bearer token for scripts. Only the SHA-256 digest of the
+// token is stored.
+type APIToken struct {
+	Name      string   `json:"name"`
+	Hash      string   `json:"hash"`
+	Scopes    []string `json:"scopes"`
+	CreatedAt string   `json:"created_at"`
+}
+
+// AuthUser is an additional dashboard login, e.g. a read-only account.
+type AuthUser struct {
+	Name         string   `json:"name"`
+	PasswordHash string   `json:"password_hash"`
+	Scopes       []string `json:"scopes"`
 }
 
 // Defaults provides safe defaults when nothing else is configured.
@@ -61,6 +325,8 @@ func Defaults() Config {
 			BotToken:  "",
 			ChatID:    "",
 			ParseMode: "",
+			Commands:  false,
+			Alerts:    true,
 		},
 		LongPolling: LongPollingConfig{
 			Enabled:              false,
@@ -74,7 +340,85 @@ func Defaults() Config {
 			Username:  "",
 			Password:  "",
 			TopicBase: "modem/nokia",
+
+			HomeAssistant:   false,
+			DiscoveryPrefix: "homeassistant",
+			APNOptions:      []string{"internet", "xlunlimited"},
+			AllowedCommands: []string{"apn", "led", "reboot"},
+			Alerts:          true,
+		},
+		SignalHistory: SignalHistoryConfig{
+			Enabled:         true,
+			IntervalSeconds: 60,
+			RetentionDays:   7,
+		},
+		Metrics: MetricsConfig{
+			Enabled:         false,
+			IntervalSeconds: 30,
+		},
+		WanRenew: WanRenewConfig{
+			TempAPN:        "internet",
+			APN:            "",
+			MaxAttempts:    3,
+			TimeoutSeconds: 60,
+		},
+		Auth: AuthConfig{
+			Enabled:         false,
+			SessionTTLHours: 168,
+		},
+		// Status endpoints stay just under the default 1 s poll interval so
+		// the dashboard still sees every tick; slow-moving data lives longer.
+		RouterCache: RouterCacheConfig{
+			Enabled: true,
+			TTLMs: map[string]int{
+				"prelogin_status":     5000,
+				"status_web":          900,
+				"service_data":        900,
+				"overview":            2000,
+				"wan_status":          2000,
+				"device_status":       2000,
+				"network_clients":     2000,
+				"lan_status":          2000,
+				"sms_list":            900,
+				"led_state":           2000,
+				"cell_identification": 5000,
+				"wlan_24g":            10000,
+				"wlan_5g":             10000,
+				"sim_info":            60000,
+			},
+		},
+		Quota: QuotaConfig{
+			Packages:        []QuotaPackage{},
+			Thresholds:      []int{80, 95, 100},
+			IntervalSeconds: 300,
 		},
+		Usage: UsageConfig{
+			HourlyRetentionDays:    14,
+			DailyRetentionDays:     400,
+			MonthlyRetentionMonths: 0,
+		},
+		SmsRules: SmsRulesConfig{
+			Rules: []SmsRule{},
+		},
+		Notifiers: []NotifierConfig{},
+		Alerts: AlertsConfig{
+			Enabled:         false,
+			IntervalSeconds: 60,
+			Rules:           []AlertRule{},
+		},
+		Watchdog: WatchdogConfig{
+			Enabled:          false,
+			IntervalSeconds:  60,
+			FailureThreshold: 3,
+			BackoffMinutes:   5,
+			MaxRebootsPerDay: 2,
+			Checks: []WatchdogCheck{
+				{Type: "http", Target: "http://connectivitycheck.gstatic.com/generate_204", TimeoutSeconds: 5},
+				{Type: "tcp", Target: "1.1.1.1:443", TimeoutSeconds: 5},
+				{Type: "dns", Target: "example.com", TimeoutSeconds: 5},
+			},
+		},
+		Schedules: []ScheduleConfig{},
 	}
 }
 
@@ -126,6 +470,18 @@ func applyEnvOverrides(cfg *Config) {
 	if v := strings.TrimSpace(os.Getenv("PORT")); v != "" {
 		cfg.ListenPort = v
 	}
+	if v := strings.TrimSpace(os.Getenv("TLS_ENABLED")); v != "" {
+		cfg.TLSEnabled = parseBool(v, cfg.TLSEnabled)
+	}
+	if v := strings.TrimSpace(os.Getenv("TLS_CERT")); v != "" {
+		cfg.TLSCert = v
+	}
+	if v := strings.TrimSpace(os.Getenv("TLS_KEY")); v != "" {
+		cfg.TLSKey = v
+	}
+	if v, ok := os.LookupEnv("HTTP_REDIRECT_PORT"); ok {
+		cfg.HTTPRedirectPort = strings.TrimSpace(v)
+	}
 	if v := strings.TrimSpace(os.Getenv("POLL_INTERVAL_MS")); v != "" {
 		if ms, err := strconv.Atoi(v); err == nil {
 			cfg.PollIntervalMs = ms
@@ -149,6 +505,15 @@ func applyEnvOverrides(cfg *Config) {
 	if v := strings.TrimSpace(os.Getenv("LONG_POLLING_ENABLED")); v != "" {
 		cfg.LongPolling.Enabled = parseBool(v, cfg.LongPolling.Enabled)
 	}
+	if v := strings.TrimSpace(os.Getenv("TELEGRAM_COMMANDS")); v != "" {
+		cfg.Telegram.Commands = parseBool(v, cfg.Telegram.Commands)
+	}
+	if v, ok := os.LookupEnv("TELEGRAM_ALLOWED_CHAT_IDS"); ok {
+		cfg.Telegram.AllowedChatIDs = splitList(v)
+	}
+	if v := strings.TrimSpace(os.Getenv("TELEGRAM_ALERTS")); v != "" {
+		cfg.Telegram.Alerts = parseBool(v, cfg.Telegram.Alerts)
+	}
 	if v := strings.TrimSpace(os.Getenv("LONG_POLLING_FORWARD_SMS_TO_TELEGRAM")); v != "" {
 		cfg.LongPolling.ForwardSmsToTelegram = parseBool(v, cfg.LongPolling.ForwardSmsToTelegram)
 	}
@@ -175,6 +540,101 @@ func applyEnvOverrides(cfg *Config) {
 	if v := strings.TrimSpace(os.Getenv("MQTT_TOPIC_BASE")); v != "" {
 		cfg.MQTT.TopicBase = v
 	}
+	if v := strings.TrimSpace(os.Getenv("MQTT_HOME_ASSISTANT")); v != "" {
+		cfg.MQTT.HomeAssistant = parseBool(v, cfg.MQTT.HomeAssistant)
+	}
+	if v := strings.TrimSpace(os.Getenv("MQTT_DISCOVERY_PREFIX")); v != "" {
+		cfg.MQTT.DiscoveryPrefix = v
+	}
+	if v, ok := os.LookupEnv("MQTT_ALLOWED_COMMANDS"); ok {
+		cfg.MQTT.AllowedCommands = splitList(v)
+	}
+	if v := strings.TrimSpace(os.Getenv("MQTT_ALERTS")); v != "" {
+		cfg.MQTT.Alerts = parseBool(v, cfg.MQTT.Alerts)
+	}
+	if v := strings.TrimSpace(os.Getenv("SIGNAL_HISTORY_ENABLED")); v != "" {
+		cfg.SignalHistory.Enabled = parseBool(v, cfg.SignalHistory.Enabled)
+	}
+	if v := strings.TrimSpace(os.Getenv("SIGNAL_HISTORY_INTERVAL_SECONDS")); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			cfg.SignalHistory.IntervalSeconds = seconds
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("SIGNAL_HISTORY_RETENTION_DAYS")); v != "" {
+		if days, err := strconv.Atoi(v); err == nil {
+			cfg.SignalHistory.RetentionDays = days
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("METRICS_ENABLED")); v != "" {
+		cfg.Metrics.Enabled = parseBool(v, cfg.Metrics.Enabled)
+	}
+	if v := strings.TrimSpace(os.Getenv("METRICS_INTERVAL_SECONDS")); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			cfg.Metrics.IntervalSeconds = seconds
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("WAN_RENEW_TEMP_APN")); v != "" {
+		cfg.WanRenew.TempAPN = v
+	}
+	if v := strings.TrimSpace(os.Getenv("WAN_RENEW_APN")); v != "" {
+		cfg.WanRenew.APN = v
+	}
+	if v := strings.TrimSpace(os.Getenv("WAN_RENEW_MAX_ATTEMPTS")); v != "" {
+		if attempts, err := strconv.Atoi(v); err == nil {
+			cfg.WanRenew.MaxAttempts = attempts
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("WAN_RENEW_TIMEOUT_SECONDS")); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			cfg.WanRenew.TimeoutSeconds = seconds
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("ROUTER_CACHE_ENABLED")); v != "" {
+		cfg.RouterCache.Enabled = parseBool(v, cfg.RouterCache.Enabled)
+	}
+	if v, ok := os.LookupEnv("QUOTA_THRESHOLDS"); ok {
+		thresholds := []int{}
+		for _, item := range splitList(v) {
+			if pct, err := strconv.Atoi(item); err == nil {
+				thresholds = append(thresholds, pct)
+			}
+		}
+		cfg.Quota.Thresholds = thresholds
+	}
+	if v := strings.TrimSpace(os.Getenv("QUOTA_INTERVAL_SECONDS")); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			cfg.Quota.IntervalSeconds = seconds
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("USAGE_HOURLY_RETENTION_DAYS")); v != "" {
+		if days, err := strconv.Atoi(v); err == nil {
+			cfg.Usage.HourlyRetentionDays = days
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("USAGE_DAILY_RETENTION_DAYS")); v != "" {
+		if days, err := strconv.Atoi(v); err == nil {
+			cfg.Usage.DailyRetentionDays = days
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("USAGE_MONTHLY_RETENTION_MONTHS")); v != "" {
+		if months, err := strconv.Atoi(v); err == nil {
+			cfg.Usage.MonthlyRetentionMonths = months
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("AUTH_ENABLED")); v != "" {
+		cfg.Auth.Enabled = parseBool(v, cfg.Auth.Enabled)
+	}
+	if v := strings.TrimSpace(os.Getenv("AUTH_PASSWORD_HASH")); v != "" {
+		cfg.Auth.PasswordHash = v
+	}
+	if v := strings.TrimSpace(os.Getenv("AUTH_SESSION_TTL_HOURS")); v != "" {
+		if hours, err := strconv.Atoi(v); err == nil {
+			cfg.Auth.SessionTTLHours = hours
+		}
+	}
+	if v, ok := os.LookupEnv("AUTH_ALLOWED_ORIGINS"); ok {
+		cfg.Auth.AllowedOrigins = splitList(v)
+	}
 }
 
 func ensureDefaults(cfg *Config) {
@@ -210,6 +670,96 @@ func ensureDefaults(cfg *Config) {
 	if strings.TrimSpace(cfg.MQTT.TopicBase) == "" {
 		cfg.MQTT.TopicBase = defaults.MQTT.TopicBase
 	}
+	if strings.TrimSpace(cfg.MQTT.DiscoveryPrefix) == "" {
+		cfg.MQTT.DiscoveryPrefix = defaults.MQTT.DiscoveryPrefix
+	}
+	if len(cfg.MQTT.APNOptions) == 0 {
+		cfg.MQTT.APNOptions = defaults.MQTT.APNOptions
+	}
+	if cfg.MQTT.AllowedCommands == nil {
+		cfg.MQTT.AllowedCommands = defaults.MQTT.AllowedCommands
+	}
+	if cfg.SignalHistory.IntervalSeconds <= 0 {
+		cfg.SignalHistory.IntervalSeconds = defaults.SignalHistory.IntervalSeconds
+	}
+	if cfg.SignalHistory.RetentionDays <= 0 {
+		cfg.SignalHistory.RetentionDays = defaults.SignalHistory.RetentionDays
+	}
+	if cfg.Metrics.IntervalSeconds <= 0 {
+		cfg.Metrics.IntervalSeconds = defaults.Metrics.IntervalSeconds
+	}
+	if strings.TrimSpace(cfg.WanRenew.TempAPN) == "" {
+		cfg.WanRenew.TempAPN = defaults.WanRenew.TempAPN
+	}
+	if cfg.WanRenew.MaxAttempts <= 0 {
+		cfg.WanRenew.MaxAttempts = defaults.WanRenew.MaxAttempts
+	}
+	if cfg.WanRenew.TimeoutSeconds <= 0 {
+		cfg.WanRenew.TimeoutSeconds = defaults.WanRenew.TimeoutSeconds
+	}
+	if cfg.Auth.SessionTTLHours <= 0 {
+		cfg.Auth.SessionTTLHours = defaults.Auth.SessionTTLHours
+	}
+	if cfg.RouterCache.TTLMs == nil {
+		cfg.RouterCache.TTLMs = map[string]int{}
+	}
+	for key, ms := range defaults.RouterCache.TTLMs {
+		if _, ok := cfg.RouterCache.TTLMs[key]; !ok {
+			cfg.RouterCache.TTLMs[key] = ms
+		}
+	}
+	if cfg.Quota.Packages == nil {
+		cfg.Quota.Packages = []QuotaPackage{}
+	}
+	if cfg.Quota.Thresholds == nil {
+		cfg.Quota.Thresholds = defaults.Quota.Thresholds
+	}
+	if cfg.Quota.IntervalSeconds <= 0 {
+		cfg.Quota.IntervalSeconds = defaults.Quota.IntervalSeconds
+	}
+	if cfg.Usage.HourlyRetentionDays <= 0 {
+		cfg.Usage.HourlyRetentionDays = defaults.Usage.HourlyRetentionDays
+	}
+	if cfg.Usage.DailyRetentionDays <= 0 {
+		cfg.Usage.DailyRetentionDays = defaults.Usage.DailyRetentionDays
+	}
+	if cfg.Usage.MonthlyRetentionMonths < 0 {
+		cfg.Usage.MonthlyRetentionMonths = defaults.Usage.MonthlyRetentionMonths
+	}
+	if cfg.SmsRules.Rules == nil {
+		cfg.SmsRules.Rules = []SmsRule{}
+	}
+	if cfg.Notifiers == nil {
+		cfg.Notifiers = []NotifierConfig{}
+	}
+	if cfg.Alerts.IntervalSeconds == 0 {
+		cfg.Alerts.IntervalSeconds = defaults.Alerts.IntervalSeconds
+	}
+	if cfg.Alerts.Rules == nil {
+		cfg.Alerts.Rules = []AlertRule{}
+	}
+	if cfg.Watchdog.IntervalSeconds == 0 {
+		cfg.Watchdog.IntervalSeconds = defaults.Watchdog.IntervalSeconds
+	}
+	if cfg.Watchdog.FailureThreshold == 0 {
+		cfg.Watchdog.FailureThreshold = defaults.Watchdog.FailureThreshold
+	}
+	if cfg.Watchdog.BackoffMinutes == 0 {
+		cfg.Watchdog.BackoffMinutes = defaults.Watchdog.BackoffMinutes
+	}
+	if cfg.Watchdog.Checks == nil {
+		cfg.Watchdog.Checks = defaults.Watchdog.Checks
+	}
+	if cfg.Schedules == nil {
+		cfg.Schedules = []ScheduleConfig{}
+	}
+	// Tokens created before scopes existed had full access; keep it that way
+	// rather than silently breaking scripts.
+	for i := range cfg.Auth.Tokens {
+		if len(cfg.Auth.Tokens[i].Scopes) == 0 {
+			cfg.Auth.Tokens[i].Scopes = []string{"admin"}
+		}
+	}
 }
 
 func parseBool(value string, fallback bool) bool {
@@ -229,6 +779,16 @@ func parseBool(value string, fallback bool) bool {
 	}
 }
 
+func splitList(value string) []string {
+	out := []string{}
+	for _, part := range strings.Split(value, ",") {
+		if trimmed := strings.TrimSpace(part); trimmed != "" {
+			out = append(out, trimmed)
+		}
+	}
+	return out
+}
+
 // Save writes the provided configuration to the given path.
 func Save(path string, cfg Config) error {
 	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
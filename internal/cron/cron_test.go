@@ -0,0 +1,64 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no zoneinfo: %v", err)
+	}
+	at := func(value string) time.Time {
+		t.Helper()
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", value, berlin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	cases := []struct {
+		spec, from, want string
+	}{
+		{"0 4 * * *", "2026-05-01 03:59", "2026-05-01 04:00"},
+		{"0 4 * * *", "2026-05-01 04:00", "2026-05-02 04:00"},
+		{"@hourly", "2026-05-01 04:30", "2026-05-01 05:00"},
+		{"*/15 22-23 * * *", "2026-05-01 22:50", "2026-05-01 23:00"},
+		{"30 3 * * sun", "2026-05-01 12:00", "2026-05-03 03:30"},
+		{"0 0 1 * *", "2026-12-15 00:00", "2027-01-01 00:00"},
+		{"0 12 29 feb *", "2026-01-01 00:00", "2028-02-29 12:00"},
+		// Both day fields restricted: either one matches.
+		{"0 9 15 * mon", "2026-05-01 10:00", "2026-05-04 09:00"},
+		{"0 9 1-7 * 7", "2026-05-08 00:00", "2026-05-10 09:00"},
+		// A stepped '*' counts as unrestricted: odd days that are Mondays.
+		{"0 4 */2 * 1", "2026-05-01 00:00", "2026-05-11 04:00"},
+		// 02:30 does not exist on the spring-forward day.
+		{"30 2 * * *", "2026-03-28 12:00", "2026-03-30 02:30"},
+	}
+	for _, tc := range cases {
+		schedule, err := Parse(tc.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.spec, err)
+		}
+		if got, want := schedule.Next(at(tc.from)), at(tc.want); !got.Equal(want) {
+			t.Errorf("%s after %s = %s, want %s", tc.spec, tc.from, got.Format("2006-01-02 15:04"), tc.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "1,,2 * * * *", "0 0 * foo *"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+	schedule, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schedule.Validate() == nil || !schedule.Next(time.Now()).IsZero() {
+		t.Fatalf("30 February must never match")
+	}
+}
@@ -0,0 +1,149 @@
+package router
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"nokia_modem/internal/config"
+)
+
+// responseCache sits in front of the read-only router calls. Responses are
+// reused for a per-endpoint TTL and concurrent identical requests share one
+// round trip, since the FastMile web server copes badly with bursts.
+type responseCache struct {
+	ttls map[string]time.Duration
+
+	mu       sync.Mutex
+	entries  map[string]cacheEntry
+	inflight map[string]*cacheCall
+	// gen is bumped by invalidate so responses fetched before a write are
+	// not stored afterwards.
+	gen uint64
+}
+
+type cacheEntry struct {
+	data    map[string]interface{}
+	expires time.Time
+}
+
+type cacheCall struct {
+	done chan struct{}
+	data map[string]interface{}
+	err  error
+}
+
+func newResponseCache(cfg config.RouterCacheConfig) *responseCache {
+	ttls := map[string]time.Duration{}
+	if cfg.Enabled {
+		for key, ms := range config.Defaults().RouterCache.TTLMs {
+			if v, ok := cfg.TTLMs[key]; ok {
+				ms = v
+			}
+			ttls[key] = time.Duration(ms) * time.Millisecond
+		}
+	}
+	return &responseCache{
+		ttls:     ttls,
+		entries:  map[string]cacheEntry{},
+		inflight: map[string]*cacheCall{},
+	}
+}
+
+type freshKey struct{}
+
+// WithFresh marks ctx so cached responses are skipped and the router is
+// asked again. Concurrent requests are still coalesced.
+func WithFresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshKey{}, true)
+}
+
+func isFresh(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshKey{}).(bool)
+	return fresh
+}
+
+// get returns the cached response for key or calls fetch, sharing the
+// result with every caller that asks for key while it runs. Callers always
+// get their own copy of the response.
+func (rc *responseCache) get(ctx context.Context, key string, fetch func(context.Context) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	now := time.Now()
+
+	rc.mu.Lock()
+	if entry, ok := rc.entries[key]; ok && !isFresh(ctx) && now.Before(entry.expires) {
+		rc.mu.Unlock()
+		return cloneMap(entry.data), nil
+	}
+	call, running := rc.inflight[key]
+	if !running {
+		call = &cacheCall{done: make(chan struct{})}
+		rc.inflight[key] = call
+		gen := rc.gen
+		// The shared request must not fail for everyone when the caller that
+		// started it goes away; the HTTP client timeout still bounds it.
+		go rc.run(context.WithoutCancel(ctx), key, gen, call, fetch)
+	}
+	rc.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-call.done:
+	}
+	if call.err != nil {
+		return nil, call.err
+	}
+	return cloneMap(call.data), nil
+}
+
+func (rc *responseCache) run(ctx context.Context, key string, gen uint64, call *cacheCall, fetch func(context.Context) (map[string]interface{}, error)) {
+	call.data, call.err = fetch(ctx)
+
+	rc.mu.Lock()
+	if rc.inflight[key] == call {
+		delete(rc.inflight, key)
+	}
+	if ttl := rc.ttls[key]; call.err == nil && ttl > 0 && gen == rc.gen {
+		rc.entries[key] = cacheEntry{data: call.data, expires: time.Now().Add(ttl)}
+	}
+	rc.mu.Unlock()
+	close(call.done)
+}
+
+// invalidate drops every cached response. Writes call it because they can
+// change what any read returns.
+func (rc *responseCache) invalidate() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.gen++
+	clear(rc.entries)
+	// Requests already on the wire may predate the write; later callers
+	// start their own.
+	clear(rc.inflight)
+}
+
+func cloneMap(in map[string]interface{}) map[string]interface{} {
+	if in == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(in))
+	for k, v := range in {
+		out[k] = cloneValue(v)
+	}
+	return out
+}
+
+func cloneValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return cloneMap(val)
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = cloneValue(item)
+		}
+		return out
+	default:
+		return val
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -35,6 +36,21 @@ type Client struct {
 
 	mu          sync.Mutex
 	cachedLogin *LoginSession
+
+	observerMu sync.RWMutex
+	observer   func(RequestStats)
+
+	cache *responseCache
+}
+
+// RequestStats describes one HTTP exchange with the router. Endpoint is the
+// CGI path without its query string; StatusCode is 0 when no response
+// arrived.
+type RequestStats struct {
+	Endpoint   string
+	StatusCode int
+	Duration   time.Duration
+	Err        error
 }
 
 func NewClient(cfg config.Config) *Client {
@@ -45,9 +61,36 @@ func NewClient(cfg config.Config) *Client {
 		httpClient: &http.Client{
 			Timeout: 15 * time.Second,
 		},
+		cache: newResponseCache(cfg.RouterCache),
+	}
+}
+
+// SetObserver registers fn to be called after every router request, e.g. to
+// feed latency and error metrics. Pass nil to remove it.
+func (c *Client) SetObserver(fn func(RequestStats)) {
+	c.observerMu.Lock()
+	defer c.observerMu.Unlock()
+	c.observer = fn
+}
+
+func (c *Client) observe(req *http.Request, started time.Time, statusCode int, err error) {
+	c.observerMu.RLock()
+	fn := c.observer
+	c.observerMu.RUnlock()
+	if fn == nil {
+		return
 	}
+	fn(RequestStats{
+		Endpoint:   strings.TrimPrefix(req.URL.Path, "/"),
+		StatusCode: statusCode,
+		Duration:   time.Since(started),
+		Err:        err,
+	})
 }
 
+// GetLogin returns the cached router session, logging in when none exists or
+// when force is set. A nil session with a non-nil response means the router
+// rejected the credentials; the response is returned for inspection.
 func (c *Client) GetLogin(ctx context.Context, force bool) (*LoginSession, map[string]interface{}, error) {
 	if ctx == nil {
 		ctx = context.Background()
@@ -59,7 +102,70 @@ func (c *Client) GetLogin(ctx context.Context, force bool) (*LoginSession, map[s
 	if !force && c.cachedLogin != nil && c.cachedLogin.SID != "" {
 		return c.cachedLogin, nil, nil
 	}
+	return c.loginLocked(ctx)
+}
+
+// session returns the cached session or logs in, turning a rejected login
+// into a *LoginError.
+func (c *Client) session(ctx context.Context) (*LoginSession, error) {
+	session, loginResp, err := c.GetLogin(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, &LoginError{Response: loginResp}
+	}
+	return session, nil
+}
 
+// relogin replaces a session the router no longer accepts. Callers holding
+// the same stale session are serialised on the client mutex; only the first
+// one performs the login and the rest pick up its result.
+func (c *Client) relogin(ctx context.Context, stale *LoginSession) (*LoginSession, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cachedLogin != nil && c.cachedLogin != stale && c.cachedLogin.SID != "" {
+		return c.cachedLogin, nil
+	}
+	c.cachedLogin = nil
+
+	session, loginResp, err := c.loginLocked(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, &LoginError{Response: loginResp}
+	}
+	return session, nil
+}
+
+// withSession runs fn with a valid session. When the router reports the
+// session as expired or invalid it re-authenticates once and retries; any
+// other failure (timeouts, HTTP 5xx, decode errors) is returned as is.
+func (c *Client) withSession(ctx context.Context, fn func(*LoginSession) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	session, err := c.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := fn(session)
+	if err == nil || !errors.Is(err, ErrSessionExpired) {
+		return result, err
+	}
+
+	session, err = c.relogin(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	return fn(session)
+}
+
+func (c *Client) loginLocked(ctx context.Context) (*LoginSession, map[string]interface{}, error) {
 	pre, _ := c.GetPreloginStatus(ctx)
 	preToken := getString(pre, "token")
 
@@ -165,160 +271,137 @@ func (c *Client) login(ctx context.Context, username, password string, nonceResp
 }
 
 func (c *Client) GetPreloginStatus(ctx context.Context) (map[string]interface{}, error) {
-	return c.get(ctx, "prelogin_status_web_app.cgi", nil)
+	return c.cache.get(ctx, "prelogin_status", func(ctx context.Context) (map[string]interface{}, error) {
+		return c.get(ctx, "prelogin_status_web_app.cgi", nil)
+	})
 }
 
-func (c *Client) GetOverviewData(ctx context.Context, session *LoginSession) (map[string]interface{}, error) {
-	return c.getAuthenticated(ctx, "overview_get_web_app.cgi", session, nil)
+func (c *Client) GetOverviewData(ctx context.Context) (map[string]interface{}, error) {
+	return c.cache.get(ctx, "overview", func(ctx context.Context) (map[string]interface{}, error) {
+		return c.getAuthenticated(ctx, "overview_get_web_app.cgi", nil)
+	})
 }
 
-func (c *Client) GetWanStatus(ctx context.Context, session *LoginSession) (map[string]interface{}, error) {
-	return c.getAuthenticated(ctx, "show_wan_status_web_app.cgi", session, nil)
+func (c *Client) GetWanStatus(ctx context.Context) (map[string]interface{}, error) {
+	return c.cache.get(ctx, "wan_status", func(ctx context.Context) (map[string]interface{}, error) {
+		return c.getAuthenticated(ctx, "show_wan_status_web_app.cgi", nil)
+	})
 }
 
-func (c *Client) GetDeviceStatus(ctx context.Context, session *LoginSession) (map[string]interface{}, error) {
-	return c.getAuthenticated(ctx, "device_status_web_app.cgi?getroot", session, nil)
+func (c *Client) GetDeviceStatus(ctx context.Context) (map[string]interface{}, error) {
+	return c.cache.get(ctx, "device_status", func(ctx context.Context) (map[string]interface{}, error) {
+		return c.getAuthenticated(ctx, "device_status_web_app.cgi?getroot", nil)
+	})
 }
 
-func (c *Client) GetNetworkClientStatus(ctx context.Context, session *LoginSession) (map[string]interface{}, error) {
-	return c.getAuthenticated(ctx, "device_home_nw_client_status_web_app.cgi", session, nil)
+func (c *Client) GetNetworkClientStatus(ctx context.Context) (map[string]interface{}, error) {
+	return c.cache.get(ctx, "network_clients", func(ctx context.Context) (map[string]interface{}, error) {
+		return c.getAuthenticated(ctx, "device_home_nw_client_status_web_app.cgi", nil)
+	})
 }
 
-func (c *Client) PostServiceData(ctx context.Context, session *LoginSession) (map[string]interface{}, error) {
-	payload := map[string]interface{}{
-		"version":    1,
-		"csrf_token": session.Token,
-		"id":         1,
-		"interface":  "Nokia.GenericService",
-		"service":    "OAM",
-		"function":   "GetCAState",
-		"paralist":   []interface{}{},
-	}
-	return c.postAuthenticatedJSON(ctx, "service_function_web_app.cgi", session, payload)
+func (c *Client) PostServiceData(ctx context.Context) (map[string]interface{}, error) {
+	return c.cache.get(ctx, "service_data", func(ctx context.Context) (map[string]interface{}, error) {
+		return c.callService(ctx, "GetCAState", []interface{}{})
+	})
 }
 
-func (c *Client) GetStatusWeb(ctx context.Context, session *LoginSession) (map[string]interface{}, error) {
-	return c.getAuthenticated(ctx, "status_get_web_app.cgi", session, nil)
+func (c *Client) GetStatusWeb(ctx context.Context) (map[string]interface{}, error) {
+	return c.cache.get(ctx, "status_web", func(ctx context.Context) (map[string]interface{}, error) {
+		return c.getAuthenticated(ctx, "status_get_web_app.cgi", nil)
+	})
 }
 
-func (c *Client) GetWlan24Configs(ctx context.Context, session *LoginSession) (map[string]interface{}, error) {
-	return c.getAuthenticated(ctx, "wlan_config_status_web_app.cgi", session, nil)
+func (c *Client) GetWlan24Configs(ctx context.Context) (map[string]interface{}, error) {
+	return c.cache.get(ctx, "wlan_24g", func(ctx context.Context) (map[string]interface{}, error) {
+		return c.getAuthenticated(ctx, "wlan_config_status_web_app.cgi", nil)
+	})
 }
 
-func (c *Client) GetWlan5Configs(ctx context.Context, session *LoginSession) (map[string]interface{}, error) {
-	return c.getAuthenticated(ctx, "wlan_config_status_web_app.cgi?v=11ac", session, nil)
+func (c *Client) GetWlan5Configs(ctx context.Context) (map[string]interface{}, error) {
+	return c.cache.get(ctx, "wlan_5g", func(ctx context.Context) (map[string]interface{}, error) {
+		return c.getAuthenticated(ctx, "wlan_config_status_web_app.cgi?v=11ac", nil)
+	})
 }
 
-func (c *Client) GetLedState(ctx context.Context, session *LoginSession) (map[string]interface{}, error) {
-	return c.getAuthenticated(ctx, "ledctrl_status_web_app.cgi", session, nil)
+func (c *Client) GetLedState(ctx context.Context) (map[string]interface{}, error) {
+	return c.cache.get(ctx, "led_state", func(ctx context.Context) (map[string]interface{}, error) {
+		return c.getAuthenticated(ctx, "ledctrl_status_web_app.cgi", nil)
+	})
 }
 
-func (c *Client) GetSimInfo(ctx context.Context, session *LoginSession) (map[string]interface{}, error) {
-	return c.getAuthenticated(ctx, "fastmile_statistics_status_web_app.cgi", session, nil)
+func (c *Client) GetSimInfo(ctx context.Context) (map[string]interface{}, error) {
+	return c.cache.get(ctx, "sim_info", func(ctx context.Context) (map[string]interface{}, error) {
+		return c.getAuthenticated(ctx, "fastmile_statistics_status_web_app.cgi", nil)
+	})
 }
 
-func (c *Client) LedState(ctx context.Context, session *LoginSession, enable bool) (map[string]interface{}, error) {
+func (c *Client) LedState(ctx context.Context, enable bool) (map[string]interface{}, error) {
 	state := "off"
 	if enable {
 		state = "on"
 	}
 	plaintext := "EnableGbl=" + state + "&EnableSigGbl=" + state + "&csrf_token="
-	return c.PostCSRFEncrypted(ctx, "ledctrl_web_app.cgi?SetLedGlb", session, plaintext)
-}
-
-func (c *Client) PostSetAPN(ctx context.Context, session *LoginSession, newAPN string) (map[string]interface{}, error) {
-	payload := map[string]interface{}{
-		"version":    1,
-		"csrf_token": session.Token,
-		"id":         1,
-		"interface":  "Nokia.GenericService",
-		"service":    "OAM",
-		"function":   "ModifyAPN",
-		"paralist": []interface{}{
-			map[string]interface{}{
-				"WorkMode":           "RouteMode",
-				"AccessPointName":    newAPN,
-				"Services":           "TR069,INTERNET",
-				"VOIP":               nil,
-				"INTERNET":           true,
-				"IPTV":               nil,
-				"UserName":           "",
-				"Password":           "",
-				"confirmPwd":         nil,
-				"AuthenticationMode": "None",
-				"IPv4":               true,
-				"IPv6":               true,
-				"IPv4NetMask":        "",
-				"MTUSize":            1500,
-				"APNInstanceID":      1,
-				"ipMode":             3,
-				"mtuMode":            "Manual",
-				"EthernetInterface":  "",
-				"VLANID":             0,
-			},
+	return c.PostCSRFEncrypted(ctx, "ledctrl_web_app.cgi?SetLedGlb", plaintext)
+}
+
+func (c *Client) PostSetAPN(ctx context.Context, newAPN string) (map[string]interface{}, error) {
+	defer c.cache.invalidate()
+	return c.callService(ctx, "ModifyAPN", []interface{}{
+		map[string]interface{}{
+			"WorkMode":           "RouteMode",
+			"AccessPointName":    newAPN,
+			"Services":           "TR069,INTERNET",
+			"VOIP":               nil,
+			"INTERNET":           true,
+			"IPTV":               nil,
+			"UserName":           "",
+			"Password":           "",
+			"confirmPwd":         nil,
+			"AuthenticationMode": "None",
+			"IPv4":               true,
+			"IPv6":               true,
+			"IPv4NetMask":        "",
+			"MTUSize":            1500,
+			"APNInstanceID":      1,
+			"ipMode":             3,
+			"mtuMode":            "Manual",
+			"EthernetInterface":  "",
+			"VLANID":             0,
 		},
-	}
-	return c.postAuthenticatedJSON(ctx, "service_function_web_app.cgi", session, payload)
+	})
 }
 
-func (c *Client) Reboot(ctx context.Context, session *LoginSession) (map[string]interface{}, error) {
-	payload := map[string]interface{}{
-		"version":    1,
-		"csrf_token": session.Token,
-		"id":         1,
-		"interface":  "Nokia.GenericService",
-		"service":    "OAM",
-		"function":   "Reboot",
-		"paralist":   []interface{}{},
-	}
-	return c.postAuthenticatedJSON(ctx, "service_function_web_app.cgi", session, payload)
+func (c *Client) Reboot(ctx context.Context) (map[string]interface{}, error) {
+	defer c.cache.invalidate()
+	return c.callService(ctx, "Reboot", []interface{}{})
 }
 
-func (c *Client) GetLanStatusWeb(ctx context.Context, session *LoginSession) (map[string]interface{}, error) {
-	return c.getAuthenticated(ctx, "lan_status_web_app.cgi?wlan=", session, nil)
+func (c *Client) GetLanStatusWeb(ctx context.Context) (map[string]interface{}, error) {
+	return c.cache.get(ctx, "lan_status", func(ctx context.Context) (map[string]interface{}, error) {
+		return c.getAuthenticated(ctx, "lan_status_web_app.cgi?wlan=", nil)
+	})
 }
 
-func (c *Client) GetSmsList(ctx context.Context, session *LoginSession) (map[string]interface{}, error) {
-	payload := map[string]interface{}{
-		"version":    1,
-		"csrf_token": session.Token,
-		"id":         1,
-		"interface":  "Nokia.GenericService",
-		"service":    "OAM",
-		"function":   "GetSMSList",
-		"paralist":   []interface{}{},
-	}
-	return c.postAuthenticatedJSON(ctx, "service_function_web_app.cgi", session, payload)
+func (c *Client) GetSmsList(ctx context.Context) (map[string]interface{}, error) {
+	return c.cache.get(ctx, "sms_list", func(ctx context.Context) (map[string]interface{}, error) {
+		return c.callService(ctx, "GetSMSList", []interface{}{})
+	})
 }
 
-func (c *Client) PostCellularIdentification(ctx context.Context, session *LoginSession) (map[string]interface{}, error) {
-	payload := map[string]interface{}{
-		"version":    1,
-		"csrf_token": session.Token,
-		"id":         1,
-		"interface":  "Nokia.GenericService",
-		"service":    "OAM",
-		"function":   "GetCellularNetworkIdentification",
-		"paralist":   []interface{}{},
-	}
-	return c.postAuthenticatedJSON(ctx, "service_function_web_app.cgi", session, payload)
+func (c *Client) PostCellularIdentification(ctx context.Context) (map[string]interface{}, error) {
+	return c.cache.get(ctx, "cell_identification", func(ctx context.Context) (map[string]interface{}, error) {
+		return c.callService(ctx, "GetCellularNetworkIdentification", []interface{}{})
+	})
 }
 
-func (c *Client) SetSmsState(ctx context.Context, session *LoginSession, smsID, smsUnread string) (map[string]interface{}, error) {
+func (c *Client) SetSmsState(ctx context.Context, smsID, smsUnread string) (map[string]interface{}, error) {
+	defer c.cache.invalidate()
 	shouldUnread := parseBoolString(smsUnread, true)
-	payload := map[string]interface{}{
-		"version":    1,
-		"csrf_token": session.Token,
-		"id":         1,
-		"interface":  "Nokia.GenericService",
-		"service":    "OAM",
-		"function":   "SetSMSState",
-		"paralist": []interface{}{
-			map[string]interface{}{"SMSID": smsID},
-			map[string]interface{}{"SMSUnread": shouldUnread},
-		},
-	}
-	return c.postAuthenticatedJSON(ctx, "service_function_web_app.cgi", session, payload)
+	return c.callService(ctx, "SetSMSState", []interface{}{
+		map[string]interface{}{"SMSID": smsID},
+		map[string]interface{}{"SMSUnread": shouldUnread},
+	})
 }
 
 func parseBoolString(value string, defaultValue bool) bool {
@@ -339,26 +422,18 @@ func parseBoolString(value string, defaultValue bool) bool {
 	}
 }
 
-func (c *Client) DeleteSms(ctx context.Context, session *LoginSession, smsIDs []string, deleteAll bool) (map[string]interface{}, error) {
+func (c *Client) DeleteSms(ctx context.Context, smsIDs []string, deleteAll bool) (map[string]interface{}, error) {
+	defer c.cache.invalidate()
 	if deleteAll {
 		smsIDs = []string{}
 	} else if len(smsIDs) == 0 {
 		return nil, fmt.Errorf("no SMS IDs provided")
 	}
-	payload := map[string]interface{}{
-		"version":    1,
-		"csrf_token": session.Token,
-		"id":         1,
-		"interface":  "Nokia.GenericService",
-		"service":    "OAM",
-		"function":   "DeleteSMS",
-		"paralist": []interface{}{
-			map[string]interface{}{
-				"SMSList": smsIDs,
-			},
+	return c.callService(ctx, "DeleteSMS", []interface{}{
+		map[string]interface{}{
+			"SMSList": smsIDs,
 		},
-	}
-	return c.postAuthenticatedJSON(ctx, "service_function_web_app.cgi", session, payload)
+	})
 }
 
 func (c *Client) get(ctx context.Context, endpoint string, headers map[string]string) (map[string]interface{}, error) {
@@ -400,12 +475,29 @@ func (c *Client) postJSON(ctx context.Context, endpoint string, payload interfac
 	return c.doRequest(req)
 }
 
-func (c *Client) getAuthenticated(ctx context.Context, endpoint string, session *LoginSession, headers map[string]string) (map[string]interface{}, error) {
-	if headers == nil {
-		headers = map[string]string{}
-	}
-	headers["Cookie"] = "sid=" + session.SID
-	return c.get(ctx, endpoint, headers)
+func (c *Client) getAuthenticated(ctx context.Context, endpoint string, headers map[string]string) (map[string]interface{}, error) {
+	return c.withSession(ctx, func(session *LoginSession) (map[string]interface{}, error) {
+		merged := cloneHeaders(headers)
+		merged["Cookie"] = "sid=" + session.SID
+		return checkSession(c.get(ctx, endpoint, merged))
+	})
+}
+
+// callService invokes a Nokia.GenericService OAM function, filling in the
+// CSRF token of whichever session ends up being used.
+func (c *Client) callService(ctx context.Context, function string, paralist []interface{}) (map[string]interface{}, error) {
+	return c.withSession(ctx, func(session *LoginSession) (map[string]interface{}, error) {
+		payload := map[string]interface{}{
+			"version":    1,
+			"csrf_token": session.Token,
+			"id":         1,
+			"interface":  "Nokia.GenericService",
+			"service":    "OAM",
+			"function":   function,
+			"paralist":   paralist,
+		}
+		return c.postAuthenticatedJSON(ctx, "service_function_web_app.cgi", session, payload, nil)
+	})
 }
 
 // DebugGet issues a raw GET request against the router without authentication handling.
@@ -415,50 +507,70 @@ func (c *Client) DebugGet(ctx context.Context, endpoint string, headers map[stri
 
 // DebugPostForm sends an x-www-form-urlencoded POST without authentication.
 func (c *Client) DebugPostForm(ctx context.Context, endpoint string, form url.Values, headers map[string]string) (map[string]interface{}, error) {
+	defer c.cache.invalidate()
 	return c.postForm(ctx, endpoint, form, headers)
 }
 
 // DebugPostJSON performs a JSON POST without authentication.
 func (c *Client) DebugPostJSON(ctx context.Context, endpoint string, payload interface{}, headers map[string]string) (map[string]interface{}, error) {
+	defer c.cache.invalidate()
 	return c.postJSON(ctx, endpoint, payload, headers)
 }
 
 // DebugGetAuthenticated allows manual debugging against custom endpoints.
-func (c *Client) DebugGetAuthenticated(ctx context.Context, endpoint string, session *LoginSession, headers map[string]string) (map[string]interface{}, error) {
-	return c.getAuthenticated(ctx, endpoint, session, headers)
+func (c *Client) DebugGetAuthenticated(ctx context.Context, endpoint string, headers map[string]string) (map[string]interface{}, error) {
+	return c.getAuthenticated(ctx, endpoint, headers)
 }
 
 // DebugPostAuthenticatedJSON performs a JSON POST including the session cookie.
-func (c *Client) DebugPostAuthenticatedJSON(ctx context.Context, endpoint string, session *LoginSession, payload interface{}, headers map[string]string) (map[string]interface{}, error) {
-	if headers == nil {
-		headers = map[string]string{}
-	}
-	headers["Cookie"] = "sid=" + session.SID
-	return c.postJSON(ctx, endpoint, payload, headers)
+func (c *Client) DebugPostAuthenticatedJSON(ctx context.Context, endpoint string, payload interface{}, headers map[string]string) (map[string]interface{}, error) {
+	defer c.cache.invalidate()
+	return c.withSession(ctx, func(session *LoginSession) (map[string]interface{}, error) {
+		return c.postAuthenticatedJSON(ctx, endpoint, session, payload, headers)
+	})
+}
+
+func (c *Client) postAuthenticatedJSON(ctx context.Context, endpoint string, session *LoginSession, payload interface{}, headers map[string]string) (map[string]interface{}, error) {
+	merged := cloneHeaders(headers)
+	merged["Cookie"] = "sid=" + session.SID
+	return checkSession(c.postJSON(ctx, endpoint, payload, merged))
 }
 
-func (c *Client) postAuthenticatedJSON(ctx context.Context, endpoint string, session *LoginSession, payload interface{}) (map[string]interface{}, error) {
-	headers := map[string]string{
-		"Cookie": "sid=" + session.SID,
+func cloneHeaders(in map[string]string) map[string]string {
+	out := make(map[string]string, len(in)+1)
+	for k, v := range in {
+		out[k] = v
 	}
-	return c.postJSON(ctx, endpoint, payload, headers)
+	return out
 }
 
 func (c *Client) doRequest(req *http.Request) (map[string]interface{}, error) {
+	started := time.Now()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		c.observe(req, started, 0, err)
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		return nil, fmt.Errorf("request failed: %s (%s)", resp.Status, string(body))
+		statusErr := &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(body)}
+		c.observe(req, started, resp.StatusCode, statusErr)
+		return nil, statusErr
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	c.observe(req, started, resp.StatusCode, err)
+	if err != nil {
+		return nil, err
 	}
 
 	var data map[string]interface{}
-	decoder := json.NewDecoder(resp.Body)
-	if err := decoder.Decode(&data); err != nil {
+	if err := json.Unmarshal(body, &data); err != nil {
+		if looksLikeHTML(body) {
+			return nil, errHTMLResponse
+		}
 		return nil, err
 	}
 	return data, nil
@@ -566,6 +678,7 @@ func getInt(v interface{}) int {
 
 func (c *Client) ClearCache() {
 	c.mu.Lock()
-	defer c.mu.Unlock()
 	c.cachedLogin = nil
+	c.mu.Unlock()
+	c.cache.invalidate()
 }
@@ -0,0 +1,326 @@
+package router_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nokia_modem/internal/config"
+	"nokia_modem/internal/router"
+	"nokia_modem/internal/router/routertest"
+)
+
+func newEmulatedClient(t *testing.T, opts routertest.Options) (*router.Client, *routertest.Router) {
+	t.Helper()
+	emu := routertest.New(opts)
+	t.Cleanup(emu.Close)
+
+	cfg := config.Defaults()
+	cfg.RouterHost = emu.Host()
+	if opts.Password != "" {
+		cfg.RouterPassword = opts.Password
+	}
+	return router.NewClient(cfg), emu
+}
+
+func TestGetLoginAgainstEmulator(t *testing.T) {
+	client, _ := newEmulatedClient(t, routertest.Options{})
+	ctx := context.Background()
+
+	session, loginResp, err := client.GetLogin(ctx, false)
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if session == nil || session.SID == "" || session.Token == "" {
+		t.Fatalf("expected session, got %+v (resp %v)", session, loginResp)
+	}
+
+	cached, _, err := client.GetLogin(ctx, false)
+	if err != nil || cached != session {
+		t.Fatalf("expected cached session to be reused")
+	}
+}
+
+func TestGetLoginRejectsWrongPassword(t *testing.T) {
+	emu := routertest.New(routertest.Options{Password: "correct"})
+	defer emu.Close()
+
+	cfg := config.Defaults()
+	cfg.RouterHost = emu.Host()
+	cfg.RouterPassword = "wrong"
+	client := router.NewClient(cfg)
+
+	session, loginResp, err := client.GetLogin(context.Background(), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if session != nil {
+		t.Fatalf("expected no session for wrong password")
+	}
+	if loginResp == nil {
+		t.Fatalf("expected login response to be returned")
+	}
+
+	_, err = client.GetStatusWeb(context.Background())
+	var loginErr *router.LoginError
+	if !errors.As(err, &loginErr) || loginErr.Response == nil {
+		t.Fatalf("expected *router.LoginError, got %v", err)
+	}
+}
+
+func TestEncryptedLedControlRoundTrip(t *testing.T) {
+	client, emu := newEmulatedClient(t, routertest.Options{})
+	ctx := context.Background()
+
+	if _, err := client.LedState(ctx, false); err != nil {
+		t.Fatalf("led off failed: %v", err)
+	}
+	if emu.LedEnabled() {
+		t.Fatalf("expected emulator LEDs to be off")
+	}
+
+	status, err := client.LedStatus(ctx)
+	if err != nil {
+		t.Fatalf("led status failed: %v", err)
+	}
+	if status.Enabled() {
+		t.Fatalf("expected typed LED status to be off")
+	}
+}
+
+func TestSmsLifecycle(t *testing.T) {
+	client, emu := newEmulatedClient(t, routertest.Options{})
+	ctx := context.Background()
+
+	first := emu.AddSms("+620001", "hello", time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+	emu.AddSms("BANK", "code 1234", time.Date(2025, 1, 2, 4, 0, 0, 0, time.UTC))
+
+	list, err := client.SmsList(ctx)
+	if err != nil {
+		t.Fatalf("sms list failed: %v", err)
+	}
+	if len(list.Messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(list.Messages))
+	}
+
+	if _, err := client.SetSmsState(ctx, first, "0"); err != nil {
+		t.Fatalf("set state failed: %v", err)
+	}
+	if emu.Sms()[0].Unread {
+		t.Fatalf("expected first message to be marked read")
+	}
+
+	if _, err := client.DeleteSms(ctx, []string{first}, false); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if remaining := emu.Sms(); len(remaining) != 1 || remaining[0].Sender != "BANK" {
+		t.Fatalf("unexpected inbox after delete: %+v", remaining)
+	}
+}
+
+func TestSendSmsSendsEverySegment(t *testing.T) {
+	client, emu := newEmulatedClient(t, routertest.Options{})
+	ctx := context.Background()
+
+	text := strings.Repeat("x", 200)
+	result, err := client.SendSms(ctx, "+62 812-3456", text)
+	if err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if result.To != "+628123456" || result.Segments != 2 || result.Encoding != router.SmsEncodingGSM7 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	sent := emu.SentSms()
+	if len(sent) != 2 || sent[0].To != "+628123456" || sent[0].Content+sent[1].Content != text {
+		t.Fatalf("unexpected sent messages %+v", sent)
+	}
+
+	for _, to := range []string{"", "12", "call me"} {
+		if _, err := client.SendSms(ctx, to, "hi"); !errors.Is(err, router.ErrInvalidSms) {
+			t.Fatalf("recipient %q: expected ErrInvalidSms, got %v", to, err)
+		}
+	}
+	if _, err := client.SendSms(ctx, "+628123456", strings.Repeat("x", 153*router.MaxSmsSegments+1)); !errors.Is(err, router.ErrInvalidSms) {
+		t.Fatalf("expected overly long text to be rejected, got %v", err)
+	}
+	if len(emu.SentSms()) != 2 {
+		t.Fatalf("rejected messages must not reach the router")
+	}
+}
+
+func TestServiceActions(t *testing.T) {
+	client, emu := newEmulatedClient(t, routertest.Options{})
+	ctx := context.Background()
+
+	if _, err := client.PostSetAPN(ctx, "xlunlimited"); err != nil {
+		t.Fatalf("set apn failed: %v", err)
+	}
+	if emu.APN() != "xlunlimited" {
+		t.Fatalf("expected APN to change, got %q", emu.APN())
+	}
+
+	if _, err := client.Reboot(ctx); err != nil {
+		t.Fatalf("reboot failed: %v", err)
+	}
+	if emu.Reboots() != 1 {
+		t.Fatalf("expected one reboot, got %d", emu.Reboots())
+	}
+
+	ca, err := client.CAState(ctx)
+	if err != nil {
+		t.Fatalf("ca state failed: %v", err)
+	}
+	if len(ca.Downlink()) != 1 {
+		t.Fatalf("expected one downlink carrier, got %d", len(ca.Downlink()))
+	}
+}
+
+func TestSessionExpiryTriggersSingleRelogin(t *testing.T) {
+	client, emu := newEmulatedClient(t, routertest.Options{})
+	ctx := context.Background()
+
+	if _, err := client.GetStatusWeb(ctx); err != nil {
+		t.Fatalf("initial status failed: %v", err)
+	}
+	before := emu.Calls("login_web_app.cgi")
+	emu.ExpireSessions()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.GetStatusWeb(router.WithFresh(ctx)); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("call after expiry failed: %v", err)
+	}
+
+	// One login is the nonce, salt and login requests.
+	if got := emu.Calls("login_web_app.cgi") - before; got != 3 {
+		t.Fatalf("expected exactly one re-login (3 requests), got %d requests", got)
+	}
+}
+
+func TestServerErrorDoesNotRelogin(t *testing.T) {
+	client, emu := newEmulatedClient(t, routertest.Options{})
+	ctx := context.Background()
+
+	if _, err := client.GetStatusWeb(ctx); err != nil {
+		t.Fatalf("initial status failed: %v", err)
+	}
+	before := emu.Calls("login_web_app.cgi")
+	emu.FailNext("status_get_web_app.cgi", 1)
+
+	_, err := client.GetStatusWeb(router.WithFresh(ctx))
+	var statusErr *router.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 500 {
+		t.Fatalf("expected HTTP 500 error, got %v", err)
+	}
+	if errors.Is(err, router.ErrSessionExpired) {
+		t.Fatalf("HTTP 500 must not be reported as session expiry")
+	}
+	if got := emu.Calls("login_web_app.cgi") - before; got != 0 {
+		t.Fatalf("expected no re-login, got %d login requests", got)
+	}
+}
+
+func TestEncryptedPostReloginsAfterExpiry(t *testing.T) {
+	client, emu := newEmulatedClient(t, routertest.Options{})
+	ctx := context.Background()
+
+	if _, err := client.LedState(ctx, true); err != nil {
+		t.Fatalf("led on failed: %v", err)
+	}
+	emu.ExpireSessions()
+
+	if _, err := client.LedState(ctx, false); err != nil {
+		t.Fatalf("led off after expiry failed: %v", err)
+	}
+	if emu.LedEnabled() {
+		t.Fatalf("expected emulator LEDs to be off")
+	}
+}
+
+func TestResponseCacheCoalescesAndExpires(t *testing.T) {
+	client, emu := newEmulatedClient(t, routertest.Options{})
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.GetStatusWeb(ctx); err != nil {
+				t.Errorf("status: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls := emu.Calls("status_get_web_app.cgi"); calls != 1 {
+		t.Fatalf("expected concurrent calls to share one request, got %d", calls)
+	}
+
+	first, _ := client.GetStatusWeb(ctx)
+	first["mutated"] = true
+	second, _ := client.GetStatusWeb(ctx)
+	if _, leaked := second["mutated"]; leaked {
+		t.Fatalf("callers must get their own copy of a cached response")
+	}
+	if calls := emu.Calls("status_get_web_app.cgi"); calls != 1 {
+		t.Fatalf("expected cached response within the TTL, got %d requests", calls)
+	}
+
+	if _, err := client.GetStatusWeb(router.WithFresh(ctx)); err != nil {
+		t.Fatalf("fresh status: %v", err)
+	}
+	if calls := emu.Calls("status_get_web_app.cgi"); calls != 2 {
+		t.Fatalf("expected WithFresh to bypass the cache, got %d requests", calls)
+	}
+}
+
+func TestResponseCacheInvalidatedByWrites(t *testing.T) {
+	client, emu := newEmulatedClient(t, routertest.Options{})
+	ctx := context.Background()
+
+	emu.AddSms("+620001", "hello", time.Now())
+	list, err := client.SmsList(ctx)
+	if err != nil || len(list.Messages) != 1 {
+		t.Fatalf("unexpected sms list: %+v (%v)", list, err)
+	}
+	if _, err := client.DeleteSms(ctx, nil, true); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	list, err = client.SmsList(ctx)
+	if err != nil || len(list.Messages) != 0 {
+		t.Fatalf("expected the delete to invalidate the cached list: %+v (%v)", list, err)
+	}
+}
+
+func TestResponseCacheDisabled(t *testing.T) {
+	emu := routertest.New(routertest.Options{})
+	defer emu.Close()
+
+	cfg := config.Defaults()
+	cfg.RouterHost = emu.Host()
+	cfg.RouterCache.Enabled = false
+	client := router.NewClient(cfg)
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.GetWanStatus(context.Background()); err != nil {
+			t.Fatalf("wan status: %v", err)
+		}
+	}
+	if calls := emu.Calls("show_wan_status_web_app.cgi"); calls != 3 {
+		t.Fatalf("expected every call to reach the router, got %d", calls)
+	}
+}
@@ -0,0 +1,92 @@
+package router
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const maxResponseBytes = 8 << 20
+
+// ErrSessionExpired is reported when the router no longer accepts the SID
+// of the cached session. Client methods handle it by logging in again once;
+// callers only see it when the fresh session is rejected as well.
+var ErrSessionExpired = errors.New("router session expired")
+
+// errHTMLResponse is returned when the router answers a JSON endpoint with an
+// HTML page. Authenticated endpoints do this when the SID is unknown: the
+// firmware serves its login page instead of the requested data.
+var errHTMLResponse = errors.New("router returned an HTML page instead of JSON")
+
+// StatusError is returned for non-2xx router responses.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("request failed: %s (%s)", e.Status, e.Body)
+}
+
+// LoginError is returned when the router rejects the configured credentials.
+// Response holds the router's login reply.
+type LoginError struct {
+	Response map[string]interface{}
+}
+
+func (e *LoginError) Error() string {
+	if msg := strings.TrimSpace(getString(e.Response, "message")); msg != "" {
+		return "router login rejected: " + msg
+	}
+	return "router login rejected"
+}
+
+// checkSession maps the router's ways of saying "this SID is no longer
+// valid" onto ErrSessionExpired: HTTP 401/403, the HTML login page, or a JSON
+// reply whose result/message/error text mentions an expired or invalid
+// session. Network errors and other failures pass through untouched so they
+// never trigger a re-login.
+func checkSession(data map[string]interface{}, err error) (map[string]interface{}, error) {
+	if err != nil {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) {
+			switch statusErr.StatusCode {
+			case http.StatusUnauthorized, http.StatusForbidden:
+				return nil, fmt.Errorf("%w: %v", ErrSessionExpired, err)
+			}
+		}
+		if errors.Is(err, errHTMLResponse) {
+			return nil, fmt.Errorf("%w: %v", ErrSessionExpired, err)
+		}
+		return nil, err
+	}
+	if payloadReportsExpiredSession(data) {
+		return nil, ErrSessionExpired
+	}
+	return data, nil
+}
+
+func payloadReportsExpiredSession(data map[string]interface{}) bool {
+	for _, key := range []string{"result", "message", "error", "errmsg"} {
+		text := strings.ToLower(getString(data, key))
+		if text == "" {
+			continue
+		}
+		if strings.Contains(text, "not login") || strings.Contains(text, "unauthorized") {
+			return true
+		}
+		if strings.Contains(text, "session") &&
+			(strings.Contains(text, "expire") || strings.Contains(text, "timeout") || strings.Contains(text, "invalid")) {
+			return true
+		}
+	}
+	return false
+}
+
+func looksLikeHTML(body []byte) bool {
+	trimmed := bytes.TrimSpace(body)
+	return len(trimmed) > 0 && trimmed[0] == '<'
+}
@@ -17,9 +17,23 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
+// PostCSRFEncrypted sends plaintext form data through the router's RSA/AES
+// envelope, filling in the CSRF token of the session that ends up being used.
 func (c *Client) PostCSRFEncrypted(
+	ctx context.Context,
+	endpoint string,
+	plaintext string,
+) (map[string]interface{}, error) {
+	defer c.cache.invalidate()
+	return c.withSession(ctx, func(session *LoginSession) (map[string]interface{}, error) {
+		return c.postCSRFEncrypted(ctx, endpoint, session, plaintext)
+	})
+}
+
+func (c *Client) postCSRFEncrypted(
 	ctx context.Context,
 	endpoint string,
 	session *LoginSession,
@@ -37,9 +51,6 @@ func (c *Client) PostCSRFEncrypted(
 		return nil, err
 	}
 
-	if ctx == nil {
-		ctx = context.Background()
-	}
 	req, err := http.NewRequestWithContext(
 		ctx,
 		http.MethodPost,
@@ -53,22 +64,34 @@ func (c *Client) PostCSRFEncrypted(
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("Cookie", "sid="+session.SID)
 
+	started := time.Now()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		c.observe(req, started, 0, err)
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	var observed error
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("http %d: %s", resp.StatusCode, string(respBody))
+		observed = fmt.Errorf("http %d", resp.StatusCode)
+	} else if err != nil {
+		observed = err
+	}
+	c.observe(req, started, resp.StatusCode, observed)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return checkSession(nil, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(respBody)})
 	}
 
 	var out map[string]interface{}
 	if err := json.Unmarshal(respBody, &out); err != nil {
+		if looksLikeHTML(respBody) {
+			return checkSession(nil, errHTMLResponse)
+		}
 		return map[string]interface{}{"raw": string(respBody)}, nil
 	}
-	return out, nil
+	return checkSession(out, nil)
 }
 
 func (c *Client) prepareEncryptedPayload(session *LoginSession, plaintext string) (string, error) {
@@ -0,0 +1,101 @@
+package routertest
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// decryptForm reverses the encrypted=1&ct=&ck= envelope: ck carries the
+// RSA-wrapped "base64(key) base64(iv)" pair and ct the AES-CBC ciphertext of
+// the original form body.
+func (r *Router) decryptForm(req *http.Request) (url.Values, error) {
+	body, err := io.ReadAll(io.LimitReader(req.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	envelope, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("parse envelope: %w", err)
+	}
+	if envelope.Get("encrypted") != "1" {
+		return nil, errors.New("payload not encrypted")
+	}
+
+	ckRaw, err := base64.StdEncoding.DecodeString(unescapeBase64URL(envelope.Get("ck")))
+	if err != nil {
+		return nil, fmt.Errorf("decode ck: %w", err)
+	}
+	keyPair, err := rsa.DecryptPKCS1v15(rand.Reader, r.key, ckRaw)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt ck: %w", err)
+	}
+	parts := strings.Fields(string(keyPair))
+	if len(parts) != 2 {
+		return nil, errors.New("malformed ck")
+	}
+	key, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("decode key: %w", err)
+	}
+	iv, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("decode iv: %w", err)
+	}
+
+	ct, err := base64.RawURLEncoding.DecodeString(envelope.Get("ct"))
+	if err != nil {
+		return nil, fmt.Errorf("decode ct: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ct) == 0 || len(ct)%aes.BlockSize != 0 || len(iv) != aes.BlockSize {
+		return nil, errors.New("invalid ciphertext length")
+	}
+	plain := make([]byte, len(ct))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, ct)
+
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > aes.BlockSize || pad > len(plain) {
+		return nil, errors.New("invalid padding")
+	}
+	return formValuesFromPlaintext(string(plain[:len(plain)-pad]))
+}
+
+func sha256Join(v1, v2 string) string {
+	h := sha256.Sum256([]byte(v1 + ":" + v2))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func sha256url(v1, v2 string) string {
+	s := sha256Join(v1, v2)
+	s = strings.ReplaceAll(s, "+", "-")
+	s = strings.ReplaceAll(s, "/", "_")
+	s = strings.ReplaceAll(s, "=", ".")
+	return s
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic("routertest: random: " + err.Error())
+	}
+	return hex.EncodeToString(buf)
+}
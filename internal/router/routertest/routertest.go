@@ -0,0 +1,599 @@
+// Package routertest provides an in-process emulator of the Nokia FastMile
+// web API for offline development and tests. It implements the nonce/salt
+// login handshake, the RSA+AES encrypted form format used by
+// router.Client.PostCSRFEncrypted and stateful responses for the
+// *_web_app.cgi endpoints the client talks to.
+package routertest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options configures a Router. Zero values fall back to the defaults used by
+// config.Defaults so a client built from the stock config can log in.
+type Options struct {
+	Username   string
+	Password   string
+	Iterations int
+}
+
+// Sms is a message held in the emulated inbox.
+type Sms struct {
+	ID       string
+	Sender   string
+	Content  string
+	DateTime time.Time
+	Unread   bool
+}
+
+// SentSms is one message accepted by SendSMS.
+type SentSms struct {
+	To      string
+	Content string
+	SentAt  time.Time
+}
+
+// Router is a running emulator. All exported methods are safe for
+// concurrent use with requests being served.
+type Router struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	pubPEM string
+
+	username   string
+	password   string
+	iterations int
+	salt       string
+
+	mu         sync.Mutex
+	nonces     map[string]struct{}
+	sessions   map[string]string
+	nextSmsID  int
+	sms        []Sms
+	sent       []SentSms
+	apn        string
+	ledEnabled bool
+	reboots    int
+	bytesSent  int64
+	bytesRecv  int64
+	externalIP string
+	calls      map[string]int
+	failures   map[string]int
+}
+
+// New starts an emulator listening on a random loopback port.
+func New(opts Options) *Router {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		panic("routertest: generate key: " + err.Error())
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		panic("routertest: marshal key: " + err.Error())
+	}
+	pubPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	r := &Router{
+		key:        key,
+		pubPEM:     pubPEM,
+		username:   opts.Username,
+		password:   opts.Password,
+		iterations: opts.Iterations,
+		salt:       randomHex(8),
+		nonces:     map[string]struct{}{},
+		sessions:   map[string]string{},
+		nextSmsID:  1,
+		apn:        "xlunlimited",
+		ledEnabled: true,
+		externalIP: "10.20.30.40",
+		calls:      map[string]int{},
+		failures:   map[string]int{},
+	}
+	if r.username == "" {
+		r.username = "admin"
+	}
+	if r.password == "" {
+		r.password = "6fa6e262c3"
+	}
+	if r.iterations <= 0 {
+		r.iterations = 3
+	}
+
+	r.server = httptest.NewServer(http.HandlerFunc(r.serveHTTP))
+	return r
+}
+
+// Close shuts the emulator down.
+func (r *Router) Close() {
+	r.server.Close()
+}
+
+// URL returns the base URL of the emulator.
+func (r *Router) URL() string {
+	return r.server.URL
+}
+
+// Host returns host:port suitable for config.Config.RouterHost.
+func (r *Router) Host() string {
+	return strings.TrimPrefix(r.server.URL, "http://")
+}
+
+// AddSms places a new unread message in the inbox and returns its ID.
+func (r *Router) AddSms(sender, content string, at time.Time) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := fmt.Sprintf("%d", r.nextSmsID)
+	r.nextSmsID++
+	r.sms = append(r.sms, Sms{ID: id, Sender: sender, Content: content, DateTime: at, Unread: true})
+	return id
+}
+
+// Sms returns a copy of the inbox.
+func (r *Router) Sms() []Sms {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Sms(nil), r.sms...)
+}
+
+// SentSms returns the messages sent so far, one entry per segment.
+func (r *Router) SentSms() []SentSms {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]SentSms(nil), r.sent...)
+}
+
+// APN returns the access point name last applied via ModifyAPN.
+func (r *Router) APN() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.apn
+}
+
+// LedEnabled reports the global LED state.
+func (r *Router) LedEnabled() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ledEnabled
+}
+
+// Reboots returns how many Reboot calls were accepted.
+func (r *Router) Reboots() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reboots
+}
+
+// SetCounters sets the cumulative cellular byte counters.
+func (r *Router) SetCounters(sent, received int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bytesSent = sent
+	r.bytesRecv = received
+}
+
+// SetExternalIP sets the WAN address reported by the status endpoints.
+func (r *Router) SetExternalIP(ip string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.externalIP = ip
+}
+
+// Calls returns how many requests hit the given endpoint path (without the
+// query string), e.g. "status_get_web_app.cgi".
+func (r *Router) Calls(endpoint string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls[endpoint]
+}
+
+// FailNext makes the next n requests to endpoint answer with HTTP 500.
+func (r *Router) FailNext(endpoint string, n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures[endpoint] = n
+}
+
+// ExpireSessions forgets every issued SID, as the router does after its idle
+// timeout. Subsequent authenticated requests answer with HTTP 401.
+func (r *Router) ExpireSessions() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions = map[string]string{}
+}
+
+func (r *Router) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	endpoint := strings.TrimPrefix(req.URL.Path, "/")
+
+	r.mu.Lock()
+	r.calls[endpoint]++
+	fail := r.failures[endpoint] > 0
+	if fail {
+		r.failures[endpoint]--
+	}
+	r.mu.Unlock()
+
+	if fail {
+		http.Error(w, "injected failure", http.StatusInternalServerError)
+		return
+	}
+
+	switch endpoint {
+	case "prelogin_status_web_app.cgi":
+		r.writeJSON(w, r.preloginStatus())
+	case "login_web_app.cgi":
+		r.handleLogin(w, req)
+	case "service_function_web_app.cgi":
+		r.authenticated(w, req, r.handleService)
+	case "ledctrl_web_app.cgi":
+		r.authenticated(w, req, r.handleLedControl)
+	default:
+		builder, ok := r.statusPages()[endpoint]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		r.authenticated(w, req, func(w http.ResponseWriter, req *http.Request, _ string) {
+			r.writeJSON(w, builder(req))
+		})
+	}
+}
+
+func (r *Router) handleLogin(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, "bad form", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case req.URL.RawQuery == "nonce":
+		nonce := base64.StdEncoding.EncodeToString([]byte(randomHex(16)))
+		r.mu.Lock()
+		r.nonces[nonce] = struct{}{}
+		r.mu.Unlock()
+		r.writeJSON(w, map[string]interface{}{
+			"nonce":      nonce,
+			"pubkey":     r.pubPEM,
+			"randomKey":  randomHex(16),
+			"iterations": r.iterations,
+		})
+	case req.URL.RawQuery == "salt" && req.PostForm.Get("response") == "":
+		nonce := unescapeBase64URL(req.PostForm.Get("nonce"))
+		if req.PostForm.Get("userhash") != sha256url(r.username, nonce) {
+			r.writeJSON(w, map[string]interface{}{"result": 1, "message": "unknown user"})
+			return
+		}
+		r.writeJSON(w, map[string]interface{}{"alati": r.salt})
+	case req.URL.RawQuery == "salt":
+		nonce := unescapeBase64URL(req.PostForm.Get("nonce"))
+		r.mu.Lock()
+		_, known := r.nonces[nonce]
+		delete(r.nonces, nonce)
+		r.mu.Unlock()
+
+		if !known || req.PostForm.Get("response") != r.expectedResponse(nonce) {
+			r.writeJSON(w, map[string]interface{}{"result": 1, "message": "invalid credentials"})
+			return
+		}
+
+		sid := randomHex(16)
+		token := randomHex(16)
+		r.mu.Lock()
+		r.sessions[sid] = token
+		r.mu.Unlock()
+		r.writeJSON(w, map[string]interface{}{"sid": sid, "token": token, "result": 0})
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (r *Router) expectedResponse(nonce string) string {
+	hashed := r.salt + r.password
+	sum := sha256Hex([]byte(hashed))
+	for i := 1; i < r.iterations; i++ {
+		raw, _ := hex.DecodeString(sum)
+		sum = sha256Hex(raw)
+	}
+	return sha256url(sha256Join(r.username, strings.ToLower(sum)), nonce)
+}
+
+type authedHandler func(w http.ResponseWriter, req *http.Request, token string)
+
+func (r *Router) authenticated(w http.ResponseWriter, req *http.Request, next authedHandler) {
+	cookie, err := req.Cookie("sid")
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	r.mu.Lock()
+	token, ok := r.sessions[cookie.Value]
+	r.mu.Unlock()
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	next(w, req, token)
+}
+
+func (r *Router) handleLedControl(w http.ResponseWriter, req *http.Request, token string) {
+	form, err := r.decryptForm(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if form.Get("csrf_token") != token {
+		http.Error(w, "csrf token mismatch", http.StatusForbidden)
+		return
+	}
+	if req.URL.RawQuery != "SetLedGlb" {
+		http.NotFound(w, req)
+		return
+	}
+
+	r.mu.Lock()
+	r.ledEnabled = form.Get("EnableGbl") == "on"
+	r.mu.Unlock()
+	r.writeJSON(w, map[string]interface{}{"result": 0})
+}
+
+func (r *Router) handleService(w http.ResponseWriter, req *http.Request, token string) {
+	var call struct {
+		ID        int               `json:"id"`
+		CSRFToken string            `json:"csrf_token"`
+		Function  string            `json:"function"`
+		Paralist  []json.RawMessage `json:"paralist"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&call); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if call.CSRFToken != token {
+		http.Error(w, "csrf token mismatch", http.StatusForbidden)
+		return
+	}
+
+	result, err := r.callFunction(call.Function, call.Paralist)
+	if err != nil {
+		r.writeJSON(w, map[string]interface{}{"id": call.ID, "result": 1, "error": err.Error()})
+		return
+	}
+	r.writeJSON(w, map[string]interface{}{"id": call.ID, "result": 0, "FunctionResult": result})
+}
+
+func (r *Router) callFunction(name string, params []json.RawMessage) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch name {
+	case "GetSMSList":
+		list := make([]map[string]interface{}, 0, len(r.sms))
+		for _, msg := range r.sms {
+			list = append(list, map[string]interface{}{
+				"SMSID":       msg.ID,
+				"SMSSender":   msg.Sender,
+				"SMSContent":  msg.Content,
+				"SMSDateTime": msg.DateTime.Format("2006-01-02 15:04:05"),
+				"SMSUnread":   msg.Unread,
+			})
+		}
+		return list, nil
+	case "SetSMSState":
+		var id struct{ SMSID string }
+		var unread struct{ SMSUnread bool }
+		if len(params) < 2 || json.Unmarshal(params[0], &id) != nil || json.Unmarshal(params[1], &unread) != nil {
+			return nil, fmt.Errorf("invalid parameters")
+		}
+		for i := range r.sms {
+			if r.sms[i].ID == id.SMSID {
+				r.sms[i].Unread = unread.SMSUnread
+				return map[string]interface{}{}, nil
+			}
+		}
+		return nil, fmt.Errorf("sms %s not found", id.SMSID)
+	case "DeleteSMS":
+		var p struct{ SMSList []string }
+		if len(params) < 1 || json.Unmarshal(params[0], &p) != nil {
+			return nil, fmt.Errorf("invalid parameters")
+		}
+		if len(p.SMSList) == 0 {
+			r.sms = nil
+			return map[string]interface{}{}, nil
+		}
+		drop := make(map[string]struct{}, len(p.SMSList))
+		for _, id := range p.SMSList {
+			drop[id] = struct{}{}
+		}
+		kept := r.sms[:0]
+		for _, msg := range r.sms {
+			if _, ok := drop[msg.ID]; !ok {
+				kept = append(kept, msg)
+			}
+		}
+		r.sms = kept
+		return map[string]interface{}{}, nil
+	case "SendSMS":
+		var p struct{ SMSReceiver, SMSContent string }
+		if len(params) < 1 || json.Unmarshal(params[0], &p) != nil || p.SMSReceiver == "" || p.SMSContent == "" {
+			return nil, fmt.Errorf("invalid parameters")
+		}
+		r.sent = append(r.sent, SentSms{To: p.SMSReceiver, Content: p.SMSContent, SentAt: time.Now()})
+		return map[string]interface{}{}, nil
+	case "ModifyAPN":
+		var p struct{ AccessPointName string }
+		if len(params) < 1 || json.Unmarshal(params[0], &p) != nil || p.AccessPointName == "" {
+			return nil, fmt.Errorf("invalid parameters")
+		}
+		if p.AccessPointName != r.apn {
+			// Re-attaching to the network hands out a new public address.
+			r.externalIP = nextIPv4(r.externalIP)
+		}
+		r.apn = p.AccessPointName
+		return map[string]interface{}{}, nil
+	case "Reboot":
+		r.reboots++
+		return map[string]interface{}{}, nil
+	case "GetCAState":
+		return map[string]interface{}{
+			"LTEDLCA": []interface{}{
+				map[string]interface{}{"ScellBand": "B40", "ScellBandwidth": "20MHz", "PhysicalCellID": 301, "ScellChannel": 39150},
+			},
+			"LTEULCA": []interface{}{},
+		}, nil
+	case "GetCellularNetworkIdentification":
+		return map[string]interface{}{
+			"Name": "Emulated", "Band": "B3", "PhysicalCellID": 211, "EARFCN": 1850, "ECI": "0123456",
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+}
+
+func (r *Router) preloginStatus() map[string]interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return map[string]interface{}{
+		"token":     "",
+		"wan_conns": r.wanConnsLocked(),
+		"device_cfg": []interface{}{
+			map[string]interface{}{"Active": 1, "InterfaceType": "Ethernet", "HostName": "desktop", "IPAddress": "192.168.0.10", "MACAddress": "aa:bb:cc:00:00:01"},
+			map[string]interface{}{"Active": 1, "InterfaceType": "802.11", "HostName": "phone", "IPAddress": "192.168.0.11", "MACAddress": "aa:bb:cc:00:00:02"},
+		},
+	}
+}
+
+func (r *Router) wanConnsLocked() []interface{} {
+	return []interface{}{
+		map[string]interface{}{
+			"Name": "WAN",
+			"ipConns": []interface{}{
+				map[string]interface{}{
+					"Name":              "INTERNET",
+					"ConnectionStatus":  "Connected",
+					"ExternalIPAddress": r.externalIP,
+					"DNSServers":        "10.0.0.53,10.0.0.54",
+					"DefaultGateway":    "10.20.30.1",
+				},
+			},
+		},
+	}
+}
+
+func (r *Router) statusPages() map[string]func(*http.Request) map[string]interface{} {
+	return map[string]func(*http.Request) map[string]interface{}{
+		"overview_get_web_app.cgi": func(*http.Request) map[string]interface{} {
+			return r.preloginStatus()
+		},
+		"show_wan_status_web_app.cgi": func(*http.Request) map[string]interface{} {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			return map[string]interface{}{"wan_conns": r.wanConnsLocked()}
+		},
+		"device_status_web_app.cgi": func(*http.Request) map[string]interface{} {
+			return map[string]interface{}{
+				"UpTime":        86400,
+				"cpu_usageinfo": map[string]interface{}{"CPUUsage": 12},
+				"mem_info":      map[string]interface{}{"Total": 524288, "Free": 262144},
+			}
+		},
+		"device_home_nw_client_status_web_app.cgi": func(*http.Request) map[string]interface{} {
+			return map[string]interface{}{"ap": r.preloginStatus()["device_cfg"]}
+		},
+		"status_get_web_app.cgi": func(*http.Request) map[string]interface{} {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			return map[string]interface{}{
+				"cell_LTE_stats_cfg": []interface{}{
+					map[string]interface{}{"stat": map[string]interface{}{
+						"RSRPCurrent": -95, "RSRQCurrent": -11, "SNRCurrent": 7, "RSSICurrent": -70,
+						"Band": "B3", "PhysicalCellID": 211, "DownlinkEarfcn": 1850, "ECI": "0123456",
+					}},
+				},
+				"cell_5G_stats_cfg": []interface{}{
+					map[string]interface{}{"stat": map[string]interface{}{"RSRPCurrent": -32768, "SNRCurrent": -32768}},
+				},
+				"cellular_stats": []interface{}{
+					map[string]interface{}{"BytesSent": r.bytesSent, "BytesReceived": r.bytesRecv},
+				},
+				"apn_cfg": []interface{}{
+					map[string]interface{}{"APN": r.apn, "Enable": 1},
+				},
+			}
+		},
+		"wlan_config_status_web_app.cgi": func(req *http.Request) map[string]interface{} {
+			ssid := "Emulated-2.4G"
+			if req.URL.Query().Get("v") == "11ac" {
+				ssid = "Emulated-5G"
+			}
+			return map[string]interface{}{
+				"wlan_cfg": []interface{}{
+					map[string]interface{}{"Enable": 1, "SSID": ssid, "Channel": 6, "X_ALU_COM_Bandwidth": "20MHz"},
+				},
+			}
+		},
+		"ledctrl_status_web_app.cgi": func(*http.Request) map[string]interface{} {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			return map[string]interface{}{
+				"LEDGlobalSts": map[string]interface{}{
+					"X_ALU_COM_StatusLED_Enable": r.ledEnabled,
+					"X_ALU_COM_SignalLED_Enable": r.ledEnabled,
+				},
+			}
+		},
+		"fastmile_statistics_status_web_app.cgi": func(*http.Request) map[string]interface{} {
+			return map[string]interface{}{
+				"network_cfg": []interface{}{map[string]interface{}{"IMEI": "350000000000001"}},
+				"sim_cfg": []interface{}{map[string]interface{}{
+					"Status": "Ready", "Type": "USIM", "ICCID": "8962000000000000001", "IMSI": "510000000000001", "MSISDN": "+620000000001",
+				}},
+			}
+		},
+		"lan_status_web_app.cgi": func(*http.Request) map[string]interface{} {
+			return map[string]interface{}{"device_cfg": r.preloginStatus()["device_cfg"]}
+		},
+	}
+}
+
+func (r *Router) writeJSON(w http.ResponseWriter, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func unescapeBase64URL(s string) string {
+	s = strings.ReplaceAll(s, "-", "+")
+	s = strings.ReplaceAll(s, "_", "/")
+	s = strings.ReplaceAll(s, ".", "=")
+	return s
+}
+
+func formValuesFromPlaintext(plaintext string) (url.Values, error) {
+	return url.ParseQuery(plaintext)
+}
+
+func nextIPv4(ip string) string {
+	parsed := net.ParseIP(ip).To4()
+	if parsed == nil {
+		return "10.20.30.41"
+	}
+	next := make(net.IP, len(parsed))
+	copy(next, parsed)
+	next[3]++
+	return next.String()
+}
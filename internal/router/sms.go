@@ -0,0 +1,179 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// SMS encodings reported by SplitSms.
+const (
+	SmsEncodingGSM7 = "gsm7"
+	SmsEncodingUCS2 = "ucs2"
+)
+
+// MaxSmsSegments bounds how many messages a single SendSms call may turn
+// into.
+const MaxSmsSegments = 10
+
+// ErrInvalidSms is returned by SendSms before anything is sent when the
+// recipient or the text cannot be used.
+var ErrInvalidSms = errors.New("invalid sms")
+
+// gsm7Basic is the GSM 03.38 default alphabet without the escape character.
+// Each of these costs one septet.
+const gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// gsm7Extension holds the characters sent as escape + code, two septets each.
+const gsm7Extension = "\f^{}\\[~]|€"
+
+// SmsParts describes how a text is sent: its encoding, its length in
+// encoding units (septets for GSM-7, UTF-16 code units for UCS-2) and the
+// segments it is split into.
+type SmsParts struct {
+	Encoding string
+	Units    int
+	Segments []string
+}
+
+// SmsSendResult reports a completed SendSms call.
+type SmsSendResult struct {
+	To       string `json:"to"`
+	Encoding string `json:"encoding"`
+	Units    int    `json:"units"`
+	Segments int    `json:"segments"`
+}
+
+func gsm7Units(r rune) int {
+	switch {
+	case strings.ContainsRune(gsm7Basic, r):
+		return 1
+	case strings.ContainsRune(gsm7Extension, r):
+		return 2
+	default:
+		return 0
+	}
+}
+
+func ucs2Units(r rune) int {
+	if n := utf16.RuneLen(r); n > 0 {
+		return n
+	}
+	return 1
+}
+
+// SplitSms works out the encoding of text and splits it the way a phone
+// would: up to 160 septets (70 UCS-2 units) fit in one message, longer texts
+// are sent as segments of 153 (67) to leave room for the concatenation
+// header. Escape sequences and surrogate pairs are never split.
+func SplitSms(text string) SmsParts {
+	parts := SmsParts{Encoding: SmsEncodingGSM7}
+	units := gsm7Units
+	single, multi := 160, 153
+	for _, r := range text {
+		if gsm7Units(r) == 0 {
+			parts.Encoding = SmsEncodingUCS2
+			units = ucs2Units
+			single, multi = 70, 67
+			break
+		}
+	}
+
+	for _, r := range text {
+		parts.Units += units(r)
+	}
+	if text == "" {
+		return parts
+	}
+	if parts.Units <= single {
+		parts.Segments = []string{text}
+		return parts
+	}
+
+	start, used := 0, 0
+	for i, r := range text {
+		n := units(r)
+		if used+n > multi {
+			parts.Segments = append(parts.Segments, text[start:i])
+			start, used = i, 0
+		}
+		used += n
+	}
+	parts.Segments = append(parts.Segments, text[start:])
+	return parts
+}
+
+// normalizeSmsNumber strips the separators people type into phone numbers
+// and checks what is left is an optional '+' followed by digits.
+func normalizeSmsNumber(raw string) (string, error) {
+	number := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(raw))
+
+	digits := strings.TrimPrefix(number, "+")
+	if len(digits) < 3 || len(digits) > 20 {
+		return "", fmt.Errorf("%w: recipient %q must have 3 to 20 digits", ErrInvalidSms, raw)
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("%w: recipient %q is not a phone number", ErrInvalidSms, raw)
+		}
+	}
+	return number, nil
+}
+
+// SendSms sends text to the given number through the OAM SendSMS function.
+// Texts longer than one message are sent segment by segment, in order; the
+// first failure stops the rest and the error names the segment that failed.
+func (c *Client) SendSms(ctx context.Context, to, text string) (*SmsSendResult, error) {
+	number, err := normalizeSmsNumber(to)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("%w: text is empty", ErrInvalidSms)
+	}
+	parts := SplitSms(text)
+	if len(parts.Segments) > MaxSmsSegments {
+		return nil, fmt.Errorf("%w: text needs %d messages, at most %d are allowed", ErrInvalidSms, len(parts.Segments), MaxSmsSegments)
+	}
+
+	defer c.cache.invalidate()
+	for i, segment := range parts.Segments {
+		data, err := c.callService(ctx, "SendSMS", []interface{}{
+			map[string]interface{}{
+				"SMSReceiver": number,
+				"SMSContent":  segment,
+			},
+		})
+		if err == nil && getInt(data["result"]) != 0 {
+			err = fmt.Errorf("router rejected the message: %s", firstNonEmpty(getString(data, "error"), getString(data, "message"), "unknown error"))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("send segment %d of %d: %w", i+1, len(parts.Segments), err)
+		}
+	}
+
+	return &SmsSendResult{
+		To:       number,
+		Encoding: parts.Encoding,
+		Units:    parts.Units,
+		Segments: len(parts.Segments),
+	}, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,45 @@
+package router
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitSmsEncodingAndSegments(t *testing.T) {
+	cases := []struct {
+		name     string
+		text     string
+		encoding string
+		units    int
+		segments []int // rune length of each segment
+	}{
+		{"gsm single", strings.Repeat("a", 160), SmsEncodingGSM7, 160, []int{160}},
+		{"gsm multipart", strings.Repeat("a", 161), SmsEncodingGSM7, 161, []int{153, 8}},
+		// 152 plain septets plus '€' (two septets) must not straddle the boundary.
+		{"escape kept whole", strings.Repeat("a", 152) + "€" + strings.Repeat("b", 10), SmsEncodingGSM7, 164, []int{152, 11}},
+		{"ucs2 single", strings.Repeat("ж", 70), SmsEncodingUCS2, 70, []int{70}},
+		{"ucs2 multipart", strings.Repeat("ж", 71), SmsEncodingUCS2, 71, []int{67, 4}},
+		// Each emoji is a surrogate pair: 33 fit in 67 units, the 34th moves on.
+		{"surrogates kept whole", strings.Repeat("😀", 36), SmsEncodingUCS2, 72, []int{33, 3}},
+		{"empty", "", SmsEncodingGSM7, 0, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			parts := SplitSms(tc.text)
+			if parts.Encoding != tc.encoding || parts.Units != tc.units {
+				t.Fatalf("got %s/%d, want %s/%d", parts.Encoding, parts.Units, tc.encoding, tc.units)
+			}
+			if len(parts.Segments) != len(tc.segments) {
+				t.Fatalf("got %d segments, want %d", len(parts.Segments), len(tc.segments))
+			}
+			for i, segment := range parts.Segments {
+				if n := len([]rune(segment)); n != tc.segments[i] {
+					t.Fatalf("segment %d has %d runes, want %d", i, n, tc.segments[i])
+				}
+			}
+			if strings.Join(parts.Segments, "") != tc.text {
+				t.Fatalf("segments do not add up to the text")
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package router
+
+import "context"
+
+// The methods below wrap the raw map-returning calls and decode them into the
+// typed models from types.go. The undecoded payload remains available via
+// the Raw field of each result.
+
+func (c *Client) Prelogin(ctx context.Context) (*PreloginStatus, error) {
+	raw, err := c.GetPreloginStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePreloginStatus(raw)
+}
+
+func (c *Client) Overview(ctx context.Context) (*Overview, error) {
+	raw, err := c.GetOverviewData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ParseOverview(raw)
+}
+
+func (c *Client) WanStatus(ctx context.Context) (*WanStatus, error) {
+	raw, err := c.GetWanStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ParseWanStatus(raw)
+}
+
+func (c *Client) DeviceStatus(ctx context.Context) (*DeviceStatus, error) {
+	raw, err := c.GetDeviceStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDeviceStatus(raw)
+}
+
+func (c *Client) NetworkClients(ctx context.Context) (*NetworkClients, error) {
+	raw, err := c.GetNetworkClientStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ParseNetworkClients(raw)
+}
+
+func (c *Client) CAState(ctx context.Context) (*CAState, error) {
+	raw, err := c.PostServiceData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCAState(raw)
+}
+
+func (c *Client) CellularStatus(ctx context.Context) (*CellularStatus, error) {
+	raw, err := c.GetStatusWeb(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCellularStatus(raw)
+}
+
+func (c *Client) Wlan24(ctx context.Context) (*WlanConfig, error) {
+	raw, err := c.GetWlan24Configs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ParseWlanConfig(raw)
+}
+
+func (c *Client) Wlan5(ctx context.Context) (*WlanConfig, error) {
+	raw, err := c.GetWlan5Configs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ParseWlanConfig(raw)
+}
+
+func (c *Client) LedStatus(ctx context.Context) (*LedStatus, error) {
+	raw, err := c.GetLedState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ParseLedStatus(raw)
+}
+
+func (c *Client) SimInfo(ctx context.Context) (*SimInfo, error) {
+	raw, err := c.GetSimInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSimInfo(raw)
+}
+
+func (c *Client) LanStatus(ctx context.Context) (*LanStatus, error) {
+	raw, err := c.GetLanStatusWeb(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ParseLanStatus(raw)
+}
+
+func (c *Client) SmsList(ctx context.Context) (*SmsList, error) {
+	raw, err := c.GetSmsList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSmsList(raw)
+}
+
+func (c *Client) CellIdentification(ctx context.Context) (*CellIdentification, error) {
+	raw, err := c.PostCellularIdentification(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCellIdentification(raw)
+}
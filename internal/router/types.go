@@ -0,0 +1,818 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// invalidSignal is the sentinel the firmware reports for radio metrics that
+// are not currently measured (e.g. the NR block while camped on LTE only).
+const invalidSignal = -32768
+
+// FlexString decodes a JSON string, number or boolean into a string. The
+// FastMile firmware is inconsistent about quoting scalar values across
+// releases, so every typed field tolerates either representation.
+type FlexString string
+
+func (f *FlexString) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		*f = ""
+		return nil
+	}
+	if data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*f = FlexString(strings.TrimSpace(s))
+		return nil
+	}
+	switch data[0] {
+	case '{', '[':
+		return fmt.Errorf("cannot decode %s into string", data)
+	}
+	*f = FlexString(string(data))
+	return nil
+}
+
+func (f FlexString) String() string {
+	return string(f)
+}
+
+// FlexInt decodes a JSON number, numeric string or boolean into an int64.
+// Fractional values are truncated and unparsable strings decode as zero.
+type FlexInt int64
+
+func (f *FlexInt) UnmarshalJSON(data []byte) error {
+	v, err := decodeFlexNumber(data)
+	if err != nil {
+		return err
+	}
+	*f = FlexInt(int64(v))
+	return nil
+}
+
+func (f FlexInt) Int64() int64 {
+	return int64(f)
+}
+
+// FlexFloat decodes a JSON number, numeric string or boolean into a float64.
+type FlexFloat float64
+
+func (f *FlexFloat) UnmarshalJSON(data []byte) error {
+	v, err := decodeFlexNumber(data)
+	if err != nil {
+		return err
+	}
+	*f = FlexFloat(v)
+	return nil
+}
+
+func (f FlexFloat) Float64() float64 {
+	return float64(f)
+}
+
+// FlexBool decodes booleans, 0/1 numbers and the usual textual spellings
+// ("true", "on", "enabled", ...) into a bool.
+type FlexBool bool
+
+func (f *FlexBool) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		*f = false
+		return nil
+	}
+	switch data[0] {
+	case 't', 'f':
+		var b bool
+		if err := json.Unmarshal(data, &b); err != nil {
+			return err
+		}
+		*f = FlexBool(b)
+		return nil
+	case '"':
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		switch strings.ToLower(strings.TrimSpace(s)) {
+		case "enabled", "enable":
+			*f = true
+		case "disabled", "disable":
+			*f = false
+		default:
+			*f = FlexBool(parseBoolString(s, false))
+		}
+		return nil
+	}
+	v, err := decodeFlexNumber(data)
+	if err != nil {
+		return err
+	}
+	*f = v != 0
+	return nil
+}
+
+func decodeFlexNumber(data []byte) (float64, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return 0, nil
+	}
+	switch data[0] {
+	case '"':
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return 0, err
+		}
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return 0, nil
+		}
+		if v, err := strconv.ParseFloat(s, 64); err == nil {
+			return v, nil
+		}
+		return 0, nil
+	case 't':
+		return 1, nil
+	case 'f':
+		return 0, nil
+	case '{', '[':
+		return 0, fmt.Errorf("cannot decode %s into number", data)
+	}
+	return strconv.ParseFloat(string(data), 64)
+}
+
+// RawResponse keeps the undecoded router payload next to the typed view so
+// callers can fall back to it for fields the typed layer does not model.
+type RawResponse struct {
+	Raw map[string]interface{} `json:"-"`
+}
+
+func (r *RawResponse) setRaw(raw map[string]interface{}) {
+	r.Raw = raw
+}
+
+type rawSetter interface {
+	setRaw(map[string]interface{})
+}
+
+func decodeTyped[T any, PT interface {
+	*T
+	rawSetter
+}](raw map[string]interface{}) (*T, error) {
+	out := new(T)
+	if raw != nil {
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return nil, fmt.Errorf("encode raw response: %w", err)
+		}
+		if err := json.Unmarshal(data, out); err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+	}
+	PT(out).setRaw(raw)
+	return out, nil
+}
+
+// PreloginStatus is the unauthenticated status snapshot from
+// prelogin_status_web_app.cgi.
+type PreloginStatus struct {
+	RawResponse
+	Token    FlexString      `json:"token"`
+	WanConns []WanConnection `json:"wan_conns"`
+	Devices  []LanClient     `json:"device_cfg"`
+}
+
+// ExternalIP returns the public IPv4 address of the first WAN connection.
+func (p *PreloginStatus) ExternalIP() string {
+	return primaryIPConnection(p.WanConns).ExternalIPAddress.String()
+}
+
+// ActiveDevices returns the LAN clients flagged as active.
+func (p *PreloginStatus) ActiveDevices() []LanClient {
+	return activeClients(p.Devices)
+}
+
+// Overview is the dashboard summary from overview_get_web_app.cgi. Its layout
+// differs noticeably between firmware builds, so only the sections shared
+// with the status endpoints are modelled; everything else lives in Raw.
+type Overview struct {
+	RawResponse
+	WanConns []WanConnection `json:"wan_conns"`
+	Devices  []LanClient     `json:"device_cfg"`
+}
+
+// WanStatus is the payload from show_wan_status_web_app.cgi.
+type WanStatus struct {
+	RawResponse
+	WanConns []WanConnection `json:"wan_conns"`
+}
+
+// Primary returns the first IP connection of the first WAN interface.
+func (w *WanStatus) Primary() IPConnection {
+	return primaryIPConnection(w.WanConns)
+}
+
+// ExternalIP returns the public IPv4 address of the primary connection.
+func (w *WanStatus) ExternalIP() string {
+	return w.Primary().ExternalIPAddress.String()
+}
+
+type WanConnection struct {
+	Name    FlexString     `json:"Name"`
+	IPConns []IPConnection `json:"ipConns"`
+}
+
+type IPConnection struct {
+	Name                FlexString `json:"Name"`
+	ConnectionStatus    FlexString `json:"ConnectionStatus"`
+	ExternalIPAddress   FlexString `json:"ExternalIPAddress"`
+	ExternalIPv6Address FlexString `json:"X_CT_COM_IPv6IPAddress"`
+	DNSServers          FlexString `json:"DNSServers"`
+	IPv6DNSServers      FlexString `json:"X_CT_COM_IPv6DNSServers"`
+	DefaultGateway      FlexString `json:"DefaultGateway"`
+	MACAddress          FlexString `json:"MACAddress"`
+	Uptime              FlexInt    `json:"Uptime"`
+}
+
+// Connected reports whether the connection status reads as up.
+func (c IPConnection) Connected() bool {
+	return strings.EqualFold(c.ConnectionStatus.String(), "Connected")
+}
+
+// DNSServerList splits the comma separated IPv4 resolver list.
+func (c IPConnection) DNSServerList() []string {
+	return splitList(c.DNSServers.String())
+}
+
+func primaryIPConnection(conns []WanConnection) IPConnection {
+	for _, conn := range conns {
+		if len(conn.IPConns) > 0 {
+			return conn.IPConns[0]
+		}
+	}
+	return IPConnection{}
+}
+
+// DeviceStatus is the payload from device_status_web_app.cgi?getroot.
+type DeviceStatus struct {
+	RawResponse
+	UpTime FlexInt    `json:"UpTime"`
+	CPU    CPUInfo    `json:"cpu_usageinfo"`
+	Memory MemoryInfo `json:"mem_info"`
+}
+
+type CPUInfo struct {
+	CPUUsage FlexFloat `json:"CPUUsage"`
+}
+
+type MemoryInfo struct {
+	Total FlexInt `json:"Total"`
+	Free  FlexInt `json:"Free"`
+}
+
+// UsedPercent returns the share of memory in use, or 0 when unknown.
+func (m MemoryInfo) UsedPercent() float64 {
+	if m.Total <= 0 {
+		return 0
+	}
+	return float64(m.Total-m.Free) / float64(m.Total) * 100
+}
+
+// CellularStatus is the radio and traffic payload from status_get_web_app.cgi.
+type CellularStatus struct {
+	RawResponse
+	LTE   []CellEntry     `json:"cell_LTE_stats_cfg"`
+	NR    []CellEntry     `json:"cell_5G_stats_cfg"`
+	Stats []CellularStats `json:"cellular_stats"`
+	APNs  []APNEntry      `json:"apn_cfg"`
+}
+
+// APNEntry is one configured access point of the cellular WAN.
+type APNEntry struct {
+	APN    FlexString `json:"APN"`
+	Enable FlexBool   `json:"Enable"`
+}
+
+type CellEntry struct {
+	Stat RadioStat `json:"stat"`
+}
+
+// RadioStat holds the per-cell signal metrics. Unmeasured values are
+// reported by the firmware as -32768; use Valid before trusting them.
+type RadioStat struct {
+	RSRPCurrent    FlexFloat  `json:"RSRPCurrent"`
+	RSRQCurrent    FlexFloat  `json:"RSRQCurrent"`
+	SNRCurrent     FlexFloat  `json:"SNRCurrent"`
+	RSSICurrent    FlexFloat  `json:"RSSICurrent"`
+	CQI            FlexFloat  `json:"CQI"`
+	Band           FlexString `json:"Band"`
+	PhysicalCellID FlexInt    `json:"PhysicalCellID"`
+	DownlinkEarfcn FlexInt    `json:"DownlinkEarfcn"`
+	ECI            FlexString `json:"ECI"`
+}
+
+// Valid reports whether the cell carries real RSRP or SNR measurements.
+func (r RadioStat) Valid() bool {
+	return validSignal(r.RSRPCurrent) || validSignal(r.SNRCurrent)
+}
+
+func validSignal(v FlexFloat) bool {
+	return v != 0 && v != invalidSignal
+}
+
+// CellularStats holds the cumulative byte counters of the cellular WAN.
+type CellularStats struct {
+	BytesSent     FlexInt `json:"BytesSent"`
+	BytesReceived FlexInt `json:"BytesReceived"`
+}
+
+// Serving returns the radio technology ("nr" or "lte") and metrics of the
+// serving cell, preferring NR when it carries valid measurements. This is
+// the same selection the dashboard applies.
+func (s *CellularStatus) Serving() (string, RadioStat) {
+	if len(s.NR) > 0 && s.NR[0].Stat.Valid() {
+		return "nr", s.NR[0].Stat
+	}
+	if len(s.LTE) > 0 && s.LTE[0].Stat.Valid() {
+		return "lte", s.LTE[0].Stat
+	}
+	return "lte", RadioStat{}
+}
+
+// Counters returns the first cellular byte counter entry.
+func (s *CellularStatus) Counters() (CellularStats, bool) {
+	if len(s.Stats) == 0 {
+		return CellularStats{}, false
+	}
+	return s.Stats[0], true
+}
+
+// CurrentAPN returns the access point name the modem is configured with:
+// the first enabled entry, or the first named one when none is flagged.
+func (s *CellularStatus) CurrentAPN() string {
+	fallback := ""
+	for _, entry := range s.APNs {
+		name := entry.APN.String()
+		if name == "" {
+			continue
+		}
+		if entry.Enable {
+			return name
+		}
+		if fallback == "" {
+			fallback = name
+		}
+	}
+	return fallback
+}
+
+// CAState is the carrier-aggregation result of the OAM GetCAState function.
+type CAState struct {
+	RawResponse
+	Result struct {
+		Downlink CarrierList `json:"LTEDLCA"`
+		Uplink   CarrierList `json:"LTEULCA"`
+	} `json:"FunctionResult"`
+}
+
+// Downlink returns the aggregated downlink secondary cells.
+func (c *CAState) Downlink() []Carrier {
+	return c.Result.Downlink
+}
+
+// Uplink returns the aggregated uplink secondary cells.
+func (c *CAState) Uplink() []Carrier {
+	return c.Result.Uplink
+}
+
+type Carrier struct {
+	ScellBand      FlexString `json:"ScellBand"`
+	ScellBandwidth FlexString `json:"ScellBandwidth"`
+	PhysicalCellID FlexInt    `json:"PhysicalCellID"`
+	ScellChannel   FlexInt    `json:"ScellChannel"`
+}
+
+// CarrierList accepts both the array form and the index-keyed object form
+// ({"0": {...}, "1": {...}}) the firmware uses for carrier lists.
+type CarrierList []Carrier
+
+func (l *CarrierList) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		*l = nil
+		return nil
+	}
+	if data[0] == '[' {
+		var list []Carrier
+		if err := json.Unmarshal(data, &list); err != nil {
+			return err
+		}
+		*l = list
+		return nil
+	}
+	if data[0] != '{' {
+		*l = nil
+		return nil
+	}
+	var keyed map[string]Carrier
+	if err := json.Unmarshal(data, &keyed); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(keyed))
+	for k := range keyed {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ai, errI := strconv.Atoi(keys[i])
+		aj, errJ := strconv.Atoi(keys[j])
+		if errI == nil && errJ == nil {
+			return ai < aj
+		}
+		return keys[i] < keys[j]
+	})
+	list := make([]Carrier, 0, len(keys))
+	for _, k := range keys {
+		list = append(list, keyed[k])
+	}
+	*l = list
+	return nil
+}
+
+// CellIdentification is the result of GetCellularNetworkIdentification.
+type CellIdentification struct {
+	RawResponse
+	Result CellIdentity `json:"FunctionResult"`
+}
+
+type CellIdentity struct {
+	Name           FlexString `json:"Name"`
+	Band           FlexString `json:"Band"`
+	PhysicalCellID FlexInt    `json:"PhysicalCellID"`
+	EARFCN         FlexInt    `json:"EARFCN"`
+	ECI            FlexString `json:"ECI"`
+	MCC            FlexString `json:"MCC"`
+	MNC            FlexString `json:"MNC"`
+	TAC            FlexString `json:"TAC"`
+}
+
+// SimInfo is the payload from fastmile_statistics_status_web_app.cgi.
+type SimInfo struct {
+	RawResponse
+	Network []NetworkInfo `json:"network_cfg"`
+	Sim     []SimCard     `json:"sim_cfg"`
+}
+
+type NetworkInfo struct {
+	IMEI FlexString `json:"IMEI"`
+}
+
+type SimCard struct {
+	Status FlexString `json:"Status"`
+	Type   FlexString `json:"Type"`
+	ICCID  FlexString `json:"ICCID"`
+	IMSI   FlexString `json:"IMSI"`
+	MSISDN FlexString `json:"MSISDN"`
+}
+
+// IMEI returns the modem IMEI, if reported.
+func (s *SimInfo) IMEI() string {
+	if len(s.Network) == 0 {
+		return ""
+	}
+	return s.Network[0].IMEI.String()
+}
+
+// Card returns the first SIM card entry.
+func (s *SimInfo) Card() SimCard {
+	if len(s.Sim) == 0 {
+		return SimCard{}
+	}
+	return s.Sim[0]
+}
+
+// LanClient is a host known to the gateway, wired or wireless.
+type LanClient struct {
+	Active         FlexBool   `json:"Active"`
+	InterfaceType  FlexString `json:"InterfaceType"`
+	HostName       FlexString `json:"HostName"`
+	Alias          FlexString `json:"Alias"`
+	IPAddress      FlexString `json:"IPAddress"`
+	MACAddress     FlexString `json:"MACAddress"`
+	LastActiveTime FlexString `json:"X_ALU_COM_LastActiveTime"`
+}
+
+// DisplayName returns the host name, falling back to the alias.
+func (c LanClient) DisplayName() string {
+	if name := c.HostName.String(); name != "" {
+		return name
+	}
+	return c.Alias.String()
+}
+
+// Wired reports whether the client is attached over Ethernet.
+func (c LanClient) Wired() bool {
+	return strings.EqualFold(c.InterfaceType.String(), "Ethernet")
+}
+
+// LanStatus is the LAN host inventory from lan_status_web_app.cgi. The host
+// list key varies between builds, so every top-level list whose entries
+// carry a MACAddress is collected.
+type LanStatus struct {
+	RawResponse
+	Clients []LanClient `json:"-"`
+}
+
+// ActiveClients returns the hosts flagged as active.
+func (l *LanStatus) ActiveClients() []LanClient {
+	return activeClients(l.Clients)
+}
+
+// NetworkClients is the topology dump from
+// device_home_nw_client_status_web_app.cgi, flattened to its hosts.
+type NetworkClients struct {
+	RawResponse
+	Clients []LanClient `json:"-"`
+}
+
+func activeClients(clients []LanClient) []LanClient {
+	out := make([]LanClient, 0, len(clients))
+	for _, c := range clients {
+		if c.Active {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// WlanConfig is the radio configuration from wlan_config_status_web_app.cgi.
+type WlanConfig struct {
+	RawResponse
+	Networks []WlanNetwork `json:"-"`
+}
+
+// Enabled reports whether any SSID on the radio is enabled.
+func (w *WlanConfig) Enabled() bool {
+	for _, n := range w.Networks {
+		if n.Enable {
+			return true
+		}
+	}
+	return false
+}
+
+type WlanNetwork struct {
+	Enable       FlexBool   `json:"Enable"`
+	SSID         FlexString `json:"SSID"`
+	Channel      FlexInt    `json:"Channel"`
+	Bandwidth    FlexString `json:"X_ALU_COM_Bandwidth"`
+	Mode         FlexString `json:"X_ALU_COM_Mode"`
+	SecurityMode FlexString `json:"X_ALU_COM_SecurityMode"`
+}
+
+// LedStatus is the payload from ledctrl_status_web_app.cgi.
+type LedStatus struct {
+	RawResponse
+	Global struct {
+		StatusLED FlexBool `json:"X_ALU_COM_StatusLED_Enable"`
+		SignalLED FlexBool `json:"X_ALU_COM_SignalLED_Enable"`
+	} `json:"LEDGlobalSts"`
+}
+
+// Enabled reports whether both the status and signal LEDs are on.
+func (l *LedStatus) Enabled() bool {
+	return bool(l.Global.StatusLED) && bool(l.Global.SignalLED)
+}
+
+// SmsList is the result of the OAM GetSMSList function.
+type SmsList struct {
+	RawResponse
+	Messages []Sms `json:"-"`
+}
+
+// Sms is a single inbox entry. Older firmware uses lower-case or
+// From/Body/Timestamp keys; ParseSmsList folds those into the same fields.
+type Sms struct {
+	SMSID       string `json:"SMSID"`
+	SMSContent  string `json:"SMSContent"`
+	SMSDateTime string `json:"SMSDateTime"`
+	SMSSender   string `json:"SMSSender"`
+	SMSUnread   bool   `json:"SMSUnread"`
+}
+
+// ParsePreloginStatus decodes a raw prelogin_status payload.
+func ParsePreloginStatus(raw map[string]interface{}) (*PreloginStatus, error) {
+	return decodeTyped[PreloginStatus](raw)
+}
+
+// ParseOverview decodes a raw overview payload.
+func ParseOverview(raw map[string]interface{}) (*Overview, error) {
+	return decodeTyped[Overview](raw)
+}
+
+// ParseWanStatus decodes a raw show_wan_status payload.
+func ParseWanStatus(raw map[string]interface{}) (*WanStatus, error) {
+	return decodeTyped[WanStatus](raw)
+}
+
+// ParseDeviceStatus decodes a raw device_status payload.
+func ParseDeviceStatus(raw map[string]interface{}) (*DeviceStatus, error) {
+	return decodeTyped[DeviceStatus](raw)
+}
+
+// ParseCellularStatus decodes a raw status_get payload.
+func ParseCellularStatus(raw map[string]interface{}) (*CellularStatus, error) {
+	return decodeTyped[CellularStatus](raw)
+}
+
+// ParseCAState decodes a raw GetCAState service response.
+func ParseCAState(raw map[string]interface{}) (*CAState, error) {
+	return decodeTyped[CAState](raw)
+}
+
+// ParseCellIdentification decodes a raw GetCellularNetworkIdentification response.
+func ParseCellIdentification(raw map[string]interface{}) (*CellIdentification, error) {
+	return decodeTyped[CellIdentification](raw)
+}
+
+// ParseSimInfo decodes a raw fastmile_statistics payload.
+func ParseSimInfo(raw map[string]interface{}) (*SimInfo, error) {
+	return decodeTyped[SimInfo](raw)
+}
+
+// ParseLedStatus decodes a raw ledctrl_status payload.
+func ParseLedStatus(raw map[string]interface{}) (*LedStatus, error) {
+	return decodeTyped[LedStatus](raw)
+}
+
+// ParseLanStatus decodes a raw lan_status payload.
+func ParseLanStatus(raw map[string]interface{}) (*LanStatus, error) {
+	out, err := decodeTyped[LanStatus](raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := collectObjects(raw, "MACAddress", &out.Clients); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ParseNetworkClients decodes a raw device_home_nw_client_status payload.
+func ParseNetworkClients(raw map[string]interface{}) (*NetworkClients, error) {
+	out, err := decodeTyped[NetworkClients](raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := collectObjects(raw, "MACAddress", &out.Clients); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ParseWlanConfig decodes a raw wlan_config_status payload.
+func ParseWlanConfig(raw map[string]interface{}) (*WlanConfig, error) {
+	out, err := decodeTyped[WlanConfig](raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := collectObjects(raw, "SSID", &out.Networks); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ParseSmsList decodes a raw GetSMSList service response. Entries without an
+// SMSID are dropped.
+func ParseSmsList(raw map[string]interface{}) (*SmsList, error) {
+	out, err := decodeTyped[SmsList](raw)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range extractSmsItems(raw) {
+		msg := Sms{
+			SMSID:       firstString(item, "SMSID", "smsid", "id"),
+			SMSContent:  firstString(item, "SMSContent", "sms_content", "Body", "body"),
+			SMSDateTime: firstString(item, "SMSDateTime", "sms_datetime", "Timestamp", "timestamp"),
+			SMSSender:   firstString(item, "SMSSender", "sms_sender", "From", "from"),
+			SMSUnread:   true,
+		}
+		if msg.SMSID == "" {
+			continue
+		}
+		if candidate, ok := firstValue(item, "SMSUnread", "sms_unread", "Unread", "unread"); ok {
+			msg.SMSUnread = flexBool(candidate, true)
+		} else if candidate, ok := item["Read"]; ok {
+			msg.SMSUnread = !flexBool(candidate, false)
+		}
+		out.Messages = append(out.Messages, msg)
+	}
+	return out, nil
+}
+
+// collectObjects walks the payload and decodes every object that carries
+// marker into out, which must point to a slice.
+func collectObjects(raw map[string]interface{}, marker string, out interface{}) error {
+	found := make([]interface{}, 0)
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			if _, ok := val[marker]; ok {
+				found = append(found, val)
+				return
+			}
+			keys := make([]string, 0, len(val))
+			for k := range val {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				walk(val[k])
+			}
+		case []interface{}:
+			for _, item := range val {
+				walk(item)
+			}
+		}
+	}
+	walk(raw)
+
+	data, err := json.Marshal(found)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func extractSmsItems(raw interface{}) []map[string]interface{} {
+	switch v := raw.(type) {
+	case map[string]interface{}:
+		for _, key := range []string{"FunctionResult", "SMSList", "sms_list", "Data", "data"} {
+			if list := extractSmsItems(v[key]); len(list) > 0 {
+				return list
+			}
+		}
+		return nil
+	case []interface{}:
+		result := make([]map[string]interface{}, 0, len(v))
+		for _, item := range v {
+			if m, ok := item.(map[string]interface{}); ok {
+				result = append(result, m)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+func firstString(item map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if _, ok := item[key]; ok {
+			if s := strings.TrimSpace(getString(item, key)); s != "" && s != "<nil>" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+func firstValue(item map[string]interface{}, keys ...string) (interface{}, bool) {
+	for _, key := range keys {
+		if val, ok := item[key]; ok {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+func flexBool(v interface{}, fallback bool) bool {
+	switch val := v.(type) {
+	case bool:
+		return val
+	case string:
+		return parseBoolString(val, fallback)
+	case nil:
+		return fallback
+	default:
+		return getInt(val) != 0
+	}
+}
+
+func splitList(raw string) []string {
+	parts := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == ' ' || r == ';'
+	})
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,118 @@
+package router
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseCellularStatusToleratesMixedScalars(t *testing.T) {
+	raw := mustDecodeRaw(t, `{
+		"cell_5G_stats_cfg": [{"stat": {"RSRPCurrent": -32768, "SNRCurrent": "-32768"}}],
+		"cell_LTE_stats_cfg": [{"stat": {"RSRPCurrent": "-95", "RSRQCurrent": -11.5, "SNRCurrent": "7", "Band": 3, "PhysicalCellID": "211", "DownlinkEarfcn": 1850}}],
+		"cellular_stats": [{"BytesSent": "1024", "BytesReceived": 4096}],
+		"apn_cfg": [{"APN": "ims", "Enable": 0}, {"APN": "xlunlimited", "Enable": "1"}]
+	}`)
+
+	status, err := ParseCellularStatus(raw)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	tech, stat := status.Serving()
+	if tech != "lte" {
+		t.Fatalf("expected lte serving cell, got %s", tech)
+	}
+	if stat.RSRPCurrent != -95 || stat.RSRQCurrent != -11.5 || stat.SNRCurrent != 7 {
+		t.Fatalf("unexpected signal values: %+v", stat)
+	}
+	if stat.Band != "3" || stat.PhysicalCellID != 211 || stat.DownlinkEarfcn != 1850 {
+		t.Fatalf("unexpected cell identity: %+v", stat)
+	}
+
+	counters, ok := status.Counters()
+	if !ok || counters.BytesSent != 1024 || counters.BytesReceived != 4096 {
+		t.Fatalf("unexpected counters: %+v", counters)
+	}
+	if apn := status.CurrentAPN(); apn != "xlunlimited" {
+		t.Fatalf("expected the enabled APN, got %q", apn)
+	}
+	if status.Raw == nil {
+		t.Fatalf("expected raw payload to be retained")
+	}
+}
+
+func TestParseCAStateAcceptsKeyedObjects(t *testing.T) {
+	raw := mustDecodeRaw(t, `{"FunctionResult": {
+		"LTEDLCA": {"1": {"ScellBand": "B40", "ScellChannel": "39150"}, "0": {"ScellBand": "B1", "PhysicalCellID": 12}},
+		"LTEULCA": []
+	}}`)
+
+	ca, err := ParseCAState(raw)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	dl := ca.Downlink()
+	if len(dl) != 2 {
+		t.Fatalf("expected 2 downlink carriers, got %d", len(dl))
+	}
+	if dl[0].ScellBand != "B1" || dl[1].ScellChannel != 39150 {
+		t.Fatalf("unexpected carrier ordering: %+v", dl)
+	}
+	if len(ca.Uplink()) != 0 {
+		t.Fatalf("expected no uplink carriers")
+	}
+}
+
+func TestParseSmsListFoldsAlternateKeys(t *testing.T) {
+	raw := mustDecodeRaw(t, `{"FunctionResult": [
+		{"SMSID": 7, "SMSSender": "+62811", "SMSContent": "hi", "SMSUnread": "0"},
+		{"id": "8", "From": "BANK", "Body": "code 1234", "Read": true},
+		{"SMSContent": "orphan"}
+	]}`)
+
+	list, err := ParseSmsList(raw)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(list.Messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(list.Messages))
+	}
+	if list.Messages[0].SMSID != "7" || list.Messages[0].SMSUnread {
+		t.Fatalf("unexpected first message: %+v", list.Messages[0])
+	}
+	if list.Messages[1].SMSSender != "BANK" || list.Messages[1].SMSUnread {
+		t.Fatalf("unexpected second message: %+v", list.Messages[1])
+	}
+}
+
+func TestParseWanStatusAndLedStatus(t *testing.T) {
+	wan, err := ParseWanStatus(mustDecodeRaw(t, `{"wan_conns": [{"ipConns": [{
+		"ConnectionStatus": "Connected", "ExternalIPAddress": "10.1.2.3", "DNSServers": "1.1.1.1,8.8.8.8"
+	}]}]}`))
+	if err != nil {
+		t.Fatalf("parse wan failed: %v", err)
+	}
+	if wan.ExternalIP() != "10.1.2.3" || !wan.Primary().Connected() {
+		t.Fatalf("unexpected wan status: %+v", wan.Primary())
+	}
+	if dns := wan.Primary().DNSServerList(); len(dns) != 2 || dns[1] != "8.8.8.8" {
+		t.Fatalf("unexpected dns list: %v", dns)
+	}
+
+	led, err := ParseLedStatus(mustDecodeRaw(t, `{"LEDGlobalSts": {"X_ALU_COM_StatusLED_Enable": 1, "X_ALU_COM_SignalLED_Enable": "true"}}`))
+	if err != nil {
+		t.Fatalf("parse led failed: %v", err)
+	}
+	if !led.Enabled() {
+		t.Fatalf("expected LEDs enabled")
+	}
+}
+
+func mustDecodeRaw(t *testing.T, body string) map[string]interface{} {
+	t.Helper()
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &raw); err != nil {
+		t.Fatalf("invalid fixture: %v", err)
+	}
+	return raw
+}
@@ -0,0 +1,522 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"nokia_modem/internal/config"
+	"nokia_modem/internal/settings"
+)
+
+// Alert rule states. A rule is pending while its condition holds for less
+// than for_minutes and resolved after a firing ended.
+const (
+	alertOK       = "ok"
+	alertPending  = "pending"
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+)
+
+// maxAlertHistory bounds the alert history kept in settings.json.
+const maxAlertHistory = 100
+
+type alertMetricKind int
+
+const (
+	alertNumeric alertMetricKind = iota
+	alertCondition
+	alertEvent
+)
+
+// alertMetrics lists the metrics rules can watch. Numeric metrics are
+// compared with the rule's threshold, link_down holds while the WAN link is
+// down and events fire once per occurrence.
+var alertMetrics = map[string]alertMetricKind{
+	"rsrp":                 alertNumeric,
+	"rsrq":                 alertNumeric,
+	"sinr":                 alertNumeric,
+	"rssi":                 alertNumeric,
+	"cpu_percent":          alertNumeric,
+	"memory_percent":       alertNumeric,
+	"data_expires_in_days": alertNumeric,
+	"link_down":            alertCondition,
+	"wan_ip_changed":       alertEvent,
+	"new_device":           alertEvent,
+}
+
+var alertOps = []string{"<", "<=", ">", ">=", "==", "!="}
+
+func alertRuleHolds(rule config.AlertRule, value float64) bool {
+	switch rule.Op {
+	case "<":
+		return value < rule.Threshold
+	case "<=":
+		return value <= rule.Threshold
+	case ">":
+		return value > rule.Threshold
+	case ">=":
+		return value >= rule.Threshold
+	case "==":
+		return value == rule.Threshold
+	case "!=":
+		return value != rule.Threshold
+	}
+	return false
+}
+
+// alertObservation is what one evaluation saw. Metrics that could not be
+// read are missing from values; wanIP is empty and devices nil when their
+// source failed, and the rules depending on them keep their state.
+type alertObservation struct {
+	values  map[string]float64
+	wanIP   string
+	devices map[string]string
+}
+
+// alertEngine holds the latest observed values for /api/alerts. Everything
+// else lives in settings.json.
+type alertEngine struct {
+	mu     sync.Mutex
+	values map[string]float64
+	at     time.Time
+}
+
+func alertsConfigsEqual(a, b config.AlertsConfig) bool {
+	return a.Enabled == b.Enabled &&
+		a.IntervalSeconds == b.IntervalSeconds &&
+		slices.Equal(a.Rules, b.Rules)
+}
+
+func alertInterval(cfg config.AlertsConfig) time.Duration {
+	seconds := cfg.IntervalSeconds
+	if seconds < 10 {
+		seconds = 60
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// configureAlerts runs the alerting engine while it is enabled with rules.
+// The other alert settings are read at every evaluation.
+func (s *Server) configureAlerts(cfg config.Config) {
+	var (
+		start bool
+		stop  context.CancelFunc
+		ctx   context.Context
+	)
+	enabled := cfg.Alerts.Enabled && len(cfg.Alerts.Rules) > 0
+
+	s.alertsMu.Lock()
+	running := s.alertsCancel != nil
+	changed := !alertsConfigsEqual(s.alertsCfg, cfg.Alerts)
+
+	if running && (changed || !enabled) {
+		stop = s.alertsCancel
+		s.alertsCancel = nil
+		running = false
+	}
+	if enabled && !running {
+		ctx, s.alertsCancel = context.WithCancel(context.Background())
+		s.alertsWG.Add(1)
+		start = true
+	}
+	s.alertsCfg = cfg.Alerts
+	s.alertsMu.Unlock()
+
+	if stop != nil {
+		stop()
+		s.alertsWG.Wait()
+		s.logger.Printf("alerts: engine stopped")
+	}
+
+	if start {
+		interval := alertInterval(cfg.Alerts)
+		go s.runAlertEngine(ctx, interval)
+		s.logger.Printf("alerts: engine started (%d rules, interval %s)", len(cfg.Alerts.Rules), interval)
+	}
+}
+
+func (s *Server) runAlertEngine(ctx context.Context, interval time.Duration) {
+	defer s.alertsWG.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s.evaluateAlerts(ctx, time.Now())
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.evaluateAlerts(ctx, time.Now())
+		}
+	}
+}
+
+// evaluateAlerts observes the router once, advances every rule and sends
+// the notifications that are due. settings.json is only written when a
+// rule changed state.
+func (s *Server) evaluateAlerts(ctx context.Context, now time.Time) {
+	cfg := s.getConfig()
+	snapshot := s.store.Get()
+	obs := s.observeAlerts(ctx, cfg.Alerts.Rules, snapshot, now)
+	if ctx.Err() != nil {
+		return
+	}
+
+	s.alerts.mu.Lock()
+	s.alerts.values = obs.values
+	s.alerts.at = now
+	s.alerts.mu.Unlock()
+
+	state := snapshot.Alerts
+	before := alertsStateKey(state)
+	events := evaluateAlertRules(&state, cfg.Alerts.Rules, obs, now)
+	if len(events) > 0 || alertsStateKey(state) != before {
+		err := s.store.Update(func(data *settings.Settings) error {
+			data.Alerts = state
+			return nil
+		})
+		if err != nil {
+			s.logger.Printf("alerts: persist state failed: %v", err)
+		}
+	}
+
+	for _, event := range events {
+		s.logger.Printf("alerts: %s %s: %s", event.Rule, event.Status, event.Message)
+		if event.Notified {
+			s.sendAlertEvent(ctx, cfg, event)
+		}
+	}
+}
+
+// alertsStateKey renders everything but the history for change detection;
+// new history entries are always written.
+func alertsStateKey(state settings.AlertsState) string {
+	return fmt.Sprintf("%v|%s|%v", state.Rules, state.WanIP, state.KnownDevices)
+}
+
+// observeAlerts reads only the sources the rules need. A failed source is
+// logged and leaves its metrics out.
+func (s *Server) observeAlerts(ctx context.Context, rules []config.AlertRule, data settings.Settings, now time.Time) alertObservation {
+	obs := alertObservation{values: map[string]float64{}}
+	need := map[string]bool{}
+	for _, rule := range rules {
+		need[rule.Metric] = true
+	}
+	client := s.getClient()
+	fetchCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+
+	if need["rsrp"] || need["rsrq"] || need["sinr"] || need["rssi"] {
+		if status, err := client.CellularStatus(fetchCtx); err != nil {
+			s.logger.Printf("alerts: status_web failed: %v", err)
+		} else if _, stat := status.Serving(); stat.Valid() {
+			for metric, v := range map[string]*float64{
+				"rsrp": signalMetric(stat.RSRPCurrent),
+				"rsrq": signalMetric(stat.RSRQCurrent),
+				"sinr": signalMetric(stat.SNRCurrent),
+				"rssi": signalMetric(stat.RSSICurrent),
+			} {
+				if v != nil {
+					obs.values[metric] = *v
+				}
+			}
+		}
+	}
+
+	if need["link_down"] || need["wan_ip_changed"] {
+		if wan, err := client.WanStatus(fetchCtx); err != nil {
+			s.logger.Printf("alerts: wan status failed: %v", err)
+		} else {
+			primary := wan.Primary()
+			obs.values["link_down"] = 0
+			if !primary.Connected() {
+				obs.values["link_down"] = 1
+			}
+			obs.wanIP = strings.TrimSpace(wan.ExternalIP())
+		}
+	}
+
+	if need["cpu_percent"] || need["memory_percent"] {
+		if device, err := client.DeviceStatus(fetchCtx); err != nil {
+			s.logger.Printf("alerts: device status failed: %v", err)
+		} else {
+			obs.values["cpu_percent"] = device.CPU.CPUUsage.Float64()
+			if device.Memory.Total > 0 {
+				obs.values["memory_percent"] = math.Round(device.Memory.UsedPercent()*10) / 10
+			}
+		}
+	}
+
+	if need["new_device"] {
+		if lan, err := client.LanStatus(fetchCtx); err != nil {
+			s.logger.Printf("alerts: lan status failed: %v", err)
+		} else {
+			obs.devices = map[string]string{}
+			for _, c := range lan.ActiveClients() {
+				if mac := strings.ToLower(strings.TrimSpace(c.MACAddress.String())); mac != "" {
+					obs.devices[mac] = fmt.Sprintf("%s (%s)", valueOr(c.DisplayName(), "unnamed"), c.IPAddress.String())
+				}
+			}
+		}
+	}
+
+	if data.DataExpired > 0 {
+		days := time.Unix(data.DataExpired, 0).Sub(now).Hours() / 24
+		obs.values["data_expires_in_days"] = math.Round(days*10) / 10
+	}
+	return obs
+}
+
+// evaluateAlertRules advances state by one observation and returns the
+// history entries it produced, in rule order.
+func evaluateAlertRules(state *settings.AlertsState, rules []config.AlertRule, obs alertObservation, now time.Time) []settings.AlertEvent {
+	ruleStates := make(map[string]settings.AlertRuleState, len(rules))
+
+	// Event metrics compare against baselines shared by every rule.
+	occurred := map[string]string{}
+	if obs.wanIP != "" {
+		if state.WanIP != "" && state.WanIP != obs.wanIP {
+			occurred["wan_ip_changed"] = fmt.Sprintf("WAN IP changed from %s to %s", state.WanIP, obs.wanIP)
+		}
+		state.WanIP = obs.wanIP
+	}
+	if obs.devices != nil {
+		if state.KnownDevices == nil {
+			// First look at the LAN: everything there is known.
+			state.KnownDevices = map[string]string{}
+			for mac, name := range obs.devices {
+				state.KnownDevices[mac] = name
+			}
+		} else {
+			var joined []string
+			for mac, name := range obs.devices {
+				if _, known := state.KnownDevices[mac]; !known {
+					state.KnownDevices[mac] = name
+					joined = append(joined, fmt.Sprintf("%s [%s]", name, mac))
+				}
+			}
+			if len(joined) > 0 {
+				sort.Strings(joined)
+				occurred["new_device"] = "New device on the LAN: " + strings.Join(joined, ", ")
+			}
+		}
+	}
+
+	var events []settings.AlertEvent
+	emit := func(rule config.AlertRule, st *settings.AlertRuleState, status, message string, notify bool) {
+		if notify {
+			st.LastNotified = now
+		}
+		events = append(events, settings.AlertEvent{
+			Rule:     rule.Name,
+			Metric:   rule.Metric,
+			Status:   status,
+			Message:  message,
+			At:       now.UTC(),
+			Notified: notify,
+		})
+	}
+	cooledDown := func(rule config.AlertRule, st settings.AlertRuleState) bool {
+		cooldown := time.Duration(rule.CooldownMinutes) * time.Minute
+		return st.LastNotified.IsZero() || now.Sub(st.LastNotified) >= cooldown
+	}
+
+	for _, rule := range rules {
+		st, ok := state.Rules[rule.Name]
+		if !ok {
+			st.Status = alertOK
+		}
+
+		if alertMetrics[rule.Metric] == alertEvent {
+			if message, ok := occurred[rule.Metric]; ok {
+				st.FiredAt = now.UTC()
+				emit(rule, &st, alertFiring, message, cooledDown(rule, st))
+			}
+			ruleStates[rule.Name] = st
+			continue
+		}
+
+		value, ok := obs.values[rule.Metric]
+		if !ok {
+			ruleStates[rule.Name] = st
+			continue
+		}
+		holds := value == 1
+		if alertMetrics[rule.Metric] == alertNumeric {
+			holds = alertRuleHolds(rule, value)
+		}
+
+		switch {
+		case holds && st.Status == alertFiring:
+		case holds:
+			if st.Status != alertPending {
+				st.Status = alertPending
+				st.Since = now.UTC()
+			}
+			if now.Sub(st.Since) >= time.Duration(rule.ForMinutes)*time.Minute {
+				st.Status = alertFiring
+				st.FiredAt = now.UTC()
+				st.Notified = cooledDown(rule, st)
+				emit(rule, &st, alertFiring, describeAlert(rule, value), st.Notified)
+			}
+		case st.Status == alertFiring:
+			st.Status = alertResolved
+			st.ResolvedAt = now.UTC()
+			st.Since = time.Time{}
+			emit(rule, &st, alertResolved, describeAlertResolved(rule, value), st.Notified)
+			st.Notified = false
+		case st.Status == alertPending:
+			st.Status = alertOK
+			st.Since = time.Time{}
+		}
+		ruleStates[rule.Name] = st
+	}
+
+	// Dropping the states of removed rules happens here too.
+	state.Rules = ruleStates
+	state.History = append(state.History, events...)
+	if extra := len(state.History) - maxAlertHistory; extra > 0 {
+		state.History = slices.Clone(state.History[extra:])
+	}
+	return events
+}
+
+func describeAlert(rule config.AlertRule, value float64) string {
+	if rule.Metric == "link_down" {
+		return "Cellular link is down"
+	}
+	text := fmt.Sprintf("%s is %s (%s %s)", rule.Metric, formatAlertValue(value), rule.Op, formatAlertValue(rule.Threshold))
+	if rule.ForMinutes > 0 {
+		text += fmt.Sprintf(" for %d min", rule.ForMinutes)
+	}
+	return text
+}
+
+func describeAlertResolved(rule config.AlertRule, value float64) string {
+	if rule.Metric == "link_down" {
+		return "Cellular link is back up"
+	}
+	return fmt.Sprintf("%s is back at %s", rule.Metric, formatAlertValue(value))
+}
+
+func formatAlertValue(v float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.1f", v), "0"), ".")
+}
+
+// sendAlertEvent announces an alert to the notifiers that take alerts. MQTT
+// publishes the event itself to <topic_base>/alert.
+func (s *Server) sendAlertEvent(ctx context.Context, cfg config.Config, event settings.AlertEvent) {
+	title := "Alert: " + event.Rule
+	if event.Status == alertResolved {
+		title = "Resolved: " + event.Rule
+	}
+	notification := newAlertNotification(event.Metric, title, event.Message, event.At)
+	notification.Topic, notification.Details = "alert", event
+	s.notifyAlert(ctx, cfg, notification)
+}
+
+func normalizeAlerts(cfg config.AlertsConfig) config.AlertsConfig {
+	rules := make([]config.AlertRule, 0, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		rule.Name = strings.TrimSpace(rule.Name)
+		rule.Metric = strings.ToLower(strings.TrimSpace(rule.Metric))
+		rule.Op = strings.TrimSpace(rule.Op)
+		rules = append(rules, rule)
+	}
+	cfg.Rules = rules
+	return cfg
+}
+
+func validateAlerts(cfg config.AlertsConfig) error {
+	if cfg.IntervalSeconds < 0 {
+		return errors.New("alerts.interval_seconds must not be negative")
+	}
+	names := map[string]struct{}{}
+	for _, rule := range cfg.Rules {
+		if rule.Name == "" {
+			return errors.New("alerts.rules entries need a name")
+		}
+		if _, dup := names[rule.Name]; dup {
+			return fmt.Errorf("alerts: duplicate rule name %q", rule.Name)
+		}
+		names[rule.Name] = struct{}{}
+		kind, ok := alertMetrics[rule.Metric]
+		if !ok {
+			return fmt.Errorf("alerts %q: unknown metric %q", rule.Name, rule.Metric)
+		}
+		if kind == alertNumeric && !slices.Contains(alertOps, rule.Op) {
+			return fmt.Errorf("alerts %q: op must be one of %s", rule.Name, strings.Join(alertOps, " "))
+		}
+		if rule.ForMinutes < 0 || rule.ForMinutes > 1440 {
+			return fmt.Errorf("alerts %q: for_minutes must be between 0 and 1440", rule.Name)
+		}
+		if rule.CooldownMinutes < 0 || rule.CooldownMinutes > 10080 {
+			return fmt.Errorf("alerts %q: cooldown_minutes must be between 0 and 10080", rule.Name)
+		}
+	}
+	return nil
+}
+
+type alertRuleResponse struct {
+	config.AlertRule
+	settings.AlertRuleState
+	Value *float64 `json:"value,omitempty"`
+}
+
+func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg := s.getConfig().Alerts
+	state := s.store.Get().Alerts
+
+	s.alerts.mu.Lock()
+	values := s.alerts.values
+	evaluatedAt := s.alerts.at
+	s.alerts.mu.Unlock()
+
+	rules := make([]alertRuleResponse, 0, len(cfg.Rules))
+	firing := 0
+	for _, rule := range cfg.Rules {
+		entry := alertRuleResponse{AlertRule: rule, AlertRuleState: state.Rules[rule.Name]}
+		if entry.Status == "" {
+			entry.Status = alertOK
+		}
+		if v, ok := values[rule.Metric]; ok && alertMetrics[rule.Metric] != alertEvent {
+			entry.Value = &v
+		}
+		if entry.Status == alertFiring && alertMetrics[rule.Metric] != alertEvent {
+			firing++
+		}
+		rules = append(rules, entry)
+	}
+
+	history := slices.Clone(state.History)
+	slices.Reverse(history)
+	if history == nil {
+		history = []settings.AlertEvent{}
+	}
+
+	payload := map[string]interface{}{
+		"enabled": cfg.Enabled,
+		"firing":  firing,
+		"rules":   rules,
+		"history": history,
+	}
+	if !evaluatedAt.IsZero() {
+		payload["evaluated_at"] = evaluatedAt.UTC().Format(time.RFC3339)
+	}
+	writeJSON(w, http.StatusOK, payload)
+}
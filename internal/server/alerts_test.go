@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"nokia_modem/internal/config"
+	"nokia_modem/internal/router"
+	"nokia_modem/internal/settings"
+)
+
+func TestEvaluateAlertRulesForDurationAndCooldown(t *testing.T) {
+	rules := []config.AlertRule{
+		{Name: "weak", Metric: "sinr", Op: "<", Threshold: 0, ForMinutes: 10, CooldownMinutes: 60},
+		{Name: "down", Metric: "link_down"},
+	}
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	state := settings.AlertsState{}
+	step := func(minute int, sinr float64, down float64) []settings.AlertEvent {
+		obs := alertObservation{values: map[string]float64{"sinr": sinr, "link_down": down}}
+		return evaluateAlertRules(&state, rules, obs, start.Add(time.Duration(minute)*time.Minute))
+	}
+
+	if events := step(0, -2, 0); len(events) != 0 || state.Rules["weak"].Status != alertPending {
+		t.Fatalf("expected weak to be pending, got %v %+v", events, state.Rules["weak"])
+	}
+	if events := step(5, -1, 0); len(events) != 0 {
+		t.Fatalf("fired before for_minutes: %v", events)
+	}
+	events := step(10, -1, 1)
+	if len(events) != 2 || events[0].Status != alertFiring || !events[0].Notified || events[1].Message != "Cellular link is down" {
+		t.Fatalf("expected both rules to fire, got %+v", events)
+	}
+	if events := step(11, -3, 1); len(events) != 0 {
+		t.Fatalf("firing alerts must not repeat: %v", events)
+	}
+
+	events = step(12, 4, 0)
+	if len(events) != 2 || events[0].Status != alertResolved || !events[0].Notified || state.Rules["weak"].Status != alertResolved {
+		t.Fatalf("expected both rules to resolve, got %+v", events)
+	}
+
+	// Within the cooldown the rule fires again but stays quiet.
+	step(20, -1, 0)
+	events = step(30, -1, 0)
+	if len(events) != 1 || events[0].Notified {
+		t.Fatalf("expected a silent firing inside the cooldown, got %+v", events)
+	}
+	if events = step(31, 1, 0); len(events) != 1 || events[0].Notified {
+		t.Fatalf("a silent firing must resolve silently, got %+v", events)
+	}
+	if len(state.History) != 6 {
+		t.Fatalf("expected 6 history entries, got %d", len(state.History))
+	}
+
+	// A missing metric keeps the state.
+	step(40, -1, 0)
+	evaluateAlertRules(&state, rules, alertObservation{values: map[string]float64{}}, start.Add(45*time.Minute))
+	if state.Rules["weak"].Status != alertPending {
+		t.Fatalf("missing data must not reset the rule: %+v", state.Rules["weak"])
+	}
+}
+
+func TestAlertEventsThroughEmulator(t *testing.T) {
+	srv, emu, httpSrv := newTestServer(t)
+	fake, telegram := newFakeTelegram(t)
+
+	cfg := srv.getConfig()
+	cfg.Telegram = telegram
+	cfg.Telegram.Commands = false
+	cfg.Telegram.Alerts = true
+	cfg.RouterCache.Enabled = false
+	cfg.Alerts = config.AlertsConfig{
+		Rules: []config.AlertRule{
+			{Name: "ip", Metric: "wan_ip_changed"},
+			{Name: "lan", Metric: "new_device"},
+			{Name: "busy", Metric: "cpu_percent", Op: ">", Threshold: 10},
+		},
+	}
+	srv.setConfig(cfg)
+	srv.setClient(router.NewClient(cfg))
+
+	now := time.Now()
+	srv.evaluateAlerts(context.Background(), now)
+	emu.SetExternalIP("203.0.113.77")
+	srv.evaluateAlerts(context.Background(), now.Add(time.Minute))
+
+	var payload struct {
+		Firing  int                   `json:"firing"`
+		Rules   []alertRuleResponse   `json:"rules"`
+		History []settings.AlertEvent `json:"history"`
+	}
+	getJSON(t, httpSrv.URL+"/api/alerts", &payload)
+	if payload.Firing != 1 || payload.Rules[2].Status != alertFiring || payload.Rules[2].Value == nil || *payload.Rules[2].Value != 12 {
+		t.Fatalf("expected the cpu rule to be firing: %+v", payload.Rules)
+	}
+	if len(payload.History) != 2 || payload.History[0].Rule != "ip" || !strings.Contains(payload.History[0].Message, "203.0.113.77") {
+		t.Fatalf("unexpected history (the LAN baseline must not alert): %+v", payload.History)
+	}
+	if sent := fake.sent("sendMessage"); len(sent) != 2 {
+		t.Fatalf("expected two telegram alerts, got %v", sent)
+	}
+
+	if err := validateAlerts(config.AlertsConfig{Rules: []config.AlertRule{{Name: "x", Metric: "sinr"}}}); err == nil {
+		t.Fatalf("expected a numeric rule without op to be rejected")
+	}
+}
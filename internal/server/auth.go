@@ -0,0 +1,804 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"nokia_modem/internal/auth"
+	"nokia_modem/internal/config"
+
+	webtpl "nokia_modem/templates"
+)
+
+const (
+	sessionCookieName  = "nokia_session"
+	csrfHeaderName     = "X-CSRF-Token"
+	loginMaxFailures   = 5
+	loginFailureWindow = 15 * time.Minute
+
+	// adminUser is the login name of auth.password_hash. It always has the
+	// admin scope.
+	adminUser = "admin"
+)
+
+var (
+	errLoginThrottled = errors.New("too many failed login attempts, try again later")
+	errBadPassword    = errors.New("invalid username or password")
+	errNoPassword     = errors.New("no admin password configured")
+	errCrossOrigin    = errors.New("cross-origin request rejected")
+	errTokenNotFound  = errors.New("token not found")
+)
+
+var loginTemplate = template.Must(template.New("login").Parse(string(webtpl.LoginPage())))
+
+// authIdentity describes how a request authenticated. It is attached to the
+// request context by requireScope.
+type authIdentity struct {
+	Method string // "session", "token" or "none" when auth is disabled
+	User   string // login name for sessions
+	Token  string // API token name
+	Scopes []string
+	csrf   string
+}
+
+type authIdentityKey struct{}
+
+func identityFromContext(ctx context.Context) *authIdentity {
+	ident, _ := ctx.Value(authIdentityKey{}).(*authIdentity)
+	return ident
+}
+
+type authSession struct {
+	user    string
+	csrf    string
+	expires time.Time
+}
+
+// authSessions keeps login sessions in memory; a restart signs everyone out.
+type authSessions struct {
+	mu       sync.Mutex
+	sessions map[string]authSession
+	failures map[string][]time.Time
+}
+
+func newAuthSessions() *authSessions {
+	return &authSessions{
+		sessions: map[string]authSession{},
+		failures: map[string][]time.Time{},
+	}
+}
+
+func (a *authSessions) create(user string, ttl time.Duration) (string, authSession, error) {
+	id, err := auth.RandomString(32)
+	if err != nil {
+		return "", authSession{}, err
+	}
+	csrf, err := auth.RandomString(24)
+	if err != nil {
+		return "", authSession{}, err
+	}
+	now := time.Now()
+	sess := authSession{user: user, csrf: csrf, expires: now.Add(ttl)}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, existing := range a.sessions {
+		if now.After(existing.expires) {
+			delete(a.sessions, key)
+		}
+	}
+	a.sessions[id] = sess
+	return id, sess, nil
+}
+
+func (a *authSessions) lookup(id string) (authSession, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	sess, ok := a.sessions[id]
+	if !ok {
+		return authSession{}, false
+	}
+	if time.Now().After(sess.expires) {
+		delete(a.sessions, id)
+		return authSession{}, false
+	}
+	return sess, true
+}
+
+func (a *authSessions) remove(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.sessions, id)
+}
+
+func (a *authSessions) clear() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sessions = map[string]authSession{}
+}
+
+// allowAttempt reports whether client may try another password.
+func (a *authSessions) allowAttempt(client string, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	recent := a.failures[client][:0]
+	for _, at := range a.failures[client] {
+		if now.Sub(at) < loginFailureWindow {
+			recent = append(recent, at)
+		}
+	}
+	if len(recent) == 0 {
+		delete(a.failures, client)
+	} else {
+		a.failures[client] = recent
+	}
+	return len(recent) < loginMaxFailures
+}
+
+func (a *authSessions) recordFailure(client string, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.failures[client] = append(a.failures[client], now)
+}
+
+func (a *authSessions) resetFailures(client string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.failures, client)
+}
+
+func sessionTTL(cfg config.AuthConfig) time.Duration {
+	hours := cfg.SessionTTLHours
+	if hours <= 0 {
+		hours = config.Defaults().Auth.SessionTTLHours
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// userScopes resolves a login name to its scopes. Scopes are looked up on
+// every request, so editing or removing a user takes effect immediately.
+func userScopes(cfg config.AuthConfig, name string) ([]string, bool) {
+	if name == adminUser {
+		return []string{auth.ScopeAdmin}, true
+	}
+	for _, user := range cfg.Users {
+		if user.Name == name {
+			return user.Scopes, true
+		}
+	}
+	return nil, false
+}
+
+// requireScope authenticates the request and lets it through only when the
+// caller holds the scope rt needs for the request method. Public routes still
+// see the identity, if any, so the login page can tell who is signed in.
+func (s *Server) requireScope(rt route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := s.getConfig().Auth
+		if !cfg.Enabled {
+			ident := &authIdentity{Method: "none", Scopes: []string{auth.ScopeAdmin}}
+			rt.handler(w, r.WithContext(context.WithValue(r.Context(), authIdentityKey{}, ident)))
+			return
+		}
+
+		ident, err := s.authenticate(r, cfg)
+		if ident != nil {
+			r = r.WithContext(context.WithValue(r.Context(), authIdentityKey{}, ident))
+		}
+		scope := rt.scope(r.Method)
+		if scope == scopePublic {
+			rt.handler(w, r)
+			return
+		}
+
+		switch {
+		case errors.Is(err, errCrossOrigin):
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+		case ident == nil:
+			s.writeUnauthorized(w, r)
+		case !auth.ScopeGranted(ident.Scopes, scope):
+			writeJSON(w, http.StatusForbidden, map[string]string{
+				"error":          fmt.Sprintf("%s %s requires the %q scope", r.Method, r.URL.Path, scope),
+				"required_scope": scope,
+			})
+		default:
+			rt.handler(w, r)
+		}
+	})
+}
+
+// authenticate resolves a bearer token or session cookie. Cookie sessions
+// must also pass the CSRF check.
+func (s *Server) authenticate(r *http.Request, cfg config.AuthConfig) (*authIdentity, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return nil, nil
+		}
+		token = strings.TrimSpace(token)
+		for _, candidate := range cfg.Tokens {
+			if auth.TokenMatches(candidate.Hash, token) {
+				return &authIdentity{Method: "token", Token: candidate.Name, Scopes: candidate.Scopes}, nil
+			}
+		}
+		return nil, nil
+	}
+
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return nil, nil
+	}
+	sess, ok := s.authSessions.lookup(cookie.Value)
+	if !ok {
+		return nil, nil
+	}
+	scopes, ok := userScopes(cfg, sess.user)
+	if !ok {
+		s.authSessions.remove(cookie.Value)
+		return nil, nil
+	}
+	if !csrfCheckPassed(r, cfg, sess.csrf) {
+		return nil, errCrossOrigin
+	}
+	return &authIdentity{Method: "session", User: sess.user, Scopes: scopes, csrf: sess.csrf}, nil
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// csrfCheckPassed guards cookie-authenticated requests. The session cookie is
+// SameSite=Strict, so browsers do not attach it to cross-site requests; on
+// top of that, state-changing methods must come from this origin, an allowed
+// origin, or carry the session's CSRF token (for non-browser clients).
+func csrfCheckPassed(r *http.Request, cfg config.AuthConfig, token string) bool {
+	if r.Header.Get("Sec-Fetch-Site") == "cross-site" && !originListed(cfg.AllowedOrigins, r.Header.Get("Origin")) {
+		return false
+	}
+	if safeMethod(r.Method) {
+		return true
+	}
+	if header := r.Header.Get(csrfHeaderName); header != "" {
+		return subtle.ConstantTimeCompare([]byte(header), []byte(token)) == 1
+	}
+	return sameOriginRequest(r, cfg.AllowedOrigins)
+}
+
+func sameOriginRequest(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		if ref, err := url.Parse(r.Header.Get("Referer")); err == nil && ref.Host != "" {
+			origin = ref.Scheme + "://" + ref.Host
+		}
+	}
+	if origin == "" || origin == "null" {
+		return r.Header.Get("Sec-Fetch-Site") == "same-origin"
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	// "*" only opens CORS for credential-less requests; it never vouches for
+	// a cookie session.
+	return originListed(allowed, origin)
+}
+
+func originListed(allowed []string, origin string) bool {
+	origin = strings.ToLower(strings.TrimRight(origin, "/"))
+	return slices.Contains(allowed, origin)
+}
+
+func normalizeOrigins(in []string) []string {
+	out := make([]string, 0, len(in))
+	for _, origin := range in {
+		origin = strings.ToLower(strings.TrimRight(strings.TrimSpace(origin), "/"))
+		if origin != "" && !slices.Contains(out, origin) {
+			out = append(out, origin)
+		}
+	}
+	return out
+}
+
+func normalizeScopes(in []string) []string {
+	if in == nil {
+		return nil
+	}
+	out := make([]string, 0, len(in))
+	for _, scope := range in {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if scope != "" && !slices.Contains(out, scope) {
+			out = append(out, scope)
+		}
+	}
+	return out
+}
+
+func validateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !auth.ValidScope(scope) {
+			return fmt.Errorf("unknown scope %q (want %s)", scope, strings.Join(auth.Scopes, ", "))
+		}
+	}
+	return nil
+}
+
+func normalizeAuthUsers(in []config.AuthUser) []config.AuthUser {
+	if in == nil {
+		return nil
+	}
+	out := make([]config.AuthUser, 0, len(in))
+	for _, user := range in {
+		out = append(out, config.AuthUser{
+			Name:         strings.TrimSpace(user.Name),
+			PasswordHash: strings.TrimSpace(user.PasswordHash),
+			Scopes:       normalizeScopes(user.Scopes),
+		})
+	}
+	return out
+}
+
+func normalizeAPITokens(in []config.APIToken) []config.APIToken {
+	if in == nil {
+		return nil
+	}
+	out := make([]config.APIToken, 0, len(in))
+	for _, token := range in {
+		token.Scopes = normalizeScopes(token.Scopes)
+		out = append(out, token)
+	}
+	return out
+}
+
+func (s *Server) writeUnauthorized(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/api/") && r.URL.Path != "/metrics" {
+		http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer realm="nokia"`)
+	writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+}
+
+func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		allowed := s.getConfig().Auth.AllowedOrigins
+		cors := false
+		if origin != "" {
+			switch {
+			case originListed(allowed, origin):
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+				w.Header().Add("Vary", "Origin")
+				cors = true
+			case slices.Contains(allowed, "*"):
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+				cors = true
+			}
+		}
+		if cors {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+csrfHeaderName)
+		}
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loginName maps the optional username field to a login; an empty name
+// means the admin account.
+func loginName(name string) string {
+	if name = strings.TrimSpace(name); name == "" {
+		return adminUser
+	}
+	return name
+}
+
+// checkPassword verifies a user's password with per-client throttling.
+func (s *Server) checkPassword(r *http.Request, cfg config.AuthConfig, user, password string) error {
+	client := clientAddress(r)
+	now := time.Now()
+	if !s.authSessions.allowAttempt(client, now) {
+		return errLoginThrottled
+	}
+	hash := cfg.PasswordHash
+	if user != adminUser {
+		hash = ""
+		for _, candidate := range cfg.Users {
+			if candidate.Name == user {
+				hash = candidate.PasswordHash
+			}
+		}
+	}
+	if hash == "" && user == adminUser {
+		return errNoPassword
+	}
+	// Unknown users still pay for a hash check so response times do not
+	// reveal which names exist.
+	if ok := auth.VerifyPassword(valueOr(hash, cfg.PasswordHash), password); !ok || hash == "" {
+		s.authSessions.recordFailure(client, now)
+		s.logger.Printf("auth: failed login for %q from %s", user, client)
+		return errBadPassword
+	}
+	s.authSessions.resetFailures(client)
+	return nil
+}
+
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, cfg config.AuthConfig, user string) (authSession, error) {
+	ttl := sessionTTL(cfg)
+	id, sess, err := s.authSessions.create(user, ttl)
+	if err != nil {
+		return authSession{}, err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(ttl / time.Second),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return sess, nil
+}
+
+func clearSessionCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func loginErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, errLoginThrottled):
+		return "Too many failed attempts. Try again later."
+	case errors.Is(err, errNoPassword):
+		return "No admin password is configured. Run `nokia-router passwd`."
+	default:
+		return "Invalid username or password."
+	}
+}
+
+func loginStatus(err error) int {
+	if errors.Is(err, errLoginThrottled) {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusUnauthorized
+}
+
+// safeRedirectTarget keeps post-login redirects on this site.
+func safeRedirectTarget(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") || strings.HasPrefix(next, "/login") {
+		return "/"
+	}
+	return next
+}
+
+func (s *Server) handleLoginPage(w http.ResponseWriter, r *http.Request) {
+	cfg := s.getConfig().Auth
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		next := safeRedirectTarget(r.URL.Query().Get("next"))
+		if ident := identityFromContext(r.Context()); !cfg.Enabled || (ident != nil && ident.Method == "session") {
+			http.Redirect(w, r, next, http.StatusSeeOther)
+			return
+		}
+		s.renderLogin(w, http.StatusOK, next, "")
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			s.renderLogin(w, http.StatusBadRequest, "/", "Invalid form submission.")
+			return
+		}
+		next := safeRedirectTarget(r.PostForm.Get("next"))
+		if !sameOriginRequest(r, cfg.AllowedOrigins) {
+			s.renderLogin(w, http.StatusForbidden, next, "Cross-origin login rejected.")
+			return
+		}
+		user := loginName(r.PostForm.Get("username"))
+		if err := s.checkPassword(r, cfg, user, r.PostForm.Get("password")); err != nil {
+			s.renderLogin(w, loginStatus(err), next, loginErrorMessage(err))
+			return
+		}
+		if _, err := s.startSession(w, r, cfg, user); err != nil {
+			s.renderLogin(w, http.StatusInternalServerError, next, "Could not start a session.")
+			return
+		}
+		http.Redirect(w, r, next, http.StatusSeeOther)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) renderLogin(w http.ResponseWriter, status int, next, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := loginTemplate.Execute(w, map[string]string{"Next": next, "Error": message}); err != nil {
+		s.logger.Printf("auth: render login page: %v", err)
+	}
+}
+
+func (s *Server) handleAuthLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg := s.getConfig().Auth
+	if !cfg.Enabled {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "authentication is disabled"})
+		return
+	}
+	if r.Header.Get("Origin") != "" && !sameOriginRequest(r, cfg.AllowedOrigins) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": errCrossOrigin.Error()})
+		return
+	}
+
+	var payload struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON payload"})
+		return
+	}
+	user := loginName(payload.Username)
+	if err := s.checkPassword(r, cfg, user, payload.Password); err != nil {
+		writeJSON(w, loginStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	scopes, _ := userScopes(cfg, user)
+	sess, err := s.startSession(w, r, cfg, user)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "could not start a session"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"authenticated": true,
+		"user":          user,
+		"scopes":        scopes,
+		"csrf_token":    sess.csrf,
+		"expires_at":    sess.expires.UTC().Format(time.RFC3339),
+	})
+}
+
+func (s *Server) handleAuthLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		s.authSessions.remove(cookie.Value)
+	}
+	clearSessionCookie(w, r)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"authenticated": false})
+}
+
+func (s *Server) handleAuthSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg := s.getConfig().Auth
+	resp := map[string]interface{}{
+		"enabled":       cfg.Enabled,
+		"authenticated": !cfg.Enabled,
+	}
+	ident := identityFromContext(r.Context())
+	if ident != nil {
+		resp["scopes"] = ident.Scopes
+	}
+	if ident != nil && ident.Method != "none" {
+		resp["authenticated"] = true
+		resp["method"] = ident.Method
+		if ident.Method == "session" {
+			resp["user"] = ident.User
+			resp["csrf_token"] = ident.csrf
+		} else {
+			resp["token"] = ident.Token
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// updateAuthConfig persists a change to the auth section. Auth changes do
+// not touch the listener or router client, so no reload is triggered.
+func (s *Server) updateAuthConfig(fn func(*config.AuthConfig) error) (config.Config, error) {
+	s.cfgWriteMu.Lock()
+	defer s.cfgWriteMu.Unlock()
+
+	updated := s.getConfig()
+	updated.Auth.Users = slices.Clone(updated.Auth.Users)
+	updated.Auth.Tokens = slices.Clone(updated.Auth.Tokens)
+	if err := fn(&updated.Auth); err != nil {
+		return config.Config{}, err
+	}
+	updated = normalizeConfig(updated)
+	if err := validateConfig(updated); err != nil {
+		return config.Config{}, err
+	}
+	if err := config.Save(s.cfgPath, updated); err != nil {
+		return config.Config{}, err
+	}
+	s.setConfig(updated)
+	return updated, nil
+}
+
+func (s *Server) handleAuthPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var payload struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON payload"})
+		return
+	}
+
+	cfg := s.getConfig().Auth
+	if cfg.PasswordHash != "" {
+		if err := s.checkPassword(r, cfg, adminUser, payload.CurrentPassword); err != nil {
+			writeJSON(w, loginStatus(err), map[string]string{"error": "current password is incorrect"})
+			return
+		}
+	}
+	hash, err := auth.HashPassword(payload.NewPassword)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": strings.TrimPrefix(err.Error(), "auth: ")})
+		return
+	}
+
+	updated, err := s.updateAuthConfig(func(a *config.AuthConfig) error {
+		a.PasswordHash = hash
+		a.Enabled = true
+		return nil
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// Sign out every other browser; keep the caller logged in.
+	s.authSessions.clear()
+	resp := map[string]interface{}{"message": "password updated", "enabled": true}
+	if ident := identityFromContext(r.Context()); ident != nil && ident.Method == "session" {
+		if sess, err := s.startSession(w, r, updated.Auth, ident.User); err == nil {
+			resp["csrf_token"] = sess.csrf
+		}
+	}
+	s.logger.Printf("auth: admin password changed")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type apiTokenInfo struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	CreatedAt string   `json:"created_at"`
+}
+
+func (s *Server) handleAuthTokens(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		tokens := s.getConfig().Auth.Tokens
+		out := make([]apiTokenInfo, 0, len(tokens))
+		for _, token := range tokens {
+			out = append(out, apiTokenInfo{Name: token.Name, Scopes: token.Scopes, CreatedAt: token.CreatedAt})
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"tokens": out})
+	case http.MethodPost:
+		var payload struct {
+			Name   string   `json:"name"`
+			Scopes []string `json:"scopes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON payload"})
+			return
+		}
+		name := strings.TrimSpace(payload.Name)
+		if name == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Missing 'name'"})
+			return
+		}
+		token, digest, err := auth.GenerateToken()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		// New tokens are read-only unless asked otherwise.
+		scopes := normalizeScopes(payload.Scopes)
+		if len(scopes) == 0 {
+			scopes = []string{auth.ScopeRead}
+		}
+		if err := validateScopes(scopes); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		entry := config.APIToken{Name: name, Hash: digest, Scopes: scopes, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+		_, err = s.updateAuthConfig(func(a *config.AuthConfig) error {
+			a.Tokens = append(a.Tokens, entry)
+			return nil
+		})
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		s.logger.Printf("auth: created API token %q", name)
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"name":       entry.Name,
+			"token":      token,
+			"scopes":     entry.Scopes,
+			"created_at": entry.CreatedAt,
+		})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleAuthToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.PathValue("name")
+	_, err := s.updateAuthConfig(func(a *config.AuthConfig) error {
+		before := len(a.Tokens)
+		a.Tokens = slices.DeleteFunc(a.Tokens, func(t config.APIToken) bool { return t.Name == name })
+		if len(a.Tokens) == before {
+			return errTokenNotFound
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errTokenNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	default:
+		s.logger.Printf("auth: revoked API token %q", name)
+		writeJSON(w, http.StatusOK, map[string]string{"message": "token revoked"})
+	}
+}
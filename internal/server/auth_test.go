@@ -0,0 +1,223 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"nokia_modem/internal/auth"
+	"nokia_modem/internal/config"
+)
+
+func enableTestAuth(t *testing.T, srv *Server) {
+	t.Helper()
+	hash, err := auth.HashPasswordIterations("hunter2hunter2", 1000)
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	cfg := srv.getConfig()
+	cfg.Auth.Enabled = true
+	cfg.Auth.PasswordHash = hash
+	cfg.Auth.Users = []config.AuthUser{{Name: "family", PasswordHash: hash, Scopes: []string{auth.ScopeRead}}}
+	cfg.Auth.AllowedOrigins = []string{"https://dash.example"}
+	srv.setConfig(cfg)
+}
+
+func doRequest(t *testing.T, method, url, body string, headers map[string]string) (*http.Response, map[string]interface{}) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	var payload map[string]interface{}
+	_ = json.Unmarshal(data, &payload)
+	return resp, payload
+}
+
+func loginCookie(t *testing.T, base string) (string, string) {
+	t.Helper()
+	resp, payload := doRequest(t, http.MethodPost, base+"/api/auth/login", `{"password":"hunter2hunter2"}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("login failed: %d %v", resp.StatusCode, payload)
+	}
+	for _, c := range resp.Cookies() {
+		if c.Name == sessionCookieName {
+			if c.SameSite != http.SameSiteStrictMode || !c.HttpOnly {
+				t.Fatalf("session cookie must be HttpOnly and SameSite=Strict: %+v", c)
+			}
+			return sessionCookieName + "=" + c.Value, payload["csrf_token"].(string)
+		}
+	}
+	t.Fatalf("no session cookie set")
+	return "", ""
+}
+
+func TestAuthRequiresLogin(t *testing.T) {
+	srv, _, httpSrv := newTestServer(t)
+	enableTestAuth(t, srv)
+
+	if resp, _ := doRequest(t, http.MethodGet, httpSrv.URL+"/api/led_status", "", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", resp.StatusCode)
+	}
+	resp, _ := doRequest(t, http.MethodGet, httpSrv.URL+"/", "", nil)
+	if resp.StatusCode != http.StatusSeeOther || !strings.HasPrefix(resp.Header.Get("Location"), "/login") {
+		t.Fatalf("expected redirect to login, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if resp, _ := doRequest(t, http.MethodGet, httpSrv.URL+"/login", "", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("login page must stay public, got %d", resp.StatusCode)
+	}
+	if resp, _ := doRequest(t, http.MethodPost, httpSrv.URL+"/api/auth/login", `{"password":"nope"}`, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for wrong password, got %d", resp.StatusCode)
+	}
+}
+
+func TestAuthSessionCSRF(t *testing.T) {
+	srv, emu, httpSrv := newTestServer(t)
+	enableTestAuth(t, srv)
+	cookie, csrf := loginCookie(t, httpSrv.URL)
+	url := httpSrv.URL + "/api/led_state"
+
+	if resp, _ := doRequest(t, http.MethodGet, httpSrv.URL+"/api/led_status", "", map[string]string{"Cookie": cookie}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected session GET to pass, got %d", resp.StatusCode)
+	}
+
+	resp, _ := doRequest(t, http.MethodPost, url, `{"enable":false}`, map[string]string{"Cookie": cookie, "Origin": "https://evil.example"})
+	if resp.StatusCode != http.StatusForbidden || !emu.LedEnabled() {
+		t.Fatalf("expected cross-origin POST to be rejected, got %d", resp.StatusCode)
+	}
+	if resp, _ := doRequest(t, http.MethodPost, url, `{"enable":false}`, map[string]string{"Cookie": cookie}); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected POST without origin or token to be rejected, got %d", resp.StatusCode)
+	}
+	if resp, _ := doRequest(t, http.MethodPost, url, `{"enable":false}`, map[string]string{"Cookie": cookie, "Origin": httpSrv.URL}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected same-origin POST to pass, got %d", resp.StatusCode)
+	}
+	if resp, _ := doRequest(t, http.MethodPost, url, `{"enable":true}`, map[string]string{"Cookie": cookie, csrfHeaderName: csrf}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected POST with CSRF token to pass, got %d", resp.StatusCode)
+	}
+}
+
+func TestAuthBearerTokens(t *testing.T) {
+	srv, _, httpSrv := newTestServer(t)
+	enableTestAuth(t, srv)
+	cookie, csrf := loginCookie(t, httpSrv.URL)
+
+	resp, payload := doRequest(t, http.MethodPost, httpSrv.URL+"/api/auth/tokens", `{"name":"ci","scopes":["admin"]}`, map[string]string{"Cookie": cookie, csrfHeaderName: csrf})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create token: %d %v", resp.StatusCode, payload)
+	}
+	token := payload["token"].(string)
+	if stored := srv.getConfig().Auth.Tokens; len(stored) != 1 || strings.Contains(stored[0].Hash, token) {
+		t.Fatalf("expected only the token digest to be stored: %+v", stored)
+	}
+
+	bearer := map[string]string{"Authorization": "Bearer " + token}
+	if resp, _ := doRequest(t, http.MethodPost, httpSrv.URL+"/api/led_state", `{"enable":true}`, bearer); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected bearer POST to pass, got %d", resp.StatusCode)
+	}
+
+	if resp, _ := doRequest(t, http.MethodDelete, httpSrv.URL+"/api/auth/tokens/ci", "", bearer); resp.StatusCode != http.StatusOK {
+		t.Fatalf("revoke token: %d", resp.StatusCode)
+	}
+	if resp, _ := doRequest(t, http.MethodGet, httpSrv.URL+"/api/led_status", "", bearer); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected revoked token to fail, got %d", resp.StatusCode)
+	}
+}
+
+func TestCORSAllowList(t *testing.T) {
+	srv, _, httpSrv := newTestServer(t)
+	enableTestAuth(t, srv)
+
+	resp, _ := doRequest(t, http.MethodOptions, httpSrv.URL+"/api/led_status", "", map[string]string{"Origin": "https://dash.example"})
+	if resp.Header.Get("Access-Control-Allow-Origin") != "https://dash.example" || resp.Header.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("expected allowed origin to be echoed: %v", resp.Header)
+	}
+	resp, _ = doRequest(t, http.MethodOptions, httpSrv.URL+"/api/led_status", "", map[string]string{"Origin": "https://evil.example"})
+	if resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("unexpected CORS header for unknown origin: %v", resp.Header)
+	}
+}
+
+func TestLoginThrottling(t *testing.T) {
+	srv, _, httpSrv := newTestServer(t)
+	enableTestAuth(t, srv)
+
+	for i := 0; i < loginMaxFailures; i++ {
+		doRequest(t, http.MethodPost, httpSrv.URL+"/api/auth/login", `{"password":"wrong"}`, nil)
+	}
+	resp, _ := doRequest(t, http.MethodPost, httpSrv.URL+"/api/auth/login", `{"password":"hunter2hunter2"}`, nil)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 after repeated failures, got %d", resp.StatusCode)
+	}
+}
+
+func TestRoutesAreClassified(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	seen := map[string]bool{}
+	for _, rt := range srv.routes() {
+		if seen[rt.pattern] {
+			t.Errorf("%s registered twice", rt.pattern)
+		}
+		seen[rt.pattern] = true
+		for _, scope := range []string{rt.read, rt.write} {
+			if scope != scopePublic && !auth.ValidScope(scope) {
+				t.Errorf("%s has unknown scope %q", rt.pattern, scope)
+			}
+		}
+		if strings.HasPrefix(rt.pattern, "/api/debug/") && rt.read != auth.ScopeAdmin {
+			t.Errorf("%s must be admin-only", rt.pattern)
+		}
+	}
+}
+
+func TestScopesRestrictReadOnlyUsers(t *testing.T) {
+	srv, emu, httpSrv := newTestServer(t)
+	enableTestAuth(t, srv)
+
+	resp, payload := doRequest(t, http.MethodPost, httpSrv.URL+"/api/auth/login", `{"username":"family","password":"hunter2hunter2"}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("login failed: %d %v", resp.StatusCode, payload)
+	}
+	headers := map[string]string{"Cookie": resp.Cookies()[0].String(), csrfHeaderName: payload["csrf_token"].(string)}
+
+	if resp, _ := doRequest(t, http.MethodGet, httpSrv.URL+"/api/led_status", "", headers); resp.StatusCode != http.StatusOK {
+		t.Fatalf("read-only user must see led_status, got %d", resp.StatusCode)
+	}
+	for _, path := range []string{"/api/led_state?enable=false", "/api/do_reboot", "/api/config"} {
+		resp, payload := doRequest(t, http.MethodPost, httpSrv.URL+path, `{}`, headers)
+		if resp.StatusCode != http.StatusForbidden || payload["required_scope"] == nil {
+			t.Fatalf("POST %s: expected 403 with required_scope, got %d %v", path, resp.StatusCode, payload)
+		}
+	}
+	if resp, _ := doRequest(t, http.MethodGet, httpSrv.URL+"/api/debug/get?endpoint=/", "", headers); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected debug routes to be forbidden, got %d", resp.StatusCode)
+	}
+	if !emu.LedEnabled() || emu.Reboots() != 0 {
+		t.Fatalf("forbidden requests reached the router")
+	}
+
+	// Tokens default to read-only.
+	admin, csrf := loginCookie(t, httpSrv.URL)
+	_, created := doRequest(t, http.MethodPost, httpSrv.URL+"/api/auth/tokens", `{"name":"kiosk"}`, map[string]string{"Cookie": admin, csrfHeaderName: csrf})
+	bearer := map[string]string{"Authorization": "Bearer " + created["token"].(string)}
+	if resp, _ := doRequest(t, http.MethodPost, httpSrv.URL+"/api/led_state?enable=false", "", bearer); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected read-only token to be forbidden, got %d", resp.StatusCode)
+	}
+	if resp, _ := doRequest(t, http.MethodGet, httpSrv.URL+"/api/led_state", "", bearer); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected read-only token to read led_state, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,350 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"nokia_modem/internal/config"
+	"nokia_modem/internal/settings"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	mqttCommandTopic       = "cmd"
+	mqttCommandResultTopic = "cmd/result"
+)
+
+var errUnknownCommand = errors.New("unknown command")
+
+// mqttCommandNames lists the commands executeCommand understands, for
+// validating the MQTT allow-list and schedules.
+var mqttCommandNames = []string{"reboot", "led", "apn", "sms_read", "sms_delete", "sms_send", "wan_renew", "data_expired", "data_expiry_bump"}
+
+// commandArgs holds the parameters of a remote command. Plain-text payloads
+// are stored under "value".
+type commandArgs map[string]interface{}
+
+func (a commandArgs) str(keys ...string) string {
+	for _, key := range keys {
+		switch v := a[key].(type) {
+		case string:
+			if trimmed := strings.TrimSpace(v); trimmed != "" {
+				return trimmed
+			}
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			return strconv.FormatBool(v)
+		}
+	}
+	return ""
+}
+
+func (a commandArgs) boolean(fallback bool, keys ...string) (bool, error) {
+	for _, key := range keys {
+		switch v := a[key].(type) {
+		case bool:
+			return v, nil
+		case float64:
+			return v != 0, nil
+		case string:
+			switch strings.ToLower(strings.TrimSpace(v)) {
+			case "1", "true", "on", "yes", "enable":
+				return true, nil
+			case "0", "false", "off", "no", "disable":
+				return false, nil
+			case "":
+				continue
+			default:
+				return fallback, fmt.Errorf("invalid %s value %q", key, v)
+			}
+		}
+	}
+	return fallback, nil
+}
+
+func (a commandArgs) integer(keys ...string) (int, error) {
+	raw := a.str(keys...)
+	if raw == "" {
+		return 0, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value %q", keys[0], raw)
+	}
+	return value, nil
+}
+
+func (a commandArgs) list(keys ...string) []string {
+	for _, key := range keys {
+		switch v := a[key].(type) {
+		case []interface{}:
+			out := make([]string, 0, len(v))
+			for _, item := range v {
+				if text := strings.TrimSpace(fmt.Sprint(item)); text != "" {
+					out = append(out, text)
+				}
+			}
+			if len(out) > 0 {
+				return out
+			}
+		case string:
+			if ids := splitAndCleanIDs(v); len(ids) > 0 {
+				return ids
+			}
+		case float64:
+			return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+		}
+	}
+	return nil
+}
+
+// commandResult is published to <base>/cmd/result after every command.
+type commandResult struct {
+	ID          string      `json:"id"`
+	Command     string      `json:"command"`
+	Success     bool        `json:"success"`
+	Error       string      `json:"error,omitempty"`
+	Response    interface{} `json:"response,omitempty"`
+	Source      string      `json:"source"`
+	CompletedAt string      `json:"completed_at"`
+}
+
+// validateCommandArgs checks the arguments of the named command without
+// running it. executeCommand checks them first, and schedules are checked
+// when saved rather than failing at their first run.
+func validateCommandArgs(name string, args commandArgs) error {
+	switch name {
+	case "led":
+		if _, err := args.boolean(true, "enable", "value"); err != nil {
+			return err
+		}
+		if args.str("enable", "value") == "" {
+			return errors.New("led: 'enable' is required")
+		}
+	case "apn":
+		if args.str("apn", "value") == "" {
+			return errors.New("apn: 'apn' is required")
+		}
+	case "sms_read":
+		if args.str("sms_id", "value") == "" {
+			return errors.New("sms_read: 'sms_id' is required")
+		}
+		if _, err := args.boolean(false, "unread"); err != nil {
+			return err
+		}
+	case "sms_delete":
+		all, err := args.boolean(false, "all")
+		if err != nil {
+			return err
+		}
+		if !all && len(args.list("sms_ids", "value")) == 0 {
+			return errors.New("sms_delete: 'sms_ids' or 'all' is required")
+		}
+	case "sms_send":
+		if args.str("to", "number") == "" || args.str("text", "message") == "" {
+			return errors.New("sms_send: 'to' and 'text' are required")
+		}
+	case "data_expired":
+		raw := args.str("data_expired", "timestamp", "value")
+		if timestamp, err := strconv.ParseInt(raw, 10, 64); err != nil || timestamp <= 0 {
+			return fmt.Errorf("data_expired: invalid timestamp %q", raw)
+		}
+	case "data_expiry_bump":
+		months, err := args.integer("months")
+		if err != nil {
+			return err
+		}
+		days, err := args.integer("days")
+		if err != nil {
+			return err
+		}
+		if months < 0 || days < 0 {
+			return errors.New("data_expiry_bump: 'months' and 'days' must not be negative")
+		}
+	}
+	return nil
+}
+
+// executeCommand runs a named remote command. MQTT and the chat bots share
+// it, so each integration only deals with parsing and permissions. source
+// names the integration for jobs that outlive the call.
+func (s *Server) executeCommand(ctx context.Context, source, name string, args commandArgs) (interface{}, error) {
+	if err := validateCommandArgs(name, args); err != nil {
+		return nil, err
+	}
+	client := s.getClient()
+
+	switch name {
+	case "reboot":
+		return client.Reboot(ctx)
+	case "led":
+		enable, _ := args.boolean(true, "enable", "value")
+		return client.LedState(ctx, enable)
+	case "apn":
+		apn := args.str("apn", "value")
+		result, err := client.PostSetAPN(ctx, apn)
+		if err != nil {
+			return nil, err
+		}
+		s.rememberAPN(apn)
+		return result, nil
+	case "sms_read":
+		unread, _ := args.boolean(false, "unread")
+		return client.SetSmsState(ctx, args.str("sms_id", "value"), strconv.FormatBool(unread))
+	case "sms_delete":
+		all, _ := args.boolean(false, "all")
+		return client.DeleteSms(ctx, args.list("sms_ids", "value"), all)
+	case "sms_send":
+		return s.sendSms(ctx, args.str("to", "number"), args.str("text", "message"))
+	case "wan_renew":
+		return s.awaitWanRenew(ctx, source)
+	case "data_expired":
+		timestamp, _ := strconv.ParseInt(args.str("data_expired", "timestamp", "value"), 10, 64)
+		if err := s.store.SetDataExpired(timestamp); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"data_expired": timestamp}, nil
+	case "data_expiry_bump":
+		months, _ := args.integer("months")
+		days, _ := args.integer("days")
+		if months == 0 && days == 0 {
+			months = 1
+		}
+		var timestamp int64
+		err := s.store.Update(func(data *settings.Settings) error {
+			// Extend a package that is still running; start a lapsed one
+			// from now.
+			base := time.Now()
+			if expiry := time.Unix(data.DataExpired, 0); data.DataExpired > 0 && expiry.After(base) {
+				base = expiry
+			}
+			timestamp = base.AddDate(0, months, days).Unix()
+			data.DataExpired = timestamp
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"data_expired": timestamp}, nil
+	default:
+		return nil, fmt.Errorf("%w %q", errUnknownCommand, name)
+	}
+}
+
+// commandTimeout bounds a single command; WAN renewal waits for the whole
+// job and a long SMS for every segment.
+func (s *Server) commandTimeout(name string) time.Duration {
+	switch name {
+	case "wan_renew":
+		return wanRenewDeadline(s.getConfig().WanRenew) + 10*time.Second
+	case "sms_send":
+		return 60 * time.Second
+	}
+	return 20 * time.Second
+}
+
+func mqttCommandAllowed(cfg config.MQTTConfig, name string) bool {
+	for _, allowed := range cfg.AllowedCommands {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == "*" || strings.EqualFold(allowed, name) {
+			return true
+		}
+	}
+	return false
+}
+
+var commandSeq atomic.Uint64
+
+func newCommandID() string {
+	return fmt.Sprintf("%d-%d", time.Now().UnixMilli(), commandSeq.Add(1))
+}
+
+// parseMqttCommand decodes a command payload. JSON objects carry arguments
+// (and optionally "id" and "command"); anything else is a plain value.
+func parseMqttCommand(name string, payload []byte) (string, string, commandArgs) {
+	args := commandArgs{}
+	trimmed := strings.TrimSpace(string(payload))
+	if strings.HasPrefix(trimmed, "{") {
+		if err := json.Unmarshal([]byte(trimmed), &args); err != nil {
+			args = commandArgs{"value": trimmed}
+		}
+	} else if trimmed != "" {
+		args["value"] = trimmed
+	}
+
+	if name == "" {
+		name = args.str("command")
+	}
+	id := args.str("id", "request_id")
+	if id == "" {
+		id = newCommandID()
+	}
+	return strings.ToLower(strings.TrimSpace(name)), id, args
+}
+
+func (s *Server) subscribeMqttCommands(client mqtt.Client, base string) {
+	prefix := joinMqttTopic(base, mqttCommandTopic)
+	topic := prefix + "/#"
+	token := client.Subscribe(topic, 1, func(c mqtt.Client, msg mqtt.Message) {
+		if msg.Retained() {
+			s.logger.Printf("mqtt cmd: ignored retained payload from %s", msg.Topic())
+			return
+		}
+		name := strings.Trim(strings.TrimPrefix(msg.Topic(), prefix), "/")
+		if name == "result" {
+			return
+		}
+		payload := append([]byte(nil), msg.Payload()...)
+		go s.dispatchMqttCommand(msg.Topic(), name, payload)
+	})
+	if err := waitMqttToken(token); err != nil {
+		s.logger.Printf("mqtt: subscribe %s failed: %v", topic, err)
+		return
+	}
+	s.logger.Printf("mqtt: subscribed to %s", topic)
+}
+
+// dispatchMqttCommand checks the allow-list, runs the command and publishes
+// a correlated result. Used for both <base>/cmd/# and the Home Assistant
+// <base>/set/+ topics.
+func (s *Server) dispatchMqttCommand(topic, name string, payload []byte) {
+	name, id, args := parseMqttCommand(name, payload)
+	result := commandResult{ID: id, Command: name, Source: "mqtt"}
+
+	cfg := s.getConfig()
+	switch {
+	case name == "":
+		result.Error = "missing command"
+	case !mqttCommandAllowed(cfg.MQTT, name):
+		result.Error = fmt.Sprintf("command %q is not allowed", name)
+	default:
+		ctx, cancel := context.WithTimeout(context.Background(), s.commandTimeout(name))
+		response, err := s.executeCommand(ctx, "mqtt", name, args)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Success = true
+			result.Response = response
+		}
+		if name == "led" || name == "apn" {
+			s.publishHAState(ctx, nil)
+		}
+		cancel()
+	}
+
+	result.CompletedAt = time.Now().UTC().Format(time.RFC3339)
+	if result.Success {
+		s.logger.Printf("mqtt cmd: %s (%s) from %s succeeded", name, id, topic)
+	} else {
+		s.logger.Printf("mqtt cmd: %s (%s) from %s failed: %s", name, id, topic, result.Error)
+	}
+	s.publishMqttSafe(mqttCommandResultTopic, result)
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"nokia_modem/internal/config"
+)
+
+func TestParseMqttCommand(t *testing.T) {
+	name, id, args := parseMqttCommand("", []byte(`{"command":"LED","id":"abc","enable":false}`))
+	if name != "led" || id != "abc" {
+		t.Fatalf("unexpected name/id: %q %q", name, id)
+	}
+	if enable, err := args.boolean(true, "enable", "value"); err != nil || enable {
+		t.Fatalf("expected enable=false, got %v (%v)", enable, err)
+	}
+
+	name, id, args = parseMqttCommand("reboot", []byte("PRESS"))
+	if name != "reboot" || id == "" || args.str("value") != "PRESS" {
+		t.Fatalf("unexpected plain command: %q %q %v", name, id, args)
+	}
+
+	_, _, args = parseMqttCommand("sms_delete", []byte(`{"sms_ids":[3,"4"]}`))
+	if ids := args.list("sms_ids", "value"); len(ids) != 2 || ids[0] != "3" || ids[1] != "4" {
+		t.Fatalf("unexpected ids: %v", ids)
+	}
+}
+
+func TestMqttCommandAllowed(t *testing.T) {
+	cfg := config.Defaults().MQTT
+	if !mqttCommandAllowed(cfg, "reboot") || mqttCommandAllowed(cfg, "sms_delete") {
+		t.Fatalf("unexpected default allow-list: %v", cfg.AllowedCommands)
+	}
+	cfg.AllowedCommands = []string{"*"}
+	if !mqttCommandAllowed(cfg, "wan_renew") {
+		t.Fatalf("expected wildcard to allow wan_renew")
+	}
+	cfg.AllowedCommands = []string{}
+	if mqttCommandAllowed(cfg, "led") {
+		t.Fatalf("expected empty allow-list to reject everything")
+	}
+}
+
+func TestExecuteCommand(t *testing.T) {
+	srv, emu, _ := newTestServer(t)
+	ctx := context.Background()
+
+	if _, err := srv.executeCommand(ctx, "test", "led", commandArgs{"value": "OFF"}); err != nil {
+		t.Fatalf("led: %v", err)
+	}
+	if emu.LedEnabled() {
+		t.Fatalf("expected LEDs to be switched off")
+	}
+
+	id := emu.AddSms("+620001", "hello", time.Now())
+	emu.AddSms("+620002", "world", time.Now())
+	if _, err := srv.executeCommand(ctx, "test", "sms_delete", commandArgs{"sms_ids": []interface{}{id}}); err != nil {
+		t.Fatalf("sms_delete: %v", err)
+	}
+	if remaining := emu.Sms(); len(remaining) != 1 {
+		t.Fatalf("unexpected inbox: %+v", remaining)
+	}
+
+	if _, err := srv.executeCommand(ctx, "test", "data_expired", commandArgs{"value": "1767225600"}); err != nil {
+		t.Fatalf("data_expired: %v", err)
+	}
+	if got := srv.store.Get().DataExpired; got != 1767225600 {
+		t.Fatalf("unexpected data_expired: %d", got)
+	}
+
+	if _, err := srv.executeCommand(ctx, "test", "format_disk", nil); !errors.Is(err, errUnknownCommand) {
+		t.Fatalf("expected errUnknownCommand, got %v", err)
+	}
+}
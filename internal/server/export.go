@@ -0,0 +1,301 @@
+package server
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"nokia_modem/internal/settings"
+)
+
+// parseExportRange reads the optional 'from' and 'to' filters. Besides the
+// formats /api/signal_history takes, plain dates (YYYY-MM-DD, local time)
+// are accepted. A zero time leaves that side of the range open.
+func parseExportRange(query url.Values) (time.Time, time.Time, error) {
+	parse := func(name string) (time.Time, error) {
+		raw := strings.TrimSpace(query.Get(name))
+		if raw == "" {
+			return time.Time{}, nil
+		}
+		if day, err := time.ParseInLocation(settings.DayLayout, raw, time.Local); err == nil {
+			return day, nil
+		}
+		parsed, err := parseHistoryTime(raw)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid '%s' value", name)
+		}
+		return parsed, nil
+	}
+	from, err := parse("from")
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := parse("to")
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("'from' must be before 'to'")
+	}
+	return from, to, nil
+}
+
+func inExportRange(t, from, to time.Time) bool {
+	if from.IsZero() && to.IsZero() {
+		return true
+	}
+	if t.IsZero() {
+		return false
+	}
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+}
+
+func setExportHeaders(w http.ResponseWriter, contentType, filename string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+func (s *Server) handleExportUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	format := strings.ToLower(strings.TrimSpace(query.Get("format")))
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "format must be csv or json"})
+		return
+	}
+	granularity := strings.ToLower(strings.TrimSpace(query.Get("granularity")))
+	if granularity == "" {
+		granularity = settings.GranularityDay
+	}
+	from, to, err := parseExportRange(query)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	buckets, err := s.store.Get().Usage(granularity, from, to)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	filename := "usage-" + granularity + "." + format
+	switch format {
+	case "csv":
+		setExportHeaders(w, "text/csv; charset=utf-8", filename)
+		out := csv.NewWriter(w)
+		_ = out.Write([]string{granularity, "start", "upload_bytes", "download_bytes", "total_bytes"})
+		for _, bucket := range buckets {
+			_ = out.Write([]string{
+				bucket.Key,
+				bucket.Start.Format(time.RFC3339),
+				strconv.FormatInt(bucket.Upload, 10),
+				strconv.FormatInt(bucket.Download, 10),
+				strconv.FormatInt(bucket.Upload+bucket.Download, 10),
+			})
+		}
+		out.Flush()
+		err = out.Error()
+	case "json":
+		setExportHeaders(w, "application/json", filename)
+		err = writeJSONArray(w, len(buckets), func(i int) interface{} {
+			bucket := buckets[i]
+			return usageBucketResponse{
+				Key:      bucket.Key,
+				Start:    bucket.Start.Format(time.RFC3339),
+				Upload:   bucket.Upload,
+				Download: bucket.Download,
+				Total:    bucket.Upload + bucket.Download,
+			}
+		})
+	}
+	if err != nil {
+		s.logger.Printf("export: usage %s failed: %v", format, err)
+	}
+}
+
+// writeJSONArray encodes n items as a JSON array one element at a time.
+func writeJSONArray(w io.Writer, n int, item func(int) interface{}) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		data, err := json.Marshal(item(i))
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "]\n")
+	return err
+}
+
+type smsExportRecord struct {
+	ID      string `json:"id"`
+	Hash    string `json:"hash"`
+	Sender  string `json:"sender"`
+	Time    string `json:"time"`
+	RawTime string `json:"raw_time"`
+	Unread  bool   `json:"unread"`
+	Content string `json:"content"`
+	// DeletedOnRouter marks messages only the archive still has.
+	DeletedOnRouter bool   `json:"deleted_on_router"`
+	Direction       string `json:"direction"`
+	Recipient       string `json:"recipient,omitempty"`
+}
+
+func newSmsExportRecord(msg smsMessage) smsExportRecord {
+	record := smsExportRecord{
+		ID:      msg.SMSID,
+		Hash:    msg.SMSHash,
+		Sender:  strings.TrimSpace(msg.SMSSender),
+		RawTime: msg.SMSDateTime,
+		Unread:  msg.SMSUnread,
+		Content: msg.SMSContent,
+
+		DeletedOnRouter: msg.DeletedOnRouter,
+		Direction:       msg.direction(),
+		Recipient:       msg.Recipient,
+	}
+	if !msg.parsedTime.IsZero() {
+		record.Time = msg.parsedTime.Format(time.RFC3339)
+	}
+	return record
+}
+
+// smsExportTypes maps each SMS export format to its content type.
+var smsExportTypes = map[string]string{
+	"csv":    "text/csv; charset=utf-8",
+	"ndjson": "application/x-ndjson",
+	"mbox":   "application/mbox",
+}
+
+// newSmsExporter returns a func writing one message in format and a func
+// flushing whatever the format buffers.
+func newSmsExporter(format string, w io.Writer) (func(smsMessage) error, func() error) {
+	switch format {
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		return func(msg smsMessage) error {
+			return enc.Encode(newSmsExportRecord(msg))
+		}, func() error { return nil }
+	case "mbox":
+		out := bufio.NewWriter(w)
+		return func(msg smsMessage) error {
+			return writeMboxMessage(out, newSmsExportRecord(msg), msg.parsedTime)
+		}, out.Flush
+	default:
+		out := csv.NewWriter(w)
+		_ = out.Write([]string{"id", "hash", "sender", "time", "raw_time", "unread", "content", "deleted_on_router", "direction", "recipient"})
+		write := func(msg smsMessage) error {
+			rec := newSmsExportRecord(msg)
+			return out.Write([]string{rec.ID, rec.Hash, rec.Sender, rec.Time, rec.RawTime, strconv.FormatBool(rec.Unread), rec.Content, strconv.FormatBool(rec.DeletedOnRouter), rec.Direction, rec.Recipient})
+		}
+		finish := func() error {
+			out.Flush()
+			return out.Error()
+		}
+		return write, finish
+	}
+}
+
+// writeMboxMessage writes rec as one mboxrd entry, so the export opens in a
+// regular mail client.
+func writeMboxMessage(w *bufio.Writer, rec smsExportRecord, t time.Time) error {
+	sender := rec.Sender
+	subject := "SMS from " + sender
+	if rec.Direction == smsDirectionSent {
+		sender = "gateway"
+		subject = "SMS to " + rec.Recipient
+	}
+	if sender == "" {
+		sender = "unknown"
+		subject = "SMS from unknown"
+	}
+	envelope := strings.Join(strings.Fields(sender), "_")
+	if t.IsZero() {
+		t = time.Unix(0, 0).UTC()
+	}
+
+	fmt.Fprintf(w, "From %s %s\n", envelope, t.Format(time.ANSIC))
+	fmt.Fprintf(w, "From: %s\n", sender)
+	if rec.Recipient != "" {
+		fmt.Fprintf(w, "To: %s\n", rec.Recipient)
+	}
+	fmt.Fprintf(w, "Date: %s\n", t.Format(time.RFC1123Z))
+	fmt.Fprintf(w, "Subject: %s\n", subject)
+	fmt.Fprintf(w, "X-SMS-ID: %s\n", rec.ID)
+	fmt.Fprintf(w, "X-SMS-Hash: %s\n", rec.Hash)
+	fmt.Fprintf(w, "Content-Type: text/plain; charset=utf-8\n\n")
+	for _, line := range strings.Split(strings.ReplaceAll(rec.Content, "\r\n", "\n"), "\n") {
+		// mboxrd: quote every line that would read as a separator.
+		if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+			line = ">" + line
+		}
+		fmt.Fprintln(w, line)
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+func (s *Server) handleExportSms(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	format := strings.ToLower(strings.TrimSpace(query.Get("format")))
+	if format == "" {
+		format = "csv"
+	}
+	contentType, ok := smsExportTypes[format]
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "format must be csv, ndjson or mbox"})
+		return
+	}
+	from, to, err := parseExportRange(query)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	setExportHeaders(w, contentType, "sms."+format)
+	write, finish := newSmsExporter(format, w)
+	err = s.smsArchive.Each(func(msg smsMessage) error {
+		if r.Context().Err() != nil {
+			return r.Context().Err()
+		}
+		if !inExportRange(msg.parsedTime, from, to) {
+			return nil
+		}
+		return write(msg)
+	})
+	if finishErr := finish(); err == nil {
+		err = finishErr
+	}
+	if err != nil {
+		s.logger.Printf("export: sms %s failed: %v", format, err)
+	}
+}
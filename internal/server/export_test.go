@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"nokia_modem/internal/settings"
+)
+
+func TestExportSmsFormats(t *testing.T) {
+	srv, _, httpSrv := newTestServer(t)
+
+	messages := []smsMessage{
+		{SMSID: "1", SMSSender: "+100", SMSDateTime: "2026-01-10 08:00:00", SMSContent: "old"},
+		{SMSID: "2", SMSSender: "Bank Alerts", SMSDateTime: "2026-02-10 09:30:00", SMSContent: "line one\nFrom here on"},
+		{SMSID: "3", SMSSender: "+300", SMSDateTime: "2026-03-10 10:00:00", SMSContent: "new"},
+	}
+	if _, _, err := srv.smsArchive.Sync(messages, nil, false); err != nil {
+		t.Fatalf("seed archive: %v", err)
+	}
+
+	get := func(query string) (*http.Response, string) {
+		t.Helper()
+		resp, err := http.Get(httpSrv.URL + "/api/export/sms?" + query)
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, body := get("format=ndjson&from=2026-02-01&to=2026-03-01")
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	var ids []string
+	for scanner.Scan() {
+		var rec smsExportRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("decode %q: %v", scanner.Text(), err)
+		}
+		ids = append(ids, rec.ID)
+	}
+	if len(ids) != 1 || ids[0] != "2" {
+		t.Fatalf("expected only message 2 in range, got %v", ids)
+	}
+
+	_, body = get("format=mbox&from=2026-02-01&to=2026-03-01")
+	if !strings.HasPrefix(body, "From Bank_Alerts Tue Feb 10 09:30:00 2026\n") {
+		t.Fatalf("unexpected mbox separator:\n%s", body)
+	}
+	if !strings.Contains(body, "\n>From here on\n") {
+		t.Fatalf("body line starting with From must be quoted:\n%s", body)
+	}
+
+	_, body = get("format=csv")
+	if lines := strings.Count(body, "\n"); lines != 5 {
+		t.Fatalf("expected a header and 3 records (one spanning two lines), got %d lines:\n%s", lines, body)
+	}
+
+	if resp, _ := get("format=xml"); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown format, got %d", resp.StatusCode)
+	}
+}
+
+func TestExportUsageCSV(t *testing.T) {
+	srv, _, httpSrv := newTestServer(t)
+	if err := srv.store.Update(func(data *settings.Settings) error {
+		data.DailyUsage = map[string]settings.UsageStats{
+			"2026-01-31": {Upload: 1, Download: 2},
+			"2026-02-01": {Upload: 10, Download: 20},
+			"2026-02-02": {Upload: 100, Download: 200},
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("seed usage: %v", err)
+	}
+
+	resp, err := http.Get(httpSrv.URL + "/api/export/usage?format=csv&from=2026-02-01")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if len(lines) != 3 || lines[0] != "day,start,upload_bytes,download_bytes,total_bytes" {
+		t.Fatalf("unexpected csv:\n%s", body)
+	}
+	if !strings.HasPrefix(lines[1], "2026-02-01,") || !strings.HasSuffix(lines[1], ",10,20,30") {
+		t.Fatalf("unexpected first row %q", lines[1])
+	}
+	if cd := resp.Header.Get("Content-Disposition"); !strings.Contains(cd, "usage-day.csv") {
+		t.Fatalf("unexpected Content-Disposition %q", cd)
+	}
+}
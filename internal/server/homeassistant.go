@@ -0,0 +1,323 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"nokia_modem/internal/config"
+	"nokia_modem/internal/router"
+	"nokia_modem/internal/settings"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	mqttAvailabilityTopic = "availability"
+	mqttStateTopic        = "state"
+	mqttSetTopic          = "set"
+	mqttPayloadOnline     = "online"
+	mqttPayloadOffline    = "offline"
+)
+
+// haEntity describes one Home Assistant entity announced through MQTT
+// discovery. Every entity reads the flattened <base>/state document; those
+// with a command go to <base>/set/<Command>.
+type haEntity struct {
+	Component   string
+	ObjectID    string
+	Name        string
+	Field       string
+	DeviceClass string
+	StateClass  string
+	Unit        string
+	Icon        string
+	Category    string
+	Command     string
+}
+
+var haEntities = []haEntity{
+	{Component: "sensor", ObjectID: "rsrp", Name: "RSRP", Field: "rsrp", DeviceClass: "signal_strength", StateClass: "measurement", Unit: "dBm"},
+	{Component: "sensor", ObjectID: "rsrq", Name: "RSRQ", Field: "rsrq", StateClass: "measurement", Unit: "dB", Icon: "mdi:signal"},
+	{Component: "sensor", ObjectID: "sinr", Name: "SINR", Field: "sinr", StateClass: "measurement", Unit: "dB", Icon: "mdi:signal"},
+	{Component: "sensor", ObjectID: "rssi", Name: "RSSI", Field: "rssi", DeviceClass: "signal_strength", StateClass: "measurement", Unit: "dBm"},
+	{Component: "sensor", ObjectID: "network_type", Name: "Network type", Field: "rat", Icon: "mdi:radio-tower"},
+	{Component: "sensor", ObjectID: "band", Name: "Band", Field: "band", Icon: "mdi:radio-tower"},
+	{Component: "sensor", ObjectID: "pci", Name: "Physical cell ID", Field: "pci", Icon: "mdi:radio-tower", Category: "diagnostic"},
+	{Component: "sensor", ObjectID: "usage_upload_today", Name: "Upload today", Field: "usage_upload_today", DeviceClass: "data_size", StateClass: "total_increasing", Unit: "B"},
+	{Component: "sensor", ObjectID: "usage_download_today", Name: "Download today", Field: "usage_download_today", DeviceClass: "data_size", StateClass: "total_increasing", Unit: "B"},
+	{Component: "sensor", ObjectID: "usage_total_today", Name: "Usage today", Field: "usage_total_today", DeviceClass: "data_size", StateClass: "total_increasing", Unit: "B"},
+	{Component: "sensor", ObjectID: "data_expiry", Name: "Data expiry", Field: "data_expired", DeviceClass: "timestamp"},
+	{Component: "sensor", ObjectID: "uptime", Name: "Uptime", Field: "uptime", DeviceClass: "duration", Unit: "s", Category: "diagnostic"},
+	{Component: "sensor", ObjectID: "wan_ip", Name: "WAN IP", Field: "wan_ip", Icon: "mdi:ip-network"},
+	{Component: "binary_sensor", ObjectID: "led", Name: "LEDs", Field: "led", Icon: "mdi:led-on"},
+	{Component: "binary_sensor", ObjectID: "wifi_24g", Name: "Wi-Fi 2.4 GHz", Field: "wifi_24g", Icon: "mdi:wifi"},
+	{Component: "binary_sensor", ObjectID: "wifi_5g", Name: "Wi-Fi 5 GHz", Field: "wifi_5g", Icon: "mdi:wifi"},
+	{Component: "switch", ObjectID: "led_switch", Name: "LEDs", Field: "led", Icon: "mdi:led-on", Command: "led"},
+	{Component: "select", ObjectID: "apn", Name: "APN", Field: "apn", Icon: "mdi:access-point-network", Command: "apn"},
+	{Component: "button", ObjectID: "reboot", Name: "Reboot", DeviceClass: "restart", Command: "reboot"},
+}
+
+// haNodeID derives a stable discovery node id from the MQTT topic base.
+func haNodeID(base string) string {
+	var b strings.Builder
+	b.WriteString("nokia")
+	for _, r := range strings.ToLower(base) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return strings.Trim(b.String(), "_")
+}
+
+func haDiscoveryPrefix(cfg config.MQTTConfig) string {
+	prefix := strings.Trim(strings.TrimSpace(cfg.DiscoveryPrefix), "/")
+	if prefix == "" {
+		prefix = "homeassistant"
+	}
+	return prefix
+}
+
+func haDiscoveryTopic(prefix, nodeID string, entity haEntity) string {
+	return fmt.Sprintf("%s/%s/%s/%s/config", prefix, entity.Component, nodeID, entity.ObjectID)
+}
+
+func joinMqttTopic(base, segment string) string {
+	base = strings.Trim(base, "/")
+	segment = strings.Trim(segment, "/")
+	switch {
+	case base == "":
+		return segment
+	case segment == "":
+		return base
+	default:
+		return base + "/" + segment
+	}
+}
+
+func buildHADiscoveryPayload(entity haEntity, cfg config.MQTTConfig, base, nodeID string) map[string]interface{} {
+	payload := map[string]interface{}{
+		"name":                  entity.Name,
+		"unique_id":             nodeID + "_" + entity.ObjectID,
+		"object_id":             nodeID + "_" + entity.ObjectID,
+		"availability_topic":    joinMqttTopic(base, mqttAvailabilityTopic),
+		"payload_available":     mqttPayloadOnline,
+		"payload_not_available": mqttPayloadOffline,
+		"device": map[string]interface{}{
+			"identifiers":  []string{nodeID},
+			"name":         "Nokia FastMile",
+			"manufacturer": "Nokia",
+			"model":        "FastMile 5G Gateway",
+		},
+	}
+	if entity.Field != "" {
+		payload["state_topic"] = joinMqttTopic(base, mqttStateTopic)
+		payload["value_template"] = fmt.Sprintf("{{ value_json.%s }}", entity.Field)
+	}
+	if entity.Command != "" {
+		payload["command_topic"] = joinMqttTopic(base, mqttSetTopic+"/"+entity.Command)
+	}
+	if entity.DeviceClass != "" {
+		payload["device_class"] = entity.DeviceClass
+	}
+	if entity.StateClass != "" {
+		payload["state_class"] = entity.StateClass
+	}
+	if entity.Unit != "" {
+		payload["unit_of_measurement"] = entity.Unit
+	}
+	if entity.Icon != "" {
+		payload["icon"] = entity.Icon
+	}
+	if entity.Category != "" {
+		payload["entity_category"] = entity.Category
+	}
+
+	switch entity.Component {
+	case "binary_sensor", "switch":
+		payload["payload_on"] = "ON"
+		payload["payload_off"] = "OFF"
+	case "button":
+		payload["payload_press"] = "PRESS"
+	case "select":
+		payload["options"] = mqttAPNOptions(cfg)
+	}
+	return payload
+}
+
+func mqttAPNOptions(cfg config.MQTTConfig) []string {
+	options := make([]string, 0, len(cfg.APNOptions))
+	for _, apn := range cfg.APNOptions {
+		if trimmed := strings.TrimSpace(apn); trimmed != "" {
+			options = append(options, trimmed)
+		}
+	}
+	if len(options) == 0 {
+		options = append(options, config.Defaults().MQTT.APNOptions...)
+	}
+	return options
+}
+
+// publishHADiscovery announces every entity with a retained config message.
+// Called from the MQTT OnConnect handler, so it talks to the client directly
+// instead of going through publishMqtt (mqttMu may be held by configureMqtt).
+func (s *Server) publishHADiscovery(client mqtt.Client, cfg config.MQTTConfig, base string) {
+	prefix := haDiscoveryPrefix(cfg)
+	nodeID := haNodeID(base)
+	for _, entity := range haEntities {
+		data, err := json.Marshal(buildHADiscoveryPayload(entity, cfg, base, nodeID))
+		if err != nil {
+			s.logger.Printf("mqtt: encode discovery for %s failed: %v", entity.ObjectID, err)
+			continue
+		}
+		topic := haDiscoveryTopic(prefix, nodeID, entity)
+		if err := waitMqttToken(client.Publish(topic, 1, true, data)); err != nil {
+			s.logger.Printf("mqtt: publish discovery %s failed: %v", topic, err)
+		}
+	}
+	s.logger.Printf("mqtt: published Home Assistant discovery for %d entities", len(haEntities))
+}
+
+// clearHADiscovery removes previously announced entities by publishing empty
+// retained payloads to their config topics.
+func (s *Server) clearHADiscovery(client mqtt.Client, cfg config.MQTTConfig, base string) {
+	prefix := haDiscoveryPrefix(cfg)
+	nodeID := haNodeID(base)
+	for _, entity := range haEntities {
+		topic := haDiscoveryTopic(prefix, nodeID, entity)
+		if err := waitMqttToken(client.Publish(topic, 1, true, []byte{})); err != nil {
+			s.logger.Printf("mqtt: clear discovery %s failed: %v", topic, err)
+		}
+	}
+}
+
+// subscribeMqttSetCommands listens on <base>/set/+, the command topics
+// announced to Home Assistant. They run through the same executor and
+// allow-list as <base>/cmd/#.
+func (s *Server) subscribeMqttSetCommands(client mqtt.Client, base string) {
+	topic := joinMqttTopic(base, mqttSetTopic+"/+")
+	token := client.Subscribe(topic, 1, func(c mqtt.Client, msg mqtt.Message) {
+		if msg.Retained() {
+			s.logger.Printf("mqtt set: ignored retained payload from %s", msg.Topic())
+			return
+		}
+		command := msg.Topic()[strings.LastIndex(msg.Topic(), "/")+1:]
+		payload := append([]byte(nil), msg.Payload()...)
+		go s.dispatchMqttCommand(msg.Topic(), command, payload)
+	})
+	if err := waitMqttToken(token); err != nil {
+		s.logger.Printf("mqtt: subscribe %s failed: %v", topic, err)
+		return
+	}
+	s.logger.Printf("mqtt: subscribed to %s", topic)
+}
+
+// publishHAState gathers the flattened state document Home Assistant reads
+// and publishes it retained to <base>/state. statusWeb may be passed in when
+// the caller already fetched it. Fields that cannot be read are sent as null
+// so the entities show "unknown" instead of a stale value.
+func (s *Server) publishHAState(ctx context.Context, statusWeb map[string]interface{}) {
+	cfg := s.getConfig()
+	if !cfg.MQTT.HomeAssistant {
+		return
+	}
+
+	state := s.collectHAState(ctx, statusWeb, s.store.Get())
+	if err := s.publishMqttRetained(mqttStateTopic, state); err != nil && err != errMqttDisabled {
+		s.logger.Printf("mqtt: publish state failed: %v", err)
+	}
+}
+
+func (s *Server) collectHAState(ctx context.Context, statusWeb map[string]interface{}, snapshot settings.Settings) map[string]interface{} {
+	client := s.getClient()
+	state := map[string]interface{}{
+		"rsrp": nil, "rsrq": nil, "sinr": nil, "rssi": nil,
+		"rat": nil, "band": nil, "pci": nil,
+		"uptime": nil, "wan_ip": nil,
+		"led": nil, "wifi_24g": nil, "wifi_5g": nil,
+		"apn":          s.lastAPN(),
+		"data_expired": nil,
+		"updated_at":   time.Now().UTC().Format(time.RFC3339),
+	}
+
+	if statusWeb == nil {
+		if fetched, err := s.fetchStatusWeb(ctx); err == nil {
+			statusWeb = fetched
+		}
+	}
+	if statusWeb != nil {
+		if status, err := router.ParseCellularStatus(statusWeb); err == nil {
+			rat, stat := status.Serving()
+			if stat.Valid() {
+				state["rat"] = strings.ToUpper(rat)
+				state["rsrp"] = signalMetric(stat.RSRPCurrent)
+				state["rsrq"] = signalMetric(stat.RSRQCurrent)
+				state["sinr"] = signalMetric(stat.SNRCurrent)
+				state["rssi"] = signalMetric(stat.RSSICurrent)
+				state["band"] = stat.Band.String()
+				state["pci"] = stat.PhysicalCellID.Int64()
+			}
+		}
+	}
+
+	today := snapshot.DailyUsage[time.Now().Format("2006-01-02")]
+	state["usage_upload_today"] = today.Upload
+	state["usage_download_today"] = today.Download
+	state["usage_total_today"] = today.Upload + today.Download
+	if snapshot.DataExpired > 0 {
+		state["data_expired"] = time.Unix(snapshot.DataExpired, 0).UTC().Format(time.RFC3339)
+	}
+
+	if device, err := client.DeviceStatus(ctx); err == nil {
+		state["uptime"] = device.UpTime.Int64()
+	}
+	if wan, err := client.WanStatus(ctx); err == nil {
+		if ip := wan.ExternalIP(); ip != "" {
+			state["wan_ip"] = ip
+		}
+	}
+	if led, err := client.LedStatus(ctx); err == nil {
+		state["led"] = onOff(led.Enabled())
+	}
+	if wlan, err := client.Wlan24(ctx); err == nil {
+		state["wifi_24g"] = onOff(wlan.Enabled())
+	}
+	if wlan, err := client.Wlan5(ctx); err == nil {
+		state["wifi_5g"] = onOff(wlan.Enabled())
+	}
+	return state
+}
+
+func onOff(v bool) string {
+	if v {
+		return "ON"
+	}
+	return "OFF"
+}
+
+func (s *Server) lastAPN() interface{} {
+	s.apnMu.Lock()
+	defer s.apnMu.Unlock()
+	if s.currentAPN == "" {
+		return nil
+	}
+	return s.currentAPN
+}
+
+func (s *Server) rememberAPN(apn string) {
+	s.apnMu.Lock()
+	defer s.apnMu.Unlock()
+	s.currentAPN = apn
+}
+
+func waitMqttToken(token mqtt.Token) error {
+	if !token.WaitTimeout(5 * time.Second) {
+		return fmt.Errorf("mqtt timeout")
+	}
+	return token.Error()
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"nokia_modem/internal/config"
+)
+
+func TestHADiscoveryPayload(t *testing.T) {
+	cfg := config.Defaults().MQTT
+	nodeID := haNodeID("modem/nokia")
+	if nodeID != "nokiamodem_nokia" {
+		t.Fatalf("unexpected node id %q", nodeID)
+	}
+
+	byID := map[string]haEntity{}
+	for _, entity := range haEntities {
+		byID[entity.ObjectID] = entity
+	}
+
+	rsrp := buildHADiscoveryPayload(byID["rsrp"], cfg, "modem/nokia", nodeID)
+	if rsrp["state_topic"] != "modem/nokia/state" || rsrp["value_template"] != "{{ value_json.rsrp }}" {
+		t.Fatalf("unexpected sensor payload: %v", rsrp)
+	}
+	if rsrp["availability_topic"] != "modem/nokia/availability" {
+		t.Fatalf("unexpected availability topic: %v", rsrp["availability_topic"])
+	}
+	if got := haDiscoveryTopic(haDiscoveryPrefix(cfg), nodeID, byID["rsrp"]); got != "homeassistant/sensor/nokiamodem_nokia/rsrp/config" {
+		t.Fatalf("unexpected discovery topic %q", got)
+	}
+
+	reboot := buildHADiscoveryPayload(byID["reboot"], cfg, "modem/nokia", nodeID)
+	if reboot["command_topic"] != "modem/nokia/set/reboot" || reboot["state_topic"] != nil {
+		t.Fatalf("unexpected button payload: %v", reboot)
+	}
+
+	apn := buildHADiscoveryPayload(byID["apn"], cfg, "modem/nokia", nodeID)
+	options, _ := apn["options"].([]string)
+	if len(options) != 2 || options[0] != "internet" {
+		t.Fatalf("unexpected APN options: %v", apn["options"])
+	}
+}
+
+func TestCollectHAState(t *testing.T) {
+	srv, emu, _ := newTestServer(t)
+	emu.SetExternalIP("203.0.113.7")
+	srv.rememberAPN("xlunlimited")
+
+	state := srv.collectHAState(context.Background(), nil, srv.store.Get())
+
+	if rsrp, ok := state["rsrp"].(*float64); !ok || rsrp == nil || *rsrp != -95 {
+		t.Fatalf("unexpected rsrp: %v", state["rsrp"])
+	}
+	checks := map[string]interface{}{
+		"rat":      "LTE",
+		"wan_ip":   "203.0.113.7",
+		"led":      "ON",
+		"wifi_24g": "ON",
+		"apn":      "xlunlimited",
+		"uptime":   int64(86400),
+	}
+	for key, want := range checks {
+		if state[key] != want {
+			t.Errorf("state[%q] = %v, want %v", key, state[key], want)
+		}
+	}
+}
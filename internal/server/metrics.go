@@ -0,0 +1,482 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"nokia_modem/internal/config"
+	"nokia_modem/internal/router"
+)
+
+// routerLatencyBuckets are the upper bounds, in seconds, of the router
+// request duration histogram.
+var routerLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type routerRequestKey struct {
+	endpoint string
+	code     string
+}
+
+type latencyHistogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// routerMetrics accumulates the request counters fed by the router client
+// observer. They survive client replacement on config reload.
+type routerMetrics struct {
+	mu       sync.Mutex
+	requests map[routerRequestKey]uint64
+	errors   map[string]uint64
+	latency  map[string]*latencyHistogram
+}
+
+func newRouterMetrics() *routerMetrics {
+	return &routerMetrics{
+		requests: map[routerRequestKey]uint64{},
+		errors:   map[string]uint64{},
+		latency:  map[string]*latencyHistogram{},
+	}
+}
+
+func (m *routerMetrics) observe(stats router.RequestStats) {
+	endpoint := stats.Endpoint
+	if endpoint == "" {
+		endpoint = "unknown"
+	}
+	code := "error"
+	if stats.StatusCode > 0 {
+		code = strconv.Itoa(stats.StatusCode)
+	}
+	seconds := stats.Duration.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[routerRequestKey{endpoint: endpoint, code: code}]++
+	if stats.Err != nil {
+		m.errors[endpoint]++
+	}
+
+	hist, ok := m.latency[endpoint]
+	if !ok {
+		hist = &latencyHistogram{counts: make([]uint64, len(routerLatencyBuckets))}
+		m.latency[endpoint] = hist
+	}
+	for i, bound := range routerLatencyBuckets {
+		if seconds <= bound {
+			hist.counts[i]++
+		}
+	}
+	hist.sum += seconds
+	hist.count++
+}
+
+// metricsSnapshot is the router state captured by the background refresher.
+// Scrapes only ever read the latest snapshot.
+type metricsSnapshot struct {
+	refreshedAt time.Time
+	lastError   string
+
+	cellular *router.CellularStatus
+	ca       *router.CAState
+	device   *router.DeviceStatus
+	clients  []router.LanClient
+}
+
+func metricsConfigsEqual(a, b config.MetricsConfig) bool {
+	return a.Enabled == b.Enabled && a.IntervalSeconds == b.IntervalSeconds
+}
+
+func (s *Server) configureMetrics(cfg config.Config) {
+	var (
+		start bool
+		stop  context.CancelFunc
+		ctx   context.Context
+	)
+
+	s.metricsMu.Lock()
+	running := s.metricsCancel != nil
+	changed := !metricsConfigsEqual(s.metricsCfg, cfg.Metrics)
+
+	if running && (changed || !cfg.Metrics.Enabled) {
+		stop = s.metricsCancel
+		s.metricsCancel = nil
+		running = false
+	}
+	if cfg.Metrics.Enabled && !running {
+		ctx, s.metricsCancel = context.WithCancel(context.Background())
+		s.metricsWG.Add(1)
+		start = true
+	}
+	s.metricsCfg = cfg.Metrics
+	s.metricsMu.Unlock()
+
+	if stop != nil {
+		stop()
+		s.metricsWG.Wait()
+		s.logger.Printf("metrics: refresher stopped")
+	}
+
+	if start {
+		interval := metricsRefreshInterval(cfg.Metrics)
+		go s.runMetricsRefresher(ctx, interval)
+		s.logger.Printf("metrics: refresher started (interval %s)", interval)
+	}
+}
+
+func metricsRefreshInterval(cfg config.MetricsConfig) time.Duration {
+	seconds := cfg.IntervalSeconds
+	if seconds < 5 {
+		seconds = 30
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func (s *Server) runMetricsRefresher(ctx context.Context, interval time.Duration) {
+	defer s.metricsWG.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s.refreshMetrics(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.refreshMetrics(ctx)
+		}
+	}
+}
+
+// refreshMetrics captures a new snapshot. Values that fail to load keep
+// their previous reading so a single failed call does not blank a series.
+func (s *Server) refreshMetrics(ctx context.Context) {
+	refreshCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+
+	client := s.getClient()
+
+	s.metricsSnapMu.RLock()
+	snapshot := s.metricsSnap
+	s.metricsSnapMu.RUnlock()
+
+	var failures []string
+
+	if cellular, err := client.CellularStatus(refreshCtx); err != nil {
+		failures = append(failures, "status_web: "+err.Error())
+	} else {
+		snapshot.cellular = cellular
+	}
+	if ca, err := client.CAState(refreshCtx); err != nil {
+		failures = append(failures, "service_data: "+err.Error())
+	} else {
+		snapshot.ca = ca
+	}
+	if device, err := client.DeviceStatus(refreshCtx); err != nil {
+		failures = append(failures, "device_status: "+err.Error())
+	} else {
+		snapshot.device = device
+	}
+	if prelogin, err := client.Prelogin(refreshCtx); err != nil {
+		failures = append(failures, "prelogin_status: "+err.Error())
+	} else {
+		snapshot.clients = prelogin.ActiveDevices()
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	snapshot.refreshedAt = time.Now()
+	snapshot.lastError = strings.Join(failures, "; ")
+	if len(failures) > 0 {
+		s.logger.Printf("metrics: refresh incomplete: %s", snapshot.lastError)
+	}
+
+	s.metricsSnapMu.Lock()
+	s.metricsSnap = snapshot
+	s.metricsSnapMu.Unlock()
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.getConfig().Metrics.Enabled {
+		http.Error(w, "metrics disabled", http.StatusNotFound)
+		return
+	}
+
+	s.metricsSnapMu.RLock()
+	snapshot := s.metricsSnap
+	s.metricsSnapMu.RUnlock()
+
+	var buf bytes.Buffer
+	p := &promWriter{buf: &buf}
+
+	p.family("nokia_router_up", "gauge", "Whether the last metrics refresh reached the router without errors.")
+	up := 0.0
+	if !snapshot.refreshedAt.IsZero() && snapshot.lastError == "" {
+		up = 1
+	}
+	p.sample("nokia_router_up", nil, up)
+	if !snapshot.refreshedAt.IsZero() {
+		p.family("nokia_metrics_refresh_timestamp_seconds", "gauge", "Unix time of the last metrics refresh.")
+		p.sample("nokia_metrics_refresh_timestamp_seconds", nil, float64(snapshot.refreshedAt.Unix()))
+	}
+
+	writeCellularMetrics(p, snapshot.cellular)
+	writeCAMetrics(p, snapshot.ca)
+	writeDeviceMetrics(p, snapshot.device)
+	if !snapshot.refreshedAt.IsZero() {
+		writeClientMetrics(p, snapshot.clients)
+	}
+
+	total, pending := s.smsArchive.Stats()
+	p.family("nokia_sms_archived_messages", "gauge", "Messages held in the local SMS archive.")
+	p.sample("nokia_sms_archived_messages", nil, float64(total))
+	p.family("nokia_sms_pending_deliveries", "gauge", "Archived messages still waiting for delivery by at least one notifier.")
+	p.sample("nokia_sms_pending_deliveries", nil, float64(pending))
+
+	s.mqttMu.Lock()
+	mqttClient := s.mqttClient
+	s.mqttMu.Unlock()
+	mqttConnected := 0.0
+	if mqttClient != nil && mqttClient.IsConnected() {
+		mqttConnected = 1
+	}
+	p.family("nokia_mqtt_connected", "gauge", "Whether the MQTT client is connected to the broker.")
+	p.sample("nokia_mqtt_connected", nil, mqttConnected)
+
+	s.routerMetrics.write(p)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+func writeCellularMetrics(p *promWriter, status *router.CellularStatus) {
+	if status == nil {
+		return
+	}
+
+	type cell struct {
+		labels []string
+		stat   router.RadioStat
+	}
+	cells := make([]cell, 0, len(status.LTE)+len(status.NR))
+	for i, entry := range status.LTE {
+		if entry.Stat.Valid() {
+			cells = append(cells, cell{cellLabels("lte", i, entry.Stat), entry.Stat})
+		}
+	}
+	for i, entry := range status.NR {
+		if entry.Stat.Valid() {
+			cells = append(cells, cell{cellLabels("nr", i, entry.Stat), entry.Stat})
+		}
+	}
+
+	metrics := []struct {
+		name, help string
+		value      func(router.RadioStat) router.FlexFloat
+	}{
+		{"nokia_signal_rsrp_dbm", "Reference signal received power per carrier.", func(r router.RadioStat) router.FlexFloat { return r.RSRPCurrent }},
+		{"nokia_signal_rsrq_db", "Reference signal received quality per carrier.", func(r router.RadioStat) router.FlexFloat { return r.RSRQCurrent }},
+		{"nokia_signal_sinr_db", "Signal to interference plus noise ratio per carrier.", func(r router.RadioStat) router.FlexFloat { return r.SNRCurrent }},
+		{"nokia_signal_rssi_dbm", "Received signal strength indicator per carrier.", func(r router.RadioStat) router.FlexFloat { return r.RSSICurrent }},
+	}
+	for _, metric := range metrics {
+		wrote := false
+		for _, c := range cells {
+			v := metric.value(c.stat).Float64()
+			if v == invalidSignalValue {
+				continue
+			}
+			if !wrote {
+				p.family(metric.name, "gauge", metric.help)
+				wrote = true
+			}
+			p.sample(metric.name, c.labels, v)
+		}
+	}
+
+	if counters, ok := status.Counters(); ok {
+		p.family("nokia_cellular_sent_bytes_total", "counter", "Bytes sent over the cellular WAN since the router booted.")
+		p.sample("nokia_cellular_sent_bytes_total", nil, float64(counters.BytesSent.Int64()))
+		p.family("nokia_cellular_received_bytes_total", "counter", "Bytes received over the cellular WAN since the router booted.")
+		p.sample("nokia_cellular_received_bytes_total", nil, float64(counters.BytesReceived.Int64()))
+	}
+}
+
+func cellLabels(rat string, index int, stat router.RadioStat) []string {
+	return []string{
+		"rat", rat,
+		"cell", strconv.Itoa(index),
+		"band", strings.TrimSpace(stat.Band.String()),
+		"pci", strconv.FormatInt(stat.PhysicalCellID.Int64(), 10),
+	}
+}
+
+func writeCAMetrics(p *promWriter, ca *router.CAState) {
+	if ca == nil {
+		return
+	}
+
+	p.family("nokia_ca_secondary_cells", "gauge", "Aggregated secondary cells per direction.")
+	p.sample("nokia_ca_secondary_cells", []string{"direction", "downlink"}, float64(len(ca.Downlink())))
+	p.sample("nokia_ca_secondary_cells", []string{"direction", "uplink"}, float64(len(ca.Uplink())))
+
+	if len(ca.Downlink())+len(ca.Uplink()) == 0 {
+		return
+	}
+	p.family("nokia_ca_secondary_cell_info", "gauge", "Aggregated secondary cell, labelled with its band, bandwidth, PCI and channel.")
+	for _, dir := range []struct {
+		name     string
+		carriers []router.Carrier
+	}{{"downlink", ca.Downlink()}, {"uplink", ca.Uplink()}} {
+		for _, carrier := range dir.carriers {
+			p.sample("nokia_ca_secondary_cell_info", []string{
+				"direction", dir.name,
+				"band", strings.TrimSpace(carrier.ScellBand.String()),
+				"bandwidth", strings.TrimSpace(carrier.ScellBandwidth.String()),
+				"pci", strconv.FormatInt(carrier.PhysicalCellID.Int64(), 10),
+				"channel", strconv.FormatInt(carrier.ScellChannel.Int64(), 10),
+			}, 1)
+		}
+	}
+}
+
+func writeDeviceMetrics(p *promWriter, device *router.DeviceStatus) {
+	if device == nil {
+		return
+	}
+	p.family("nokia_uptime_seconds", "gauge", "Router uptime.")
+	p.sample("nokia_uptime_seconds", nil, float64(device.UpTime.Int64()))
+	p.family("nokia_cpu_usage_percent", "gauge", "Router CPU usage.")
+	p.sample("nokia_cpu_usage_percent", nil, device.CPU.CPUUsage.Float64())
+	if device.Memory.Total > 0 {
+		p.family("nokia_memory_total_kilobytes", "gauge", "Router memory size as reported by mem_info.")
+		p.sample("nokia_memory_total_kilobytes", nil, float64(device.Memory.Total.Int64()))
+		p.family("nokia_memory_free_kilobytes", "gauge", "Free router memory as reported by mem_info.")
+		p.sample("nokia_memory_free_kilobytes", nil, float64(device.Memory.Free.Int64()))
+		p.family("nokia_memory_used_percent", "gauge", "Share of router memory in use.")
+		p.sample("nokia_memory_used_percent", nil, device.Memory.UsedPercent())
+	}
+}
+
+func writeClientMetrics(p *promWriter, clients []router.LanClient) {
+	wired, wireless := 0, 0
+	for _, c := range clients {
+		if c.Wired() {
+			wired++
+		} else {
+			wireless++
+		}
+	}
+	p.family("nokia_connected_clients", "gauge", "Active LAN clients by interface type.")
+	p.sample("nokia_connected_clients", []string{"interface", "wired"}, float64(wired))
+	p.sample("nokia_connected_clients", []string{"interface", "wireless"}, float64(wireless))
+}
+
+func (m *routerMetrics) write(p *promWriter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]routerRequestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].endpoint != keys[j].endpoint {
+			return keys[i].endpoint < keys[j].endpoint
+		}
+		return keys[i].code < keys[j].code
+	})
+	p.family("nokia_router_requests_total", "counter", "HTTP requests sent to the router, by endpoint and status code.")
+	for _, key := range keys {
+		p.sample("nokia_router_requests_total", []string{"endpoint", key.endpoint, "code", key.code}, float64(m.requests[key]))
+	}
+
+	endpoints := make([]string, 0, len(m.latency))
+	for endpoint := range m.latency {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+
+	p.family("nokia_router_request_errors_total", "counter", "Router requests that failed (transport error or non-2xx status).")
+	for _, endpoint := range endpoints {
+		p.sample("nokia_router_request_errors_total", []string{"endpoint", endpoint}, float64(m.errors[endpoint]))
+	}
+
+	p.family("nokia_router_request_duration_seconds", "histogram", "Router request latency.")
+	for _, endpoint := range endpoints {
+		hist := m.latency[endpoint]
+		for i, bound := range routerLatencyBuckets {
+			p.sample("nokia_router_request_duration_seconds_bucket", []string{"endpoint", endpoint, "le", formatPromFloat(bound)}, float64(hist.counts[i]))
+		}
+		p.sample("nokia_router_request_duration_seconds_bucket", []string{"endpoint", endpoint, "le", "+Inf"}, float64(hist.count))
+		p.sample("nokia_router_request_duration_seconds_sum", []string{"endpoint", endpoint}, hist.sum)
+		p.sample("nokia_router_request_duration_seconds_count", []string{"endpoint", endpoint}, float64(hist.count))
+	}
+}
+
+// promWriter renders the Prometheus text exposition format.
+type promWriter struct {
+	buf *bytes.Buffer
+}
+
+func (p *promWriter) family(name, kind, help string) {
+	fmt.Fprintf(p.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one series; labels alternate name and value.
+func (p *promWriter) sample(name string, labels []string, value float64) {
+	p.buf.WriteString(name)
+	if len(labels) > 0 {
+		p.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				p.buf.WriteByte(',')
+			}
+			p.buf.WriteString(labels[i])
+			p.buf.WriteString(`="`)
+			p.buf.WriteString(escapePromLabel(labels[i+1]))
+			p.buf.WriteByte('"')
+		}
+		p.buf.WriteByte('}')
+	}
+	p.buf.WriteByte(' ')
+	p.buf.WriteString(formatPromFloat(value))
+	p.buf.WriteByte('\n')
+}
+
+func escapePromLabel(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	return strings.ReplaceAll(v, `"`, `\"`)
+}
+
+func formatPromFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetricsServedFromSnapshot(t *testing.T) {
+	srv, emu, httpSrv := newTestServer(t)
+	emu.SetCounters(1234, 5678)
+
+	cfg := srv.getConfig()
+	cfg.Metrics.Enabled = true
+	srv.setConfig(cfg)
+
+	srv.refreshMetrics(context.Background())
+	emu.ExpireSessions()
+	logins := emu.Calls("login_web_app.cgi")
+
+	resp, err := http.Get(httpSrv.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+
+	text := string(body)
+	for _, want := range []string{
+		"nokia_router_up 1\n",
+		`nokia_signal_rsrp_dbm{rat="lte",cell="0",band="B3",pci="211"} -95`,
+		"nokia_cellular_sent_bytes_total 1234\n",
+		"nokia_cellular_received_bytes_total 5678\n",
+		`nokia_ca_secondary_cells{direction="downlink"} 1`,
+		"nokia_cpu_usage_percent 12\n",
+		`nokia_connected_clients{interface="wired"} 1`,
+		"nokia_mqtt_connected 0\n",
+		`nokia_router_requests_total{endpoint="status_get_web_app.cgi",code="200"} 1`,
+		`nokia_router_request_duration_seconds_count{endpoint="service_function_web_app.cgi"}`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+	if strings.Contains(text, "nokia_signal_rsrp_dbm{rat=\"nr\"") {
+		t.Errorf("invalid NR measurements must not be exported")
+	}
+	if got := emu.Calls("login_web_app.cgi"); got != logins {
+		t.Fatalf("scrape must not log in to the router (%d -> %d login requests)", logins, got)
+	}
+}
+
+func TestMetricsDisabled(t *testing.T) {
+	_, _, httpSrv := newTestServer(t)
+
+	if status := getJSON(t, httpSrv.URL+"/metrics", nil); status != http.StatusNotFound {
+		t.Fatalf("expected 404 while metrics are disabled, got %d", status)
+	}
+}
@@ -0,0 +1,500 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"nokia_modem/internal/config"
+	"nokia_modem/internal/settings"
+)
+
+// Notifier types accepted in config.NotifierConfig.Type.
+var notifierTypes = []string{"ntfy", "gotify", "discord", "slack", "webhook", "smtp"}
+
+// Names of the built-in notifiers; configured notifiers cannot reuse them.
+var builtinNotifierNames = []string{"mqtt", "telegram", "rules"}
+
+const (
+	defaultNtfyURL = "https://ntfy.sh"
+	// discordContentLimit is the longest message a Discord webhook takes.
+	discordContentLimit = 2000
+	// maxQueuedAlerts bounds the undelivered alerts kept in settings.json;
+	// the oldest are dropped first.
+	maxQueuedAlerts = 100
+)
+
+// errNotifierUnavailable is returned when a notifier cannot send right now,
+// e.g. MQTT is disconnected. The message stays pending without an error
+// being logged.
+var errNotifierUnavailable = errors.New("notifier unavailable")
+
+// Notifier delivers forwarded SMS to one destination. Name keys the
+// delivery state in sms.json, so it must stay stable across restarts.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, n smsNotification) error
+}
+
+// alertNotifier is implemented by the notifiers that can also carry router
+// alerts: MQTT, Telegram and the configured ones.
+type alertNotifier interface {
+	Name() string
+	Alert(ctx context.Context, a alertNotification) error
+}
+
+// alertNotification is a router alert, e.g. a quota threshold. Webhooks
+// receive it as is; MQTT publishes Details to <topic_base>/<Topic> instead.
+type alertNotification struct {
+	Kind  string `json:"alert"`
+	Title string `json:"title"`
+	Text  string `json:"text"`
+	Time  string `json:"time"`
+
+	Topic   string      `json:"-"`
+	Details interface{} `json:"-"`
+}
+
+func newAlertNotification(kind, title, text string, at time.Time) alertNotification {
+	return alertNotification{Kind: kind, Title: title, Text: text, Time: at.UTC().Format(time.RFC3339)}
+}
+
+// smsNotification is the forwarded form of an SMS. It is published as is
+// to <topic_base>/sms and posted to generic webhooks.
+type smsNotification struct {
+	ID           string `json:"id"`
+	Hash         string `json:"hash"`
+	Sender       string `json:"sender"`
+	Content      string `json:"content"`
+	Timestamp    string `json:"timestamp"`
+	DisplayTime  string `json:"display_time"`
+	Unread       bool   `json:"unread"`
+	ReceivedAt   string `json:"received_at"`
+	PollInterval int    `json:"poll_interval"`
+
+	msg smsMessage
+}
+
+func newSmsNotification(msg smsMessage, receivedAt time.Time, pollInterval int) smsNotification {
+	return smsNotification{
+		ID:           msg.SMSID,
+		Hash:         strings.TrimSpace(msg.SMSHash),
+		Sender:       strings.TrimSpace(msg.SMSSender),
+		Content:      msg.SMSContent,
+		Timestamp:    msg.SMSDateTime,
+		DisplayTime:  formatSmsDisplayTime(msg),
+		Unread:       msg.SMSUnread,
+		ReceivedAt:   receivedAt.Format(time.RFC3339),
+		PollInterval: pollInterval,
+		msg:          msg,
+	}
+}
+
+// title and text are the plain-text rendering shared by the push services.
+func (n smsNotification) title() string {
+	return "SMS from " + valueOr(n.Sender, "unknown sender")
+}
+
+func (n smsNotification) text() string {
+	return fmt.Sprintf("%s\n\n%s", valueOr(strings.TrimSpace(n.Content), "(empty message)"), n.DisplayTime)
+}
+
+// smsNotifiers returns the notifiers SMS are forwarded to under cfg, built
+// in first followed by the configured ones in order. Telegram without a
+// chat ID is left out: messages would stay pending for it forever.
+func (s *Server) smsNotifiers(cfg config.Config, mqttReady bool) []Notifier {
+	var notifiers []Notifier
+	if cfg.MQTT.Enabled && cfg.LongPolling.Enabled {
+		notifiers = append(notifiers, mqttNotifier{s: s, ready: mqttReady})
+	}
+	if cfg.Telegram.Enabled && cfg.LongPolling.ForwardSmsToTelegram && strings.TrimSpace(cfg.Telegram.ChatID) != "" {
+		notifiers = append(notifiers, telegramNotifier{s: s, cfg: cfg.Telegram})
+	}
+	for _, nc := range cfg.Notifiers {
+		if nc.Enabled {
+			notifiers = append(notifiers, s.newNotifier(nc))
+		}
+	}
+	return notifiers
+}
+
+func (s *Server) newNotifier(nc config.NotifierConfig) Notifier {
+	if nc.Type == "smtp" {
+		return smtpNotifier{cfg: nc}
+	}
+	return webNotifier{cfg: nc, client: s.httpClient}
+}
+
+// alertNotifiers returns the notifiers that take alerts under cfg, built in
+// first followed by the configured ones that have alerts set. As for SMS,
+// MQTT needs long polling and Telegram a chat ID.
+func (s *Server) alertNotifiers(cfg config.Config) []alertNotifier {
+	var notifiers []alertNotifier
+	if cfg.MQTT.Enabled && cfg.MQTT.Alerts && cfg.LongPolling.Enabled {
+		notifiers = append(notifiers, mqttNotifier{s: s, ready: s.mqttConnected()})
+	}
+	if cfg.Telegram.Enabled && cfg.Telegram.Alerts && strings.TrimSpace(cfg.Telegram.ChatID) != "" {
+		notifiers = append(notifiers, telegramNotifier{s: s, cfg: cfg.Telegram})
+	}
+	for _, nc := range cfg.Notifiers {
+		if !nc.Enabled || !nc.Alerts {
+			continue
+		}
+		if notifier, ok := s.newNotifier(nc).(alertNotifier); ok {
+			notifiers = append(notifiers, notifier)
+		}
+	}
+	return notifiers
+}
+
+// notifyAlert sends a router alert to every notifier that takes alerts. The
+// notifiers that fail are queued in settings.json and retried by the SMS
+// poller, so the alert survives a restart.
+func (s *Server) notifyAlert(ctx context.Context, cfg config.Config, alert alertNotification) {
+	notifiers := s.alertNotifiers(cfg)
+	if len(notifiers) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(notifiers))
+	for _, n := range notifiers {
+		names = append(names, n.Name())
+	}
+	pending, _ := s.deliverAlert(ctx, alert, notifiers, names, map[string]bool{})
+	if len(pending) == 0 {
+		return
+	}
+
+	at, _ := time.Parse(time.RFC3339, alert.Time)
+	queued := settings.QueuedAlert{
+		ID:      newCommandID(),
+		Kind:    alert.Kind,
+		Title:   alert.Title,
+		Text:    alert.Text,
+		At:      at,
+		Topic:   alert.Topic,
+		Pending: pending,
+	}
+	if alert.Details != nil {
+		details, err := json.Marshal(alert.Details)
+		if err != nil {
+			s.logger.Printf("notifiers: encode %s alert details failed: %v", alert.Kind, err)
+		}
+		queued.Details = details
+	}
+	err := s.store.Update(func(data *settings.Settings) error {
+		data.AlertQueue = append(data.AlertQueue, queued)
+		if extra := len(data.AlertQueue) - maxQueuedAlerts; extra > 0 {
+			s.logger.Printf("notifiers: alert queue full, dropping %d oldest alerts", extra)
+			data.AlertQueue = slices.Clone(data.AlertQueue[extra:])
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Printf("notifiers: queue %s alert failed: %v", alert.Kind, err)
+	}
+}
+
+// retryQueuedAlerts hands every queued alert to the notifiers it is still
+// pending for. A notifier that fails is not tried again in the same pass,
+// and names that no longer take alerts are dropped.
+func (s *Server) retryQueuedAlerts(ctx context.Context, cfg config.Config) {
+	queue := s.store.Get().AlertQueue
+	if len(queue) == 0 {
+		return
+	}
+	notifiers := s.alertNotifiers(cfg)
+
+	done := make(map[string][]string, len(queue))
+	failed := map[string]bool{}
+	for _, queued := range queue {
+		alert := newAlertNotification(queued.Kind, queued.Title, queued.Text, queued.At)
+		alert.Topic = queued.Topic
+		if len(queued.Details) > 0 {
+			alert.Details = queued.Details
+		}
+		_, finished := s.deliverAlert(ctx, alert, notifiers, queued.Pending, failed)
+		if len(finished) > 0 {
+			done[queued.ID] = finished
+		}
+	}
+	if len(done) == 0 {
+		return
+	}
+
+	err := s.store.Update(func(data *settings.Settings) error {
+		kept := data.AlertQueue[:0]
+		for _, queued := range data.AlertQueue {
+			queued.Pending = slices.DeleteFunc(slices.Clone(queued.Pending), func(name string) bool {
+				return slices.Contains(done[queued.ID], name)
+			})
+			if len(queued.Pending) > 0 {
+				kept = append(kept, queued)
+			}
+		}
+		data.AlertQueue = kept
+		return nil
+	})
+	if err != nil {
+		s.logger.Printf("notifiers: update alert queue failed: %v", err)
+	}
+}
+
+// deliverAlert sends alert to the notifiers named in pending and splits the
+// names into those still pending and those that are done, either delivered
+// or no longer taking alerts. Notifiers in failed are skipped; the ones that
+// fail now are added to it.
+func (s *Server) deliverAlert(ctx context.Context, alert alertNotification, notifiers []alertNotifier, pending []string, failed map[string]bool) (left, done []string) {
+	for _, name := range pending {
+		i := slices.IndexFunc(notifiers, func(n alertNotifier) bool { return n.Name() == name })
+		if i < 0 {
+			done = append(done, name)
+			continue
+		}
+		if failed[name] {
+			left = append(left, name)
+			continue
+		}
+		sendCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+		err := notifiers[i].Alert(sendCtx, alert)
+		cancel()
+		switch {
+		case errors.Is(err, errNotifierUnavailable):
+			failed[name] = true
+			left = append(left, name)
+		case err != nil:
+			s.logger.Printf("notifiers: %s alert to %s failed: %v", alert.Kind, name, err)
+			failed[name] = true
+			left = append(left, name)
+		default:
+			done = append(done, name)
+		}
+	}
+	return left, done
+}
+
+func notifierNames(notifiers []Notifier) []string {
+	names := make([]string, 0, len(notifiers))
+	for _, n := range notifiers {
+		names = append(names, n.Name())
+	}
+	return names
+}
+
+type mqttNotifier struct {
+	s     *Server
+	ready bool
+}
+
+func (n mqttNotifier) Name() string { return "mqtt" }
+
+func (n mqttNotifier) Notify(_ context.Context, sms smsNotification) error {
+	if !n.ready {
+		return errNotifierUnavailable
+	}
+	return n.s.publishMqtt("sms", sms)
+}
+
+// Alert publishes the alert's details, or the alert itself when it has
+// none, to <topic_base>/<topic>.
+func (n mqttNotifier) Alert(_ context.Context, alert alertNotification) error {
+	if !n.ready {
+		return errNotifierUnavailable
+	}
+	var payload interface{} = alert
+	if alert.Details != nil {
+		payload = alert.Details
+	}
+	return n.s.publishMqtt(valueOr(alert.Topic, "alert"), payload)
+}
+
+type telegramNotifier struct {
+	s   *Server
+	cfg config.TelegramConfig
+}
+
+func (n telegramNotifier) Name() string { return "telegram" }
+
+func (n telegramNotifier) Notify(ctx context.Context, sms smsNotification) error {
+	text, parseMode := formatSmsForTelegram(sms.msg, strings.TrimSpace(n.cfg.ParseMode))
+	return n.s.sendTelegramMessage(ctx, n.cfg, strings.TrimSpace(n.cfg.ChatID), parseMode, text)
+}
+
+func (n telegramNotifier) Alert(ctx context.Context, alert alertNotification) error {
+	return n.s.sendTelegramMessage(ctx, n.cfg, strings.TrimSpace(n.cfg.ChatID), "", alert.Title+"\n"+alert.Text)
+}
+
+// webNotifier posts to the HTTP services configured under "notifiers".
+type webNotifier struct {
+	cfg    config.NotifierConfig
+	client *http.Client
+}
+
+func (n webNotifier) Name() string { return n.cfg.Name }
+
+func (n webNotifier) Notify(ctx context.Context, sms smsNotification) error {
+	return n.send(ctx, sms.title(), sms.text(), sms)
+}
+
+func (n webNotifier) Alert(ctx context.Context, alert alertNotification) error {
+	return n.send(ctx, alert.Title, alert.Text, alert)
+}
+
+// send posts title and text in the service's format. Generic webhooks get
+// raw instead.
+func (n webNotifier) send(ctx context.Context, title, text string, raw interface{}) error {
+	endpoint := n.cfg.URL
+	headers := map[string]string{"Content-Type": "application/json"}
+	var payload interface{}
+
+	switch n.cfg.Type {
+	case "ntfy":
+		// JSON publishing keeps non-ASCII titles intact, unlike headers.
+		body := map[string]interface{}{
+			"topic":   n.cfg.Topic,
+			"title":   title,
+			"message": text,
+			"tags":    []string{"envelope"},
+		}
+		if n.cfg.Priority > 0 {
+			body["priority"] = n.cfg.Priority
+		}
+		if n.cfg.Token != "" {
+			headers["Authorization"] = "Bearer " + n.cfg.Token
+		}
+		payload = body
+	case "gotify":
+		endpoint = strings.TrimRight(endpoint, "/") + "/message"
+		headers["X-Gotify-Key"] = n.cfg.Token
+		payload = map[string]interface{}{
+			"title":    title,
+			"message":  text,
+			"priority": n.cfg.Priority,
+		}
+	case "discord":
+		content := []rune("**" + title + "**\n" + text)
+		if len(content) > discordContentLimit {
+			content = append(content[:discordContentLimit-1], '…')
+		}
+		payload = map[string]string{"content": string(content)}
+	case "slack":
+		payload = map[string]string{"text": "*" + title + "*\n" + text}
+	case "webhook":
+		payload = raw
+	default:
+		return fmt.Errorf("unknown notifier type %q", n.cfg.Type)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if n.cfg.Type == "webhook" && n.cfg.Secret != "" {
+		headers["X-Signature-256"] = "sha256=" + signWebhookBody(n.cfg.Secret, body)
+	}
+	return postNotification(ctx, n.client, endpoint, body, headers)
+}
+
+// signWebhookBody returns the hex HMAC-SHA256 of body under secret.
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func postNotification(ctx context.Context, client *http.Client, endpoint string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s answered %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(snippet)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func normalizeNotifiers(list []config.NotifierConfig) []config.NotifierConfig {
+	out := make([]config.NotifierConfig, 0, len(list))
+	for _, nc := range list {
+		nc.Name = strings.TrimSpace(nc.Name)
+		nc.Type = strings.ToLower(strings.TrimSpace(nc.Type))
+		nc.URL = strings.TrimSpace(nc.URL)
+		nc.Topic = strings.TrimSpace(nc.Topic)
+		nc.Token = strings.TrimSpace(nc.Token)
+		if nc.Type == "ntfy" && nc.URL == "" {
+			nc.URL = defaultNtfyURL
+		}
+		if nc.Type == "smtp" {
+			nc.SMTP = normalizeSMTP(nc.SMTP)
+		}
+		out = append(out, nc)
+	}
+	return out
+}
+
+func validateNotifiers(list []config.NotifierConfig) error {
+	names := map[string]struct{}{}
+	for _, nc := range list {
+		if nc.Name == "" {
+			return errors.New("notifiers entries need a name")
+		}
+		if slices.Contains(builtinNotifierNames, nc.Name) {
+			return fmt.Errorf("notifiers: %q is reserved", nc.Name)
+		}
+		if _, dup := names[nc.Name]; dup {
+			return fmt.Errorf("notifiers: duplicate name %q", nc.Name)
+		}
+		names[nc.Name] = struct{}{}
+		if !slices.Contains(notifierTypes, nc.Type) {
+			return fmt.Errorf("notifiers %q: type must be one of %s", nc.Name, strings.Join(notifierTypes, ", "))
+		}
+		if nc.Type == "smtp" {
+			if err := validateSMTP(nc.SMTP); err != nil {
+				return fmt.Errorf("notifiers %q: %w", nc.Name, err)
+			}
+			continue
+		}
+		parsed, err := url.ParseRequestURI(nc.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return fmt.Errorf("notifiers %q: url must be an http(s) URL", nc.Name)
+		}
+		switch nc.Type {
+		case "ntfy":
+			if nc.Topic == "" {
+				return fmt.Errorf("notifiers %q: topic is required for ntfy", nc.Name)
+			}
+			if nc.Priority < 0 || nc.Priority > 5 {
+				return fmt.Errorf("notifiers %q: ntfy priority must be between 1 and 5", nc.Name)
+			}
+		case "gotify":
+			if nc.Token == "" {
+				return fmt.Errorf("notifiers %q: token is required for gotify", nc.Name)
+			}
+			if nc.Priority < 0 || nc.Priority > 10 {
+				return fmt.Errorf("notifiers %q: gotify priority must be between 0 and 10", nc.Name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"nokia_modem/internal/config"
+)
+
+// SMTP security modes accepted in config.SMTPConfig.Security.
+var smtpSecurityModes = []string{"starttls", "tls", "none"}
+
+const defaultSMTPSubject = "{{.Title}}"
+
+// emailSubjectData is what config.SMTPConfig.Subject is rendered with. For
+// alerts Sender is empty and Content holds the alert text.
+type emailSubjectData struct {
+	Title   string
+	Sender  string
+	Content string
+	Time    string
+}
+
+// smtpNotifier mails forwarded SMS and alerts as plain text.
+type smtpNotifier struct {
+	cfg config.NotifierConfig
+}
+
+func (n smtpNotifier) Name() string { return n.cfg.Name }
+
+func (n smtpNotifier) Notify(ctx context.Context, sms smsNotification) error {
+	data := emailSubjectData{Title: sms.title(), Sender: sms.Sender, Content: sms.Content, Time: sms.DisplayTime}
+	return n.send(ctx, data, sms.text())
+}
+
+func (n smtpNotifier) Alert(ctx context.Context, alert alertNotification) error {
+	data := emailSubjectData{Title: alert.Title, Content: alert.Text, Time: alert.Time}
+	return n.send(ctx, data, alert.Text)
+}
+
+func (n smtpNotifier) send(ctx context.Context, data emailSubjectData, body string) error {
+	cfg := n.cfg.SMTP
+	subject, err := renderEmailSubject(cfg.Subject, data)
+	if err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return fmt.Errorf("from: %w", err)
+	}
+	to := make([]*mail.Address, 0, len(cfg.To))
+	for _, raw := range cfg.To {
+		addr, err := mail.ParseAddress(raw)
+		if err != nil {
+			return fmt.Errorf("to %q: %w", raw, err)
+		}
+		to = append(to, addr)
+	}
+	return sendMail(ctx, cfg, from, to, buildEmail(from, to, subject, body, time.Now()))
+}
+
+func renderEmailSubject(raw string, data emailSubjectData) (string, error) {
+	tmpl, err := template.New("subject").Parse(valueOr(raw, defaultSMTPSubject))
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	// A header cannot span lines, and SMS content often does.
+	return strings.Join(strings.Fields(b.String()), " "), nil
+}
+
+// buildEmail renders a UTF-8 plain-text message with CRLF line endings.
+func buildEmail(from *mail.Address, to []*mail.Address, subject, body string, at time.Time) []byte {
+	recipients := make([]string, 0, len(to))
+	for _, addr := range to {
+		recipients = append(recipients, addr.String())
+	}
+	domain := "localhost"
+	if i := strings.LastIndexByte(from.Address, '@'); i >= 0 {
+		domain = from.Address[i+1:]
+	}
+	id := make([]byte, 12)
+	_, _ = rand.Read(id)
+
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", from.String())
+	header("To", strings.Join(recipients, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", at.Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s@%s>", hex.EncodeToString(id), domain))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	_, _ = qp.Write([]byte(body))
+	_ = qp.Close()
+	return buf.Bytes()
+}
+
+// sendMail delivers msg over one SMTP session. "starttls" refuses servers
+// that do not offer STARTTLS rather than sending in the clear, and net/smtp
+// only sends credentials over TLS or to localhost.
+func sendMail(ctx context.Context, cfg config.SMTPConfig, from *mail.Address, to []*mail.Address, msg []byte) error {
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	tlsConfig := &tls.Config{ServerName: cfg.Host}
+	dialer := &net.Dialer{}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if cfg.Security == "tls" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if cfg.Security == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("server does not offer STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("mail from: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt.Address); err != nil {
+			return fmt.Errorf("rcpt to %s: %w", rcpt.Address, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("data: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("data: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("data: %w", err)
+	}
+	return client.Quit()
+}
+
+func normalizeSMTP(cfg config.SMTPConfig) config.SMTPConfig {
+	cfg.Host = strings.TrimSpace(cfg.Host)
+	cfg.Security = strings.ToLower(strings.TrimSpace(cfg.Security))
+	if cfg.Security == "" {
+		cfg.Security = "starttls"
+	}
+	if cfg.Port == 0 {
+		switch cfg.Security {
+		case "tls":
+			cfg.Port = 465
+		case "none":
+			cfg.Port = 25
+		default:
+			cfg.Port = 587
+		}
+	}
+	cfg.Username = strings.TrimSpace(cfg.Username)
+	cfg.From = strings.TrimSpace(cfg.From)
+	to := make([]string, 0, len(cfg.To))
+	for _, addr := range cfg.To {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			to = append(to, addr)
+		}
+	}
+	cfg.To = to
+	cfg.Subject = strings.TrimSpace(cfg.Subject)
+	return cfg
+}
+
+func validateSMTP(cfg config.SMTPConfig) error {
+	if cfg.Host == "" {
+		return errors.New("smtp.host is required")
+	}
+	if !slices.Contains(smtpSecurityModes, cfg.Security) {
+		return fmt.Errorf("smtp.security must be one of %s", strings.Join(smtpSecurityModes, ", "))
+	}
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		return errors.New("smtp.port must be between 1 and 65535")
+	}
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		return fmt.Errorf("smtp.from: %w", err)
+	}
+	if len(cfg.To) == 0 {
+		return errors.New("smtp.to needs at least one address")
+	}
+	for _, addr := range cfg.To {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return fmt.Errorf("smtp.to %q: %w", addr, err)
+		}
+	}
+	if _, err := template.New("subject").Parse(valueOr(cfg.Subject, defaultSMTPSubject)); err != nil {
+		return fmt.Errorf("smtp.subject: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nokia_modem/internal/config"
+	"nokia_modem/internal/router"
+)
+
+type fakeMail struct {
+	From string
+	To   []string
+	Data string
+}
+
+// fakeSMTP is a minimal SMTP server: EHLO, AUTH PLAIN, MAIL, RCPT, DATA
+// and QUIT, enough for net/smtp.
+type fakeSMTP struct {
+	port  int
+	mu    sync.Mutex
+	auth  []string
+	mails []fakeMail
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	f := &fakeSMTP{port: ln.Addr().(*net.TCPAddr).Port}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 localhost ESMTP")
+	var current fakeMail
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "EHLO", "HELO":
+			_ = tp.PrintfLine("250-localhost")
+			_ = tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			decoded, _ := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+			f.mu.Lock()
+			f.auth = append(f.auth, string(decoded))
+			f.mu.Unlock()
+			_ = tp.PrintfLine("235 ok")
+		case "MAIL":
+			current = fakeMail{From: strings.Trim(strings.TrimPrefix(line[5:], "FROM:"), "<> ")}
+			_ = tp.PrintfLine("250 ok")
+		case "RCPT":
+			current.To = append(current.To, strings.Trim(strings.TrimPrefix(line[5:], "TO:"), "<> "))
+			_ = tp.PrintfLine("250 ok")
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			current.Data = string(data)
+			f.mu.Lock()
+			f.mails = append(f.mails, current)
+			f.mu.Unlock()
+			_ = tp.PrintfLine("250 queued")
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func (f *fakeSMTP) received() ([]fakeMail, []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeMail(nil), f.mails...), append([]string(nil), f.auth...)
+}
+
+func TestSmtpNotifierRetriesAcrossRestart(t *testing.T) {
+	srv, emu, _ := newTestServer(t)
+
+	// Nothing listens on this port yet, so the first delivery fails.
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	cfg := srv.getConfig()
+	cfg.LongPolling.Enabled = true
+	cfg.RouterCache.Enabled = false
+	cfg.Notifiers = []config.NotifierConfig{{
+		Name:    "mail",
+		Type:    "smtp",
+		Enabled: true,
+		SMTP: config.SMTPConfig{
+			Host:     "127.0.0.1",
+			Port:     closedPort,
+			Security: "none",
+			Username: "gw",
+			Password: "secret",
+			From:     "Gateway <gw@example.com>",
+			To:       []string{"me@example.com", "you@example.com"},
+			Subject:  "[SMS] {{.Sender}}: {{.Content}}",
+		},
+	}}
+	srv.setConfig(cfg)
+	srv.setClient(router.NewClient(cfg))
+
+	emu.AddSms("BANK", "Kode 123456\nÜberweisung", time.Now())
+	srv.performSmsSync(context.Background())
+
+	// A restart reloads the pending state from sms.json.
+	srv.smsArchive = newSmsArchive(srv.smsArchive.path)
+	if total, pending := srv.smsArchive.Stats(); total != 1 || pending != 1 {
+		t.Fatalf("expected the failed mail to stay pending, got %d/%d", total, pending)
+	}
+
+	smtpSrv := newFakeSMTP(t)
+	cfg.Notifiers[0].SMTP.Port = smtpSrv.port
+	srv.setConfig(cfg)
+	srv.performSmsSync(context.Background())
+	srv.performSmsSync(context.Background())
+
+	mails, auth := smtpSrv.received()
+	if len(mails) != 1 {
+		t.Fatalf("expected one mail, got %d", len(mails))
+	}
+	if len(auth) != 1 || auth[0] != "\x00gw\x00secret" {
+		t.Fatalf("unexpected AUTH PLAIN: %q", auth)
+	}
+	if mails[0].From != "gw@example.com" || strings.Join(mails[0].To, ",") != "me@example.com,you@example.com" {
+		t.Fatalf("unexpected envelope: %+v", mails[0])
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(mails[0].Data))
+	if err != nil {
+		t.Fatalf("parse mail: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != "[SMS] BANK: Kode 123456 Überweisung" {
+		t.Fatalf("unexpected subject %q (%v)", subject, err)
+	}
+	body, _ := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if !strings.Contains(string(body), "Überweisung") {
+		t.Fatalf("unexpected body: %q", body)
+	}
+	if _, pending := srv.smsArchive.Stats(); pending != 0 {
+		t.Fatalf("expected nothing pending after delivery")
+	}
+}
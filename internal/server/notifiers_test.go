@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nokia_modem/internal/config"
+	"nokia_modem/internal/router"
+)
+
+type capturedRequest struct {
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+func TestWebNotifierPayloads(t *testing.T) {
+	var got capturedRequest
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = capturedRequest{Path: r.URL.Path, Header: r.Header.Clone(), Body: body}
+	}))
+	t.Cleanup(hook.Close)
+
+	sms := newSmsNotification(smsMessage{SMSID: "7", SMSHash: "abc", SMSSender: "BANK", SMSContent: "Code 123456"}, time.Now(), 30)
+	notify := func(nc config.NotifierConfig) map[string]interface{} {
+		t.Helper()
+		nc.URL = hook.URL + nc.URL
+		if err := (webNotifier{cfg: nc, client: hook.Client()}).Notify(context.Background(), sms); err != nil {
+			t.Fatalf("%s: %v", nc.Type, err)
+		}
+		var payload map[string]interface{}
+		if err := json.Unmarshal(got.Body, &payload); err != nil {
+			t.Fatalf("%s: decode body: %v", nc.Type, err)
+		}
+		return payload
+	}
+
+	payload := notify(config.NotifierConfig{Type: "ntfy", Topic: "sms", Token: "tk", Priority: 4})
+	if payload["topic"] != "sms" || payload["title"] != "SMS from BANK" || payload["priority"] != float64(4) || got.Header.Get("Authorization") != "Bearer tk" {
+		t.Fatalf("unexpected ntfy request: %v %v", payload, got.Header)
+	}
+	payload = notify(config.NotifierConfig{Type: "gotify", URL: "/gotify/", Token: "app"})
+	if got.Path != "/gotify/message" || got.Header.Get("X-Gotify-Key") != "app" || !strings.Contains(payload["message"].(string), "Code 123456") {
+		t.Fatalf("unexpected gotify request: %s %v", got.Path, payload)
+	}
+	if payload = notify(config.NotifierConfig{Type: "discord"}); !strings.Contains(payload["content"].(string), "Code 123456") {
+		t.Fatalf("unexpected discord payload: %v", payload)
+	}
+	if payload = notify(config.NotifierConfig{Type: "slack"}); !strings.Contains(payload["text"].(string), "SMS from BANK") {
+		t.Fatalf("unexpected slack payload: %v", payload)
+	}
+
+	payload = notify(config.NotifierConfig{Type: "webhook", Secret: "s3cret"})
+	if payload["hash"] != "abc" || payload["poll_interval"] != float64(30) {
+		t.Fatalf("unexpected webhook payload: %v", payload)
+	}
+	if want := "sha256=" + signWebhookBody("s3cret", got.Body); got.Header.Get("X-Signature-256") != want {
+		t.Fatalf("signature = %q, want %q", got.Header.Get("X-Signature-256"), want)
+	}
+
+	alert := newAlertNotification("quota", "Data package main at 80%", "80% used", time.Now())
+	if err := (webNotifier{cfg: config.NotifierConfig{Type: "webhook", URL: hook.URL}, client: hook.Client()}).Alert(context.Background(), alert); err != nil {
+		t.Fatalf("alert: %v", err)
+	}
+	if !strings.Contains(string(got.Body), `"alert":"quota"`) {
+		t.Fatalf("unexpected alert payload: %s", got.Body)
+	}
+
+	for _, bad := range [][]config.NotifierConfig{
+		{{Name: "mqtt", Type: "webhook", URL: "http://x"}},
+		{{Name: "a", Type: "webhook", URL: "http://x"}, {Name: "a", Type: "slack", URL: "http://y"}},
+		{{Name: "a", Type: "pager", URL: "http://x"}},
+		{{Name: "a", Type: "ntfy", URL: "https://ntfy.sh"}},
+		{{Name: "a", Type: "gotify", URL: "ftp://x", Token: "t"}},
+	} {
+		if err := validateNotifiers(bad); err == nil {
+			t.Fatalf("expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestNotifierFailureStaysPendingForThatNotifierOnly(t *testing.T) {
+	srv, emu, httpSrv := newTestServer(t)
+
+	var (
+		mu    sync.Mutex
+		calls = map[string]int{}
+	)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls[r.URL.Path]++
+		n := calls[r.URL.Path]
+		mu.Unlock()
+		if r.URL.Path == "/flaky" && n == 1 {
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(hook.Close)
+
+	cfg := srv.getConfig()
+	cfg.LongPolling.Enabled = true
+	cfg.RouterCache.Enabled = false
+	cfg.Notifiers = []config.NotifierConfig{
+		{Name: "steady", Type: "webhook", Enabled: true, URL: hook.URL + "/steady"},
+		{Name: "flaky", Type: "webhook", Enabled: true, URL: hook.URL + "/flaky"},
+	}
+	srv.setConfig(cfg)
+	srv.setClient(router.NewClient(cfg))
+
+	emu.AddSms("Carrier", "Hello", time.Now())
+	srv.performSmsSync(context.Background())
+
+	var page archivePage
+	getJSON(t, httpSrv.URL+"/api/sms/archive", &page)
+	if page.Total != 1 || !slices.Equal(page.Messages[0].Forwarded, []string{"steady"}) || !slices.Equal(page.Messages[0].Pending, []string{"flaky"}) {
+		t.Fatalf("unexpected delivery state after the first poll: %+v", page.Messages)
+	}
+
+	srv.performSmsSync(context.Background())
+	getJSON(t, httpSrv.URL+"/api/sms/archive", &page)
+	if len(page.Messages[0].Pending) != 0 || !slices.Equal(page.Messages[0].Forwarded, []string{"steady", "flaky"}) {
+		t.Fatalf("unexpected delivery state after the retry: %+v", page.Messages[0])
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if calls["/steady"] != 1 || calls["/flaky"] != 2 {
+		t.Fatalf("unexpected webhook calls: %v", calls)
+	}
+}
+
+func TestTelegramWithoutChatIDIsNotANotifier(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+
+	cfg := srv.getConfig()
+	cfg.LongPolling.Enabled = true
+	cfg.LongPolling.ForwardSmsToTelegram = true
+	cfg.Telegram.Enabled = true
+	cfg.Telegram.ChatID = " "
+	if names := notifierNames(srv.smsNotifiers(cfg, false)); slices.Contains(names, "telegram") {
+		t.Fatalf("expected telegram to be left out without a chat ID, got %v", names)
+	}
+
+	cfg.Telegram.ChatID = "42"
+	if names := notifierNames(srv.smsNotifiers(cfg, false)); !slices.Contains(names, "telegram") {
+		t.Fatalf("expected telegram with a chat ID, got %v", names)
+	}
+}
+
+func TestFailedAlertIsQueuedAndRetriedByThePoller(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+
+	var (
+		mu    sync.Mutex
+		calls = map[string]int{}
+	)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls[r.URL.Path]++
+		n := calls[r.URL.Path]
+		mu.Unlock()
+		if r.URL.Path == "/flaky" && n == 1 {
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(hook.Close)
+
+	cfg := srv.getConfig()
+	cfg.LongPolling.Enabled = true
+	cfg.Notifiers = []config.NotifierConfig{
+		{Name: "steady", Type: "webhook", Enabled: true, Alerts: true, URL: hook.URL + "/steady"},
+		{Name: "flaky", Type: "webhook", Enabled: true, Alerts: true, URL: hook.URL + "/flaky"},
+	}
+	srv.setConfig(cfg)
+
+	srv.notifyAlert(context.Background(), cfg, newAlertNotification("quota", "Data package main at 80%", "800 MB of 1 GB", time.Now()))
+	queue := srv.store.Get().AlertQueue
+	if len(queue) != 1 || !slices.Equal(queue[0].Pending, []string{"flaky"}) || queue[0].Title != "Data package main at 80%" {
+		t.Fatalf("expected the alert to be queued for flaky only: %+v", queue)
+	}
+
+	srv.performSmsSync(context.Background())
+	if queue := srv.store.Get().AlertQueue; len(queue) != 0 {
+		t.Fatalf("expected the queue to drain after a poll: %+v", queue)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if calls["/steady"] != 1 || calls["/flaky"] != 2 {
+		t.Fatalf("unexpected webhook calls: %v", calls)
+	}
+}
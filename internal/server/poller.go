@@ -9,24 +9,59 @@ import (
 	"html"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"nokia_modem/internal/config"
+	"nokia_modem/internal/router"
 )
 
 type smsMessage struct {
-	SMSID         string    `json:"SMSID"`
-	SMSContent    string    `json:"SMSContent"`
-	SMSDateTime   string    `json:"SMSDateTime"`
-	SMSUnread     bool      `json:"SMSUnread"`
-	SMSSender     string    `json:"SMSSender"`
-	SMSHash       string    `json:"hash,omitempty"`
-	NeedsMQTT     bool      `json:"needs_mqtt,omitempty"`
-	NeedsTelegram bool      `json:"needs_telegram,omitempty"`
-	parsedTime    time.Time `json:"-"`
+	SMSID       string `json:"SMSID"`
+	SMSContent  string `json:"SMSContent"`
+	SMSDateTime string `json:"SMSDateTime"`
+	SMSUnread   bool   `json:"SMSUnread"`
+	SMSSender   string `json:"SMSSender"`
+	SMSHash     string `json:"hash,omitempty"`
+
+	// Pending lists the notifiers ("mqtt", "telegram" or the name of a
+	// configured notifier) that still have to deliver the message.
+	Pending []string `json:"pending,omitempty"`
+	// NeedsMQTT and NeedsTelegram are the delivery flags of archives
+	// written before Pending existed; load folds them into Pending.
+	NeedsMQTT     bool `json:"needs_mqtt,omitempty"`
+	NeedsTelegram bool `json:"needs_telegram,omitempty"`
+	// NeedsRules is set on new messages until the SMS rules ran on them.
+	NeedsRules bool `json:"needs_rules,omitempty"`
+
+	// Archive bookkeeping: messages stay in sms.json after they are deleted
+	// on the router, and Hidden removes them from the archive view only.
+	FirstSeen       time.Time `json:"first_seen,omitzero"`
+	DeletedOnRouter bool      `json:"deleted_on_router,omitempty"`
+	DeletedAt       time.Time `json:"deleted_at,omitzero"`
+	Hidden          bool      `json:"hidden,omitempty"`
+	// Forwarded lists the notifiers that delivered it.
+	Forwarded []string `json:"forwarded,omitempty"`
+
+	// Direction is smsDirectionSent for messages sent from the gateway;
+	// older entries leave it empty and are received messages. Sent
+	// messages carry the number in Recipient instead of SMSSender.
+	Direction string `json:"direction,omitempty"`
+	Recipient string `json:"recipient,omitempty"`
+	Segments  int    `json:"segments,omitempty"`
+
+	// Outcome of the SMS rules: the rules that matched, the named groups
+	// they extracted and when the message is due to be deleted on the
+	// router.
+	Rules       []string          `json:"rules,omitempty"`
+	Fields      map[string]string `json:"fields,omitempty"`
+	DeleteAfter time.Time         `json:"delete_after,omitzero"`
+
+	parsedTime time.Time `json:"-"`
 }
 
 type smsArchiveFile struct {
@@ -70,6 +105,13 @@ func (a *smsArchive) ensureLoadedLocked() error {
 	entries := make(map[string]smsMessage, len(file.Messages))
 	for _, msg := range file.Messages {
 		msg.parsedTime = parseSmsTime(msg.SMSDateTime)
+		if msg.NeedsMQTT {
+			msg.Pending = append(msg.Pending, "mqtt")
+		}
+		if msg.NeedsTelegram {
+			msg.Pending = append(msg.Pending, "telegram")
+		}
+		msg.NeedsMQTT, msg.NeedsTelegram = false, false
 		hash := ensureSmsHash(&msg)
 		if strings.TrimSpace(hash) == "" {
 			continue
@@ -81,7 +123,10 @@ func (a *smsArchive) ensureLoadedLocked() error {
 	return nil
 }
 
-func (a *smsArchive) Sync(messages []smsMessage, mqttEnabled bool, telegramEnabled bool) ([]smsMessage, []smsMessage, error) {
+// Sync archives the router's inbox. New messages wait for every notifier
+// in notifiers and, with rulesEnabled, for the SMS rules. It returns the new
+// messages and everything still pending.
+func (a *smsArchive) Sync(messages []smsMessage, notifiers []string, rulesEnabled bool) ([]smsMessage, []smsMessage, error) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
@@ -89,13 +134,9 @@ func (a *smsArchive) Sync(messages []smsMessage, mqttEnabled bool, telegramEnabl
 		return nil, nil, fmt.Errorf("load sms archive: %w", err)
 	}
 
-	if len(messages) == 0 {
-		pending := a.collectPendingLocked()
-		return nil, pending, nil
-	}
-
+	now := time.Now().UTC()
 	newMessages := make([]smsMessage, 0)
-	newEntries := make(map[string]smsMessage, len(messages))
+	onRouter := make(map[string]bool, len(messages))
 
 	for _, incoming := range messages {
 		msgCopy := incoming
@@ -103,26 +144,42 @@ func (a *smsArchive) Sync(messages []smsMessage, mqttEnabled bool, telegramEnabl
 		if strings.TrimSpace(hash) == "" {
 			continue
 		}
+		onRouter[hash] = true
 		if existing, exists := a.entries[hash]; !exists {
 			msgCopy.parsedTime = parseSmsTime(msgCopy.SMSDateTime)
-			msgCopy.NeedsMQTT = mqttEnabled
-			msgCopy.NeedsTelegram = telegramEnabled
+			msgCopy.Pending = slices.Clone(notifiers)
+			msgCopy.NeedsRules = rulesEnabled
+			msgCopy.FirstSeen = now
 			newMessages = append(newMessages, msgCopy)
 		} else {
 			if existing.parsedTime.IsZero() {
 				existing.parsedTime = parseSmsTime(existing.SMSDateTime)
 			}
 			msgCopy.parsedTime = existing.parsedTime
-			msgCopy.NeedsMQTT = existing.NeedsMQTT
-			msgCopy.NeedsTelegram = existing.NeedsTelegram
+			msgCopy.Pending = existing.Pending
+			msgCopy.NeedsRules = existing.NeedsRules
+			msgCopy.FirstSeen = existing.FirstSeen
+			msgCopy.Hidden = existing.Hidden
+			msgCopy.Forwarded = existing.Forwarded
+			msgCopy.Rules = existing.Rules
+			msgCopy.Fields = existing.Fields
+			msgCopy.DeleteAfter = existing.DeleteAfter
 		}
 		if msgCopy.parsedTime.IsZero() {
 			msgCopy.parsedTime = parseSmsTime(msgCopy.SMSDateTime)
 		}
-		newEntries[hash] = msgCopy
+		a.entries[hash] = msgCopy
 	}
 
-	a.entries = newEntries
+	// Everything the router no longer lists stays archived. Sent messages
+	// never show up in the inbox in the first place.
+	for hash, msg := range a.entries {
+		if !onRouter[hash] && !msg.DeletedOnRouter && !msg.sent() {
+			msg.DeletedOnRouter = true
+			msg.DeletedAt = now
+			a.entries[hash] = msg
+		}
+	}
 
 	pending := a.collectPendingLocked()
 
@@ -143,13 +200,83 @@ func (a *smsArchive) saveLocked(file smsArchiveFile) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(a.path, data, 0o644)
+	// Replace the file in one step so Each never reads a half-written one.
+	tmp, err := os.CreateTemp(dir, "sms-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), a.path)
+}
+
+// Each calls fn for every archived message in file order (newest first),
+// decoding sms.json one message at a time instead of loading it. Saves
+// replace the file atomically, so an export in progress keeps reading the
+// version it opened.
+func (a *smsArchive) Each(fn func(smsMessage) error) error {
+	file, err := os.Open(a.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	dec := json.NewDecoder(file)
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("read sms archive: %w", err)
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("read sms archive: %w", err)
+		}
+		if key != "messages" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fmt.Errorf("read sms archive: %w", err)
+			}
+			continue
+		}
+		if tok, err := dec.Token(); err != nil {
+			return fmt.Errorf("read sms archive: %w", err)
+		} else if tok == nil {
+			continue
+		}
+		for dec.More() {
+			var msg smsMessage
+			if err := dec.Decode(&msg); err != nil {
+				return fmt.Errorf("read sms archive: %w", err)
+			}
+			msg.parsedTime = parseSmsTime(msg.SMSDateTime)
+			if err := fn(msg); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return fmt.Errorf("read sms archive: %w", err)
+		}
+	}
+	return nil
 }
 
 func (a *smsArchive) collectPendingLocked() []smsMessage {
 	pending := make([]smsMessage, 0)
 	for _, msg := range a.entries {
-		if msg.NeedsMQTT || msg.NeedsTelegram {
+		if msg.pending() {
 			pending = append(pending, msg)
 		}
 	}
@@ -157,7 +284,35 @@ func (a *smsArchive) collectPendingLocked() []smsMessage {
 	return pending
 }
 
-func (a *smsArchive) SetPending(hash string, needsMQTT, needsTelegram bool) error {
+func (m smsMessage) pending() bool {
+	return len(m.Pending) > 0 || m.NeedsRules
+}
+
+// Stats returns the number of archived messages and how many of them still
+// wait for the SMS rules or for MQTT or Telegram delivery.
+func (a *smsArchive) Stats() (total int, pending int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.ensureLoadedLocked(); err != nil {
+		return 0, 0
+	}
+	for _, msg := range a.entries {
+		if msg.pending() {
+			pending++
+		}
+	}
+	return len(a.entries), pending
+}
+
+// MarkDelivered takes the notifiers in delivered and dropped off the
+// message's pending list and records the delivered ones as having
+// forwarded it.
+func (a *smsArchive) MarkDelivered(hash string, delivered, dropped []string) error {
+	if len(delivered) == 0 && len(dropped) == 0 {
+		return nil
+	}
+
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
@@ -170,12 +325,16 @@ func (a *smsArchive) SetPending(hash string, needsMQTT, needsTelegram bool) erro
 		return fmt.Errorf("sms %s not found in archive", hash)
 	}
 
-	if msg.NeedsMQTT == needsMQTT && msg.NeedsTelegram == needsTelegram {
-		return nil
+	msg.Pending = slices.DeleteFunc(slices.Clone(msg.Pending), func(name string) bool {
+		return slices.Contains(delivered, name) || slices.Contains(dropped, name)
+	})
+	forwarded := slices.Clone(msg.Forwarded)
+	for _, name := range delivered {
+		if !slices.Contains(forwarded, name) {
+			forwarded = append(forwarded, name)
+		}
 	}
-
-	msg.NeedsMQTT = needsMQTT
-	msg.NeedsTelegram = needsTelegram
+	msg.Forwarded = forwarded
 	a.entries[hash] = msg
 
 	return a.persistLocked()
@@ -225,6 +384,12 @@ func ensureSmsHash(msg *smsMessage) string {
 func computeSmsHash(msg *smsMessage) string {
 	sender := normalizedSmsSender(msg.SMSSender)
 	timestamp := normalizedSmsTimestamp(msg.SMSDateTime)
+	if msg.sent() {
+		// The same text can go to the same number twice in one second, so
+		// sent messages are told apart by when they were recorded.
+		sender = "to:" + normalizedSmsSender(msg.Recipient)
+		timestamp += "@" + strconv.FormatInt(msg.FirstSeen.UnixNano(), 10)
+	}
 	content := normalizedSmsContent(msg.SMSContent)
 
 	base := strings.Join([]string{sender, timestamp, content}, "\n")
@@ -271,7 +436,8 @@ func normalizedSmsContent(raw string) string {
 }
 
 func (s *Server) configureSmsForwarding(cfg config.Config) {
-	shouldStart := cfg.LongPolling.Enabled && (cfg.LongPolling.ForwardSmsToTelegram || cfg.MQTT.Enabled)
+	notifiersEnabled := slices.ContainsFunc(cfg.Notifiers, func(n config.NotifierConfig) bool { return n.Enabled })
+	shouldStart := cfg.LongPolling.Enabled && (cfg.LongPolling.ForwardSmsToTelegram || cfg.MQTT.Enabled || notifiersEnabled || len(cfg.SmsRules.Rules) > 0)
 
 	var (
 		start bool
@@ -365,17 +531,19 @@ func (s *Server) performSmsSync(ctx context.Context) {
 	mqttConfigured := cfg.MQTT.Enabled && cfg.LongPolling.Enabled
 	telegramConfigured := cfg.Telegram.Enabled && cfg.LongPolling.ForwardSmsToTelegram
 
-	newMessages, pendingMessages, err := s.smsArchive.Sync(messages, mqttConfigured, telegramConfigured)
+	rulesConfigured := cfg.LongPolling.Enabled && len(cfg.SmsRules.Rules) > 0
+
+	mqttConnected := s.mqttConnected()
+	mqttReady := mqttConfigured && mqttConnected
+	notifiers := s.smsNotifiers(cfg, mqttReady)
+
+	newMessages, pendingMessages, err := s.smsArchive.Sync(messages, notifierNames(notifiers), rulesConfigured)
 	if err != nil {
 		s.logger.Printf("poller: persist failed: %v", err)
 		return
 	}
+	s.deleteExpiredSms(ctx)
 
-	s.mqttMu.Lock()
-	mqttClient := s.mqttClient
-	s.mqttMu.Unlock()
-	mqttConnected := mqttClient != nil && mqttClient.IsConnected()
-	mqttReady := mqttConfigured && mqttConnected
 	now := time.Now().UTC()
 	statusPayload := map[string]interface{}{
 		"polled_at":         now.Format(time.RFC3339),
@@ -387,6 +555,7 @@ func (s *Server) performSmsSync(ctx context.Context) {
 		"mqtt_connected":    mqttConnected,
 		"mqtt_ready":        mqttReady,
 		"telegram_enabled":  telegramConfigured,
+		"notifiers":         notifierNames(notifiers),
 		"queued_messages":   len(pendingMessages),
 	}
 
@@ -407,6 +576,16 @@ func (s *Server) performSmsSync(ctx context.Context) {
 	if mqttReady {
 		s.publishMqttSafe("status", statusPayload)
 
+		if cfg.MQTT.HomeAssistant {
+			var haStatus map[string]interface{}
+			if statusErr == nil {
+				haStatus = statusWeb
+			}
+			haCtx, haCancel := context.WithTimeout(ctx, 20*time.Second)
+			s.publishHAState(haCtx, haStatus)
+			haCancel()
+		}
+
 		dailyPayload := buildDailyUsageSnapshot(settingsSnapshot)
 		dailyPayload["polled_at"] = now.Format(time.RFC3339)
 		dailyPayload["source"] = "poller"
@@ -454,23 +633,19 @@ func (s *Server) performSmsSync(ctx context.Context) {
 	}
 
 	if len(pendingMessages) > 0 {
-		s.deliverPendingMessages(ctx, cfg, pendingMessages, mqttConfigured, mqttReady, telegramConfigured, now)
+		s.deliverPendingMessages(ctx, cfg, pendingMessages, notifiers, now)
 	}
+	s.retryQueuedAlerts(ctx, cfg)
 }
 
-func (s *Server) deliverPendingMessages(ctx context.Context, cfg config.Config, pending []smsMessage, mqttConfigured, mqttReady bool, telegramConfigured bool, now time.Time) {
-	publishTime := now.Format(time.RFC3339)
-	parseMode := strings.TrimSpace(cfg.Telegram.ParseMode)
-
-	telegramSendReady := false
-	chatID := ""
-	if telegramConfigured {
-		chatID = strings.TrimSpace(cfg.Telegram.ChatID)
-		if chatID == "" {
-			s.logger.Printf("poller: telegram chat id missing")
-		} else {
-			telegramSendReady = true
-		}
+// deliverPendingMessages runs the SMS rules on new messages and hands each
+// message to the notifiers it is still pending for. A notifier that fails
+// keeps the message pending and is retried on the next poll; names that are
+// no longer configured are dropped.
+func (s *Server) deliverPendingMessages(ctx context.Context, cfg config.Config, pending []smsMessage, notifiers []Notifier, now time.Time) {
+	byName := make(map[string]Notifier, len(notifiers))
+	for _, n := range notifiers {
+		byName[n.Name()] = n
 	}
 
 	for _, msg := range pending {
@@ -479,164 +654,82 @@ func (s *Server) deliverPendingMessages(ctx context.Context, cfg config.Config,
 			continue
 		}
 
-		payload := map[string]interface{}{
-			"id":            msg.SMSID,
-			"hash":          hash,
-			"sender":        strings.TrimSpace(msg.SMSSender),
-			"content":       msg.SMSContent,
-			"timestamp":     msg.SMSDateTime,
-			"display_time":  formatSmsDisplayTime(msg),
-			"unread":        msg.SMSUnread,
-			"received_at":   publishTime,
-			"poll_interval": cfg.LongPolling.IntervalSeconds,
-		}
-
-		needsMQTT := msg.NeedsMQTT
-		needsTelegram := msg.NeedsTelegram
-
-		if needsMQTT {
-			if !mqttConfigured {
-				needsMQTT = false
-			} else if mqttReady {
-				if err := s.publishMqtt("sms", payload); err != nil {
-					s.logger.Printf("poller: mqtt send failed for SMS %s (hash %s): %v", msg.SMSID, hash, err)
-				} else {
-					needsMQTT = false
-				}
+		if msg.NeedsRules {
+			outcome := s.applySmsRules(ctx, cfg, msg, now)
+			if err := s.smsArchive.SetRuleOutcome(hash, outcome); err != nil {
+				s.logger.Printf("poller: record rule outcome failed for sms %s: %v", hash, err)
 			}
 		}
+		if len(msg.Pending) == 0 {
+			continue
+		}
 
-		if needsTelegram {
-			if !telegramConfigured {
-				needsTelegram = false
-			} else if telegramSendReady {
-				messageText, resolvedParseMode := formatSmsForTelegram(msg, parseMode)
-				sendCtx, sendCancel := context.WithTimeout(ctx, 15*time.Second)
-				err := s.sendTelegramMessage(sendCtx, cfg.Telegram, chatID, resolvedParseMode, messageText)
-				sendCancel()
-				if err != nil {
-					s.logger.Printf("poller: telegram send failed for SMS %s (hash %s): %v", msg.SMSID, hash, err)
-				} else {
-					needsTelegram = false
-					s.logger.Printf("poller: forwarded SMS %s to Telegram", msg.SMSID)
-				}
+		notification := newSmsNotification(msg, now, cfg.LongPolling.IntervalSeconds)
+		var delivered, dropped []string
+		for _, name := range msg.Pending {
+			notifier, ok := byName[name]
+			if !ok {
+				dropped = append(dropped, name)
+				continue
+			}
+			sendCtx, sendCancel := context.WithTimeout(ctx, 15*time.Second)
+			err := notifier.Notify(sendCtx, notification)
+			sendCancel()
+			switch {
+			case errors.Is(err, errNotifierUnavailable):
+			case err != nil:
+				s.logger.Printf("poller: %s send failed for SMS %s (hash %s): %v", name, msg.SMSID, hash, err)
+			default:
+				delivered = append(delivered, name)
+				s.logger.Printf("poller: forwarded SMS %s to %s", msg.SMSID, name)
 			}
 		}
 
-		if err := s.smsArchive.SetPending(hash, needsMQTT, needsTelegram); err != nil {
-			s.logger.Printf("poller: update delivery flags failed for sms %s: %v", hash, err)
+		if err := s.smsArchive.MarkDelivered(hash, delivered, dropped); err != nil {
+			s.logger.Printf("poller: update delivery state failed for sms %s: %v", hash, err)
 		}
 	}
 }
 
 func (s *Server) fetchSmsMessages(ctx context.Context) ([]smsMessage, error) {
-	client := s.getClient()
-	session, _, err := client.GetLogin(ctx, false)
-	if err != nil {
-		return nil, fmt.Errorf("login: %w", err)
-	}
-	if session == nil {
-		return nil, errors.New("login failed: no session")
-	}
-
-	payload, err := client.GetSmsList(ctx, session)
+	payload, err := s.getClient().GetSmsList(ctx)
 	if err != nil {
-		session, _, relogErr := client.GetLogin(ctx, true)
-		if relogErr != nil {
-			return nil, fmt.Errorf("sms list: relogin failed: %w", relogErr)
-		}
-		if session == nil {
-			return nil, errors.New("sms list: relogin failed: no session")
-		}
-		payload, err = client.GetSmsList(ctx, session)
-		if err != nil {
-			return nil, fmt.Errorf("sms list: %w", err)
-		}
+		return nil, fmt.Errorf("sms list: %w", err)
 	}
-
 	return normalizeSmsMessages(payload), nil
 }
 
 func (s *Server) fetchStatusWeb(ctx context.Context) (map[string]interface{}, error) {
-	client := s.getClient()
-	session, _, err := client.GetLogin(ctx, false)
+	data, err := s.getClient().GetStatusWeb(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("login: %w", err)
-	}
-	if session == nil {
-		return nil, errors.New("status_web: no session")
-	}
-
-	data, err := client.GetStatusWeb(ctx, session)
-	if err != nil {
-		session, _, relogErr := client.GetLogin(ctx, true)
-		if relogErr != nil {
-			return nil, fmt.Errorf("status_web: relogin failed: %w", relogErr)
-		}
-		if session == nil {
-			return nil, errors.New("status_web: relogin failed: no session")
-		}
-		data, err = client.GetStatusWeb(ctx, session)
-		if err != nil {
-			return nil, fmt.Errorf("status_web: %w", err)
-		}
+		return nil, fmt.Errorf("status_web: %w", err)
 	}
 	return data, nil
 }
 
 func (s *Server) fetchServiceData(ctx context.Context) (map[string]interface{}, error) {
-	client := s.getClient()
-	session, _, err := client.GetLogin(ctx, false)
+	data, err := s.getClient().PostServiceData(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("login: %w", err)
-	}
-	if session == nil {
-		return nil, errors.New("service_data: no session")
-	}
-
-	data, err := client.PostServiceData(ctx, session)
-	if err != nil {
-		session, _, relogErr := client.GetLogin(ctx, true)
-		if relogErr != nil {
-			return nil, fmt.Errorf("service_data: relogin failed: %w", relogErr)
-		}
-		if session == nil {
-			return nil, errors.New("service_data: relogin failed: no session")
-		}
-		data, err = client.PostServiceData(ctx, session)
-		if err != nil {
-			return nil, fmt.Errorf("service_data: %w", err)
-		}
+		return nil, fmt.Errorf("service_data: %w", err)
 	}
 	return data, nil
 }
 
-func normalizeSmsMessages(raw interface{}) []smsMessage {
-	items := extractSmsItems(raw)
-	if len(items) == 0 {
+func normalizeSmsMessages(raw map[string]interface{}) []smsMessage {
+	list, err := router.ParseSmsList(raw)
+	if err != nil || len(list.Messages) == 0 {
 		return []smsMessage{}
 	}
 
-	messages := make([]smsMessage, 0, len(items))
-	for _, item := range items {
+	messages := make([]smsMessage, 0, len(list.Messages))
+	for _, item := range list.Messages {
 		msg := smsMessage{
-			SMSID:       firstString(item, "SMSID", "smsid", "id"),
-			SMSContent:  firstString(item, "SMSContent", "sms_content", "Body", "body"),
-			SMSDateTime: firstString(item, "SMSDateTime", "sms_datetime", "Timestamp", "timestamp"),
-			SMSSender:   firstString(item, "SMSSender", "sms_sender", "From", "from"),
-			SMSUnread:   true,
-		}
-
-		if candidate, ok := firstValue(item, "SMSUnread", "sms_unread", "Unread", "unread"); ok {
-			msg.SMSUnread = toBool(candidate, true)
-		} else if candidate, ok := item["Read"]; ok {
-			msg.SMSUnread = !toBool(candidate, false)
+			SMSID:       item.SMSID,
+			SMSContent:  item.SMSContent,
+			SMSDateTime: item.SMSDateTime,
+			SMSSender:   item.SMSSender,
+			SMSUnread:   item.SMSUnread,
 		}
-
-		if msg.SMSID == "" {
-			continue
-		}
-
 		msg.parsedTime = parseSmsTime(msg.SMSDateTime)
 		messages = append(messages, msg)
 	}
@@ -659,127 +752,6 @@ func normalizeSmsMessages(raw interface{}) []smsMessage {
 	return messages
 }
 
-func extractSmsItems(raw interface{}) []map[string]interface{} {
-	switch v := raw.(type) {
-	case map[string]interface{}:
-		if list := extractSmsItems(v["FunctionResult"]); len(list) > 0 {
-			return list
-		}
-		if list := extractSmsItems(v["SMSList"]); len(list) > 0 {
-			return list
-		}
-		if list := extractSmsItems(v["sms_list"]); len(list) > 0 {
-			return list
-		}
-		if nested, ok := v["Data"]; ok {
-			if list := extractSmsItems(nested); len(list) > 0 {
-				return list
-			}
-		}
-		if nested, ok := v["data"]; ok {
-			if list := extractSmsItems(nested); len(list) > 0 {
-				return list
-			}
-		}
-		return nil
-	case []interface{}:
-		result := make([]map[string]interface{}, 0, len(v))
-		for _, item := range v {
-			if m, ok := item.(map[string]interface{}); ok {
-				result = append(result, m)
-			}
-		}
-		return result
-	default:
-		return nil
-	}
-}
-
-func firstString(item map[string]interface{}, keys ...string) string {
-	for _, key := range keys {
-		if val, ok := item[key]; ok {
-			if s := toString(val); s != "" {
-				return s
-			}
-		}
-	}
-	return ""
-}
-
-func firstValue(item map[string]interface{}, keys ...string) (interface{}, bool) {
-	for _, key := range keys {
-		if val, ok := item[key]; ok {
-			return val, true
-		}
-	}
-	return nil, false
-}
-
-func toString(value interface{}) string {
-	if value == nil {
-		return ""
-	}
-
-	switch v := value.(type) {
-	case string:
-		return strings.TrimSpace(v)
-	case json.Number:
-		return strings.TrimSpace(v.String())
-	case fmt.Stringer:
-		return strings.TrimSpace(v.String())
-	case float64, float32, int, int64, int32, int16, int8, uint, uint64, uint32, uint16, uint8:
-		return strings.TrimSpace(fmt.Sprintf("%v", v))
-	case bool:
-		if v {
-			return "true"
-		}
-		return "false"
-	default:
-		return ""
-	}
-}
-
-func toBool(value interface{}, fallback bool) bool {
-	switch v := value.(type) {
-	case bool:
-		return v
-	case string:
-		switch strings.ToLower(strings.TrimSpace(v)) {
-		case "1", "true", "yes", "on":
-			return true
-		case "0", "false", "no", "off":
-			return false
-		default:
-			return fallback
-		}
-	case float64:
-		return v != 0
-	case float32:
-		return v != 0
-	case int:
-		return v != 0
-	case int32:
-		return v != 0
-	case int64:
-		return v != 0
-	case uint:
-		return v != 0
-	case uint8:
-		return v != 0
-	case uint16:
-		return v != 0
-	case uint32:
-		return v != 0
-	case uint64:
-		return v != 0
-	case json.Number:
-		if val, err := v.Int64(); err == nil {
-			return val != 0
-		}
-	}
-	return fallback
-}
-
 func parseSmsTime(value string) time.Time {
 	value = strings.TrimSpace(value)
 	if value == "" {
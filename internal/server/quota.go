@@ -0,0 +1,465 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"nokia_modem/internal/config"
+	"nokia_modem/internal/settings"
+)
+
+const (
+	quotaDateLayout = "2006-01-02"
+	// quotaBurnWindow is how many days, today included, the burn rate used
+	// for the depletion projection looks back.
+	quotaBurnWindow = 7
+
+	quotaUpcoming = "upcoming"
+	quotaActive   = "active"
+	quotaDepleted = "depleted"
+	quotaExpired  = "expired"
+)
+
+// quotaPackageStatus is the state of one data package in its current cycle.
+// CycleEnd is exclusive: the day the package renews or expires.
+type quotaPackageStatus struct {
+	Name                string  `json:"name"`
+	Status              string  `json:"status"`
+	CycleStart          string  `json:"cycle_start"`
+	CycleEnd            string  `json:"cycle_end"`
+	QuotaBytes          int64   `json:"quota_bytes"`
+	UsedBytes           int64   `json:"used_bytes"`
+	RemainingBytes      int64   `json:"remaining_bytes"`
+	Percent             float64 `json:"percent"`
+	Quota               string  `json:"quota"`
+	Used                string  `json:"used"`
+	Remaining           string  `json:"remaining"`
+	BurnRateBytesPerDay int64   `json:"burn_rate_bytes_per_day"`
+	ProjectedDepletion  string  `json:"projected_depletion,omitempty"`
+	DepletesBeforeEnd   bool    `json:"depletes_before_end"`
+}
+
+// quotaCycle returns the cycle of pkg that contains now, or its first cycle
+// when the package has not started yet. A one-off package keeps its only
+// cycle after it ends.
+func quotaCycle(pkg config.QuotaPackage, now time.Time) (time.Time, time.Time, error) {
+	loc := now.Location()
+	start, err := time.ParseInLocation(quotaDateLayout, pkg.StartDate, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("start_date: %w", err)
+	}
+	if pkg.ResetDay <= 0 {
+		return start, start.AddDate(0, 0, pkg.ValidityDays), nil
+	}
+
+	from := now
+	if from.Before(start) {
+		from = start
+	}
+	current := quotaResetDate(from.Year(), from.Month(), pkg.ResetDay, loc)
+	if current.After(from) {
+		current = quotaResetDate(from.Year(), from.Month()-1, pkg.ResetDay, loc)
+	}
+	next := quotaResetDate(current.Year(), current.Month()+1, pkg.ResetDay, loc)
+	// The first cycle runs from the start date to the first reset day.
+	if current.Before(start) {
+		current = start
+	}
+	return current, next, nil
+}
+
+// quotaResetDate is the reset day in the given month, moved to the last day
+// for short months.
+func quotaResetDate(year int, month time.Month, day int, loc *time.Location) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, loc)
+}
+
+// computeQuota charges daily usage to the packages whose cycle covers each
+// day. Packages are filled in configuration order; traffic beyond every
+// quota counts against the last package covering the day, so overuse shows
+// up as more than 100%.
+func computeQuota(packages []config.QuotaPackage, usage map[string]settings.UsageStats, now time.Time) []quotaPackageStatus {
+	loc := now.Location()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	type window struct {
+		start, end, burnFrom time.Time
+		ok                   bool
+	}
+	windows := make([]window, len(packages))
+	for i, pkg := range packages {
+		start, end, err := quotaCycle(pkg, now)
+		if err != nil {
+			continue
+		}
+		burnFrom := today.AddDate(0, 0, 1-quotaBurnWindow)
+		if burnFrom.Before(start) {
+			burnFrom = start
+		}
+		windows[i] = window{start: start, end: end, burnFrom: burnFrom, ok: true}
+	}
+
+	dates := make([]string, 0, len(usage))
+	for date := range usage {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	used := make([]int64, len(packages))
+	recent := make([]int64, len(packages))
+	for _, date := range dates {
+		day, err := time.ParseInLocation(quotaDateLayout, date, loc)
+		if err != nil {
+			continue
+		}
+		left := usage[date].Upload + usage[date].Download
+		last := -1
+		charge := func(i int, n int64) {
+			used[i] += n
+			if !day.Before(windows[i].burnFrom) {
+				recent[i] += n
+			}
+			left -= n
+		}
+		for i, pkg := range packages {
+			w := windows[i]
+			if !w.ok || day.Before(w.start) || !day.Before(w.end) {
+				continue
+			}
+			last = i
+			if free := pkg.QuotaBytes - used[i]; free > 0 && left > 0 {
+				charge(i, min(free, left))
+			}
+		}
+		if last >= 0 && left > 0 {
+			charge(last, left)
+		}
+	}
+
+	statuses := make([]quotaPackageStatus, 0, len(packages))
+	for i, pkg := range packages {
+		w := windows[i]
+		if !w.ok {
+			continue
+		}
+		remaining := max(pkg.QuotaBytes-used[i], 0)
+		status := quotaPackageStatus{
+			Name:           pkg.Name,
+			CycleStart:     w.start.Format(quotaDateLayout),
+			CycleEnd:       w.end.Format(quotaDateLayout),
+			QuotaBytes:     pkg.QuotaBytes,
+			UsedBytes:      used[i],
+			RemainingBytes: remaining,
+			Percent:        percentage(used[i], pkg.QuotaBytes),
+			Quota:          formatBytes(pkg.QuotaBytes),
+			Used:           formatBytes(used[i]),
+			Remaining:      formatBytes(remaining),
+		}
+		switch {
+		case now.Before(w.start):
+			status.Status = quotaUpcoming
+		case !now.Before(w.end):
+			status.Status = quotaExpired
+		case remaining == 0:
+			status.Status = quotaDepleted
+		default:
+			status.Status = quotaActive
+		}
+
+		if status.Status == quotaActive {
+			// A cycle that began minutes ago would otherwise extrapolate a
+			// single burst to a whole day.
+			days := max(now.Sub(w.burnFrom).Hours()/24, 1)
+			rate := float64(recent[i]) / days
+			status.BurnRateBytesPerDay = int64(rate)
+			if rate > 0 {
+				depletion := now.Add(time.Duration(float64(remaining) / rate * float64(24*time.Hour)))
+				status.ProjectedDepletion = depletion.Format(time.RFC3339)
+				status.DepletesBeforeEnd = depletion.Before(w.end)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func buildQuotaSnapshot(cfg config.QuotaConfig, settingsData settings.Settings, now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"generated_at": now.UTC().Format(time.RFC3339),
+		"thresholds":   cfg.Thresholds,
+		"packages":     computeQuota(cfg.Packages, settingsData.DailyUsage, now),
+	}
+}
+
+func (s *Server) handleQuota(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg := s.getConfig()
+	writeJSON(w, http.StatusOK, buildQuotaSnapshot(cfg.Quota, s.store.Get(), time.Now()))
+}
+
+func quotaConfigsEqual(a, b config.QuotaConfig) bool {
+	return slices.Equal(a.Packages, b.Packages) &&
+		slices.Equal(a.Thresholds, b.Thresholds) &&
+		a.IntervalSeconds == b.IntervalSeconds
+}
+
+// configureQuota runs the quota monitor while packages are configured. The
+// monitor keeps daily usage current and sends the threshold notifications.
+func (s *Server) configureQuota(cfg config.Config) {
+	var (
+		start bool
+		stop  context.CancelFunc
+		ctx   context.Context
+	)
+	enabled := len(cfg.Quota.Packages) > 0
+
+	s.quotaMu.Lock()
+	running := s.quotaCancel != nil
+	changed := !quotaConfigsEqual(s.quotaCfg, cfg.Quota)
+
+	if running && (changed || !enabled) {
+		stop = s.quotaCancel
+		s.quotaCancel = nil
+		running = false
+	}
+	if enabled && !running {
+		ctx, s.quotaCancel = context.WithCancel(context.Background())
+		s.quotaWG.Add(1)
+		start = true
+	}
+	s.quotaCfg = cfg.Quota
+	s.quotaMu.Unlock()
+
+	if stop != nil {
+		stop()
+		s.quotaWG.Wait()
+		s.logger.Printf("quota: monitor stopped")
+	}
+
+	if start {
+		interval := quotaInterval(cfg.Quota)
+		go s.runQuotaMonitor(ctx, interval)
+		s.logger.Printf("quota: monitor started (%d packages, interval %s)", len(cfg.Quota.Packages), interval)
+	}
+}
+
+func quotaInterval(cfg config.QuotaConfig) time.Duration {
+	seconds := cfg.IntervalSeconds
+	if seconds < 60 {
+		seconds = 300
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func (s *Server) runQuotaMonitor(ctx context.Context, interval time.Duration) {
+	defer s.quotaWG.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s.checkQuota(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkQuota(ctx)
+		}
+	}
+}
+
+// checkQuota refreshes the usage counters, publishes the quota state and
+// sends notifications for newly crossed thresholds. A failed router fetch
+// still evaluates the usage recorded so far.
+func (s *Server) checkQuota(ctx context.Context) {
+	statusCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	status, err := s.fetchStatusWeb(statusCtx)
+	cancel()
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		s.logger.Printf("quota: %v", err)
+	} else if err := s.store.UpdateUsageFromStatus(status); err != nil {
+		s.logger.Printf("quota: update usage failed: %v", err)
+	}
+
+	cfg := s.getConfig()
+	now := time.Now()
+	snapshot := buildQuotaSnapshot(cfg.Quota, s.store.Get(), now)
+	s.publishMqttSafe("quota", snapshot)
+
+	alerts, err := s.dueQuotaAlerts(cfg.Quota, snapshot["packages"].([]quotaPackageStatus))
+	if err != nil {
+		s.logger.Printf("quota: persist alert state failed: %v", err)
+		return
+	}
+	for _, alert := range alerts {
+		s.sendQuotaAlert(ctx, cfg, alert, now)
+	}
+}
+
+type quotaAlert struct {
+	pkg       quotaPackageStatus
+	threshold int
+}
+
+// dueQuotaAlerts records every threshold each package has reached in its
+// current cycle and returns one alert per package for the highest threshold
+// that was not reached before, so a package that jumps past several
+// thresholds at once notifies only once.
+func (s *Server) dueQuotaAlerts(cfg config.QuotaConfig, packages []quotaPackageStatus) ([]quotaAlert, error) {
+	var alerts []quotaAlert
+	err := s.store.Update(func(data *settings.Settings) error {
+		alerts = nil
+		if data.QuotaAlerts == nil {
+			data.QuotaAlerts = map[string]settings.QuotaAlertState{}
+		}
+		seen := map[string]bool{}
+		for _, pkg := range packages {
+			seen[pkg.Name] = true
+			if pkg.Status != quotaActive && pkg.Status != quotaDepleted {
+				continue
+			}
+			state := data.QuotaAlerts[pkg.Name]
+			if state.CycleStart != pkg.CycleStart {
+				state = settings.QuotaAlertState{CycleStart: pkg.CycleStart}
+			}
+			crossed := 0
+			for _, threshold := range cfg.Thresholds {
+				if pkg.Percent >= float64(threshold) && !slices.Contains(state.Notified, threshold) {
+					state.Notified = append(state.Notified, threshold)
+					crossed = max(crossed, threshold)
+				}
+			}
+			if crossed > 0 {
+				alerts = append(alerts, quotaAlert{pkg: pkg, threshold: crossed})
+			}
+			data.QuotaAlerts[pkg.Name] = state
+		}
+		for name := range data.QuotaAlerts {
+			if !seen[name] {
+				delete(data.QuotaAlerts, name)
+			}
+		}
+		return nil
+	})
+	return alerts, err
+}
+
+func (s *Server) sendQuotaAlert(ctx context.Context, cfg config.Config, alert quotaAlert, now time.Time) {
+	pkg := alert.pkg
+	s.logger.Printf("quota: %s reached %d%% (%s of %s)", pkg.Name, alert.threshold, pkg.Used, pkg.Quota)
+
+	title := fmt.Sprintf("Data package %s at %d%%", pkg.Name, alert.threshold)
+	notification := newAlertNotification("quota", title, formatQuotaAlert(alert), now)
+	notification.Topic = "quota/alert"
+	notification.Details = map[string]interface{}{
+		"triggered_at":    now.UTC().Format(time.RFC3339),
+		"package":         pkg.Name,
+		"threshold":       alert.threshold,
+		"percent":         pkg.Percent,
+		"used_bytes":      pkg.UsedBytes,
+		"quota_bytes":     pkg.QuotaBytes,
+		"remaining_bytes": pkg.RemainingBytes,
+		"cycle_end":       pkg.CycleEnd,
+	}
+	s.notifyAlert(ctx, cfg, notification)
+}
+
+func formatQuotaAlert(alert quotaAlert) string {
+	pkg := alert.pkg
+	text := fmt.Sprintf("Data package %q reached %d%%: %s of %s used, %s left until %s.",
+		pkg.Name, alert.threshold, pkg.Used, pkg.Quota, pkg.Remaining, pkg.CycleEnd)
+	if pkg.DepletesBeforeEnd {
+		if depletion, err := time.Parse(time.RFC3339, pkg.ProjectedDepletion); err == nil {
+			text += fmt.Sprintf(" At the current rate it runs out around %s.", depletion.Local().Format("2006-01-02 15:04"))
+		}
+	}
+	return text
+}
+
+func normalizeQuota(cfg config.QuotaConfig) config.QuotaConfig {
+	packages := make([]config.QuotaPackage, 0, len(cfg.Packages))
+	for _, pkg := range cfg.Packages {
+		pkg.Name = strings.TrimSpace(pkg.Name)
+		pkg.StartDate = strings.TrimSpace(pkg.StartDate)
+		packages = append(packages, pkg)
+	}
+	thresholds := slices.Clone(cfg.Thresholds)
+	if thresholds == nil {
+		thresholds = []int{}
+	}
+	slices.Sort(thresholds)
+	return config.QuotaConfig{
+		Packages:        packages,
+		Thresholds:      slices.Compact(thresholds),
+		IntervalSeconds: cfg.IntervalSeconds,
+	}
+}
+
+// quotaMaxCycleDays is the longest cycle pkg can have: its validity, or a
+// full 31-day month for packages that renew monthly.
+func quotaMaxCycleDays(pkg config.QuotaPackage) int {
+	if pkg.ResetDay > 0 {
+		return 31
+	}
+	return pkg.ValidityDays
+}
+
+// validateQuota also checks the packages against the daily usage retention:
+// quota is summed from daily buckets, so a cycle longer than the retention
+// would silently lose its oldest days.
+func validateQuota(cfg config.QuotaConfig, dailyRetentionDays int) error {
+	if cfg.IntervalSeconds < 60 {
+		return errors.New("quota.interval_seconds must be at least 60 seconds")
+	}
+	for _, threshold := range cfg.Thresholds {
+		if threshold < 1 || threshold > 100 {
+			return fmt.Errorf("quota.thresholds: %d is not between 1 and 100", threshold)
+		}
+	}
+	names := map[string]struct{}{}
+	for _, pkg := range cfg.Packages {
+		if pkg.Name == "" {
+			return errors.New("quota.packages entries need a name")
+		}
+		if _, dup := names[pkg.Name]; dup {
+			return fmt.Errorf("quota.packages: duplicate name %q", pkg.Name)
+		}
+		names[pkg.Name] = struct{}{}
+		if pkg.QuotaBytes <= 0 {
+			return fmt.Errorf("quota.packages %q: quota_bytes must be positive", pkg.Name)
+		}
+		if _, err := time.Parse(quotaDateLayout, pkg.StartDate); err != nil {
+			return fmt.Errorf("quota.packages %q: start_date must be YYYY-MM-DD", pkg.Name)
+		}
+		if (pkg.ValidityDays > 0) == (pkg.ResetDay > 0) {
+			return fmt.Errorf("quota.packages %q: set exactly one of validity_days and reset_day", pkg.Name)
+		}
+		if pkg.ValidityDays < 0 || pkg.ValidityDays > 3660 {
+			return fmt.Errorf("quota.packages %q: validity_days must be between 1 and 3660", pkg.Name)
+		}
+		if pkg.ResetDay < 0 || pkg.ResetDay > 31 {
+			return fmt.Errorf("quota.packages %q: reset_day must be between 1 and 31", pkg.Name)
+		}
+		if days := quotaMaxCycleDays(pkg); days > dailyRetentionDays {
+			return fmt.Errorf("quota.packages %q: a cycle lasts up to %d days, longer than usage.daily_retention_days (%d)", pkg.Name, days, dailyRetentionDays)
+		}
+	}
+	return nil
+}
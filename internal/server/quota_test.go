@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"nokia_modem/internal/config"
+	"nokia_modem/internal/router"
+	"nokia_modem/internal/settings"
+)
+
+func TestComputeQuotaCycles(t *testing.T) {
+	now := time.Date(2026, time.March, 10, 12, 0, 0, 0, time.UTC)
+	packages := []config.QuotaPackage{
+		// Resets on the 31st, which February does not have.
+		{Name: "monthly", QuotaBytes: 1000, StartDate: "2026-01-05", ResetDay: 31},
+		{Name: "booster", QuotaBytes: 500, StartDate: "2026-03-08", ValidityDays: 7},
+		{Name: "next", QuotaBytes: 100, StartDate: "2026-04-01", ValidityDays: 30},
+	}
+	usage := map[string]settings.UsageStats{
+		"2026-02-27": {Upload: 100, Download: 100}, // previous cycle
+		"2026-02-28": {Upload: 50, Download: 50},
+		"2026-03-08": {Upload: 200, Download: 700},
+		"2026-03-09": {Upload: 100, Download: 200},
+		"2026-03-10": {Upload: 0, Download: 100},
+	}
+
+	statuses := computeQuota(packages, usage, now)
+	if len(statuses) != 3 {
+		t.Fatalf("expected 3 packages, got %d", len(statuses))
+	}
+
+	monthly := statuses[0]
+	if monthly.CycleStart != "2026-02-28" || monthly.CycleEnd != "2026-03-31" {
+		t.Fatalf("monthly cycle = %s..%s", monthly.CycleStart, monthly.CycleEnd)
+	}
+	// 100 on Feb 28, then the first 900 of March 8, which fills it.
+	if monthly.UsedBytes != 1000 || monthly.Status != quotaDepleted {
+		t.Fatalf("monthly = %+v", monthly)
+	}
+
+	booster := statuses[1]
+	if booster.UsedBytes != 400 || booster.RemainingBytes != 100 || booster.Status != quotaActive {
+		t.Fatalf("booster = %+v", booster)
+	}
+	// 400 bytes over 2.5 days.
+	if booster.BurnRateBytesPerDay != 160 {
+		t.Fatalf("burn rate = %d", booster.BurnRateBytesPerDay)
+	}
+	if booster.ProjectedDepletion != "2026-03-11T03:00:00Z" || !booster.DepletesBeforeEnd {
+		t.Fatalf("projection = %s (before end %v)", booster.ProjectedDepletion, booster.DepletesBeforeEnd)
+	}
+
+	if statuses[2].Status != quotaUpcoming || statuses[2].UsedBytes != 0 {
+		t.Fatalf("next = %+v", statuses[2])
+	}
+}
+
+func TestValidateQuotaAgainstDailyRetention(t *testing.T) {
+	cfg := config.Defaults().Quota
+	cfg.Packages = []config.QuotaPackage{
+		{Name: "monthly", QuotaBytes: 1000, StartDate: "2026-01-05", ResetDay: 31},
+		{Name: "yearly", QuotaBytes: 1000, StartDate: "2026-01-01", ValidityDays: 365},
+	}
+	if err := validateQuota(cfg, 365); err != nil {
+		t.Fatalf("expected a year of daily usage to cover both packages: %v", err)
+	}
+	if err := validateQuota(cfg, 200); err == nil || !strings.Contains(err.Error(), `"yearly"`) {
+		t.Fatalf("expected the yearly package to be rejected, got %v", err)
+	}
+	cfg.Packages = cfg.Packages[:1]
+	if err := validateQuota(cfg, 30); err == nil {
+		t.Fatalf("expected a monthly package to need 31 days of daily usage")
+	}
+}
+
+func TestQuotaAlertsOncePerThreshold(t *testing.T) {
+	srv, emu, _ := newTestServer(t)
+	fake, telegram := newFakeTelegram(t)
+
+	cfg := srv.getConfig()
+	cfg.Telegram = telegram
+	cfg.Telegram.Commands = false
+	cfg.Telegram.Alerts = true
+	cfg.Quota.Packages = []config.QuotaPackage{
+		{Name: "main", QuotaBytes: 1000, StartDate: time.Now().AddDate(0, 0, -1).Format(quotaDateLayout), ValidityDays: 30},
+	}
+	// Every step must see the new counters.
+	cfg.RouterCache.Enabled = false
+	srv.setConfig(cfg)
+	srv.setClient(router.NewClient(cfg))
+
+	ctx := context.Background()
+	step := func(sent, received int64) {
+		emu.SetCounters(sent, received)
+		srv.checkQuota(ctx)
+	}
+
+	step(0, 0)
+	step(400, 450)
+	step(420, 450)
+	messages := fake.sent("sendMessage")
+	if len(messages) != 1 || !strings.Contains(messages[0]["text"].(string), "reached 80%") {
+		t.Fatalf("expected one 80%% alert, got %v", messages)
+	}
+
+	// 95% and 100% are crossed together and only the higher one is sent.
+	step(500, 500)
+	messages = fake.sent("sendMessage")
+	if len(messages) != 2 || !strings.Contains(messages[1]["text"].(string), "reached 100%") {
+		t.Fatalf("expected a 100%% alert, got %v", messages)
+	}
+
+	state := srv.store.Get().QuotaAlerts["main"]
+	if len(state.Notified) != 3 {
+		t.Fatalf("expected every threshold recorded, got %v", state.Notified)
+	}
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"net/http"
+
+	"nokia_modem/internal/auth"
+
+	webtpl "nokia_modem/templates"
+)
+
+// scopePublic marks routes that need no credentials at all.
+const scopePublic = ""
+
+// route ties a pattern to the scope a caller needs. Reads (GET and HEAD)
+// and writes (every other method) are classified separately so an endpoint
+// like /api/led_state can be visible to read-only users but not changeable.
+type route struct {
+	pattern string
+	read    string
+	write   string
+	handler http.HandlerFunc
+}
+
+func (rt route) scope(method string) string {
+	if method == http.MethodGet || method == http.MethodHead {
+		return rt.read
+	}
+	return rt.write
+}
+
+// routes lists every endpoint served by Handler together with its scope.
+func (s *Server) routes() []route {
+	const (
+		public  = scopePublic
+		read    = auth.ScopeRead
+		control = auth.ScopeControl
+		admin   = auth.ScopeAdmin
+	)
+	static := http.StripPrefix("/_next/", http.FileServer(webtpl.NextStatic()))
+
+	return []route{
+		// Raw router access can change anything on the device.
+		{"/api/debug/get", admin, admin, s.handleDebugGet},
+		{"/api/debug/post_form", admin, admin, s.handleDebugPostForm},
+		{"/api/debug/post_json", admin, admin, s.handleDebugPostJSON},
+		{"/api/debug/get_authenticated", admin, admin, s.handleDebugGetAuthenticated},
+		{"/api/debug/post_authenticated_json", admin, admin, s.handleDebugPostAuthenticatedJSON},
+		{"/api/debug/post_csrf_encrypted", admin, admin, s.handleDebugPostCSRFEncrypted},
+
+		{"/api/daily_usage", read, read, s.handleDailyUsage},
+		{"/api/usage", read, read, s.handleUsage},
+		{"/api/export/usage", read, read, s.handleExportUsage},
+		{"/api/export/sms", read, read, s.handleExportSms},
+		{"/api/get_data_expired", read, read, s.handleGetDataExpired},
+		{"/api/set_data_expired", control, control, s.handleSetDataExpired},
+		{"/api/quota", read, read, s.handleQuota},
+		{"/api/prelogin_status", read, read, s.handlePreloginStatus},
+		{"/api/overview", read, read, s.handleOverview},
+		{"/api/wan_status", read, read, s.handleWanStatus},
+		{"/api/device_status", read, read, s.handleDeviceStatus},
+		{"/api/network_clients", read, read, s.handleNetworkClients},
+		{"/api/service_data", read, read, s.handleServiceData},
+		{"/api/status_web", read, read, s.handleStatusWeb},
+		{"/api/signal_history", read, read, s.handleSignalHistory},
+		{"/api/stream", read, read, s.handleStream},
+		{"/api/set_apn", control, control, s.handleSetAPN},
+		{"/api/wan/renew", read, control, s.handleWanRenew},
+		{"/api/wan/renew/{job}", read, read, s.handleWanRenewJob},
+		{"/api/wlan_configs_24g", read, read, s.handleWlan24},
+		{"/api/wlan_configs_5g", read, read, s.handleWlan5},
+		{"/api/do_reboot", control, control, s.handleReboot},
+		{"/api/lan_status", read, read, s.handleLanStatus},
+		{"/api/sms", read, read, s.handleSmsList},
+		{"/api/sms/send", control, control, s.handleSmsSend},
+		{"/api/sms/rules", read, read, s.handleSmsRules},
+		{"/api/alerts", read, read, s.handleAlerts},
+		{"/api/watchdog", read, read, s.handleWatchdog},
+		{"/api/schedules", read, admin, s.handleSchedules},
+		{"/api/schedules/{name}", read, admin, s.handleSchedule},
+		{"/api/sms/archive", read, read, s.handleSmsArchive},
+		{"/api/sms/archive/{hash}", read, control, s.handleSmsArchiveEntry},
+		{"/api/sms/archive/{hash}/restore", control, control, s.handleSmsArchiveRestore},
+		{"/api/set_sms_state", control, control, s.handleSetSmsState},
+		{"/api/delete_sms", control, control, s.handleDeleteSms},
+		{"/api/cell_identification", read, read, s.handleCellIdentification},
+		{"/api/sim_info", read, read, s.handleSimInfo},
+		{"/api/led_status", read, read, s.handleLedStatus},
+		{"/api/led_state", read, control, s.handleLedState},
+		{"/api/telegram/send", control, control, s.handleTelegramSend},
+		{"/metrics", read, read, s.handleMetrics},
+
+		// The config holds broker and bot credentials, so even reading it
+		// is admin-only.
+		{"/api/config/listener_available", admin, admin, s.handleConfigListenerCheck},
+		{"/api/config", admin, admin, s.handleConfig},
+		{"/api/auth/password", admin, admin, s.handleAuthPassword},
+		{"/api/auth/tokens", admin, admin, s.handleAuthTokens},
+		{"/api/auth/tokens/{name}", admin, admin, s.handleAuthToken},
+
+		// The login flow and the assets the login page needs.
+		{"/login", public, public, s.handleLoginPage},
+		{"/api/auth/login", public, public, s.handleAuthLogin},
+		{"/api/auth/logout", public, public, s.handleAuthLogout},
+		{"/api/auth/session", public, public, s.handleAuthSession},
+		{"/favicon.ico", public, public, s.handleFavicon},
+		{"/_next/", public, public, static.ServeHTTP},
+
+		{"/", read, read, s.handleNextApp},
+	}
+}
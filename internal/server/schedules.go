@@ -0,0 +1,419 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	// OpenWrt images rarely ship /usr/share/zoneinfo, so schedule time
+	// zones come from the zone database embedded in the binary.
+	_ "time/tzdata"
+
+	"nokia_modem/internal/config"
+	"nokia_modem/internal/cron"
+	"nokia_modem/internal/settings"
+)
+
+var errScheduleNotFound = errors.New("schedule not found")
+
+// maxScheduleCatchUp is the longest gap between two checks that still runs
+// what fell due in it. A longer gap is a clock jump, typically the first
+// NTP sync after the router booted, and runs nothing.
+const maxScheduleCatchUp = time.Hour
+
+// scheduleRunner tracks the scheduler between checks. checked is the end
+// of the window already handled.
+type scheduleRunner struct {
+	mu      sync.Mutex
+	checked time.Time
+	running map[string]bool
+}
+
+// configureSchedules runs the scheduler while any schedule is enabled. The
+// loop reads the schedules from the current config at every check, so
+// edits and config reloads take effect without a restart and without
+// losing or repeating a run.
+func (s *Server) configureSchedules(cfg config.Config) {
+	var (
+		start bool
+		stop  context.CancelFunc
+		ctx   context.Context
+	)
+	enabled := slices.ContainsFunc(cfg.Schedules, func(sc config.ScheduleConfig) bool { return sc.Enabled })
+
+	s.schedulesMu.Lock()
+	running := s.schedulesCancel != nil
+	if running && !enabled {
+		stop = s.schedulesCancel
+		s.schedulesCancel = nil
+	}
+	if enabled && !running {
+		ctx, s.schedulesCancel = context.WithCancel(context.Background())
+		s.schedulesWG.Add(1)
+		start = true
+	}
+	s.schedulesMu.Unlock()
+
+	if stop != nil {
+		stop()
+		s.schedulesWG.Wait()
+		s.logger.Printf("schedules: stopped")
+	}
+
+	if start {
+		s.schedules.mu.Lock()
+		s.schedules.checked = time.Now()
+		s.schedules.mu.Unlock()
+		go s.runScheduler(ctx)
+		s.logger.Printf("schedules: started")
+	}
+}
+
+func (s *Server) runScheduler(ctx context.Context) {
+	defer s.schedulesWG.Done()
+
+	for {
+		// Wake just after every minute boundary.
+		now := time.Now()
+		timer := time.NewTimer(now.Truncate(time.Minute).Add(time.Minute + 100*time.Millisecond).Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.runDueSchedules(time.Now())
+	}
+}
+
+// runDueSchedules starts every enabled schedule with a run in the window
+// since the previous check. Runs outlive the scheduler loop, so disabling
+// the last schedule does not cut a reboot or WAN renewal short.
+func (s *Server) runDueSchedules(now time.Time) {
+	s.schedules.mu.Lock()
+	since := s.schedules.checked
+	s.schedules.checked = now
+	s.schedules.mu.Unlock()
+
+	gap := now.Sub(since)
+	if gap <= 0 {
+		return
+	}
+	if gap > maxScheduleCatchUp {
+		s.logger.Printf("schedules: clock jumped by %s, skipping missed runs", gap.Round(time.Minute))
+		return
+	}
+
+	for _, sc := range s.getConfig().Schedules {
+		if !sc.Enabled {
+			continue
+		}
+		next, err := nextScheduleRun(sc, since)
+		if err != nil || next.IsZero() || next.After(now) {
+			continue
+		}
+		if !s.claimSchedule(sc.Name) {
+			s.logger.Printf("schedules: %s is still running, skipping this run", sc.Name)
+			continue
+		}
+		go func() {
+			defer s.releaseSchedule(sc.Name)
+			s.runSchedule(sc, next)
+		}()
+	}
+}
+
+func (s *Server) claimSchedule(name string) bool {
+	s.schedules.mu.Lock()
+	defer s.schedules.mu.Unlock()
+	if s.schedules.running[name] {
+		return false
+	}
+	if s.schedules.running == nil {
+		s.schedules.running = map[string]bool{}
+	}
+	s.schedules.running[name] = true
+	return true
+}
+
+func (s *Server) releaseSchedule(name string) {
+	s.schedules.mu.Lock()
+	delete(s.schedules.running, name)
+	s.schedules.mu.Unlock()
+}
+
+func (s *Server) scheduleRunning(name string) bool {
+	s.schedules.mu.Lock()
+	defer s.schedules.mu.Unlock()
+	return s.schedules.running[name]
+}
+
+// runSchedule runs a schedule's command and records the outcome.
+func (s *Server) runSchedule(sc config.ScheduleConfig, at time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.commandTimeout(sc.Command))
+	defer cancel()
+
+	started := time.Now()
+	_, err := s.executeCommand(ctx, "schedule", sc.Command, commandArgs(maps.Clone(sc.Args)))
+	run := settings.ScheduleRun{
+		At:         at.UTC(),
+		DurationMs: time.Since(started).Milliseconds(),
+		Success:    err == nil,
+	}
+	if err != nil {
+		run.Error = err.Error()
+		s.logger.Printf("schedules: %s (%s) failed: %v", sc.Name, sc.Command, err)
+	} else {
+		s.logger.Printf("schedules: %s ran %s", sc.Name, sc.Command)
+	}
+
+	err = s.store.Update(func(data *settings.Settings) error {
+		if data.ScheduleRuns == nil {
+			data.ScheduleRuns = map[string]settings.ScheduleRun{}
+		}
+		data.ScheduleRuns[sc.Name] = run
+		return nil
+	})
+	if err != nil {
+		s.logger.Printf("schedules: persist run of %s failed: %v", sc.Name, err)
+	}
+}
+
+// nextScheduleRun is the first run of sc after t, in the schedule's time
+// zone.
+func nextScheduleRun(sc config.ScheduleConfig, t time.Time) (time.Time, error) {
+	spec, err := cron.Parse(sc.Cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := scheduleLocation(sc.TimeZone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return spec.Next(t.In(loc)), nil
+}
+
+func scheduleLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(name)
+}
+
+func normalizeSchedules(schedules []config.ScheduleConfig) []config.ScheduleConfig {
+	out := make([]config.ScheduleConfig, 0, len(schedules))
+	for _, sc := range schedules {
+		sc.Name = strings.TrimSpace(sc.Name)
+		sc.Cron = strings.Join(strings.Fields(sc.Cron), " ")
+		sc.TimeZone = strings.TrimSpace(sc.TimeZone)
+		sc.Command = strings.ToLower(strings.TrimSpace(sc.Command))
+		sc.Args = maps.Clone(sc.Args)
+		out = append(out, sc)
+	}
+	return out
+}
+
+func validateSchedules(schedules []config.ScheduleConfig) error {
+	names := map[string]struct{}{}
+	for _, sc := range schedules {
+		if sc.Name == "" {
+			return errors.New("schedules: every schedule needs a name")
+		}
+		if strings.Contains(sc.Name, "/") {
+			return fmt.Errorf("schedules %q: name must not contain '/'", sc.Name)
+		}
+		if _, dup := names[sc.Name]; dup {
+			return fmt.Errorf("schedules: duplicate name %q", sc.Name)
+		}
+		names[sc.Name] = struct{}{}
+
+		spec, err := cron.Parse(sc.Cron)
+		if err != nil {
+			return fmt.Errorf("schedules %q: %w", sc.Name, err)
+		}
+		if err := spec.Validate(); err != nil {
+			return fmt.Errorf("schedules %q: %w", sc.Name, err)
+		}
+		if _, err := scheduleLocation(sc.TimeZone); err != nil {
+			return fmt.Errorf("schedules %q: unknown time_zone %q", sc.Name, sc.TimeZone)
+		}
+		if !slices.Contains(mqttCommandNames, sc.Command) {
+			return fmt.Errorf("schedules %q: command must be one of %s", sc.Name, strings.Join(mqttCommandNames, ", "))
+		}
+		if err := validateCommandArgs(sc.Command, commandArgs(sc.Args)); err != nil {
+			return fmt.Errorf("schedules %q: %w", sc.Name, err)
+		}
+	}
+	return nil
+}
+
+// updateSchedules persists a change to the schedules. Like auth changes it
+// does not touch the listener or router client, so no reload is triggered.
+func (s *Server) updateSchedules(fn func([]config.ScheduleConfig) ([]config.ScheduleConfig, error)) (config.Config, error) {
+	s.cfgWriteMu.Lock()
+	defer s.cfgWriteMu.Unlock()
+
+	updated := s.getConfig()
+	schedules, err := fn(slices.Clone(updated.Schedules))
+	if err != nil {
+		return config.Config{}, err
+	}
+	updated.Schedules = schedules
+	updated = normalizeConfig(updated)
+	if err := validateConfig(updated); err != nil {
+		return config.Config{}, err
+	}
+	if err := config.Save(s.cfgPath, updated); err != nil {
+		return config.Config{}, err
+	}
+	s.setConfig(updated)
+	s.configureSchedules(updated)
+	return updated, nil
+}
+
+// scheduleResponse is a schedule with its next and latest run. NextRun is
+// in the schedule's time zone and null while the schedule is disabled.
+type scheduleResponse struct {
+	config.ScheduleConfig
+	NextRun *time.Time            `json:"next_run"`
+	LastRun *settings.ScheduleRun `json:"last_run"`
+	Running bool                  `json:"running"`
+}
+
+func (s *Server) scheduleResponse(sc config.ScheduleConfig, runs map[string]settings.ScheduleRun, now time.Time) scheduleResponse {
+	resp := scheduleResponse{ScheduleConfig: sc, Running: s.scheduleRunning(sc.Name)}
+	if sc.Enabled {
+		if next, err := nextScheduleRun(sc, now); err == nil && !next.IsZero() {
+			resp.NextRun = &next
+		}
+	}
+	if run, ok := runs[sc.Name]; ok {
+		resp.LastRun = &run
+	}
+	return resp
+}
+
+func (s *Server) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		runs := s.store.Get().ScheduleRuns
+		now := time.Now()
+		out := []scheduleResponse{}
+		for _, sc := range s.getConfig().Schedules {
+			out = append(out, s.scheduleResponse(sc, runs, now))
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"schedules": out})
+	case http.MethodPost:
+		var payload config.ScheduleConfig
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON payload"})
+			return
+		}
+		payload.Name = strings.TrimSpace(payload.Name)
+		updated, err := s.updateSchedules(func(schedules []config.ScheduleConfig) ([]config.ScheduleConfig, error) {
+			return append(schedules, payload), nil
+		})
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		s.logger.Printf("schedules: created %q", payload.Name)
+		s.writeSchedule(w, http.StatusCreated, updated, payload.Name)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	switch r.Method {
+	case http.MethodGet:
+		s.writeSchedule(w, http.StatusOK, s.getConfig(), name)
+	case http.MethodPut:
+		// The body replaces the schedule; a different name renames it.
+		var payload config.ScheduleConfig
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON payload"})
+			return
+		}
+		payload.Name = valueOr(strings.TrimSpace(payload.Name), name)
+		updated, err := s.updateSchedules(func(schedules []config.ScheduleConfig) ([]config.ScheduleConfig, error) {
+			i := slices.IndexFunc(schedules, func(sc config.ScheduleConfig) bool { return sc.Name == name })
+			if i < 0 {
+				return nil, errScheduleNotFound
+			}
+			schedules[i] = payload
+			return schedules, nil
+		})
+		if err != nil {
+			writeScheduleError(w, err)
+			return
+		}
+		if payload.Name != name {
+			s.moveScheduleRun(name, payload.Name)
+		}
+		s.logger.Printf("schedules: updated %q", payload.Name)
+		s.writeSchedule(w, http.StatusOK, updated, payload.Name)
+	case http.MethodDelete:
+		_, err := s.updateSchedules(func(schedules []config.ScheduleConfig) ([]config.ScheduleConfig, error) {
+			before := len(schedules)
+			schedules = slices.DeleteFunc(schedules, func(sc config.ScheduleConfig) bool { return sc.Name == name })
+			if len(schedules) == before {
+				return nil, errScheduleNotFound
+			}
+			return schedules, nil
+		})
+		if err != nil {
+			writeScheduleError(w, err)
+			return
+		}
+		s.moveScheduleRun(name, "")
+		s.logger.Printf("schedules: deleted %q", name)
+		writeJSON(w, http.StatusOK, map[string]string{"message": "schedule deleted"})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) writeSchedule(w http.ResponseWriter, status int, cfg config.Config, name string) {
+	i := slices.IndexFunc(cfg.Schedules, func(sc config.ScheduleConfig) bool { return sc.Name == name })
+	if i < 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": errScheduleNotFound.Error()})
+		return
+	}
+	writeJSON(w, status, s.scheduleResponse(cfg.Schedules[i], s.store.Get().ScheduleRuns, time.Now()))
+}
+
+func writeScheduleError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errScheduleNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+}
+
+// moveScheduleRun carries the last run over to a renamed schedule, or drops
+// it when to is empty.
+func (s *Server) moveScheduleRun(from, to string) {
+	err := s.store.Update(func(data *settings.Settings) error {
+		run, ok := data.ScheduleRuns[from]
+		if !ok {
+			return nil
+		}
+		delete(data.ScheduleRuns, from)
+		if to != "" {
+			data.ScheduleRuns[to] = run
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Printf("schedules: persist run history failed: %v", err)
+	}
+}
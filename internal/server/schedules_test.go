@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nokia_modem/internal/config"
+	"nokia_modem/internal/router"
+)
+
+func TestSchedulesCrudAndHotReload(t *testing.T) {
+	srv, _, httpSrv := newTestServer(t)
+
+	resp, created := doRequest(t, http.MethodPost, httpSrv.URL+"/api/schedules",
+		`{"name":"nightly","enabled":true,"cron":"0  4 * * *","time_zone":"Asia/Kolkata","command":"reboot"}`, nil)
+	if resp.StatusCode != http.StatusCreated || created["cron"] != "0 4 * * *" {
+		t.Fatalf("create: %d %v", resp.StatusCode, created)
+	}
+	next, err := time.Parse(time.RFC3339, created["next_run"].(string))
+	if err != nil || !strings.HasSuffix(created["next_run"].(string), "T04:00:00+05:30") || !next.After(time.Now()) {
+		t.Fatalf("unexpected next_run %v", created["next_run"])
+	}
+	if created["last_run"] != nil {
+		t.Fatalf("a new schedule has not run: %v", created["last_run"])
+	}
+
+	for _, body := range []string{
+		`{"name":"nightly","enabled":true,"cron":"0 4 * * *","command":"reboot"}`,
+		`{"name":"bad","cron":"0 25 * * *","command":"reboot"}`,
+		`{"name":"bad","cron":"0 4 * * *","time_zone":"Mars/Olympus","command":"reboot"}`,
+		`{"name":"bad","cron":"0 4 * * *","command":"format"}`,
+		`{"name":"bad","cron":"0 4 * * *","command":"led"}`,
+		`{"name":"bad","cron":"0 4 * * *","command":"led","args":{"enable":"dim"}}`,
+		`{"name":"bad","cron":"0 4 * * *","command":"apn","args":{"apn":" "}}`,
+		`{"name":"bad","cron":"0 4 * * *","command":"sms_send","args":{"to":"+15550100"}}`,
+		`{"name":"bad","cron":"0 4 * * *","command":"data_expiry_bump","args":{"months":-1}}`,
+	} {
+		if resp, _ := doRequest(t, http.MethodPost, httpSrv.URL+"/api/schedules", body, nil); resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected %s to be rejected, got %d", body, resp.StatusCode)
+		}
+	}
+
+	resp, updated := doRequest(t, http.MethodPut, httpSrv.URL+"/api/schedules/nightly",
+		`{"name":"leds-off","enabled":true,"cron":"0 22 * * *","command":"led","args":{"enable":false}}`, nil)
+	if resp.StatusCode != http.StatusOK || updated["name"] != "leds-off" || updated["args"].(map[string]interface{})["enable"] != false {
+		t.Fatalf("update: %d %v", resp.StatusCode, updated)
+	}
+	if resp, _ := doRequest(t, http.MethodGet, httpSrv.URL+"/api/schedules/nightly", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("the old name must be gone, got %d", resp.StatusCode)
+	}
+
+	// A config save from the dashboard keeps the schedules and the loop.
+	if resp, _ := doRequest(t, http.MethodPost, httpSrv.URL+"/api/config", `{"poll_interval_ms":5000}`, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("config save failed: %d", resp.StatusCode)
+	}
+	var list struct {
+		Schedules []scheduleResponse `json:"schedules"`
+	}
+	getJSON(t, httpSrv.URL+"/api/schedules", &list)
+	if len(list.Schedules) != 1 || list.Schedules[0].Name != "leds-off" || list.Schedules[0].NextRun == nil {
+		t.Fatalf("schedules lost on reload: %+v", list.Schedules)
+	}
+	srv.schedulesMu.Lock()
+	running := srv.schedulesCancel != nil
+	srv.schedulesMu.Unlock()
+	if !running {
+		t.Fatalf("the scheduler stopped on reload")
+	}
+
+	if resp, _ := doRequest(t, http.MethodDelete, httpSrv.URL+"/api/schedules/leds-off", "", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete failed: %d", resp.StatusCode)
+	}
+	if resp, _ := doRequest(t, http.MethodDelete, httpSrv.URL+"/api/schedules/leds-off", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("deleting twice must 404, got %d", resp.StatusCode)
+	}
+	srv.schedulesMu.Lock()
+	running = srv.schedulesCancel != nil
+	srv.schedulesMu.Unlock()
+	if running {
+		t.Fatalf("the scheduler must stop without enabled schedules")
+	}
+}
+
+func TestConcurrentConfigEditsKeepEachOther(t *testing.T) {
+	srv, _, httpSrv := newTestServer(t)
+
+	var wg sync.WaitGroup
+	for i := range 5 {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"name":"job-%d","enabled":true,"cron":"0 4 * * *","command":"reboot"}`, i)
+			if resp, _ := doRequest(t, http.MethodPost, httpSrv.URL+"/api/schedules", body, nil); resp.StatusCode != http.StatusCreated {
+				t.Errorf("create schedule %d: %d", i, resp.StatusCode)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"name":"script-%d"}`, i)
+			if resp, _ := doRequest(t, http.MethodPost, httpSrv.URL+"/api/auth/tokens", body, nil); resp.StatusCode != http.StatusCreated {
+				t.Errorf("create token %d: %d", i, resp.StatusCode)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"poll_interval_ms":%d}`, 5000+i)
+			if resp, _ := doRequest(t, http.MethodPost, httpSrv.URL+"/api/config", body, nil); resp.StatusCode != http.StatusOK {
+				t.Errorf("save config %d: %d", i, resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	saved, err := config.Load(srv.cfgPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	for _, cfg := range []config.Config{srv.getConfig(), saved} {
+		if len(cfg.Schedules) != 5 || len(cfg.Auth.Tokens) != 5 {
+			t.Fatalf("lost an edit: %d schedules, %d tokens", len(cfg.Schedules), len(cfg.Auth.Tokens))
+		}
+	}
+}
+
+func TestRunDueSchedules(t *testing.T) {
+	srv, emu, httpSrv := newTestServer(t)
+
+	cfg := srv.getConfig()
+	cfg.RouterCache.Enabled = false
+	cfg.Schedules = []config.ScheduleConfig{
+		{Name: "reboot", Enabled: true, Cron: "0 4 * * *", TimeZone: "UTC", Command: "reboot"},
+		{Name: "bump", Enabled: true, Cron: "0 4 1 * *", TimeZone: "UTC", Command: "data_expiry_bump", Args: map[string]interface{}{"days": float64(30)}},
+		{Name: "purge", Enabled: true, Cron: "0 4 * * *", TimeZone: "UTC", Command: "sms_delete"},
+		{Name: "off", Cron: "0 4 * * *", TimeZone: "UTC", Command: "reboot"},
+	}
+	srv.setConfig(cfg)
+	srv.setClient(router.NewClient(cfg))
+
+	wait := func() {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for srv.scheduleRunning("reboot") || srv.scheduleRunning("bump") || srv.scheduleRunning("purge") {
+			if time.Now().After(deadline) {
+				t.Fatalf("schedules did not finish")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	srv.schedules.checked = time.Date(2026, 6, 1, 3, 59, 30, 0, time.UTC)
+	srv.runDueSchedules(time.Date(2026, 6, 1, 4, 0, 0, 100, time.UTC))
+	wait()
+	if emu.Reboots() != 1 {
+		t.Fatalf("expected one reboot, got %d", emu.Reboots())
+	}
+	expiry := time.Unix(srv.store.Get().DataExpired, 0)
+	if days := time.Until(expiry).Hours() / 24; days < 29.9 || days > 30.1 {
+		t.Fatalf("expected the expiry 30 days out, got %s", expiry)
+	}
+
+	// Nothing is due in the next window, and a clock jump skips missed runs.
+	srv.runDueSchedules(time.Date(2026, 6, 1, 4, 1, 0, 0, time.UTC))
+	srv.runDueSchedules(time.Date(2026, 6, 3, 12, 0, 0, 0, time.UTC))
+	wait()
+	if emu.Reboots() != 1 {
+		t.Fatalf("unexpected extra reboots: %d", emu.Reboots())
+	}
+
+	runs := srv.store.Get().ScheduleRuns
+	if run := runs["reboot"]; !run.Success || !run.At.Equal(time.Date(2026, 6, 1, 4, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected reboot run: %+v", run)
+	}
+	if run := runs["purge"]; run.Success || !strings.Contains(run.Error, "sms_ids") {
+		t.Fatalf("a purge without arguments must fail: %+v", run)
+	}
+	if _, ok := runs["off"]; ok {
+		t.Fatalf("a disabled schedule ran")
+	}
+
+	var list struct {
+		Schedules []scheduleResponse `json:"schedules"`
+	}
+	getJSON(t, httpSrv.URL+"/api/schedules", &list)
+	if list.Schedules[0].LastRun == nil || !list.Schedules[0].LastRun.Success || list.Schedules[3].NextRun != nil {
+		t.Fatalf("unexpected schedule list: %+v", list.Schedules)
+	}
+
+	// Bumping a running package extends it rather than restarting it.
+	before := srv.store.Get().DataExpired
+	if _, err := srv.executeCommand(context.Background(), "test", "data_expiry_bump", commandArgs{"months": "1"}); err != nil {
+		t.Fatalf("bump: %v", err)
+	}
+	if got, want := srv.store.Get().DataExpired, time.Unix(before, 0).AddDate(0, 1, 0).Unix(); got != want {
+		t.Fatalf("expiry = %d, want %d", got, want)
+	}
+}
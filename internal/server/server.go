@@ -3,12 +3,14 @@ package server
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log"
+	"maps"
 	"net"
 	"net/http"
 	"net/url"
@@ -17,13 +19,13 @@ import (
 	"path/filepath"
 	"runtime"
 	"slices"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 	"unicode"
 
+	"nokia_modem/internal/auth"
 	"nokia_modem/internal/config"
 	"nokia_modem/internal/router"
 	"nokia_modem/internal/settings"
@@ -40,12 +42,16 @@ type Server struct {
 	cfgMu   sync.RWMutex
 	cfgPath string
 	cfg     config.Config
+	// cfgWriteMu serialises read-modify-save cycles of the config file, so
+	// concurrent edits from different endpoints do not drop each other.
+	cfgWriteMu sync.Mutex
 
 	store      *settings.Store
 	logger     *log.Logger
 	httpClient *http.Client
 
-	smsArchive *smsArchive
+	smsArchive    *smsArchive
+	signalHistory *signalHistory
 
 	pollerMu            sync.Mutex
 	pollerCancel        context.CancelFunc
@@ -57,6 +63,54 @@ type Server struct {
 	mqttTopicBase string
 	mqttCfg       config.MQTTConfig
 
+	apnMu      sync.Mutex
+	currentAPN string
+
+	signalMu     sync.Mutex
+	signalCancel context.CancelFunc
+	signalWG     sync.WaitGroup
+	signalCfg    config.SignalHistoryConfig
+
+	routerMetrics *routerMetrics
+	metricsMu     sync.Mutex
+	metricsCancel context.CancelFunc
+	metricsWG     sync.WaitGroup
+	metricsCfg    config.MetricsConfig
+	metricsSnapMu sync.RWMutex
+	metricsSnap   metricsSnapshot
+
+	telegramMu     sync.Mutex
+	telegramCancel context.CancelFunc
+	telegramWG     sync.WaitGroup
+	telegramCfg    config.TelegramConfig
+
+	quotaMu     sync.Mutex
+	quotaCancel context.CancelFunc
+	quotaWG     sync.WaitGroup
+	quotaCfg    config.QuotaConfig
+
+	alertsMu     sync.Mutex
+	alertsCancel context.CancelFunc
+	alertsWG     sync.WaitGroup
+	alertsCfg    config.AlertsConfig
+	alerts       alertEngine
+
+	watchdogMu       sync.Mutex
+	watchdogCancel   context.CancelFunc
+	watchdogWG       sync.WaitGroup
+	watchdogInterval time.Duration
+	watchdog         watchdogProbe
+
+	schedulesMu     sync.Mutex
+	schedulesCancel context.CancelFunc
+	schedulesWG     sync.WaitGroup
+	schedules       scheduleRunner
+
+	wanRenew wanRenewJobs
+	stream   *streamHub
+
+	authSessions *authSessions
+
 	reloadFn func(config.Config)
 }
 
@@ -66,22 +120,37 @@ const defaultDebugTimeout = 15 * time.Second
 
 func New(client *router.Client, store *settings.Store, cfgPath string, cfg config.Config, reloadFn func(config.Config)) *Server {
 	smsPath := "sms.json"
+	signalPath := signalHistoryFile
 	if trimmed := strings.TrimSpace(cfgPath); trimmed != "" {
 		smsPath = filepath.Join(filepath.Dir(trimmed), "sms.json")
+		signalPath = filepath.Join(filepath.Dir(trimmed), signalHistoryFile)
 	}
 
 	srv := &Server{
-		client:     client,
-		cfgPath:    cfgPath,
-		cfg:        cfg,
-		store:      store,
-		logger:     log.New(os.Stdout, "[server] ", log.LstdFlags),
-		httpClient: &http.Client{Timeout: 10 * time.Second},
-		smsArchive: newSmsArchive(smsPath),
-		reloadFn:   reloadFn,
-	}
+		client:        client,
+		cfgPath:       cfgPath,
+		cfg:           cfg,
+		store:         store,
+		logger:        log.New(os.Stdout, "[server] ", log.LstdFlags),
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
+		smsArchive:    newSmsArchive(smsPath),
+		signalHistory: newSignalHistory(signalPath),
+		routerMetrics: newRouterMetrics(),
+		authSessions:  newAuthSessions(),
+		stream:        newStreamHub(),
+		reloadFn:      reloadFn,
+	}
+	client.SetObserver(srv.routerMetrics.observe)
 
 	srv.configureSmsForwarding(cfg)
+	srv.configureSignalHistory(cfg)
+	srv.configureMetrics(cfg)
+	srv.configureTelegramBot(cfg)
+	srv.configureUsageRetention(cfg)
+	srv.configureQuota(cfg)
+	srv.configureAlerts(cfg)
+	srv.configureWatchdog(cfg)
+	srv.configureSchedules(cfg)
 	return srv
 }
 
@@ -92,6 +161,8 @@ func (s *Server) getClient() *router.Client {
 }
 
 func (s *Server) setClient(client *router.Client) {
+	client.SetObserver(s.routerMetrics.observe)
+
 	s.clientMu.Lock()
 	defer s.clientMu.Unlock()
 	s.client = client
@@ -116,45 +187,21 @@ func (s *Server) Config() config.Config {
 
 func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
+	for _, rt := range s.routes() {
+		mux.Handle(rt.pattern, s.requireScope(rt))
+	}
+	return s.corsMiddleware(freshRequests(mux))
+}
 
-	mux.HandleFunc("/api/debug/get", s.handleDebugGet)
-	mux.HandleFunc("/api/debug/post_form", s.handleDebugPostForm)
-	mux.HandleFunc("/api/debug/post_json", s.handleDebugPostJSON)
-	mux.HandleFunc("/api/debug/get_authenticated", s.handleDebugGetAuthenticated)
-	mux.HandleFunc("/api/debug/post_authenticated_json", s.handleDebugPostAuthenticatedJSON)
-	mux.HandleFunc("/api/debug/post_csrf_encrypted", s.handleDebugPostCSRFEncrypted)
-
-	mux.HandleFunc("/api/daily_usage", s.handleDailyUsage)
-	mux.HandleFunc("/api/get_data_expired", s.handleGetDataExpired)
-	mux.HandleFunc("/api/set_data_expired", s.handleSetDataExpired)
-	mux.HandleFunc("/api/prelogin_status", s.handlePreloginStatus)
-	mux.HandleFunc("/api/overview", s.handleOverview)
-	mux.HandleFunc("/api/wan_status", s.handleWanStatus)
-	mux.HandleFunc("/api/device_status", s.handleDeviceStatus)
-	mux.HandleFunc("/api/network_clients", s.handleNetworkClients)
-	mux.HandleFunc("/api/service_data", s.handleServiceData)
-	mux.HandleFunc("/api/status_web", s.handleStatusWeb)
-	mux.HandleFunc("/api/set_apn", s.handleSetAPN)
-	mux.HandleFunc("/api/wlan_configs_24g", s.handleWlan24)
-	mux.HandleFunc("/api/wlan_configs_5g", s.handleWlan5)
-	mux.HandleFunc("/api/do_reboot", s.handleReboot)
-	mux.HandleFunc("/api/lan_status", s.handleLanStatus)
-	mux.HandleFunc("/api/sms", s.handleSmsList)
-	mux.HandleFunc("/api/set_sms_state", s.handleSetSmsState)
-	mux.HandleFunc("/api/delete_sms", s.handleDeleteSms)
-	mux.HandleFunc("/api/cell_identification", s.handleCellIdentification)
-	mux.HandleFunc("/api/sim_info", s.handleSimInfo)
-	mux.HandleFunc("/api/led_status", s.handleLedStatus)
-	mux.HandleFunc("/api/led_state", s.handleLedState)
-	mux.HandleFunc("/api/config/listener_available", s.handleConfigListenerCheck)
-	mux.HandleFunc("/api/config", s.handleConfig)
-	mux.HandleFunc("/api/telegram/send", s.handleTelegramSend)
-	mux.HandleFunc("/favicon.ico", s.handleFavicon)
-
-	mux.Handle("/_next/", http.StripPrefix("/_next/", http.FileServer(webtpl.NextStatic())))
-	mux.HandleFunc("/", s.handleNextApp)
-
-	return corsMiddleware(mux)
+// freshRequests lets API callers skip the router response cache with
+// ?fresh=1.
+func freshRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fresh, _ := strconv.ParseBool(r.URL.Query().Get("fresh")); fresh {
+			r = r.WithContext(router.WithFresh(r.Context()))
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 func mqttConfigsEqual(a, b config.MQTTConfig) bool {
@@ -163,7 +210,11 @@ func mqttConfigsEqual(a, b config.MQTTConfig) bool {
 		strings.TrimSpace(a.ClientID) == strings.TrimSpace(b.ClientID) &&
 		strings.TrimSpace(a.Username) == strings.TrimSpace(b.Username) &&
 		strings.TrimSpace(a.Password) == strings.TrimSpace(b.Password) &&
-		strings.TrimSpace(a.TopicBase) == strings.TrimSpace(b.TopicBase)
+		strings.TrimSpace(a.TopicBase) == strings.TrimSpace(b.TopicBase) &&
+		a.HomeAssistant == b.HomeAssistant &&
+		strings.TrimSpace(a.DiscoveryPrefix) == strings.TrimSpace(b.DiscoveryPrefix) &&
+		slices.Equal(a.APNOptions, b.APNOptions) &&
+		slices.Equal(a.AllowedCommands, b.AllowedCommands)
 }
 
 func (s *Server) configureMqtt(cfg config.Config) {
@@ -178,7 +229,7 @@ func (s *Server) configureMqtt(cfg config.Config) {
 
 	if !shouldConnect {
 		if s.mqttClient != nil {
-			s.mqttClient.Disconnect(250)
+			s.disconnectMqttLocked(cfg.MQTT)
 			s.logger.Printf("mqtt: disconnected")
 			s.mqttClient = nil
 		}
@@ -195,7 +246,7 @@ func (s *Server) configureMqtt(cfg config.Config) {
 	}
 
 	if s.mqttClient != nil {
-		s.mqttClient.Disconnect(250)
+		s.disconnectMqttLocked(cfg.MQTT)
 		s.mqttClient = nil
 	}
 
@@ -228,9 +279,21 @@ func (s *Server) configureMqtt(cfg config.Config) {
 		opts.SetPassword(cfg.MQTT.Password)
 	}
 
+	availability := joinMqttTopic(topicBase, mqttAvailabilityTopic)
+	opts.SetWill(availability, mqttPayloadOffline, 1, true)
+
+	mqttCfg := cfg.MQTT
 	opts.OnConnect = func(c mqtt.Client) {
 		s.logger.Printf("mqtt: connected to %s", broker)
 		s.subscribeMqttApn(c, topicBase)
+		s.subscribeMqttSetCommands(c, topicBase)
+		s.subscribeMqttCommands(c, topicBase)
+		if mqttCfg.HomeAssistant {
+			s.publishHADiscovery(c, mqttCfg, topicBase)
+		}
+		if err := waitMqttToken(c.Publish(availability, 1, true, mqttPayloadOnline)); err != nil {
+			s.logger.Printf("mqtt: publish availability failed: %v", err)
+		}
 	}
 	opts.OnConnectionLost = func(c mqtt.Client, err error) {
 		s.logger.Printf("mqtt: connection lost: %v", err)
@@ -249,7 +312,44 @@ func (s *Server) configureMqtt(cfg config.Config) {
 	s.mqttCfg = cfg.MQTT
 }
 
+// disconnectMqttLocked marks the daemon offline and closes the current
+// connection. Discovery entries are removed when Home Assistant support is
+// being switched off. Must be called with mqttMu held.
+func (s *Server) disconnectMqttLocked(next config.MQTTConfig) {
+	client := s.mqttClient
+	if client.IsConnected() {
+		if s.mqttCfg.HomeAssistant && (!next.HomeAssistant || !next.Enabled) {
+			s.clearHADiscovery(client, s.mqttCfg, s.mqttTopicBase)
+		}
+		availability := joinMqttTopic(s.mqttTopicBase, mqttAvailabilityTopic)
+		if err := waitMqttToken(client.Publish(availability, 1, true, mqttPayloadOffline)); err != nil {
+			s.logger.Printf("mqtt: publish availability failed: %v", err)
+		}
+	}
+	client.Disconnect(250)
+}
+
+// mqttConnected reports whether the MQTT client is currently connected.
+func (s *Server) mqttConnected() bool {
+	s.mqttMu.Lock()
+	client := s.mqttClient
+	s.mqttMu.Unlock()
+	return client != nil && client.IsConnected()
+}
+
 func (s *Server) publishMqtt(topic string, payload interface{}) error {
+	segment := strings.Trim(strings.TrimSpace(topic), "/")
+	retain := segment == "sms" || strings.HasSuffix(segment, "/sms")
+	return s.publishMqttMessage(topic, payload, retain)
+}
+
+// publishMqttRetained publishes payload under the topic base with the retain
+// flag set, for state documents consumers should see right after connecting.
+func (s *Server) publishMqttRetained(topic string, payload interface{}) error {
+	return s.publishMqttMessage(topic, payload, true)
+}
+
+func (s *Server) publishMqttMessage(topic string, payload interface{}, retain bool) error {
 	s.mqttMu.Lock()
 	client := s.mqttClient
 	base := s.mqttTopicBase
@@ -275,7 +375,6 @@ func (s *Server) publishMqtt(topic string, payload interface{}) error {
 		return fmt.Errorf("encode mqtt payload: %w", err)
 	}
 
-	retain := fullTopic == "sms" || strings.HasSuffix(fullTopic, "/sms")
 	token := client.Publish(fullTopic, 1, retain, data)
 	if !token.WaitTimeout(5 * time.Second) {
 		return errors.New("mqtt publish timeout")
@@ -338,36 +437,20 @@ func (s *Server) handleMqttApnCommand(topic, apn string) {
 		return
 	}
 
+	if !mqttCommandAllowed(s.getConfig().MQTT, "apn") {
+		s.logger.Printf("mqtt apn: ignored payload from %s: command \"apn\" is not allowed", topic)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 	defer cancel()
 
-	client := s.getClient()
-	session, _, err := client.GetLogin(ctx, false)
-	if err != nil {
-		s.logger.Printf("mqtt apn: login failed: %v", err)
-		return
-	}
-	if session == nil {
-		s.logger.Printf("mqtt apn: login returned no session")
+	if _, err := s.getClient().PostSetAPN(ctx, apn); err != nil {
+		s.logger.Printf("mqtt apn: apply failed for %q: %v", apn, err)
 		return
 	}
 
-	if _, err = client.PostSetAPN(ctx, session, apn); err != nil {
-		session, _, relogErr := client.GetLogin(ctx, true)
-		if relogErr != nil {
-			s.logger.Printf("mqtt apn: relogin failed: %v", relogErr)
-			return
-		}
-		if session == nil {
-			s.logger.Printf("mqtt apn: relogin returned no session")
-			return
-		}
-		if _, err = client.PostSetAPN(ctx, session, apn); err != nil {
-			s.logger.Printf("mqtt apn: apply failed for %q: %v", apn, err)
-			return
-		}
-	}
-
+	s.rememberAPN(apn)
 	s.logger.Printf("mqtt apn: applied APN %q from topic %s", apn, topic)
 }
 
@@ -377,21 +460,25 @@ func (s *Server) publishMqttSafe(topic string, payload interface{}) {
 	}
 }
 
+// buildDailyUsageSnapshot is the dashboard's view of the daily buckets from
+// Settings.Usage: every retained day newest first, with today split out.
 func buildDailyUsageSnapshot(settingsData settings.Settings) map[string]interface{} {
+	days, _ := settingsData.Usage(settings.GranularityDay, time.Time{}, time.Time{})
+
 	totalUpload := int64(0)
 	totalDownload := int64(0)
-
-	for _, usage := range settingsData.DailyUsage {
-		totalUpload += usage.Upload
-		totalDownload += usage.Download
+	for _, day := range days {
+		totalUpload += day.Upload
+		totalDownload += day.Download
 	}
 	totalCombined := totalUpload + totalDownload
 
-	todayKey := time.Now().Format("2006-01-02")
+	todayKey := time.Now().Format(settings.DayLayout)
 	todayUsage := settings.UsageStats{}
-	dailyData := make([]map[string]interface{}, 0, len(settingsData.DailyUsage))
-	for date, usage := range settingsData.DailyUsage {
-		if date == todayKey {
+	dailyData := make([]map[string]interface{}, 0, len(days))
+	for _, day := range slices.Backward(days) {
+		usage := day.UsageStats
+		if day.Key == todayKey {
 			todayUsage = usage
 			continue
 		}
@@ -401,7 +488,7 @@ func buildDailyUsageSnapshot(settingsData settings.Settings) map[string]interfac
 		combinedPerc := percentage(combined, totalCombined)
 
 		dailyData = append(dailyData, map[string]interface{}{
-			"date": date,
+			"date": day.Key,
 			"upload": map[string]interface{}{
 				"raw_bytes":  usage.Upload,
 				"formatted":  formatBytes(usage.Upload),
@@ -420,12 +507,6 @@ func buildDailyUsageSnapshot(settingsData settings.Settings) map[string]interfac
 		})
 	}
 
-	sort.Slice(dailyData, func(i, j int) bool {
-		di := dailyData[i]["date"].(string)
-		dj := dailyData[j]["date"].(string)
-		return di > dj
-	})
-
 	last7 := make([]map[string]interface{}, 0, 7)
 	for i := 0; i < len(dailyData) && i < 7; i++ {
 		last7 = append(last7, dailyData[i])
@@ -688,12 +769,12 @@ func (s *Server) handleDebugGetAuthenticated(w http.ResponseWriter, r *http.Requ
 	headers := sanitizeDebugHeaders(payload.Headers)
 	timeoutMs := payload.TimeoutMs
 
-	s.withSessionForMethods(w, r, []string{http.MethodPost}, func(ctx context.Context, session *router.LoginSession) (interface{}, error) {
+	s.withSessionForMethods(w, r, []string{http.MethodPost}, func(ctx context.Context) (interface{}, error) {
 		timeoutCtx, cancel := debugContext(ctx, timeoutMs)
 		defer cancel()
 
 		client := s.getClient()
-		return client.DebugGetAuthenticated(timeoutCtx, endpoint, session, cloneStringMap(headers))
+		return client.DebugGetAuthenticated(timeoutCtx, endpoint, cloneStringMap(headers))
 	})
 }
 
@@ -731,12 +812,12 @@ func (s *Server) handleDebugPostAuthenticatedJSON(w http.ResponseWriter, r *http
 	headers := sanitizeDebugHeaders(payload.Headers)
 	timeoutMs := payload.TimeoutMs
 
-	s.withSessionForMethods(w, r, []string{http.MethodPost}, func(ctx context.Context, session *router.LoginSession) (interface{}, error) {
+	s.withSessionForMethods(w, r, []string{http.MethodPost}, func(ctx context.Context) (interface{}, error) {
 		timeoutCtx, cancel := debugContext(ctx, timeoutMs)
 		defer cancel()
 
 		client := s.getClient()
-		return client.DebugPostAuthenticatedJSON(timeoutCtx, endpoint, session, body, cloneStringMap(headers))
+		return client.DebugPostAuthenticatedJSON(timeoutCtx, endpoint, body, cloneStringMap(headers))
 	})
 }
 
@@ -764,12 +845,12 @@ func (s *Server) handleDebugPostCSRFEncrypted(w http.ResponseWriter, r *http.Req
 
 	timeoutMs := payload.TimeoutMs
 
-	s.withSessionForMethods(w, r, []string{http.MethodPost}, func(ctx context.Context, session *router.LoginSession) (interface{}, error) {
+	s.withSessionForMethods(w, r, []string{http.MethodPost}, func(ctx context.Context) (interface{}, error) {
 		timeoutCtx, cancel := debugContext(ctx, timeoutMs)
 		defer cancel()
 
 		client := s.getClient()
-		return client.PostCSRFEncrypted(timeoutCtx, endpoint, session, payload.Plaintext)
+		return client.PostCSRFEncrypted(timeoutCtx, endpoint, payload.Plaintext)
 	})
 }
 
@@ -850,44 +931,44 @@ func (s *Server) handlePreloginStatus(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleOverview(w http.ResponseWriter, r *http.Request) {
-	s.withSession(w, r, func(ctx context.Context, session *router.LoginSession) (interface{}, error) {
+	s.withSession(w, r, func(ctx context.Context) (interface{}, error) {
 		client := s.getClient()
-		return client.GetOverviewData(ctx, session)
+		return client.GetOverviewData(ctx)
 	})
 }
 
 func (s *Server) handleWanStatus(w http.ResponseWriter, r *http.Request) {
-	s.withSession(w, r, func(ctx context.Context, session *router.LoginSession) (interface{}, error) {
+	s.withSession(w, r, func(ctx context.Context) (interface{}, error) {
 		client := s.getClient()
-		return client.GetWanStatus(ctx, session)
+		return client.GetWanStatus(ctx)
 	})
 }
 
 func (s *Server) handleDeviceStatus(w http.ResponseWriter, r *http.Request) {
-	s.withSession(w, r, func(ctx context.Context, session *router.LoginSession) (interface{}, error) {
+	s.withSession(w, r, func(ctx context.Context) (interface{}, error) {
 		client := s.getClient()
-		return client.GetDeviceStatus(ctx, session)
+		return client.GetDeviceStatus(ctx)
 	})
 }
 
 func (s *Server) handleNetworkClients(w http.ResponseWriter, r *http.Request) {
-	s.withSession(w, r, func(ctx context.Context, session *router.LoginSession) (interface{}, error) {
+	s.withSession(w, r, func(ctx context.Context) (interface{}, error) {
 		client := s.getClient()
-		return client.GetNetworkClientStatus(ctx, session)
+		return client.GetNetworkClientStatus(ctx)
 	})
 }
 
 func (s *Server) handleServiceData(w http.ResponseWriter, r *http.Request) {
-	s.withSession(w, r, func(ctx context.Context, session *router.LoginSession) (interface{}, error) {
+	s.withSession(w, r, func(ctx context.Context) (interface{}, error) {
 		client := s.getClient()
-		return client.PostServiceData(ctx, session)
+		return client.PostServiceData(ctx)
 	})
 }
 
 func (s *Server) handleStatusWeb(w http.ResponseWriter, r *http.Request) {
-	s.withSession(w, r, func(ctx context.Context, session *router.LoginSession) (interface{}, error) {
+	s.withSession(w, r, func(ctx context.Context) (interface{}, error) {
 		client := s.getClient()
-		data, err := client.GetStatusWeb(ctx, session)
+		data, err := client.GetStatusWeb(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -905,44 +986,49 @@ func (s *Server) handleSetAPN(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.withSession(w, r, func(ctx context.Context, session *router.LoginSession) (interface{}, error) {
+	s.withSession(w, r, func(ctx context.Context) (interface{}, error) {
 		client := s.getClient()
-		return client.PostSetAPN(ctx, session, apn)
+		result, err := client.PostSetAPN(ctx, apn)
+		if err != nil {
+			return nil, err
+		}
+		s.rememberAPN(strings.TrimSpace(apn))
+		return result, nil
 	})
 }
 
 func (s *Server) handleWlan24(w http.ResponseWriter, r *http.Request) {
-	s.withSession(w, r, func(ctx context.Context, session *router.LoginSession) (interface{}, error) {
+	s.withSession(w, r, func(ctx context.Context) (interface{}, error) {
 		client := s.getClient()
-		return client.GetWlan24Configs(ctx, session)
+		return client.GetWlan24Configs(ctx)
 	})
 }
 
 func (s *Server) handleWlan5(w http.ResponseWriter, r *http.Request) {
-	s.withSession(w, r, func(ctx context.Context, session *router.LoginSession) (interface{}, error) {
+	s.withSession(w, r, func(ctx context.Context) (interface{}, error) {
 		client := s.getClient()
-		return client.GetWlan5Configs(ctx, session)
+		return client.GetWlan5Configs(ctx)
 	})
 }
 
 func (s *Server) handleReboot(w http.ResponseWriter, r *http.Request) {
-	s.withSession(w, r, func(ctx context.Context, session *router.LoginSession) (interface{}, error) {
+	s.withSession(w, r, func(ctx context.Context) (interface{}, error) {
 		client := s.getClient()
-		return client.Reboot(ctx, session)
+		return client.Reboot(ctx)
 	})
 }
 
 func (s *Server) handleLanStatus(w http.ResponseWriter, r *http.Request) {
-	s.withSession(w, r, func(ctx context.Context, session *router.LoginSession) (interface{}, error) {
+	s.withSession(w, r, func(ctx context.Context) (interface{}, error) {
 		client := s.getClient()
-		return client.GetLanStatusWeb(ctx, session)
+		return client.GetLanStatusWeb(ctx)
 	})
 }
 
 func (s *Server) handleSmsList(w http.ResponseWriter, r *http.Request) {
-	s.withSession(w, r, func(ctx context.Context, session *router.LoginSession) (interface{}, error) {
+	s.withSession(w, r, func(ctx context.Context) (interface{}, error) {
 		client := s.getClient()
-		return client.GetSmsList(ctx, session)
+		return client.GetSmsList(ctx)
 	})
 }
 
@@ -958,9 +1044,9 @@ func (s *Server) handleSetSmsState(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.withSession(w, r, func(ctx context.Context, session *router.LoginSession) (interface{}, error) {
+	s.withSession(w, r, func(ctx context.Context) (interface{}, error) {
 		client := s.getClient()
-		return client.SetSmsState(ctx, session, smsID, smsUnread)
+		return client.SetSmsState(ctx, smsID, smsUnread)
 	})
 }
 
@@ -1047,31 +1133,31 @@ func (s *Server) handleDeleteSms(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.withSessionForMethods(w, r, []string{http.MethodPost}, func(ctx context.Context, session *router.LoginSession) (interface{}, error) {
+	s.withSessionForMethods(w, r, []string{http.MethodPost}, func(ctx context.Context) (interface{}, error) {
 		client := s.getClient()
-		return client.DeleteSms(ctx, session, ids, deleteAll)
+		return client.DeleteSms(ctx, ids, deleteAll)
 	})
 }
 
 func (s *Server) handleCellIdentification(w http.ResponseWriter, r *http.Request) {
-	s.withSession(w, r, func(ctx context.Context, session *router.LoginSession) (interface{}, error) {
+	s.withSession(w, r, func(ctx context.Context) (interface{}, error) {
 		client := s.getClient()
-		return client.PostCellularIdentification(ctx, session)
+		return client.PostCellularIdentification(ctx)
 	})
 }
 
 func (s *Server) handleSimInfo(w http.ResponseWriter, r *http.Request) {
-	s.withSession(w, r, func(ctx context.Context, session *router.LoginSession) (interface{}, error) {
+	s.withSession(w, r, func(ctx context.Context) (interface{}, error) {
 		client := s.getClient()
-		return client.GetSimInfo(ctx, session)
+		return client.GetSimInfo(ctx)
 	})
 }
 
 func (s *Server) handleLedState(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		s.withSession(w, r, func(ctx context.Context, session *router.LoginSession) (interface{}, error) {
-			return s.fetchNormalizedLedState(ctx, session)
+		s.withSession(w, r, func(ctx context.Context) (interface{}, error) {
+			return s.fetchNormalizedLedState(ctx)
 		})
 	case http.MethodPost:
 		enableParam := strings.TrimSpace(r.URL.Query().Get("enable"))
@@ -1101,34 +1187,11 @@ func (s *Server) handleLedState(w http.ResponseWriter, r *http.Request) {
 			enable = *payload.Enable
 		}
 
-		client := s.getClient()
-		session, loginResp, err := client.GetLogin(r.Context(), false)
+		result, err := s.getClient().LedState(r.Context(), enable)
 		if err != nil {
-			writeError(w, err)
-			return
-		}
-		if session == nil {
-			writeJSON(w, http.StatusOK, loginResp)
+			writeRouterError(w, err)
 			return
 		}
-
-		result, err := client.LedState(r.Context(), session, enable)
-		if err != nil {
-			session, loginResp, err = client.GetLogin(r.Context(), true)
-			if err != nil {
-				writeError(w, err)
-				return
-			}
-			if session == nil {
-				writeJSON(w, http.StatusOK, loginResp)
-				return
-			}
-			result, err = client.LedState(r.Context(), session, enable)
-			if err != nil {
-				writeError(w, err)
-				return
-			}
-		}
 		writeJSON(w, http.StatusOK, result)
 	default:
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -1141,122 +1204,65 @@ func (s *Server) handleLedStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.withSession(w, r, func(ctx context.Context, session *router.LoginSession) (interface{}, error) {
-		return s.fetchNormalizedLedState(ctx, session)
+	s.withSession(w, r, func(ctx context.Context) (interface{}, error) {
+		return s.fetchNormalizedLedState(ctx)
 	})
 }
 
-func (s *Server) fetchNormalizedLedState(ctx context.Context, session *router.LoginSession) (map[string]interface{}, error) {
+func (s *Server) fetchNormalizedLedState(ctx context.Context) (map[string]interface{}, error) {
 	client := s.getClient()
-	raw, err := client.GetLedState(ctx, session)
+	raw, err := client.GetLedState(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return normalizeLedStateResponse(raw), nil
-}
-
-func normalizeLedStateResponse(raw map[string]interface{}) map[string]interface{} {
-	statusLED := extractLedFlag(raw, "X_ALU_COM_StatusLED_Enable")
-	signalLED := extractLedFlag(raw, "X_ALU_COM_SignalLED_Enable")
-
-	return map[string]interface{}{
-		"enabled":    statusLED && signalLED,
-		"status_led": statusLED,
-		"signal_led": signalLED,
-	}
+	return normalizeLedStateResponse(raw)
 }
 
-func extractLedFlag(raw map[string]interface{}, key string) bool {
-	if raw == nil {
-		return false
-	}
-
-	ledGlobal, ok := raw["LEDGlobalSts"]
-	if !ok {
-		return false
-	}
-
-	if data, ok := ledGlobal.(map[string]interface{}); ok {
-		return parseTruthy(data[key])
+// normalizeLedStateResponse fails rather than reporting every LED off when
+// the firmware sends a payload the typed layer cannot decode.
+func normalizeLedStateResponse(raw map[string]interface{}) (map[string]interface{}, error) {
+	status, err := router.ParseLedStatus(raw)
+	if err != nil {
+		return nil, fmt.Errorf("led state: %w", err)
 	}
-	return false
-}
-
-func parseTruthy(value interface{}) bool {
-	switch v := value.(type) {
-	case bool:
-		return v
-	case float64:
-		return v != 0
-	case int:
-		return v != 0
-	case int64:
-		return v != 0
-	case string:
-		s := strings.TrimSpace(v)
-		if s == "" {
-			return false
-		}
-
-		switch strings.ToLower(s) {
-		case "true", "on", "enabled", "enable", "yes":
-			return true
-		case "false", "off", "disabled", "disable", "no":
-			return false
-		}
 
-		if num, err := strconv.Atoi(s); err == nil {
-			return num != 0
-		}
-	case json.Number:
-		if val, err := v.Int64(); err == nil {
-			return val != 0
-		}
-	}
-	return false
+	return map[string]interface{}{
+		"enabled":    status.Enabled(),
+		"status_led": bool(status.Global.StatusLED),
+		"signal_led": bool(status.Global.SignalLED),
+	}, nil
 }
 
-func (s *Server) withSession(w http.ResponseWriter, r *http.Request, fn func(context.Context, *router.LoginSession) (interface{}, error)) {
+func (s *Server) withSession(w http.ResponseWriter, r *http.Request, fn func(context.Context) (interface{}, error)) {
 	s.withSessionForMethods(w, r, []string{http.MethodGet}, fn)
 }
 
-func (s *Server) withSessionForMethods(w http.ResponseWriter, r *http.Request, methods []string, fn func(context.Context, *router.LoginSession) (interface{}, error)) {
+// withSessionForMethods runs a router call for the allowed methods. Session
+// handling, including re-login after expiry, happens inside router.Client.
+func (s *Server) withSessionForMethods(w http.ResponseWriter, r *http.Request, methods []string, fn func(context.Context) (interface{}, error)) {
 	allowed := slices.Contains(methods, r.Method)
 	if !allowed {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	client := s.getClient()
-	session, loginResp, err := client.GetLogin(r.Context(), false)
+	result, err := fn(r.Context())
 	if err != nil {
-		writeError(w, err)
-		return
-	}
-	if session == nil {
-		writeJSON(w, http.StatusOK, loginResp)
+		writeRouterError(w, err)
 		return
 	}
+	writeJSON(w, http.StatusOK, result)
+}
 
-	result, err := fn(r.Context(), session)
-	if err != nil {
-		client = s.getClient()
-		session, loginResp, err = client.GetLogin(r.Context(), true)
-		if err != nil {
-			writeError(w, err)
-			return
-		}
-		if session == nil {
-			writeJSON(w, http.StatusOK, loginResp)
-			return
-		}
-		result, err = fn(r.Context(), session)
-		if err != nil {
-			writeError(w, err)
-			return
-		}
+// writeRouterError reports a failed router call. A rejected login is passed
+// through as the router's own login response, as the UI expects.
+func writeRouterError(w http.ResponseWriter, err error) {
+	var loginErr *router.LoginError
+	if errors.As(err, &loginErr) {
+		writeJSON(w, http.StatusOK, loginErr.Response)
+		return
 	}
-	writeJSON(w, http.StatusOK, result)
+	writeError(w, err)
 }
 
 func (s *Server) handleConfigListenerCheck(w http.ResponseWriter, r *http.Request) {
@@ -1300,12 +1306,7 @@ func (s *Server) handleConfigListenerCheck(w http.ResponseWriter, r *http.Reques
 }
 
 func (s *Server) sendTelegramMessage(ctx context.Context, cfg config.TelegramConfig, chatID, parseMode, message string) error {
-	base := strings.TrimSpace(cfg.APIBase)
-	if base == "" {
-		base = config.Defaults().Telegram.APIBase
-	}
-	base = strings.TrimRight(base, "/")
-	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", base, cfg.BotToken)
+	endpoint := telegramEndpoint(cfg, "sendMessage")
 
 	payload := map[string]interface{}{
 		"chat_id": chatID,
@@ -1321,13 +1322,13 @@ func (s *Server) sendTelegramMessage(ctx context.Context, cfg config.TelegramCon
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("create telegram request: %w", err)
+		return fmt.Errorf("create telegram request: %w", redactTelegramURL(err))
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("send telegram request: %w", err)
+		return fmt.Errorf("send telegram request: %w", redactTelegramURL(err))
 	}
 	defer resp.Body.Close()
 
@@ -1354,8 +1355,12 @@ func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusOK, s.getConfig())
 	case http.MethodPost:
 		defer r.Body.Close()
+		s.cfgWriteMu.Lock()
+		defer s.cfgWriteMu.Unlock()
 
-		var payload config.Config
+		// Decode onto the current config so sections the dashboard does not
+		// know about survive a save from the UI.
+		payload := s.getConfig()
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON payload"})
 			return
@@ -1380,6 +1385,14 @@ func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
 		s.setConfig(updated)
 		s.setClient(router.NewClient(updated))
 		s.configureSmsForwarding(updated)
+		s.configureSignalHistory(updated)
+		s.configureMetrics(updated)
+		s.configureTelegramBot(updated)
+		s.configureUsageRetention(updated)
+		s.configureQuota(updated)
+		s.configureAlerts(updated)
+		s.configureWatchdog(updated)
+		s.configureSchedules(updated)
 		s.logger.Printf("Configuration updated at %s", s.cfgPath)
 
 		if s.reloadFn != nil {
@@ -1399,18 +1412,25 @@ func normalizeConfig(cfg config.Config) config.Config {
 	defaults := config.Defaults()
 
 	normalized := config.Config{
-		RouterHost:     strings.TrimSpace(cfg.RouterHost),
-		RouterUser:     strings.TrimSpace(cfg.RouterUser),
-		RouterPassword: strings.TrimSpace(cfg.RouterPassword),
-		ListenHost:     strings.TrimSpace(cfg.ListenHost),
-		ListenPort:     strings.TrimSpace(cfg.ListenPort),
-		PollIntervalMs: cfg.PollIntervalMs,
+		RouterHost:       strings.TrimSpace(cfg.RouterHost),
+		RouterUser:       strings.TrimSpace(cfg.RouterUser),
+		RouterPassword:   strings.TrimSpace(cfg.RouterPassword),
+		ListenHost:       strings.TrimSpace(cfg.ListenHost),
+		ListenPort:       strings.TrimSpace(cfg.ListenPort),
+		TLSEnabled:       cfg.TLSEnabled,
+		TLSCert:          strings.TrimSpace(cfg.TLSCert),
+		TLSKey:           strings.TrimSpace(cfg.TLSKey),
+		HTTPRedirectPort: strings.TrimSpace(cfg.HTTPRedirectPort),
+		PollIntervalMs:   cfg.PollIntervalMs,
 		Telegram: config.TelegramConfig{
-			Enabled:   cfg.Telegram.Enabled,
-			APIBase:   strings.TrimSpace(cfg.Telegram.APIBase),
-			BotToken:  strings.TrimSpace(cfg.Telegram.BotToken),
-			ChatID:    strings.TrimSpace(cfg.Telegram.ChatID),
-			ParseMode: strings.TrimSpace(cfg.Telegram.ParseMode),
+			Enabled:        cfg.Telegram.Enabled,
+			APIBase:        strings.TrimSpace(cfg.Telegram.APIBase),
+			BotToken:       strings.TrimSpace(cfg.Telegram.BotToken),
+			ChatID:         strings.TrimSpace(cfg.Telegram.ChatID),
+			ParseMode:      strings.TrimSpace(cfg.Telegram.ParseMode),
+			Commands:       cfg.Telegram.Commands,
+			AllowedChatIDs: cleanStringList(cfg.Telegram.AllowedChatIDs),
+			Alerts:         cfg.Telegram.Alerts,
 		},
 		LongPolling: config.LongPollingConfig{
 			Enabled:              cfg.LongPolling.Enabled,
@@ -1424,7 +1444,40 @@ func normalizeConfig(cfg config.Config) config.Config {
 			Username:  strings.TrimSpace(cfg.MQTT.Username),
 			Password:  cfg.MQTT.Password,
 			TopicBase: strings.TrimSpace(cfg.MQTT.TopicBase),
+
+			HomeAssistant:   cfg.MQTT.HomeAssistant,
+			DiscoveryPrefix: strings.Trim(strings.TrimSpace(cfg.MQTT.DiscoveryPrefix), "/"),
+			APNOptions:      cleanStringList(cfg.MQTT.APNOptions),
+			AllowedCommands: normalizeAllowedCommands(cfg.MQTT.AllowedCommands),
+			Alerts:          cfg.MQTT.Alerts,
 		},
+		SignalHistory: cfg.SignalHistory,
+		Metrics:       cfg.Metrics,
+		WanRenew: config.WanRenewConfig{
+			TempAPN:        strings.TrimSpace(cfg.WanRenew.TempAPN),
+			APN:            strings.TrimSpace(cfg.WanRenew.APN),
+			MaxAttempts:    cfg.WanRenew.MaxAttempts,
+			TimeoutSeconds: cfg.WanRenew.TimeoutSeconds,
+		},
+		Auth: config.AuthConfig{
+			Enabled:         cfg.Auth.Enabled,
+			PasswordHash:    strings.TrimSpace(cfg.Auth.PasswordHash),
+			SessionTTLHours: cfg.Auth.SessionTTLHours,
+			Users:           normalizeAuthUsers(cfg.Auth.Users),
+			Tokens:          normalizeAPITokens(cfg.Auth.Tokens),
+			AllowedOrigins:  normalizeOrigins(cfg.Auth.AllowedOrigins),
+		},
+		RouterCache: config.RouterCacheConfig{
+			Enabled: cfg.RouterCache.Enabled,
+			TTLMs:   maps.Clone(cfg.RouterCache.TTLMs),
+		},
+		Quota:     normalizeQuota(cfg.Quota),
+		Usage:     cfg.Usage,
+		SmsRules:  normalizeSmsRules(cfg.SmsRules),
+		Notifiers: normalizeNotifiers(cfg.Notifiers),
+		Alerts:    normalizeAlerts(cfg.Alerts),
+		Watchdog:  normalizeWatchdog(cfg.Watchdog),
+		Schedules: normalizeSchedules(cfg.Schedules),
 	}
 
 	if normalized.RouterHost == "" {
@@ -1454,6 +1507,42 @@ func normalizeConfig(cfg config.Config) config.Config {
 	if strings.TrimSpace(normalized.MQTT.TopicBase) == "" {
 		normalized.MQTT.TopicBase = defaults.MQTT.TopicBase
 	}
+	if normalized.MQTT.DiscoveryPrefix == "" {
+		normalized.MQTT.DiscoveryPrefix = defaults.MQTT.DiscoveryPrefix
+	}
+	if len(normalized.MQTT.APNOptions) == 0 {
+		normalized.MQTT.APNOptions = defaults.MQTT.APNOptions
+	}
+	if normalized.SignalHistory.IntervalSeconds <= 0 {
+		normalized.SignalHistory.IntervalSeconds = defaults.SignalHistory.IntervalSeconds
+	}
+	if normalized.SignalHistory.RetentionDays <= 0 {
+		normalized.SignalHistory.RetentionDays = defaults.SignalHistory.RetentionDays
+	}
+	if normalized.Metrics.IntervalSeconds <= 0 {
+		normalized.Metrics.IntervalSeconds = defaults.Metrics.IntervalSeconds
+	}
+	if normalized.WanRenew.TempAPN == "" {
+		normalized.WanRenew.TempAPN = defaults.WanRenew.TempAPN
+	}
+	if normalized.WanRenew.MaxAttempts <= 0 {
+		normalized.WanRenew.MaxAttempts = defaults.WanRenew.MaxAttempts
+	}
+	if normalized.WanRenew.TimeoutSeconds <= 0 {
+		normalized.WanRenew.TimeoutSeconds = defaults.WanRenew.TimeoutSeconds
+	}
+	if normalized.Auth.SessionTTLHours <= 0 {
+		normalized.Auth.SessionTTLHours = defaults.Auth.SessionTTLHours
+	}
+	if normalized.Quota.IntervalSeconds <= 0 {
+		normalized.Quota.IntervalSeconds = defaults.Quota.IntervalSeconds
+	}
+	if normalized.Usage.HourlyRetentionDays <= 0 {
+		normalized.Usage.HourlyRetentionDays = defaults.Usage.HourlyRetentionDays
+	}
+	if normalized.Usage.DailyRetentionDays <= 0 {
+		normalized.Usage.DailyRetentionDays = defaults.Usage.DailyRetentionDays
+	}
 
 	return normalized
 }
@@ -1481,6 +1570,17 @@ func validateConfig(cfg config.Config) error {
 	if _, err := strconv.Atoi(cfg.ListenPort); err != nil {
 		return fmt.Errorf("listen_port must be numeric: %w", err)
 	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return errors.New("tls_cert and tls_key must be set together")
+	}
+	if cfg.HTTPRedirectPort != "" {
+		if _, err := strconv.Atoi(cfg.HTTPRedirectPort); err != nil {
+			return fmt.Errorf("http_redirect_port must be numeric: %w", err)
+		}
+		if cfg.HTTPRedirectPort == cfg.ListenPort {
+			return errors.New("http_redirect_port must differ from listen_port")
+		}
+	}
 
 	if cfg.Telegram.Enabled {
 		if cfg.Telegram.BotToken == "" {
@@ -1511,18 +1611,138 @@ func validateConfig(cfg config.Config) error {
 			return errors.New("mqtt.topic_base is required when MQTT integration is enabled")
 		}
 	}
+	if cfg.SignalHistory.IntervalSeconds < 10 {
+		return errors.New("signal_history.interval_seconds must be at least 10 seconds")
+	}
+	if cfg.SignalHistory.RetentionDays > 366 {
+		return errors.New("signal_history.retention_days must not exceed 366 days")
+	}
+	for _, name := range cfg.MQTT.AllowedCommands {
+		if name != "*" && !slices.Contains(mqttCommandNames, name) {
+			return fmt.Errorf("mqtt.allowed_commands: unknown command %q", name)
+		}
+	}
+	if cfg.Metrics.IntervalSeconds < 5 {
+		return errors.New("metrics.interval_seconds must be at least 5 seconds")
+	}
+	if cfg.WanRenew.MaxAttempts > 10 {
+		return errors.New("wan_renew.max_attempts must not exceed 10")
+	}
+	if cfg.WanRenew.TimeoutSeconds < 10 {
+		return errors.New("wan_renew.timeout_seconds must be at least 10 seconds")
+	}
+	knownTTLs := config.Defaults().RouterCache.TTLMs
+	for key, ms := range cfg.RouterCache.TTLMs {
+		if _, ok := knownTTLs[key]; !ok {
+			return fmt.Errorf("router_cache.ttl_ms: unknown endpoint %q", key)
+		}
+		if ms < 0 || ms > 600000 {
+			return fmt.Errorf("router_cache.ttl_ms.%s must be between 0 and 600000", key)
+		}
+	}
+	if cfg.Usage.HourlyRetentionDays > 90 {
+		return errors.New("usage.hourly_retention_days must not exceed 90 days")
+	}
+	if cfg.Usage.DailyRetentionDays < 31 || cfg.Usage.DailyRetentionDays > 3660 {
+		return errors.New("usage.daily_retention_days must be between 31 and 3660 days")
+	}
+	if cfg.Usage.MonthlyRetentionMonths < 0 {
+		return errors.New("usage.monthly_retention_months must not be negative")
+	}
+	if err := validateQuota(cfg.Quota, cfg.Usage.DailyRetentionDays); err != nil {
+		return err
+	}
+	if err := validateSmsRules(cfg); err != nil {
+		return err
+	}
+	if err := validateNotifiers(cfg.Notifiers); err != nil {
+		return err
+	}
+	if err := validateAlerts(cfg.Alerts); err != nil {
+		return err
+	}
+	if err := validateWatchdog(cfg.Watchdog); err != nil {
+		return err
+	}
+	if err := validateSchedules(cfg.Schedules); err != nil {
+		return err
+	}
+	if cfg.Auth.Enabled && !auth.ValidHash(cfg.Auth.PasswordHash) {
+		return errors.New("auth.password_hash must be set (see `nokia-router passwd`) when auth is enabled")
+	}
+	users := map[string]struct{}{adminUser: {}}
+	for _, user := range cfg.Auth.Users {
+		if user.Name == "" || !auth.ValidHash(user.PasswordHash) {
+			return errors.New("auth.users entries need a name and a password hash")
+		}
+		if _, dup := users[user.Name]; dup {
+			return fmt.Errorf("auth.users: duplicate or reserved name %q", user.Name)
+		}
+		users[user.Name] = struct{}{}
+		if err := validateScopes(user.Scopes); err != nil {
+			return fmt.Errorf("auth.users %q: %w", user.Name, err)
+		}
+	}
+	names := map[string]struct{}{}
+	for _, token := range cfg.Auth.Tokens {
+		if strings.TrimSpace(token.Name) == "" || len(token.Hash) != 64 {
+			return errors.New("auth.tokens entries need a name and a SHA-256 hash")
+		}
+		if _, dup := names[token.Name]; dup {
+			return fmt.Errorf("auth.tokens: duplicate name %q", token.Name)
+		}
+		names[token.Name] = struct{}{}
+		if err := validateScopes(token.Scopes); err != nil {
+			return fmt.Errorf("auth.tokens %q: %w", token.Name, err)
+		}
+	}
+	for _, origin := range cfg.Auth.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("auth.allowed_origins: invalid origin %q", origin)
+		}
+	}
 
 	return nil
 }
 
 func (s *Server) validateListener(cfg config.Config) error {
 	current := s.getConfig()
-	if strings.EqualFold(strings.TrimSpace(cfg.ListenHost), strings.TrimSpace(current.ListenHost)) &&
-		strings.TrimSpace(cfg.ListenPort) == strings.TrimSpace(current.ListenPort) {
+	if err := probeListener(current, cfg.ListenHost, cfg.ListenPort); err != nil {
+		return err
+	}
+	if !cfg.TLSEnabled {
 		return nil
 	}
+	if cfg.HTTPRedirectPort != "" {
+		if err := probeListener(current, cfg.ListenHost, cfg.HTTPRedirectPort); err != nil {
+			return err
+		}
+	}
+	// A broken certificate would only surface when the listener restarts,
+	// taking the UI down with it, so load it up front.
+	if cfg.TLSCert != "" {
+		if _, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey); err != nil {
+			return fmt.Errorf("tls_cert/tls_key: %w", err)
+		}
+	}
+	return nil
+}
+
+// probeListener checks that host:port can be bound, unless one of the
+// current listeners already holds it.
+func probeListener(current config.Config, host, port string) error {
+	if strings.EqualFold(strings.TrimSpace(host), strings.TrimSpace(current.ListenHost)) {
+		port = strings.TrimSpace(port)
+		if port == strings.TrimSpace(current.ListenPort) ||
+			(current.TLSEnabled && port == strings.TrimSpace(current.HTTPRedirectPort)) {
+			return nil
+		}
+	}
 
-	addr := net.JoinHostPort(cfg.ListenHost, cfg.ListenPort)
+	addr := net.JoinHostPort(host, port)
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return fmt.Errorf("listen address %s unavailable: %w", addr, err)
@@ -1562,6 +1782,33 @@ func sanitizeDebugHeaders(headers map[string]string) map[string]string {
 	return out
 }
 
+// normalizeAllowedCommands lower-cases and de-duplicates the MQTT command
+// allow-list. A nil list (field omitted) falls back to the defaults, while an
+// explicit empty list disables remote commands.
+func normalizeAllowedCommands(in []string) []string {
+	if in == nil {
+		return config.Defaults().MQTT.AllowedCommands
+	}
+	out := make([]string, 0, len(in))
+	for _, name := range in {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" && !slices.Contains(out, name) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func cleanStringList(in []string) []string {
+	out := make([]string, 0, len(in))
+	for _, v := range in {
+		if trimmed := strings.TrimSpace(v); trimmed != "" {
+			out = append(out, trimmed)
+		}
+	}
+	return out
+}
+
 func cloneStringMap(in map[string]string) map[string]string {
 	if len(in) == 0 {
 		return nil
@@ -1622,20 +1869,6 @@ func writeError(w http.ResponseWriter, err error) {
 	writeJSON(w, status, map[string]string{"error": msg})
 }
 
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
-}
-
 func splitAndCleanIDs(raw string) []string {
 	if raw == "" {
 		return nil
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nokia_modem/internal/config"
+	"nokia_modem/internal/router"
+	"nokia_modem/internal/router/routertest"
+	"nokia_modem/internal/settings"
+)
+
+func newTestServer(t *testing.T) (*Server, *routertest.Router, *httptest.Server) {
+	t.Helper()
+
+	emu := routertest.New(routertest.Options{})
+	t.Cleanup(emu.Close)
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	cfg := config.Defaults()
+	cfg.RouterHost = emu.Host()
+	cfg.SignalHistory.Enabled = false
+	if err := config.Save(cfgPath, cfg); err != nil {
+		t.Fatalf("save config: %v", err)
+	}
+
+	store, err := settings.NewStore(filepath.Join(dir, "settings.json"))
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+
+	srv := New(router.NewClient(cfg), store, cfgPath, cfg, nil)
+	srv.logger = log.New(io.Discard, "", 0)
+
+	httpSrv := httptest.NewServer(srv.Handler())
+	t.Cleanup(httpSrv.Close)
+	return srv, emu, httpSrv
+}
+
+func getJSON(t *testing.T, url string, out interface{}) int {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("decode %s: %v", url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestStatusWebUpdatesUsage(t *testing.T) {
+	srv, emu, httpSrv := newTestServer(t)
+	emu.SetCounters(1000, 5000)
+
+	var payload map[string]interface{}
+	if status := getJSON(t, httpSrv.URL+"/api/status_web", &payload); status != http.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+	if _, ok := payload["cellular_stats"]; !ok {
+		t.Fatalf("expected cellular_stats in payload: %v", payload)
+	}
+
+	today := time.Now().Format("2006-01-02")
+	usage := srv.store.Get().DailyUsage[today]
+	if usage.Upload != 1000 || usage.Download != 5000 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+}
+
+func TestLedStateEndpoint(t *testing.T) {
+	_, emu, httpSrv := newTestServer(t)
+
+	resp, err := http.Post(httpSrv.URL+"/api/led_state", "application/json", strings.NewReader(`{"enable":false}`))
+	if err != nil {
+		t.Fatalf("post led_state: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+	if emu.LedEnabled() {
+		t.Fatalf("expected LEDs to be switched off")
+	}
+
+	var led map[string]interface{}
+	getJSON(t, httpSrv.URL+"/api/led_status", &led)
+	if led["enabled"] != false {
+		t.Fatalf("expected normalized LED state to be off: %v", led)
+	}
+}
+
+func TestNormalizeLedStateRejectsUndecodablePayload(t *testing.T) {
+	raw := map[string]interface{}{
+		"LEDGlobalSts": map[string]interface{}{
+			"X_ALU_COM_StatusLED_Enable": map[string]interface{}{"value": 1},
+			"X_ALU_COM_SignalLED_Enable": 1,
+		},
+	}
+	if led, err := normalizeLedStateResponse(raw); err == nil {
+		t.Fatalf("expected a decode error, got %v", led)
+	}
+}
+
+func TestDeleteSmsEndpoint(t *testing.T) {
+	_, emu, httpSrv := newTestServer(t)
+	id := emu.AddSms("+620001", "hello", time.Now())
+	emu.AddSms("+620002", "world", time.Now())
+
+	resp, err := http.Post(httpSrv.URL+"/api/delete_sms", "application/json", strings.NewReader(`{"sms_ids":["`+id+`"]}`))
+	if err != nil {
+		t.Fatalf("post delete_sms: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+	if remaining := emu.Sms(); len(remaining) != 1 || remaining[0].Sender != "+620002" {
+		t.Fatalf("unexpected inbox: %+v", remaining)
+	}
+}
+
+func TestPerformSmsSyncArchivesMessages(t *testing.T) {
+	srv, emu, _ := newTestServer(t)
+	emu.AddSms("+620001", "first", time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC))
+
+	srv.performSmsSync(context.Background())
+
+	srv.smsArchive.mu.Lock()
+	count := len(srv.smsArchive.entries)
+	srv.smsArchive.mu.Unlock()
+	if count != 1 {
+		t.Fatalf("expected 1 archived message, got %d", count)
+	}
+}
+
+func TestFreshQueryBypassesRouterCache(t *testing.T) {
+	_, emu, httpSrv := newTestServer(t)
+
+	for _, path := range []string{"/api/wan_status", "/api/wan_status", "/api/wan_status?fresh=1"} {
+		if status := getJSON(t, httpSrv.URL+path, nil); status != http.StatusOK {
+			t.Fatalf("GET %s: %d", path, status)
+		}
+	}
+	if calls := emu.Calls("show_wan_status_web_app.cgi"); calls != 2 {
+		t.Fatalf("expected one cached and one fresh request, router saw %d", calls)
+	}
+}
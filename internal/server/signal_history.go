@@ -0,0 +1,564 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"nokia_modem/internal/config"
+	"nokia_modem/internal/router"
+)
+
+const (
+	signalHistoryFile       = "signal_history.ndjson"
+	defaultSignalRange      = 24 * time.Hour
+	maxSignalHistoryPoints  = 5000
+	targetSignalHistoryStep = 500
+	invalidSignalValue      = -32768
+)
+
+// signalSample is one observation of the serving cell. Metric pointers are
+// nil when the router reported no measurement. When returned by a query,
+// metrics are bucket averages and Samples holds the number of raw samples
+// that went into the bucket.
+type signalSample struct {
+	Time       time.Time `json:"time"`
+	RAT        string    `json:"rat,omitempty"`
+	RSRP       *float64  `json:"rsrp,omitempty"`
+	RSRQ       *float64  `json:"rsrq,omitempty"`
+	SINR       *float64  `json:"sinr,omitempty"`
+	RSSI       *float64  `json:"rssi,omitempty"`
+	CQI        *float64  `json:"cqi,omitempty"`
+	Band       string    `json:"band,omitempty"`
+	PCI        int64     `json:"pci,omitempty"`
+	EARFCN     int64     `json:"earfcn,omitempty"`
+	CACarriers int       `json:"ca_carriers"`
+	CABands    []string  `json:"ca_bands,omitempty"`
+	Samples    int       `json:"samples,omitempty"`
+}
+
+// signalHistory keeps a rolling window of samples in memory and mirrors them
+// to an append-only NDJSON file. The file is compacted once expired lines
+// outnumber the retained ones, so it never grows far beyond the window.
+type signalHistory struct {
+	path      string
+	mu        sync.Mutex
+	loaded    bool
+	samples   []signalSample
+	fileLines int
+}
+
+func newSignalHistory(path string) *signalHistory {
+	return &signalHistory{path: path}
+}
+
+func (h *signalHistory) ensureLoadedLocked() error {
+	if h.loaded {
+		return nil
+	}
+
+	file, err := os.Open(h.path)
+	if errors.Is(err, os.ErrNotExist) {
+		h.loaded = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	samples := make([]signalSample, 0)
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		lines++
+		var sample signalSample
+		if err := json.Unmarshal([]byte(line), &sample); err != nil || sample.Time.IsZero() {
+			// A torn final line after a crash is expected; skip it.
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Time.Before(samples[j].Time)
+	})
+	h.samples = samples
+	h.fileLines = lines
+	h.loaded = true
+	return nil
+}
+
+// Append records sample and drops everything older than retention.
+func (h *signalHistory) Append(sample signalSample, retention time.Duration) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.ensureLoadedLocked(); err != nil {
+		return fmt.Errorf("load signal history: %w", err)
+	}
+
+	sample.Time = sample.Time.UTC()
+	sample.Samples = 0
+	h.samples = append(h.samples, sample)
+
+	if retention > 0 {
+		cutoff := sample.Time.Add(-retention)
+		drop := sort.Search(len(h.samples), func(i int) bool {
+			return !h.samples[i].Time.Before(cutoff)
+		})
+		if drop > 0 {
+			h.samples = append([]signalSample(nil), h.samples[drop:]...)
+		}
+	}
+
+	if h.fileLines > 64 && h.fileLines >= 2*len(h.samples) {
+		return h.rewriteLocked()
+	}
+	return h.appendLineLocked(sample)
+}
+
+func (h *signalHistory) appendLineLocked(sample signalSample) error {
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o755); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(h.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	h.fileLines++
+	return nil
+}
+
+func (h *signalHistory) rewriteLocked() error {
+	dir := filepath.Dir(h.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp(dir, "signal-history-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmpFile.Name()
+
+	writer := bufio.NewWriter(tmpFile)
+	encoder := json.NewEncoder(writer)
+	for _, sample := range h.samples {
+		if err := encoder.Encode(sample); err != nil {
+			_ = tmpFile.Close()
+			_ = os.Remove(tmpName)
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, h.path); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+
+	h.fileLines = len(h.samples)
+	return nil
+}
+
+// Query returns the samples in [from, to], averaged into step-sized buckets.
+func (h *signalHistory) Query(from, to time.Time, step time.Duration) ([]signalSample, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.ensureLoadedLocked(); err != nil {
+		return nil, fmt.Errorf("load signal history: %w", err)
+	}
+
+	start := sort.Search(len(h.samples), func(i int) bool {
+		return !h.samples[i].Time.Before(from)
+	})
+	end := sort.Search(len(h.samples), func(i int) bool {
+		return h.samples[i].Time.After(to)
+	})
+	if start >= end {
+		return []signalSample{}, nil
+	}
+	return downsampleSignal(h.samples[start:end], step), nil
+}
+
+type signalMetricSum struct {
+	sum   float64
+	count int
+}
+
+func (m *signalMetricSum) add(v *float64) {
+	if v == nil {
+		return
+	}
+	m.sum += *v
+	m.count++
+}
+
+func (m signalMetricSum) mean() *float64 {
+	if m.count == 0 {
+		return nil
+	}
+	v := math.Round(m.sum/float64(m.count)*10) / 10
+	return &v
+}
+
+// downsampleSignal averages the metrics of samples sharing a step-aligned
+// bucket. Cell identity fields (RAT, band, PCI, EARFCN, CA) are taken from
+// the latest sample in the bucket, since averaging them is meaningless.
+func downsampleSignal(samples []signalSample, step time.Duration) []signalSample {
+	stepSeconds := int64(step / time.Second)
+	if stepSeconds <= 0 {
+		stepSeconds = 1
+	}
+
+	out := make([]signalSample, 0)
+	var (
+		bucket                      int64
+		current                     signalSample
+		rsrp, rsrq, sinr, rssi, cqi signalMetricSum
+		open                        bool
+	)
+
+	flush := func() {
+		if !open {
+			return
+		}
+		current.Time = time.Unix(bucket*stepSeconds, 0).UTC()
+		current.RSRP = rsrp.mean()
+		current.RSRQ = rsrq.mean()
+		current.SINR = sinr.mean()
+		current.RSSI = rssi.mean()
+		current.CQI = cqi.mean()
+		out = append(out, current)
+	}
+
+	for _, sample := range samples {
+		key := floorDiv(sample.Time.Unix(), stepSeconds)
+		if !open || key != bucket {
+			flush()
+			bucket = key
+			open = true
+			current = signalSample{}
+			rsrp, rsrq, sinr, rssi, cqi = signalMetricSum{}, signalMetricSum{}, signalMetricSum{}, signalMetricSum{}, signalMetricSum{}
+		}
+
+		rsrp.add(sample.RSRP)
+		rsrq.add(sample.RSRQ)
+		sinr.add(sample.SINR)
+		rssi.add(sample.RSSI)
+		cqi.add(sample.CQI)
+
+		if sample.RAT != "" {
+			current.RAT = sample.RAT
+		}
+		if sample.Band != "" {
+			current.Band = sample.Band
+		}
+		if sample.PCI != 0 {
+			current.PCI = sample.PCI
+		}
+		if sample.EARFCN != 0 {
+			current.EARFCN = sample.EARFCN
+		}
+		current.CACarriers = sample.CACarriers
+		current.CABands = sample.CABands
+		current.Samples++
+	}
+	flush()
+	return out
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+func signalHistoryConfigsEqual(a, b config.SignalHistoryConfig) bool {
+	return a.Enabled == b.Enabled &&
+		a.IntervalSeconds == b.IntervalSeconds &&
+		a.RetentionDays == b.RetentionDays
+}
+
+func (s *Server) configureSignalHistory(cfg config.Config) {
+	var (
+		start bool
+		stop  context.CancelFunc
+		ctx   context.Context
+	)
+
+	s.signalMu.Lock()
+	running := s.signalCancel != nil
+	changed := !signalHistoryConfigsEqual(s.signalCfg, cfg.SignalHistory)
+
+	if running && (changed || !cfg.SignalHistory.Enabled) {
+		stop = s.signalCancel
+		s.signalCancel = nil
+		running = false
+	}
+	if cfg.SignalHistory.Enabled && !running {
+		ctx, s.signalCancel = context.WithCancel(context.Background())
+		s.signalWG.Add(1)
+		start = true
+	}
+	s.signalCfg = cfg.SignalHistory
+	s.signalMu.Unlock()
+
+	if stop != nil {
+		stop()
+		s.signalWG.Wait()
+		s.logger.Printf("signal history: sampler stopped")
+	}
+
+	if start {
+		interval := signalSampleInterval(cfg.SignalHistory)
+		go s.runSignalSampler(ctx, interval, signalRetention(cfg.SignalHistory))
+		s.logger.Printf("signal history: sampler started (interval %s)", interval)
+	}
+}
+
+func signalSampleInterval(cfg config.SignalHistoryConfig) time.Duration {
+	seconds := cfg.IntervalSeconds
+	if seconds < 10 {
+		seconds = 60
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func signalRetention(cfg config.SignalHistoryConfig) time.Duration {
+	days := cfg.RetentionDays
+	if days <= 0 {
+		days = 7
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func (s *Server) runSignalSampler(ctx context.Context, interval, retention time.Duration) {
+	defer s.signalWG.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s.recordSignalSample(ctx, retention)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.recordSignalSample(ctx, retention)
+		}
+	}
+}
+
+func (s *Server) recordSignalSample(ctx context.Context, retention time.Duration) {
+	sampleCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+
+	sample, err := s.collectSignalSample(sampleCtx)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.Printf("signal history: sample failed: %v", err)
+		}
+		return
+	}
+	if err := s.signalHistory.Append(sample, retention); err != nil {
+		s.logger.Printf("signal history: persist failed: %v", err)
+	}
+}
+
+// collectSignalSample reads the serving cell metrics from status_web, then
+// enriches them with the carrier-aggregation state and the cell identity.
+// Only a status_web failure drops the sample; the other two are optional.
+func (s *Server) collectSignalSample(ctx context.Context) (signalSample, error) {
+	client := s.getClient()
+	sample := signalSample{Time: time.Now().UTC()}
+
+	status, err := client.CellularStatus(ctx)
+	if err != nil {
+		return sample, fmt.Errorf("status_web: %w", err)
+	}
+	rat, stat := status.Serving()
+	if stat.Valid() {
+		sample.RAT = rat
+		sample.RSRP = signalMetric(stat.RSRPCurrent)
+		sample.RSRQ = signalMetric(stat.RSRQCurrent)
+		sample.SINR = signalMetric(stat.SNRCurrent)
+		sample.RSSI = signalMetric(stat.RSSICurrent)
+		if stat.CQI > 0 {
+			// CQI 0 means "out of range"; firmware also omits it entirely.
+			sample.CQI = signalMetric(stat.CQI)
+		}
+		sample.Band = strings.TrimSpace(stat.Band.String())
+		sample.PCI = stat.PhysicalCellID.Int64()
+		sample.EARFCN = stat.DownlinkEarfcn.Int64()
+	}
+
+	if ca, err := client.CAState(ctx); err != nil {
+		s.logger.Printf("signal history: service_data failed: %v", err)
+	} else {
+		carriers := ca.Downlink()
+		sample.CACarriers = len(carriers)
+		for _, carrier := range carriers {
+			if band := strings.TrimSpace(carrier.ScellBand.String()); band != "" {
+				sample.CABands = append(sample.CABands, band)
+			}
+		}
+	}
+
+	if ident, err := client.CellIdentification(ctx); err != nil {
+		s.logger.Printf("signal history: cell identification failed: %v", err)
+	} else {
+		if band := strings.TrimSpace(ident.Result.Band.String()); band != "" {
+			sample.Band = band
+		}
+		if pci := ident.Result.PhysicalCellID.Int64(); pci != 0 {
+			sample.PCI = pci
+		}
+		if earfcn := ident.Result.EARFCN.Int64(); earfcn != 0 {
+			sample.EARFCN = earfcn
+		}
+	}
+
+	return sample, nil
+}
+
+func signalMetric(v router.FlexFloat) *float64 {
+	f := v.Float64()
+	if f == invalidSignalValue || math.IsNaN(f) {
+		return nil
+	}
+	return &f
+}
+
+func (s *Server) handleSignalHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	now := time.Now().UTC()
+
+	to := now
+	if raw := strings.TrimSpace(query.Get("to")); raw != "" {
+		parsed, err := parseHistoryTime(raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid 'to' value"})
+			return
+		}
+		to = parsed
+	}
+
+	from := to.Add(-defaultSignalRange)
+	if raw := strings.TrimSpace(query.Get("from")); raw != "" {
+		parsed, err := parseHistoryTime(raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid 'from' value"})
+			return
+		}
+		from = parsed
+	}
+	if !from.Before(to) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "'from' must be before 'to'"})
+		return
+	}
+
+	cfg := s.getConfig().SignalHistory
+	span := to.Sub(from)
+
+	var step time.Duration
+	if raw := strings.TrimSpace(query.Get("step")); raw != "" {
+		parsed, err := parseHistoryStep(raw)
+		if err != nil || parsed < time.Second {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid 'step' value"})
+			return
+		}
+		step = parsed
+	} else {
+		step = (span / targetSignalHistoryStep).Truncate(time.Second)
+		if interval := signalSampleInterval(cfg); step < interval {
+			step = interval
+		}
+	}
+	if span/step > maxSignalHistoryPoints {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("step too small: range would exceed %d points", maxSignalHistoryPoints)})
+		return
+	}
+
+	samples, err := s.signalHistory.Query(from, to, step)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled":          cfg.Enabled,
+		"from":             from.UTC().Format(time.RFC3339),
+		"to":               to.UTC().Format(time.RFC3339),
+		"step_seconds":     int64(step / time.Second),
+		"interval_seconds": cfg.IntervalSeconds,
+		"retention_days":   cfg.RetentionDays,
+		"count":            len(samples),
+		"samples":          samples,
+	})
+}
+
+// parseHistoryTime accepts RFC 3339 timestamps or Unix seconds.
+func parseHistoryTime(raw string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+// parseHistoryStep accepts Go durations ("5m", "1h") or plain seconds.
+func parseHistoryStep(raw string) (time.Duration, error) {
+	if secs, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	return time.ParseDuration(raw)
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func TestSignalHistoryDownsamplesAndReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), signalHistoryFile)
+	history := newSignalHistory(path)
+
+	base := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		sample := signalSample{
+			Time: base.Add(time.Duration(i) * time.Minute),
+			RAT:  "lte",
+			RSRP: floatPtr(-100 + float64(i)),
+			Band: "B3",
+		}
+		if err := history.Append(sample, 0); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	reloaded := newSignalHistory(path)
+	points, err := reloaded.Query(base, base.Add(time.Hour), 3*time.Minute)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(points) != 2 {
+		t.Fatalf("expected 2 buckets, got %d: %+v", len(points), points)
+	}
+	if points[0].Samples != 3 || points[0].RSRP == nil || *points[0].RSRP != -99 {
+		t.Fatalf("unexpected first bucket: %+v", points[0])
+	}
+	if points[1].RSRP == nil || *points[1].RSRP != -96 || points[1].Band != "B3" {
+		t.Fatalf("unexpected second bucket: %+v", points[1])
+	}
+}
+
+func TestSignalHistoryRetentionCompactsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), signalHistoryFile)
+	history := newSignalHistory(path)
+
+	base := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 200; i++ {
+		sample := signalSample{Time: base.Add(time.Duration(i) * time.Minute), RSRP: floatPtr(-90)}
+		if err := history.Append(sample, 30*time.Minute); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	points, err := history.Query(base, base.Add(24*time.Hour), time.Minute)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(points) != 31 {
+		t.Fatalf("expected 31 retained samples, got %d", len(points))
+	}
+
+	reloaded := newSignalHistory(path)
+	if err := reloaded.ensureLoadedLocked(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if reloaded.fileLines > 64+1 {
+		t.Fatalf("expected compacted file, got %d lines", reloaded.fileLines)
+	}
+}
+
+func TestSignalHistoryEndpoint(t *testing.T) {
+	srv, _, httpSrv := newTestServer(t)
+
+	srv.recordSignalSample(context.Background(), time.Hour)
+
+	var payload struct {
+		Count   int            `json:"count"`
+		Samples []signalSample `json:"samples"`
+	}
+	if status := getJSON(t, httpSrv.URL+"/api/signal_history?step=60", &payload); status != http.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+	if payload.Count != 1 || len(payload.Samples) != 1 {
+		t.Fatalf("expected one sample, got %+v", payload)
+	}
+	sample := payload.Samples[0]
+	if sample.RAT != "lte" || sample.RSRP == nil || *sample.RSRP != -95 || sample.PCI != 211 || sample.CACarriers != 1 {
+		t.Fatalf("unexpected sample: %+v", sample)
+	}
+
+	if status := getJSON(t, httpSrv.URL+"/api/signal_history?from=10&to=5", nil); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for inverted range, got %d", status)
+	}
+}
@@ -0,0 +1,326 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultArchivePageSize = 50
+	maxArchivePageSize     = 500
+)
+
+var errSmsNotArchived = errors.New("sms not found in archive")
+
+// smsArchiveQuery filters the archive. Nil pointers leave a field
+// unfiltered; Hidden defaults to false so hidden messages only show up when
+// asked for.
+type smsArchiveQuery struct {
+	Direction string
+	Rule      string
+	Sender    string
+	Text      string
+	From      time.Time
+	To        time.Time
+	Unread    *bool
+	Forwarded *bool
+	Deleted   *bool
+	Hidden    bool
+	Page      int
+	PerPage   int
+}
+
+func (q smsArchiveQuery) matches(msg smsMessage) bool {
+	if msg.Hidden != q.Hidden {
+		return false
+	}
+	if q.Direction != "" && msg.direction() != q.Direction {
+		return false
+	}
+	if q.Rule != "" && !slices.Contains(msg.Rules, q.Rule) {
+		return false
+	}
+	if q.Sender != "" && !strings.Contains(strings.ToLower(msg.SMSSender), q.Sender) {
+		return false
+	}
+	if q.Text != "" && !strings.Contains(strings.ToLower(msg.SMSContent), q.Text) {
+		return false
+	}
+	if !inExportRange(msg.parsedTime, q.From, q.To) {
+		return false
+	}
+	if q.Unread != nil && msg.SMSUnread != *q.Unread {
+		return false
+	}
+	if q.Forwarded != nil && (len(msg.Forwarded) > 0) != *q.Forwarded {
+		return false
+	}
+	if q.Deleted != nil && msg.DeletedOnRouter != *q.Deleted {
+		return false
+	}
+	return true
+}
+
+// Query returns one page of the matching messages, newest first, and the
+// number of matches overall.
+func (a *smsArchive) Query(q smsArchiveQuery) ([]smsMessage, int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.ensureLoadedLocked(); err != nil {
+		return nil, 0, err
+	}
+
+	matched := make([]smsMessage, 0)
+	for _, msg := range a.entries {
+		if q.matches(msg) {
+			matched = append(matched, msg)
+		}
+	}
+	sortMessagesByTime(matched)
+
+	start := min((q.Page-1)*q.PerPage, len(matched))
+	end := min(start+q.PerPage, len(matched))
+	return matched[start:end], len(matched), nil
+}
+
+// Get returns the archived message with the given hash.
+func (a *smsArchive) Get(hash string) (smsMessage, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.ensureLoadedLocked(); err != nil {
+		return smsMessage{}, err
+	}
+	msg, ok := a.entries[hash]
+	if !ok {
+		return smsMessage{}, errSmsNotArchived
+	}
+	return msg, nil
+}
+
+// SetHidden hides a message from the archive view or restores it. The
+// message itself is kept either way.
+func (a *smsArchive) SetHidden(hash string, hidden bool) (smsMessage, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.ensureLoadedLocked(); err != nil {
+		return smsMessage{}, err
+	}
+	msg, ok := a.entries[hash]
+	if !ok {
+		return smsMessage{}, errSmsNotArchived
+	}
+	if msg.Hidden == hidden {
+		return msg, nil
+	}
+	msg.Hidden = hidden
+	a.entries[hash] = msg
+	return msg, a.persistLocked()
+}
+
+type smsArchiveRecord struct {
+	Hash            string   `json:"hash"`
+	ID              string   `json:"id"`
+	Direction       string   `json:"direction"`
+	Sender          string   `json:"sender"`
+	Recipient       string   `json:"recipient,omitempty"`
+	Segments        int      `json:"segments,omitempty"`
+	Content         string   `json:"content"`
+	Timestamp       string   `json:"timestamp"`
+	Time            string   `json:"time,omitempty"`
+	Unread          bool     `json:"unread"`
+	FirstSeen       string   `json:"first_seen,omitempty"`
+	DeletedOnRouter bool     `json:"deleted_on_router"`
+	DeletedAt       string   `json:"deleted_at,omitempty"`
+	Hidden          bool     `json:"hidden"`
+	Forwarded       []string `json:"forwarded"`
+	Pending         []string `json:"pending"`
+	// Rules lists the SMS rules that matched; Fields holds what they
+	// extracted.
+	Rules       []string          `json:"rules"`
+	Fields      map[string]string `json:"fields,omitempty"`
+	DeleteAfter string            `json:"delete_after,omitempty"`
+}
+
+func newSmsArchiveRecord(msg smsMessage) smsArchiveRecord {
+	record := smsArchiveRecord{
+		Hash:            msg.SMSHash,
+		ID:              msg.SMSID,
+		Direction:       msg.direction(),
+		Sender:          strings.TrimSpace(msg.SMSSender),
+		Recipient:       msg.Recipient,
+		Segments:        msg.Segments,
+		Content:         msg.SMSContent,
+		Timestamp:       msg.SMSDateTime,
+		Unread:          msg.SMSUnread,
+		DeletedOnRouter: msg.DeletedOnRouter,
+		Hidden:          msg.Hidden,
+		Forwarded:       []string{},
+		Pending:         []string{},
+		Rules:           []string{},
+		Fields:          msg.Fields,
+	}
+	if !msg.parsedTime.IsZero() {
+		record.Time = msg.parsedTime.Format(time.RFC3339)
+	}
+	if !msg.FirstSeen.IsZero() {
+		record.FirstSeen = msg.FirstSeen.Format(time.RFC3339)
+	}
+	if !msg.DeletedAt.IsZero() {
+		record.DeletedAt = msg.DeletedAt.Format(time.RFC3339)
+	}
+	if !msg.DeleteAfter.IsZero() {
+		record.DeleteAfter = msg.DeleteAfter.Format(time.RFC3339)
+	}
+	record.Forwarded = append(record.Forwarded, msg.Forwarded...)
+	record.Rules = append(record.Rules, msg.Rules...)
+	record.Pending = append(record.Pending, msg.Pending...)
+	if msg.NeedsRules {
+		record.Pending = append(record.Pending, "rules")
+	}
+	return record
+}
+
+func parseOptionalBool(raw string) (*bool, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+func parseSmsArchiveQuery(r *http.Request) (smsArchiveQuery, error) {
+	query := r.URL.Query()
+	q := smsArchiveQuery{
+		Sender:  strings.ToLower(strings.TrimSpace(query.Get("sender"))),
+		Text:    strings.ToLower(strings.TrimSpace(query.Get("q"))),
+		Rule:    strings.TrimSpace(query.Get("rule")),
+		Page:    1,
+		PerPage: defaultArchivePageSize,
+	}
+
+	switch q.Direction = strings.ToLower(strings.TrimSpace(query.Get("direction"))); q.Direction {
+	case "", smsDirectionReceived, smsDirectionSent:
+	default:
+		return q, errors.New("'direction' must be received or sent")
+	}
+	var err error
+	if q.From, q.To, err = parseExportRange(query); err != nil {
+		return q, err
+	}
+	boolParam := func(name string) (*bool, error) {
+		value, err := parseOptionalBool(query.Get(name))
+		if err != nil {
+			return nil, fmt.Errorf("invalid '%s' value", name)
+		}
+		return value, nil
+	}
+	if q.Unread, err = boolParam("unread"); err != nil {
+		return q, err
+	}
+	if q.Forwarded, err = boolParam("forwarded"); err != nil {
+		return q, err
+	}
+	if q.Deleted, err = boolParam("deleted"); err != nil {
+		return q, err
+	}
+	hidden, err := boolParam("hidden")
+	if err != nil {
+		return q, err
+	}
+	q.Hidden = hidden != nil && *hidden
+	if raw := strings.TrimSpace(query.Get("page")); raw != "" {
+		if q.Page, err = strconv.Atoi(raw); err != nil || q.Page < 1 {
+			return q, errors.New("invalid 'page' value")
+		}
+	}
+	if raw := strings.TrimSpace(query.Get("per_page")); raw != "" {
+		if q.PerPage, err = strconv.Atoi(raw); err != nil || q.PerPage < 1 || q.PerPage > maxArchivePageSize {
+			return q, errors.New("'per_page' must be between 1 and 500")
+		}
+	}
+	return q, nil
+}
+
+func (s *Server) handleSmsArchive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q, err := parseSmsArchiveQuery(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	messages, total, err := s.smsArchive.Query(q)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	records := make([]smsArchiveRecord, 0, len(messages))
+	for _, msg := range messages {
+		records = append(records, newSmsArchiveRecord(msg))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"total":    total,
+		"page":     q.Page,
+		"per_page": q.PerPage,
+		"pages":    (total + q.PerPage - 1) / q.PerPage,
+		"messages": records,
+	})
+}
+
+// handleSmsArchiveEntry serves one archived message. DELETE hides it from
+// the archive view; nothing is removed from sms.json or the router.
+func (s *Server) handleSmsArchiveEntry(w http.ResponseWriter, r *http.Request) {
+	hash := r.PathValue("hash")
+
+	var (
+		msg smsMessage
+		err error
+	)
+	switch r.Method {
+	case http.MethodGet:
+		msg, err = s.smsArchive.Get(hash)
+	case http.MethodDelete:
+		msg, err = s.smsArchive.SetHidden(hash, true)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.writeSmsArchiveEntry(w, msg, err)
+}
+
+// handleSmsArchiveRestore brings a hidden message back into the archive
+// view.
+func (s *Server) handleSmsArchiveRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	msg, err := s.smsArchive.SetHidden(r.PathValue("hash"), false)
+	s.writeSmsArchiveEntry(w, msg, err)
+}
+
+func (s *Server) writeSmsArchiveEntry(w http.ResponseWriter, msg smsMessage, err error) {
+	switch {
+	case errors.Is(err, errSmsNotArchived):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	default:
+		writeJSON(w, http.StatusOK, newSmsArchiveRecord(msg))
+	}
+}
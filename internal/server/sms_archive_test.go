@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type archivePage struct {
+	Total    int                `json:"total"`
+	Messages []smsArchiveRecord `json:"messages"`
+}
+
+func TestSmsArchiveKeepsRouterDeletedMessages(t *testing.T) {
+	srv, emu, httpSrv := newTestServer(t)
+	first := emu.AddSms("+620001", "Your OTP code is 1234", time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC))
+	emu.AddSms("Bank", "Balance low", time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC))
+	srv.performSmsSync(context.Background())
+
+	resp, err := http.Post(httpSrv.URL+"/api/delete_sms", "application/json", strings.NewReader(`{"sms_ids":["`+first+`"]}`))
+	if err != nil {
+		t.Fatalf("delete_sms: %v", err)
+	}
+	resp.Body.Close()
+	srv.performSmsSync(context.Background())
+
+	var page archivePage
+	getJSON(t, httpSrv.URL+"/api/sms/archive?q=otp", &page)
+	if page.Total != 1 || !page.Messages[0].DeletedOnRouter || page.Messages[0].DeletedAt == "" {
+		t.Fatalf("expected the deleted OTP message to stay archived: %+v", page)
+	}
+	hash := page.Messages[0].Hash
+
+	getJSON(t, httpSrv.URL+"/api/sms/archive?deleted=false&sender=bank", &page)
+	if page.Total != 1 || page.Messages[0].Sender != "Bank" {
+		t.Fatalf("unexpected sender filter result: %+v", page)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, httpSrv.URL+"/api/sms/archive/"+url.PathEscape(hash), nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("hide: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("hide status %d", resp.StatusCode)
+	}
+	getJSON(t, httpSrv.URL+"/api/sms/archive", &page)
+	if page.Total != 1 {
+		t.Fatalf("hidden message must leave the view: %+v", page)
+	}
+	getJSON(t, httpSrv.URL+"/api/sms/archive?hidden=true", &page)
+	if page.Total != 1 || page.Messages[0].Hash != hash {
+		t.Fatalf("expected the hidden message with hidden=true: %+v", page)
+	}
+
+	resp, err = http.Post(httpSrv.URL+"/api/sms/archive/"+url.PathEscape(hash)+"/restore", "application/json", nil)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	resp.Body.Close()
+	getJSON(t, httpSrv.URL+"/api/sms/archive?per_page=1&page=2", &page)
+	if page.Total != 2 || len(page.Messages) != 1 || page.Messages[0].Hash != hash {
+		t.Fatalf("expected the restored message on page 2: %+v", page)
+	}
+}
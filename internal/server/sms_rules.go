@@ -0,0 +1,326 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"nokia_modem/internal/config"
+	"nokia_modem/internal/settings"
+)
+
+// smsRule is a config.SmsRule with its patterns compiled. from and to are
+// minutes since midnight, or -1 when the rule is active all day.
+type smsRule struct {
+	config.SmsRule
+	sender   *regexp.Regexp
+	content  *regexp.Regexp
+	from, to int
+}
+
+// smsRuleOutcome is what the rules did to one message.
+type smsRuleOutcome struct {
+	Rules       []string
+	Fields      map[string]string
+	DeleteAfter time.Time
+}
+
+// parseClock reads "HH:MM" as minutes since midnight.
+func parseClock(raw string) (int, error) {
+	t, err := time.Parse("15:04", raw)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not HH:MM", raw)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func compileSmsRules(rules []config.SmsRule) ([]smsRule, error) {
+	compiled := make([]smsRule, 0, len(rules))
+	for _, rule := range rules {
+		c := smsRule{SmsRule: rule, from: -1, to: -1}
+		var err error
+		if rule.Sender != "" {
+			if c.sender, err = regexp.Compile(rule.Sender); err != nil {
+				return nil, fmt.Errorf("sms_rules %q: invalid sender pattern: %w", rule.Name, err)
+			}
+		}
+		if rule.Content != "" {
+			if c.content, err = regexp.Compile(rule.Content); err != nil {
+				return nil, fmt.Errorf("sms_rules %q: invalid content pattern: %w", rule.Name, err)
+			}
+		}
+		if (rule.ActiveFrom == "") != (rule.ActiveTo == "") {
+			return nil, fmt.Errorf("sms_rules %q: set both active_from and active_to or neither", rule.Name)
+		}
+		if rule.ActiveFrom != "" {
+			if c.from, err = parseClock(rule.ActiveFrom); err != nil {
+				return nil, fmt.Errorf("sms_rules %q: active_from %w", rule.Name, err)
+			}
+			if c.to, err = parseClock(rule.ActiveTo); err != nil {
+				return nil, fmt.Errorf("sms_rules %q: active_to %w", rule.Name, err)
+			}
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// match reports whether msg, received at the given local time, matches the
+// rule and returns the named groups its content pattern captured.
+func (r smsRule) match(msg smsMessage, at time.Time) (map[string]string, bool) {
+	if r.from >= 0 {
+		minute := at.Hour()*60 + at.Minute()
+		var active bool
+		if r.from <= r.to {
+			active = minute >= r.from && minute < r.to
+		} else {
+			// The window wraps midnight, e.g. 22:00-06:00.
+			active = minute >= r.from || minute < r.to
+		}
+		if !active {
+			return nil, false
+		}
+	}
+	if r.sender != nil && !r.sender.MatchString(strings.TrimSpace(msg.SMSSender)) {
+		return nil, false
+	}
+	if r.content == nil {
+		return nil, true
+	}
+	groups := r.content.FindStringSubmatch(msg.SMSContent)
+	if groups == nil {
+		return nil, false
+	}
+	fields := map[string]string{}
+	for i, name := range r.content.SubexpNames() {
+		if name != "" && groups[i] != "" {
+			fields[name] = groups[i]
+		}
+	}
+	return fields, true
+}
+
+// smsReceivedAt is the wall-clock time a message arrived, which the time
+// windows are checked against. Router timestamps carry no zone and are
+// already local; FirstSeen covers messages without one.
+func smsReceivedAt(msg smsMessage) time.Time {
+	if !msg.parsedTime.IsZero() {
+		return msg.parsedTime
+	}
+	return msg.FirstSeen.In(time.Local)
+}
+
+// applySmsRules runs every matching rule's actions on a new message and
+// counts the hits. Failed actions are logged and not retried, so a rule
+// never fires twice for the same message.
+func (s *Server) applySmsRules(ctx context.Context, cfg config.Config, msg smsMessage, now time.Time) smsRuleOutcome {
+	outcome := smsRuleOutcome{}
+	rules, err := compileSmsRules(cfg.SmsRules.Rules)
+	if err != nil {
+		s.logger.Printf("sms rules: %v", err)
+		return outcome
+	}
+
+	at := smsReceivedAt(msg)
+	markRead := false
+	for _, rule := range rules {
+		fields, ok := rule.match(msg, at)
+		if !ok {
+			continue
+		}
+		outcome.Rules = append(outcome.Rules, rule.Name)
+		if len(fields) > 0 {
+			if outcome.Fields == nil {
+				outcome.Fields = map[string]string{}
+			}
+			maps.Copy(outcome.Fields, fields)
+		}
+		markRead = markRead || rule.MarkRead
+		if rule.DeleteAfterDays > 0 {
+			due := msg.FirstSeen.AddDate(0, 0, rule.DeleteAfterDays)
+			if msg.FirstSeen.IsZero() {
+				due = now.AddDate(0, 0, rule.DeleteAfterDays)
+			}
+			if outcome.DeleteAfter.IsZero() || due.Before(outcome.DeleteAfter) {
+				outcome.DeleteAfter = due
+			}
+		}
+		s.runSmsRuleActions(ctx, cfg, rule, msg, fields)
+	}
+	if len(outcome.Rules) == 0 {
+		return outcome
+	}
+
+	if markRead && msg.SMSUnread && msg.SMSID != "" {
+		readCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		if _, err := s.getClient().SetSmsState(readCtx, msg.SMSID, "0"); err != nil {
+			s.logger.Printf("sms rules: mark sms %s read failed: %v", msg.SMSID, err)
+		}
+		cancel()
+	}
+
+	err = s.store.Update(func(data *settings.Settings) error {
+		if data.SmsRuleHits == nil {
+			data.SmsRuleHits = map[string]settings.SmsRuleHits{}
+		}
+		for _, name := range outcome.Rules {
+			hits := data.SmsRuleHits[name]
+			hits.Count++
+			hits.LastHit = now
+			data.SmsRuleHits[name] = hits
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Printf("sms rules: record hits failed: %v", err)
+	}
+	s.logger.Printf("sms rules: sms %s matched %s", msg.SMSHash, strings.Join(outcome.Rules, ", "))
+	return outcome
+}
+
+func (s *Server) runSmsRuleActions(ctx context.Context, cfg config.Config, rule smsRule, msg smsMessage, fields map[string]string) {
+	if rule.TelegramChatID != "" {
+		text, parseMode := formatSmsForTelegram(msg, cfg.Telegram.ParseMode)
+		sendCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+		if err := s.sendTelegramMessage(sendCtx, cfg.Telegram, rule.TelegramChatID, parseMode, text); err != nil {
+			s.logger.Printf("sms rules: %s: telegram send failed: %v", rule.Name, err)
+		}
+		cancel()
+	}
+	if rule.MQTTTopic != "" {
+		payload := map[string]interface{}{
+			"rule":      rule.Name,
+			"id":        msg.SMSID,
+			"hash":      msg.SMSHash,
+			"sender":    strings.TrimSpace(msg.SMSSender),
+			"content":   msg.SMSContent,
+			"timestamp": msg.SMSDateTime,
+			"fields":    fields,
+		}
+		if err := s.publishMqtt(rule.MQTTTopic, payload); err != nil {
+			s.logger.Printf("sms rules: %s: mqtt publish failed: %v", rule.Name, err)
+		}
+	}
+}
+
+// SetRuleOutcome stores what the SMS rules did to a message and clears its
+// NeedsRules flag.
+func (a *smsArchive) SetRuleOutcome(hash string, outcome smsRuleOutcome) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.ensureLoadedLocked(); err != nil {
+		return err
+	}
+	msg, ok := a.entries[hash]
+	if !ok {
+		return errSmsNotArchived
+	}
+	msg.NeedsRules = false
+	msg.Rules = outcome.Rules
+	msg.Fields = outcome.Fields
+	msg.DeleteAfter = outcome.DeleteAfter
+	a.entries[hash] = msg
+	return a.persistLocked()
+}
+
+// DueForDeletion returns the router IDs of messages a rule scheduled for
+// deletion that are still on the router.
+func (a *smsArchive) DueForDeletion(now time.Time) ([]string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.ensureLoadedLocked(); err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, msg := range a.entries {
+		if !msg.DeleteAfter.IsZero() && !now.Before(msg.DeleteAfter) && !msg.DeletedOnRouter && msg.SMSID != "" {
+			ids = append(ids, msg.SMSID)
+		}
+	}
+	return ids, nil
+}
+
+// deleteExpiredSms deletes the messages whose delete_after_days ran out. The
+// next sync marks them deleted_on_router; they stay in the archive.
+func (s *Server) deleteExpiredSms(ctx context.Context) {
+	ids, err := s.smsArchive.DueForDeletion(time.Now())
+	if err != nil || len(ids) == 0 {
+		return
+	}
+	deleteCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if _, err := s.getClient().DeleteSms(deleteCtx, ids, false); err != nil {
+		s.logger.Printf("sms rules: auto-delete of %d message(s) failed: %v", len(ids), err)
+		return
+	}
+	s.logger.Printf("sms rules: auto-deleted %d message(s) on the router", len(ids))
+}
+
+func normalizeSmsRules(cfg config.SmsRulesConfig) config.SmsRulesConfig {
+	rules := make([]config.SmsRule, 0, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		rule.Name = strings.TrimSpace(rule.Name)
+		rule.ActiveFrom = strings.TrimSpace(rule.ActiveFrom)
+		rule.ActiveTo = strings.TrimSpace(rule.ActiveTo)
+		rule.TelegramChatID = strings.TrimSpace(rule.TelegramChatID)
+		rule.MQTTTopic = strings.Trim(strings.TrimSpace(rule.MQTTTopic), "/")
+		rules = append(rules, rule)
+	}
+	return config.SmsRulesConfig{Rules: rules}
+}
+
+func validateSmsRules(cfg config.Config) error {
+	names := map[string]struct{}{}
+	for _, rule := range cfg.SmsRules.Rules {
+		if rule.Name == "" {
+			return errors.New("sms_rules.rules entries need a name")
+		}
+		if _, dup := names[rule.Name]; dup {
+			return fmt.Errorf("sms_rules: duplicate name %q", rule.Name)
+		}
+		names[rule.Name] = struct{}{}
+		if rule.DeleteAfterDays < 0 || rule.DeleteAfterDays > 3660 {
+			return fmt.Errorf("sms_rules %q: delete_after_days must be between 0 and 3660", rule.Name)
+		}
+		if strings.ContainsAny(rule.MQTTTopic, "+#") {
+			return fmt.Errorf("sms_rules %q: mqtt_topic must not contain wildcards", rule.Name)
+		}
+		if rule.TelegramChatID != "" && cfg.Telegram.BotToken == "" {
+			return fmt.Errorf("sms_rules %q: telegram_chat_id needs telegram.bot_token", rule.Name)
+		}
+	}
+	_, err := compileSmsRules(cfg.SmsRules.Rules)
+	return err
+}
+
+type smsRuleResponse struct {
+	config.SmsRule
+	Hits    int64  `json:"hits"`
+	LastHit string `json:"last_hit,omitempty"`
+}
+
+func (s *Server) handleSmsRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	configured := s.getConfig().SmsRules.Rules
+	hits := s.store.Get().SmsRuleHits
+	rules := make([]smsRuleResponse, 0, len(configured))
+	for _, rule := range configured {
+		entry := smsRuleResponse{SmsRule: rule, Hits: hits[rule.Name].Count}
+		if last := hits[rule.Name].LastHit; !last.IsZero() {
+			entry.LastHit = last.Format(time.RFC3339)
+		}
+		rules = append(rules, entry)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"rules": rules})
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"nokia_modem/internal/config"
+	"nokia_modem/internal/router"
+)
+
+func TestSmsRuleMatchWindowAndGroups(t *testing.T) {
+	rules, err := compileSmsRules([]config.SmsRule{
+		{Name: "otp", Sender: `(?i)^bank$`, Content: `code (?P<otp>\d{6})`},
+		{Name: "night", ActiveFrom: "22:00", ActiveTo: "06:00"},
+	})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	otp, night := rules[0], rules[1]
+	at := func(hour, minute int) time.Time { return time.Date(2026, 3, 1, hour, minute, 0, 0, time.UTC) }
+
+	fields, ok := otp.match(smsMessage{SMSSender: "BANK", SMSContent: "Your code 123456 expires soon"}, at(12, 0))
+	if !ok || fields["otp"] != "123456" {
+		t.Fatalf("expected otp match, got %v %v", ok, fields)
+	}
+	if _, ok := otp.match(smsMessage{SMSSender: "Shop", SMSContent: "code 123456"}, at(12, 0)); ok {
+		t.Fatalf("sender pattern must filter")
+	}
+
+	for _, tc := range []struct {
+		hour, minute int
+		want         bool
+	}{{23, 0, true}, {2, 30, true}, {6, 0, false}, {12, 0, false}, {22, 0, true}} {
+		if _, ok := night.match(smsMessage{}, at(tc.hour, tc.minute)); ok != tc.want {
+			t.Fatalf("%02d:%02d: got %v, want %v", tc.hour, tc.minute, ok, tc.want)
+		}
+	}
+
+	if _, err := compileSmsRules([]config.SmsRule{{Name: "half", ActiveFrom: "08:00"}}); err == nil {
+		t.Fatalf("expected an error for a half-open window")
+	}
+}
+
+func TestSmsRulesRunOncePerMessage(t *testing.T) {
+	srv, emu, httpSrv := newTestServer(t)
+	fake, telegram := newFakeTelegram(t)
+
+	cfg := srv.getConfig()
+	cfg.Telegram = telegram
+	cfg.Telegram.Commands = false
+	cfg.LongPolling.Enabled = true
+	cfg.RouterCache.Enabled = false
+	cfg.SmsRules.Rules = []config.SmsRule{
+		{Name: "otp", Sender: "^BANK$", Content: `(?P<otp>\d{6})`, TelegramChatID: "777", MarkRead: true, DeleteAfterDays: 1},
+		{Name: "balance", Content: `balance`},
+	}
+	srv.setConfig(cfg)
+	srv.setClient(router.NewClient(cfg))
+
+	id := emu.AddSms("BANK", "Use 654321 to log in", time.Now())
+	emu.AddSms("Carrier", "Hello", time.Now())
+	srv.performSmsSync(context.Background())
+	srv.performSmsSync(context.Background())
+
+	sent := fake.sent("sendMessage")
+	if len(sent) != 1 || sent[0]["chat_id"] != "777" {
+		t.Fatalf("expected one message to chat 777, got %v", sent)
+	}
+	if emu.Sms()[0].Unread {
+		t.Fatalf("expected the OTP message to be marked read")
+	}
+
+	var page archivePage
+	getJSON(t, httpSrv.URL+"/api/sms/archive?rule=otp", &page)
+	if page.Total != 1 || page.Messages[0].Fields["otp"] != "654321" || page.Messages[0].DeleteAfter == "" {
+		t.Fatalf("unexpected rule outcome in archive: %+v", page)
+	}
+	if len(page.Messages[0].Pending) != 0 {
+		t.Fatalf("rules must not stay pending: %+v", page.Messages[0])
+	}
+
+	var rules struct {
+		Rules []smsRuleResponse `json:"rules"`
+	}
+	getJSON(t, httpSrv.URL+"/api/sms/rules", &rules)
+	if len(rules.Rules) != 2 || rules.Rules[0].Hits != 1 || rules.Rules[0].LastHit == "" || rules.Rules[1].Hits != 0 {
+		t.Fatalf("unexpected hit counters: %+v", rules.Rules)
+	}
+
+	due, err := srv.smsArchive.DueForDeletion(time.Now().AddDate(0, 0, 2))
+	if err != nil || !slices.Equal(due, []string{id}) {
+		t.Fatalf("expected the OTP message to be due for deletion, got %v (%v)", due, err)
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"nokia_modem/internal/router"
+)
+
+// Values of smsArchiveRecord.Direction and the archive's 'direction' filter.
+const (
+	smsDirectionReceived = "received"
+	smsDirectionSent     = "sent"
+)
+
+func (m smsMessage) sent() bool {
+	return m.Direction == smsDirectionSent
+}
+
+func (m smsMessage) direction() string {
+	if m.sent() {
+		return smsDirectionSent
+	}
+	return smsDirectionReceived
+}
+
+// RecordSent archives a message sent from the gateway. Its timestamp uses
+// the router's own layout so it sorts in with the inbox.
+func (a *smsArchive) RecordSent(to, text string, segments int, at time.Time) (smsMessage, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.ensureLoadedLocked(); err != nil {
+		return smsMessage{}, err
+	}
+
+	msg := smsMessage{
+		SMSContent:  text,
+		SMSDateTime: at.Format("2006-01-02 15:04:05"),
+		FirstSeen:   at.UTC(),
+		Direction:   smsDirectionSent,
+		Recipient:   to,
+		Segments:    segments,
+	}
+	msg.parsedTime = parseSmsTime(msg.SMSDateTime)
+	for {
+		if _, taken := a.entries[ensureSmsHash(&msg)]; !taken {
+			break
+		}
+		msg.FirstSeen = msg.FirstSeen.Add(time.Nanosecond)
+	}
+	a.entries[msg.SMSHash] = msg
+	return msg, a.persistLocked()
+}
+
+// smsSendResponse is what POST /api/sms/send, the sms_send command and
+// /send report back.
+type smsSendResponse struct {
+	router.SmsSendResult
+	Hash string `json:"hash,omitempty"`
+}
+
+// sendSms sends text through the router and archives it as sent.
+func (s *Server) sendSms(ctx context.Context, to, text string) (smsSendResponse, error) {
+	result, err := s.getClient().SendSms(ctx, to, text)
+	if err != nil {
+		return smsSendResponse{}, err
+	}
+	response := smsSendResponse{SmsSendResult: *result}
+
+	// The message is already out, so a failed archive write is only logged.
+	msg, err := s.smsArchive.RecordSent(result.To, text, result.Segments, time.Now())
+	if err != nil {
+		s.logger.Printf("sms send: archive failed: %v", err)
+	} else {
+		response.Hash = msg.SMSHash
+	}
+	s.logger.Printf("sms send: sent %d segment(s) to %s", result.Segments, result.To)
+	return response, nil
+}
+
+func (s *Server) handleSmsSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		To   string `json:"to"`
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON payload"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.commandTimeout("sms_send"))
+	defer cancel()
+
+	response, err := s.sendSms(ctx, payload.To, payload.Text)
+	switch {
+	case errors.Is(err, router.ErrInvalidSms):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case err != nil:
+		writeRouterError(w, err)
+	default:
+		writeJSON(w, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSmsSendArchivesSentMessages(t *testing.T) {
+	srv, emu, httpSrv := newTestServer(t)
+	emu.AddSms("+620001", "ping", time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC))
+
+	resp, body := doRequest(t, http.MethodPost, httpSrv.URL+"/api/sms/send", `{"to":"+62 811 000","text":"pong"}`, nil)
+	if resp.StatusCode != http.StatusOK || body["to"] != "+62811000" || body["segments"] != float64(1) {
+		t.Fatalf("send: %d %v", resp.StatusCode, body)
+	}
+	if sent := emu.SentSms(); len(sent) != 1 || sent[0].Content != "pong" {
+		t.Fatalf("unexpected messages at the router: %+v", sent)
+	}
+
+	resp, body = doRequest(t, http.MethodPost, httpSrv.URL+"/api/sms/send", `{"to":"nobody","text":"pong"}`, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad recipient, got %d %v", resp.StatusCode, body)
+	}
+
+	// The Telegram command goes through the same path.
+	reply := srv.runTelegramCommand(context.Background(), srv.getConfig().Telegram, 1, "send", strings.Fields("+62811000 second reply"))
+	if !strings.HasPrefix(reply.Text, "SMS sent to") {
+		t.Fatalf("unexpected /send reply %q", reply.Text)
+	}
+
+	// Sent messages never appear in the inbox and must not be marked
+	// deleted by the next sync.
+	srv.performSmsSync(context.Background())
+
+	var page archivePage
+	getJSON(t, httpSrv.URL+"/api/sms/archive?direction=sent", &page)
+	if page.Total != 2 {
+		t.Fatalf("expected two sent messages, got %+v", page)
+	}
+	for _, msg := range page.Messages {
+		if msg.Direction != smsDirectionSent || msg.Recipient != "+62811000" || msg.DeletedOnRouter {
+			t.Fatalf("unexpected sent entry %+v", msg)
+		}
+	}
+	getJSON(t, httpSrv.URL+"/api/sms/archive?direction=received", &page)
+	if page.Total != 1 || page.Messages[0].Sender != "+620001" {
+		t.Fatalf("expected only the received message, got %+v", page)
+	}
+}
+
+func TestSmsSendKeepsRepeatsWithinASecond(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sms.json")
+	archive := newSmsArchive(path)
+
+	at := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	first, err := archive.RecordSent("+62811000", "pong", 1, at)
+	if err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	for _, when := range []time.Time{at, at.Add(300 * time.Millisecond)} {
+		again, err := archive.RecordSent("+62811000", "pong", 1, when)
+		if err != nil {
+			t.Fatalf("record: %v", err)
+		}
+		if again.SMSHash == first.SMSHash {
+			t.Fatalf("a repeated send reused hash %s", first.SMSHash)
+		}
+	}
+
+	// The keys survive a reload from disk.
+	reloaded := newSmsArchive(path)
+	if _, total, err := reloaded.Query(smsArchiveQuery{Direction: smsDirectionSent}); err != nil || total != 3 {
+		t.Fatalf("expected three sent messages after reload, got %d (%v)", total, err)
+	}
+}
@@ -0,0 +1,362 @@
+package server
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	streamHeartbeat     = 15 * time.Second
+	streamFetchTimeout  = 15 * time.Second
+	streamErrorEvent    = "error"
+	streamMinimumPeriod = 500 * time.Millisecond
+)
+
+// streamEventTypes are the event types served on /api/stream, in the order
+// they are collected.
+var streamEventTypes = []string{"signal", "usage", "sms", "device", "wan"}
+
+type streamEvent struct {
+	id    uint64
+	name  string // SSE event name: a stream type or "error"
+	topic string // stream type the event belongs to
+	data  []byte
+}
+
+// streamSubscriber is one /api/stream connection. Events are coalesced per
+// type, so a slow client only ever receives the newest value.
+type streamSubscriber struct {
+	types  map[string]bool
+	notify chan struct{}
+	done   chan struct{}
+
+	mu        sync.Mutex
+	pending   map[string]streamEvent
+	closeOnce sync.Once
+}
+
+func (sub *streamSubscriber) deliver(ev streamEvent) {
+	if !sub.types[ev.topic] {
+		return
+	}
+	sub.mu.Lock()
+	sub.pending[ev.name+"/"+ev.topic] = ev
+	sub.mu.Unlock()
+	select {
+	case sub.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (sub *streamSubscriber) drain() []streamEvent {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	events := make([]streamEvent, 0, len(sub.pending))
+	for _, ev := range sub.pending {
+		events = append(events, ev)
+	}
+	clear(sub.pending)
+	slices.SortFunc(events, func(a, b streamEvent) int { return cmp.Compare(a.id, b.id) })
+	return events
+}
+
+func (sub *streamSubscriber) close() {
+	sub.closeOnce.Do(func() { close(sub.done) })
+}
+
+// streamHub fans collector results out to subscribers. The collector only
+// runs while someone is subscribed and only fetches the types in demand.
+type streamHub struct {
+	mu     sync.Mutex
+	subs   map[*streamSubscriber]struct{}
+	latest map[string]streamEvent
+	seq    uint64
+	cancel context.CancelFunc
+	wake   chan struct{}
+}
+
+func newStreamHub() *streamHub {
+	return &streamHub{
+		subs:   map[*streamSubscriber]struct{}{},
+		latest: map[string]streamEvent{},
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// subscribe registers a subscriber and queues the cached value of each type
+// it wants. When no collector is running it returns the context the caller
+// must start one with.
+func (h *streamHub) subscribe(types []string) (*streamSubscriber, context.Context) {
+	sub := &streamSubscriber{
+		types:   map[string]bool{},
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		pending: map[string]streamEvent{},
+	}
+	for _, t := range types {
+		sub.types[t] = true
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	wanted := h.wantedLocked()
+	newType := false
+	for _, t := range types {
+		if !wanted[t] {
+			newType = true
+		}
+	}
+	h.subs[sub] = struct{}{}
+	for _, t := range streamEventTypes {
+		if ev, ok := h.latest[t]; ok {
+			sub.deliver(ev)
+		}
+	}
+
+	var ctx context.Context
+	if h.cancel == nil {
+		ctx, h.cancel = context.WithCancel(context.Background())
+	} else if newType {
+		// Fetch the new type now instead of after a full interval.
+		select {
+		case h.wake <- struct{}{}:
+		default:
+		}
+	}
+	return sub, ctx
+}
+
+func (h *streamHub) unsubscribe(sub *streamSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, sub)
+	if len(h.subs) == 0 && h.cancel != nil {
+		h.cancel()
+		h.cancel = nil
+	}
+}
+
+// closeAll ends every stream, e.g. before the listener restarts. Clients
+// reconnect on their own.
+func (h *streamHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		sub.close()
+	}
+	clear(h.subs)
+	if h.cancel != nil {
+		h.cancel()
+		h.cancel = nil
+	}
+}
+
+func (h *streamHub) wanted() map[string]bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.wantedLocked()
+}
+
+func (h *streamHub) wantedLocked() map[string]bool {
+	wanted := map[string]bool{}
+	for sub := range h.subs {
+		for t := range sub.types {
+			wanted[t] = true
+		}
+	}
+	return wanted
+}
+
+// publish sends data as a topic event unless it equals the cached value.
+func (h *streamHub) publish(topic string, data []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if prev, ok := h.latest[topic]; ok && bytes.Equal(prev.data, data) {
+		return
+	}
+	h.seq++
+	ev := streamEvent{id: h.seq, name: topic, topic: topic, data: data}
+	h.latest[topic] = ev
+	for sub := range h.subs {
+		sub.deliver(ev)
+	}
+}
+
+// publishError reports a failed fetch. Errors are not cached, so the last
+// good value stays what new subscribers see first.
+func (h *streamHub) publishError(topic string, err error) {
+	data, _ := json.Marshal(map[string]string{"type": topic, "error": err.Error()})
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	ev := streamEvent{id: h.seq, name: streamErrorEvent, topic: topic, data: data}
+	for sub := range h.subs {
+		sub.deliver(ev)
+	}
+}
+
+// CloseStreams ends all open /api/stream connections. Register it with
+// http.Server.RegisterOnShutdown so streams do not hold up a reload.
+func (s *Server) CloseStreams() {
+	s.stream.closeAll()
+}
+
+func (s *Server) streamInterval() time.Duration {
+	interval := time.Duration(s.getConfig().PollIntervalMs) * time.Millisecond
+	if interval < streamMinimumPeriod {
+		interval = streamMinimumPeriod
+	}
+	return interval
+}
+
+func (s *Server) runStreamCollector(ctx context.Context) {
+	for {
+		s.collectStream(ctx, s.stream.wanted())
+
+		timer := time.NewTimer(s.streamInterval())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-s.stream.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// collectStream fetches every wanted resource once and publishes the
+// results.
+func (s *Server) collectStream(parent context.Context, wanted map[string]bool) {
+	ctx, cancel := context.WithTimeout(parent, streamFetchTimeout)
+	defer cancel()
+	client := s.getClient()
+
+	emit := func(topic string, value interface{}, err error) {
+		if parent.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.stream.publishError(topic, err)
+			return
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			s.stream.publishError(topic, err)
+			return
+		}
+		s.stream.publish(topic, data)
+	}
+
+	// Usage is derived from the status counters, so it needs the same fetch
+	// as the signal event.
+	if wanted["signal"] || wanted["usage"] {
+		status, err := client.GetStatusWeb(ctx)
+		if err == nil {
+			if err := s.store.UpdateUsageFromStatus(status); err != nil {
+				s.logger.Printf("stream: failed to update usage: %v", err)
+			}
+		}
+		if wanted["signal"] {
+			if err != nil {
+				emit("signal", nil, err)
+			} else {
+				service, err := client.PostServiceData(ctx)
+				emit("signal", map[string]interface{}{"status_web": status, "service_data": service}, err)
+			}
+		}
+		if wanted["usage"] {
+			emit("usage", buildDailyUsageSnapshot(s.store.Get()), nil)
+		}
+	}
+	if wanted["sms"] {
+		sms, err := client.GetSmsList(ctx)
+		emit("sms", sms, err)
+	}
+	if wanted["device"] {
+		device, err := client.GetDeviceStatus(ctx)
+		emit("device", device, err)
+	}
+	if wanted["wan"] {
+		wan, err := client.GetWanStatus(ctx)
+		emit("wan", wan, err)
+	}
+}
+
+func parseStreamTypes(raw string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return streamEventTypes, nil
+	}
+	var types []string
+	for _, t := range strings.Split(raw, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || slices.Contains(types, t) {
+			continue
+		}
+		if !slices.Contains(streamEventTypes, t) {
+			return nil, fmt.Errorf("unknown event type %q (want %s)", t, strings.Join(streamEventTypes, ", "))
+		}
+		types = append(types, t)
+	}
+	if len(types) == 0 {
+		return streamEventTypes, nil
+	}
+	return types, nil
+}
+
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	types, err := parseStreamTypes(r.URL.Query().Get("types"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	sub, collectorCtx := s.stream.subscribe(types)
+	defer s.stream.unsubscribe(sub)
+	if collectorCtx != nil {
+		go s.runStreamCollector(collectorCtx)
+	}
+
+	fmt.Fprintf(w, "retry: %d\n\n", s.streamInterval().Milliseconds())
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.done:
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case <-sub.notify:
+			for _, ev := range sub.drain() {
+				fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.id, ev.name, ev.data)
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
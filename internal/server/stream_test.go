@@ -0,0 +1,98 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readStreamEvents collects SSE event names from /api/stream until want
+// distinct names were seen or the deadline passes.
+func readStreamEvents(t *testing.T, url string, want int) map[string]string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	events := map[string]string{}
+	var name string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			events[name] = strings.TrimPrefix(line, "data: ")
+			if len(events) >= want {
+				return events
+			}
+		}
+	}
+	t.Fatalf("stream ended after %v: %v", events, scanner.Err())
+	return nil
+}
+
+func TestStreamFiltersEventTypes(t *testing.T) {
+	srv, _, httpSrv := newTestServer(t)
+	defer srv.CloseStreams()
+
+	events := readStreamEvents(t, httpSrv.URL+"/api/stream?types=wan,usage", 2)
+	if _, ok := events["wan"]; !ok {
+		t.Fatalf("expected a wan event, got %v", events)
+	}
+	if _, ok := events["usage"]; !ok {
+		t.Fatalf("expected a usage event, got %v", events)
+	}
+
+	resp, payload := doRequest(t, http.MethodGet, httpSrv.URL+"/api/stream?types=wan,bogus", "", nil)
+	if resp.StatusCode != http.StatusBadRequest || payload["error"] == nil {
+		t.Fatalf("expected 400 for unknown type, got %d %v", resp.StatusCode, payload)
+	}
+}
+
+func TestStreamSharesOneCollector(t *testing.T) {
+	srv, emu, httpSrv := newTestServer(t)
+	defer srv.CloseStreams()
+	cfg := srv.getConfig()
+	cfg.PollIntervalMs = 60 * 60 * 1000
+	srv.setConfig(cfg)
+
+	// Keep one subscriber connected so the collector stays up.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, httpSrv.URL+"/api/stream?types=wan", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer resp.Body.Close()
+
+	readStreamEvents(t, httpSrv.URL+"/api/stream?types=wan", 1)
+	readStreamEvents(t, httpSrv.URL+"/api/stream?types=wan", 1)
+	if calls := emu.Calls("show_wan_status_web_app.cgi"); calls != 1 {
+		t.Fatalf("expected subscribers to share one fetch, router saw %d", calls)
+	}
+}
+
+func TestParseStreamTypes(t *testing.T) {
+	types, err := parseStreamTypes(" SMS, sms ,device")
+	if err != nil || strings.Join(types, ",") != "sms,device" {
+		t.Fatalf("unexpected types %v (%v)", types, err)
+	}
+	if types, _ := parseStreamTypes(""); len(types) != len(streamEventTypes) {
+		t.Fatalf("empty filter must select every type, got %v", types)
+	}
+}
@@ -0,0 +1,515 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"nokia_modem/internal/config"
+)
+
+const (
+	telegramPollTimeout = 25 * time.Second
+	telegramRetryDelay  = 5 * time.Second
+	// telegramStaleAfter drops commands queued while the bot was offline and
+	// bounds how long a reboot confirmation button stays valid.
+	telegramStaleAfter = 2 * time.Minute
+	telegramSmsLimit   = 5
+
+	telegramRebootConfirm = "reboot:confirm"
+	telegramRebootCancel  = "reboot:cancel"
+)
+
+const telegramHelpText = `Available commands:
+/status - signal and WAN IP
+/usage - data usage today and over the last 7 days
+/sms - latest messages in the inbox
+/send <number> <text> - send an SMS
+/reboot - reboot the router (asks for confirmation)
+/apn <name> - switch APN
+/renew - renew the WAN IP
+/led on|off - switch the LEDs
+/expiry - data package expiry`
+
+// telegramLongPollClient has no short timeout of its own; getUpdates holds
+// the request open for telegramPollTimeout.
+var telegramLongPollClient = &http.Client{Timeout: telegramPollTimeout + 10*time.Second}
+
+type telegramUpdate struct {
+	UpdateID      int64                  `json:"update_id"`
+	Message       *telegramMessage       `json:"message,omitempty"`
+	CallbackQuery *telegramCallbackQuery `json:"callback_query,omitempty"`
+}
+
+type telegramMessage struct {
+	MessageID int64        `json:"message_id"`
+	Date      int64        `json:"date"`
+	Chat      telegramChat `json:"chat"`
+	Text      string       `json:"text"`
+}
+
+type telegramChat struct {
+	ID int64 `json:"id"`
+}
+
+type telegramCallbackQuery struct {
+	ID      string           `json:"id"`
+	Data    string           `json:"data"`
+	Message *telegramMessage `json:"message,omitempty"`
+}
+
+type telegramReply struct {
+	Text        string
+	ReplyMarkup interface{}
+}
+
+func telegramEndpoint(cfg config.TelegramConfig, method string) string {
+	base := strings.TrimSpace(cfg.APIBase)
+	if base == "" {
+		base = config.Defaults().Telegram.APIBase
+	}
+	base = strings.TrimRight(base, "/")
+	return fmt.Sprintf("%s/bot%s/%s", base, cfg.BotToken, method)
+}
+
+// redactTelegramURL drops the request URL, which carries the bot token, from
+// errors of the HTTP client so they can be logged.
+func redactTelegramURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// callTelegram invokes a Bot API method and decodes its "result" into out.
+func (s *Server) callTelegram(ctx context.Context, httpClient *http.Client, cfg config.TelegramConfig, method string, payload interface{}, out interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode telegram %s: %w", method, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, telegramEndpoint(cfg, method), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create telegram %s request: %w", method, redactTelegramURL(err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("telegram %s: %w", method, redactTelegramURL(err))
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		OK          bool            `json:"ok"`
+		Result      json.RawMessage `json:"result"`
+		Description string          `json:"description"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err := json.Unmarshal(data, &envelope); err != nil || !envelope.OK {
+		return fmt.Errorf("telegram %s error: status=%d body=%s", method, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out != nil && len(envelope.Result) > 0 {
+		if err := json.Unmarshal(envelope.Result, out); err != nil {
+			return fmt.Errorf("decode telegram %s: %w", method, err)
+		}
+	}
+	return nil
+}
+
+func telegramBotConfigsEqual(a, b config.TelegramConfig) bool {
+	return a.Enabled == b.Enabled &&
+		a.Commands == b.Commands &&
+		strings.TrimSpace(a.APIBase) == strings.TrimSpace(b.APIBase) &&
+		strings.TrimSpace(a.BotToken) == strings.TrimSpace(b.BotToken) &&
+		strings.TrimSpace(a.ChatID) == strings.TrimSpace(b.ChatID) &&
+		slices.Equal(a.AllowedChatIDs, b.AllowedChatIDs)
+}
+
+func telegramBotEnabled(cfg config.TelegramConfig) bool {
+	return cfg.Enabled && cfg.Commands && strings.TrimSpace(cfg.BotToken) != ""
+}
+
+func (s *Server) configureTelegramBot(cfg config.Config) {
+	var (
+		start bool
+		stop  context.CancelFunc
+		ctx   context.Context
+	)
+	enabled := telegramBotEnabled(cfg.Telegram)
+
+	s.telegramMu.Lock()
+	running := s.telegramCancel != nil
+	changed := !telegramBotConfigsEqual(s.telegramCfg, cfg.Telegram)
+
+	if running && (changed || !enabled) {
+		stop = s.telegramCancel
+		s.telegramCancel = nil
+		running = false
+	}
+	if enabled && !running {
+		ctx, s.telegramCancel = context.WithCancel(context.Background())
+		s.telegramWG.Add(1)
+		start = true
+	}
+	s.telegramCfg = cfg.Telegram
+	s.telegramMu.Unlock()
+
+	if stop != nil {
+		stop()
+		s.telegramWG.Wait()
+		s.logger.Printf("telegram bot: stopped")
+	}
+
+	if start {
+		go s.runTelegramBot(ctx, cfg.Telegram)
+		s.logger.Printf("telegram bot: started")
+	}
+}
+
+func (s *Server) runTelegramBot(ctx context.Context, cfg config.TelegramConfig) {
+	defer s.telegramWG.Done()
+
+	var offset int64
+	for {
+		var updates []telegramUpdate
+		err := s.callTelegram(ctx, telegramLongPollClient, cfg, "getUpdates", map[string]interface{}{
+			"offset":          offset,
+			"timeout":         int(telegramPollTimeout / time.Second),
+			"allowed_updates": []string{"message", "callback_query"},
+		}, &updates)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			s.logger.Printf("telegram bot: %v", err)
+			if sleepContext(ctx, telegramRetryDelay) != nil {
+				return
+			}
+			continue
+		}
+
+		for _, update := range updates {
+			if update.UpdateID >= offset {
+				offset = update.UpdateID + 1
+			}
+			s.handleTelegramUpdate(ctx, cfg, update)
+		}
+	}
+}
+
+func telegramChatAllowed(cfg config.TelegramConfig, chatID int64) bool {
+	id := strconv.FormatInt(chatID, 10)
+	return strings.TrimSpace(cfg.ChatID) == id || slices.Contains(cfg.AllowedChatIDs, id)
+}
+
+func telegramMessageStale(msg *telegramMessage, now time.Time) bool {
+	return msg.Date > 0 && now.Sub(time.Unix(msg.Date, 0)) > telegramStaleAfter
+}
+
+// parseTelegramCommand splits "/cmd@bot_name arg1 arg2" into its command
+// name and arguments.
+func parseTelegramCommand(text string) (string, []string) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return "", nil
+	}
+	name := strings.TrimPrefix(fields[0], "/")
+	if at := strings.Index(name, "@"); at >= 0 {
+		name = name[:at]
+	}
+	return strings.ToLower(name), fields[1:]
+}
+
+func (s *Server) handleTelegramUpdate(ctx context.Context, cfg config.TelegramConfig, update telegramUpdate) {
+	if query := update.CallbackQuery; query != nil {
+		s.handleTelegramCallback(ctx, cfg, query)
+		return
+	}
+
+	msg := update.Message
+	if msg == nil {
+		return
+	}
+	if !telegramChatAllowed(cfg, msg.Chat.ID) {
+		s.logger.Printf("telegram bot: ignored message from unauthorized chat %d", msg.Chat.ID)
+		return
+	}
+	name, args := parseTelegramCommand(msg.Text)
+	if name == "" {
+		return
+	}
+	if telegramMessageStale(msg, time.Now()) {
+		s.logger.Printf("telegram bot: ignored stale /%s", name)
+		return
+	}
+
+	s.logger.Printf("telegram bot: /%s from chat %d", name, msg.Chat.ID)
+	reply := s.runTelegramCommand(ctx, cfg, msg.Chat.ID, name, args)
+
+	payload := map[string]interface{}{
+		"chat_id": msg.Chat.ID,
+		"text":    reply.Text,
+	}
+	if reply.ReplyMarkup != nil {
+		payload["reply_markup"] = reply.ReplyMarkup
+	}
+	if err := s.callTelegram(ctx, s.httpClient, cfg, "sendMessage", payload, nil); err != nil {
+		s.logger.Printf("telegram bot: reply to /%s failed: %v", name, err)
+	}
+}
+
+func (s *Server) runTelegramCommand(ctx context.Context, cfg config.TelegramConfig, chatID int64, name string, args []string) telegramReply {
+	switch name {
+	case "start", "help":
+		return telegramReply{Text: telegramHelpText}
+	case "status":
+		return telegramReply{Text: s.telegramStatusText(ctx)}
+	case "usage":
+		return telegramReply{Text: telegramUsageText(buildDailyUsageSnapshot(s.store.Get()))}
+	case "sms":
+		return telegramReply{Text: s.telegramSmsText(ctx)}
+	case "send":
+		if len(args) < 2 {
+			return telegramReply{Text: "Usage: /send <number> <text>"}
+		}
+		response, err := s.runTelegramRouterCommand(ctx, "sms_send", commandArgs{"to": args[0], "text": strings.Join(args[1:], " ")})
+		if err != nil {
+			return telegramReply{Text: fmt.Sprintf("Failed to send SMS: %v", err)}
+		}
+		if sent, ok := response.(smsSendResponse); ok && sent.Segments > 1 {
+			return telegramReply{Text: fmt.Sprintf("SMS sent to %s in %d parts.", sent.To, sent.Segments)}
+		}
+		return telegramReply{Text: fmt.Sprintf("SMS sent to %s.", args[0])}
+	case "expiry":
+		return telegramReply{Text: telegramExpiryText(s.store.Get().DataExpired, time.Now())}
+	case "reboot":
+		return telegramReply{
+			Text: "Reboot the router now?",
+			ReplyMarkup: map[string]interface{}{
+				"inline_keyboard": [][]map[string]string{{
+					{"text": "Reboot", "callback_data": telegramRebootConfirm},
+					{"text": "Cancel", "callback_data": telegramRebootCancel},
+				}},
+			},
+		}
+	case "apn":
+		if len(args) != 1 {
+			return telegramReply{Text: "Usage: /apn <name>"}
+		}
+		if _, err := s.runTelegramRouterCommand(ctx, "apn", commandArgs{"apn": args[0]}); err != nil {
+			return telegramReply{Text: fmt.Sprintf("Failed to switch APN: %v", err)}
+		}
+		return telegramReply{Text: fmt.Sprintf("APN switched to %s.", args[0])}
+	case "led":
+		if len(args) != 1 {
+			return telegramReply{Text: "Usage: /led on|off"}
+		}
+		enable, err := commandArgs{"enable": args[0]}.boolean(true, "enable")
+		if err != nil {
+			return telegramReply{Text: "Usage: /led on|off"}
+		}
+		if _, err := s.runTelegramRouterCommand(ctx, "led", commandArgs{"enable": enable}); err != nil {
+			return telegramReply{Text: fmt.Sprintf("Failed to switch LEDs: %v", err)}
+		}
+		return telegramReply{Text: fmt.Sprintf("LEDs switched %s.", strings.ToLower(onOff(enable)))}
+	case "renew":
+		job, done, started := s.startWanRenew("telegram")
+		go s.reportTelegramWanRenew(ctx, cfg, chatID, job.ID, done)
+		if !started {
+			return telegramReply{Text: fmt.Sprintf("A WAN IP renewal is already running (job %s). I'll report back when it finishes.", job.ID)}
+		}
+		return telegramReply{Text: fmt.Sprintf("WAN IP renewal started (job %s). This can take a minute.", job.ID)}
+	default:
+		return telegramReply{Text: fmt.Sprintf("Unknown command /%s.\n\n%s", name, telegramHelpText)}
+	}
+}
+
+func (s *Server) runTelegramRouterCommand(ctx context.Context, name string, args commandArgs) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.commandTimeout(name))
+	defer cancel()
+	return s.executeCommand(ctx, "telegram", name, args)
+}
+
+// reportTelegramWanRenew sends the outcome of a renewal job once it ends, so
+// the bot keeps polling while the APN is cycled.
+func (s *Server) reportTelegramWanRenew(ctx context.Context, cfg config.TelegramConfig, chatID int64, jobID string, done <-chan struct{}) {
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return
+	}
+
+	job, _ := s.wanRenew.get(jobID)
+	text := fmt.Sprintf("WAN IP renewed: %s → %s.", valueOr(job.OldIP, "unknown"), job.NewIP)
+	if job.Status == wanRenewFailed {
+		text = fmt.Sprintf("WAN IP renewal failed: %s", job.Error)
+	}
+	err := s.callTelegram(ctx, s.httpClient, cfg, "sendMessage", map[string]interface{}{
+		"chat_id": chatID,
+		"text":    text,
+	}, nil)
+	if err != nil {
+		s.logger.Printf("telegram bot: renew report failed: %v", err)
+	}
+}
+
+// handleTelegramCallback handles the inline keyboard attached to /reboot.
+func (s *Server) handleTelegramCallback(ctx context.Context, cfg config.TelegramConfig, query *telegramCallbackQuery) {
+	answer := func(text string) {
+		payload := map[string]interface{}{"callback_query_id": query.ID}
+		if text != "" {
+			payload["text"] = text
+		}
+		if err := s.callTelegram(ctx, s.httpClient, cfg, "answerCallbackQuery", payload, nil); err != nil {
+			s.logger.Printf("telegram bot: answer callback failed: %v", err)
+		}
+	}
+
+	msg := query.Message
+	if msg == nil || !telegramChatAllowed(cfg, msg.Chat.ID) {
+		answer("Not authorized.")
+		return
+	}
+
+	var text string
+	switch query.Data {
+	case telegramRebootCancel:
+		answer("")
+		text = "Reboot cancelled."
+	case telegramRebootConfirm:
+		if telegramMessageStale(msg, time.Now()) {
+			answer("Confirmation expired, send /reboot again.")
+			text = "Reboot confirmation expired."
+			break
+		}
+		answer("Rebooting…")
+		s.logger.Printf("telegram bot: reboot confirmed from chat %d", msg.Chat.ID)
+		if _, err := s.runTelegramRouterCommand(ctx, "reboot", nil); err != nil {
+			text = fmt.Sprintf("Reboot failed: %v", err)
+		} else {
+			text = "Reboot command sent."
+		}
+	default:
+		answer("Unknown action.")
+		return
+	}
+
+	// Replacing the text also drops the keyboard, so the buttons can only
+	// be used once.
+	err := s.callTelegram(ctx, s.httpClient, cfg, "editMessageText", map[string]interface{}{
+		"chat_id":    msg.Chat.ID,
+		"message_id": msg.MessageID,
+		"text":       text,
+	}, nil)
+	if err != nil {
+		s.logger.Printf("telegram bot: edit message failed: %v", err)
+	}
+}
+
+func (s *Server) telegramStatusText(ctx context.Context) string {
+	state := s.collectHAState(ctx, nil, s.store.Get())
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Network: %s, band %s, PCI %s\n", telegramValue(state["rat"], ""), telegramValue(state["band"], ""), telegramValue(state["pci"], ""))
+	fmt.Fprintf(&b, "RSRP: %s\n", telegramValue(state["rsrp"], " dBm"))
+	fmt.Fprintf(&b, "RSRQ: %s\n", telegramValue(state["rsrq"], " dB"))
+	fmt.Fprintf(&b, "SINR: %s\n", telegramValue(state["sinr"], " dB"))
+	fmt.Fprintf(&b, "WAN IP: %s\n", telegramValue(state["wan_ip"], ""))
+	fmt.Fprintf(&b, "APN: %s", telegramValue(state["apn"], ""))
+	return b.String()
+}
+
+func telegramValue(v interface{}, unit string) string {
+	switch val := v.(type) {
+	case nil:
+		return "n/a"
+	case *float64:
+		if val == nil {
+			return "n/a"
+		}
+		return strconv.FormatFloat(*val, 'f', -1, 64) + unit
+	case string:
+		if strings.TrimSpace(val) == "" {
+			return "n/a"
+		}
+		return val + unit
+	default:
+		return fmt.Sprint(val) + unit
+	}
+}
+
+func telegramUsageText(snapshot map[string]interface{}) string {
+	formatted := func(entry map[string]interface{}, key string) string {
+		if part, ok := entry[key].(map[string]interface{}); ok {
+			if text, ok := part["formatted"].(string); ok {
+				return text
+			}
+		}
+		return "n/a"
+	}
+
+	var b strings.Builder
+	if today, ok := snapshot["today_usage"].(map[string]interface{}); ok {
+		fmt.Fprintf(&b, "Today: %s (up %s, down %s)\n", formatted(today, "combined"), formatted(today, "upload"), formatted(today, "download"))
+	}
+	if days, ok := snapshot["last_7_days"].([]map[string]interface{}); ok && len(days) > 0 {
+		b.WriteString("\nLast 7 days:\n")
+		for _, day := range days {
+			fmt.Fprintf(&b, "%v: %s\n", day["date"], formatted(day, "combined"))
+		}
+	}
+	if total, ok := snapshot["total_usage"].(map[string]string); ok {
+		fmt.Fprintf(&b, "\nTracked total: %s", total["combined"])
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func (s *Server) telegramSmsText(ctx context.Context) string {
+	messages, err := s.fetchSmsMessages(ctx)
+	if err != nil {
+		return fmt.Sprintf("Failed to read the inbox: %v", err)
+	}
+	if len(messages) == 0 {
+		return "The inbox is empty."
+	}
+	sortMessagesByTime(messages)
+
+	unread := 0
+	for _, msg := range messages {
+		if msg.SMSUnread {
+			unread++
+		}
+	}
+
+	parts := []string{fmt.Sprintf("%d messages, %d unread.", len(messages), unread)}
+	for i, msg := range messages {
+		if i == telegramSmsLimit {
+			break
+		}
+		text, _ := formatSmsForTelegram(msg, "")
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, "\n\n———\n\n")
+}
+
+func telegramExpiryText(expiry int64, now time.Time) string {
+	if expiry <= 0 {
+		return "Data expiry is not set."
+	}
+	at := time.Unix(expiry, 0)
+	left := at.Sub(now)
+	if left <= 0 {
+		return fmt.Sprintf("Data expired on %s.", at.Format("02/01/2006 15:04"))
+	}
+	return fmt.Sprintf("Data expires on %s (%d days left).", at.Format("02/01/2006 15:04"), int(left.Hours()/24))
+}
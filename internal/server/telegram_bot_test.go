@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nokia_modem/internal/config"
+)
+
+// fakeTelegram records Bot API calls and serves queued updates.
+type fakeTelegram struct {
+	mu      sync.Mutex
+	calls   []fakeTelegramCall
+	updates []telegramUpdate
+}
+
+type fakeTelegramCall struct {
+	Method  string
+	Payload map[string]interface{}
+}
+
+func newFakeTelegram(t *testing.T) (*fakeTelegram, config.TelegramConfig) {
+	t.Helper()
+	fake := &fakeTelegram{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		var payload map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+
+		fake.mu.Lock()
+		fake.calls = append(fake.calls, fakeTelegramCall{Method: method, Payload: payload})
+		var result interface{} = true
+		if method == "getUpdates" {
+			offset, _ := payload["offset"].(float64)
+			pending := []telegramUpdate{}
+			for _, u := range fake.updates {
+				if float64(u.UpdateID) >= offset {
+					pending = append(pending, u)
+				}
+			}
+			result = pending
+		}
+		fake.mu.Unlock()
+
+		if method == "getUpdates" && len(result.([]telegramUpdate)) == 0 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": result})
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := config.TelegramConfig{
+		Enabled:  true,
+		Commands: true,
+		APIBase:  srv.URL,
+		BotToken: "token",
+		ChatID:   "100",
+	}
+	return fake, cfg
+}
+
+func (f *fakeTelegram) sent(method string) []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []map[string]interface{}
+	for _, call := range f.calls {
+		if call.Method == method {
+			out = append(out, call.Payload)
+		}
+	}
+	return out
+}
+
+func telegramText(chatID int64, text string) telegramUpdate {
+	return telegramUpdate{Message: &telegramMessage{
+		MessageID: 1,
+		Date:      time.Now().Unix(),
+		Chat:      telegramChat{ID: chatID},
+		Text:      text,
+	}}
+}
+
+func TestParseTelegramCommand(t *testing.T) {
+	name, args := parseTelegramCommand("/LED@nokia_bot  off")
+	if name != "led" || len(args) != 1 || args[0] != "off" {
+		t.Fatalf("unexpected parse: %q %v", name, args)
+	}
+	if name, _ := parseTelegramCommand("hello"); name != "" {
+		t.Fatalf("expected plain text to be ignored, got %q", name)
+	}
+}
+
+func TestTelegramErrorsDoNotLeakTheToken(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	cfg := config.TelegramConfig{APIBase: down.URL, BotToken: "123:secret-token", ChatID: "100"}
+	err := srv.callTelegram(context.Background(), srv.httpClient, cfg, "getUpdates", map[string]int{}, nil)
+	if err == nil || strings.Contains(err.Error(), "secret-token") {
+		t.Fatalf("expected an error without the token, got %v", err)
+	}
+	err = srv.sendTelegramMessage(context.Background(), cfg, cfg.ChatID, "", "hello")
+	if err == nil || strings.Contains(err.Error(), "secret-token") {
+		t.Fatalf("expected an error without the token, got %v", err)
+	}
+}
+
+func TestTelegramBotIgnoresUnauthorizedChats(t *testing.T) {
+	srv, emu, _ := newTestServer(t)
+	fake, cfg := newFakeTelegram(t)
+
+	srv.handleTelegramUpdate(context.Background(), cfg, telegramText(999, "/led off"))
+
+	if !emu.LedEnabled() {
+		t.Fatalf("expected LEDs to stay on")
+	}
+	if sent := fake.sent("sendMessage"); len(sent) != 0 {
+		t.Fatalf("expected no reply, got %v", sent)
+	}
+}
+
+func TestTelegramBotRebootNeedsConfirmation(t *testing.T) {
+	srv, emu, _ := newTestServer(t)
+	fake, cfg := newFakeTelegram(t)
+	ctx := context.Background()
+
+	srv.handleTelegramUpdate(ctx, cfg, telegramText(100, "/reboot"))
+	sent := fake.sent("sendMessage")
+	if len(sent) != 1 || sent[0]["reply_markup"] == nil {
+		t.Fatalf("expected confirmation keyboard, got %v", sent)
+	}
+	if emu.Reboots() != 0 {
+		t.Fatalf("reboot must wait for confirmation")
+	}
+
+	srv.handleTelegramUpdate(ctx, cfg, telegramUpdate{CallbackQuery: &telegramCallbackQuery{
+		ID:   "cb1",
+		Data: telegramRebootConfirm,
+		Message: &telegramMessage{
+			MessageID: 7,
+			Date:      time.Now().Unix(),
+			Chat:      telegramChat{ID: 100},
+		},
+	}})
+	if emu.Reboots() != 1 {
+		t.Fatalf("expected one reboot, got %d", emu.Reboots())
+	}
+	if len(fake.sent("answerCallbackQuery")) != 1 {
+		t.Fatalf("expected callback to be answered")
+	}
+	edits := fake.sent("editMessageText")
+	if len(edits) != 1 || edits[0]["text"] != "Reboot command sent." {
+		t.Fatalf("unexpected edit: %v", edits)
+	}
+}
+
+func TestTelegramBotPollsUpdates(t *testing.T) {
+	srv, emu, _ := newTestServer(t)
+	fake, tgCfg := newFakeTelegram(t)
+	fake.updates = []telegramUpdate{func() telegramUpdate {
+		u := telegramText(100, "/led off")
+		u.UpdateID = 41
+		return u
+	}()}
+
+	cfg := srv.getConfig()
+	cfg.Telegram = tgCfg
+	srv.configureTelegramBot(cfg)
+	defer func() {
+		cfg.Telegram.Commands = false
+		srv.configureTelegramBot(cfg)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for emu.LedEnabled() || len(fake.sent("sendMessage")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("bot did not handle /led off")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if reply := fake.sent("sendMessage")[0]["text"]; reply != "LEDs switched off." {
+		t.Fatalf("unexpected reply %v", reply)
+	}
+
+	// The update must be acknowledged so it is not replayed.
+	time.Sleep(100 * time.Millisecond)
+	if n := len(fake.sent("sendMessage")); n != 1 {
+		t.Fatalf("update handled %d times", n)
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"nokia_modem/internal/config"
+	"nokia_modem/internal/settings"
+)
+
+// defaultUsageRanges is how far back /api/usage looks without 'from'.
+var defaultUsageRanges = map[string]func(time.Time) time.Time{
+	settings.GranularityHour:  func(to time.Time) time.Time { return to.Add(-24 * time.Hour) },
+	settings.GranularityDay:   func(to time.Time) time.Time { return to.AddDate(0, 0, -30) },
+	settings.GranularityMonth: func(to time.Time) time.Time { return to.AddDate(-1, 0, 0) },
+}
+
+func usageRetention(cfg config.UsageConfig) settings.Retention {
+	return settings.Retention{
+		HourlyDays:    cfg.HourlyRetentionDays,
+		DailyDays:     cfg.DailyRetentionDays,
+		MonthlyMonths: cfg.MonthlyRetentionMonths,
+	}
+}
+
+func (s *Server) configureUsageRetention(cfg config.Config) {
+	if err := s.store.SetRetention(usageRetention(cfg.Usage)); err != nil {
+		s.logger.Printf("usage: apply retention failed: %v", err)
+	}
+}
+
+type usageBucketResponse struct {
+	Key      string `json:"key"`
+	Start    string `json:"start"`
+	Upload   int64  `json:"upload"`
+	Download int64  `json:"download"`
+	Total    int64  `json:"total"`
+}
+
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	granularity := strings.ToLower(strings.TrimSpace(query.Get("granularity")))
+	if granularity == "" {
+		granularity = settings.GranularityDay
+	}
+	defaultFrom, ok := defaultUsageRanges[granularity]
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "granularity must be hour, day or month"})
+		return
+	}
+
+	to := time.Now()
+	if raw := strings.TrimSpace(query.Get("to")); raw != "" {
+		parsed, err := parseHistoryTime(raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid 'to' value"})
+			return
+		}
+		to = parsed
+	}
+	from := defaultFrom(to)
+	if raw := strings.TrimSpace(query.Get("from")); raw != "" {
+		parsed, err := parseHistoryTime(raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid 'from' value"})
+			return
+		}
+		from = parsed
+	}
+	if !from.Before(to) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "'from' must be before 'to'"})
+		return
+	}
+
+	buckets, err := s.store.Get().Usage(granularity, from, to)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	out := make([]usageBucketResponse, 0, len(buckets))
+	var total settings.UsageStats
+	for _, bucket := range buckets {
+		out = append(out, usageBucketResponse{
+			Key:      bucket.Key,
+			Start:    bucket.Start.Format(time.RFC3339),
+			Upload:   bucket.Upload,
+			Download: bucket.Download,
+			Total:    bucket.Upload + bucket.Download,
+		})
+		total.Upload += bucket.Upload
+		total.Download += bucket.Download
+	}
+	total.Total = total.Upload + total.Download
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"granularity": granularity,
+		"from":        from.UTC().Format(time.RFC3339),
+		"to":          to.UTC().Format(time.RFC3339),
+		"buckets":     out,
+		"total":       total,
+	})
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"nokia_modem/internal/settings"
+)
+
+func TestUsageEndpointGranularities(t *testing.T) {
+	srv, _, httpSrv := newTestServer(t)
+
+	now := time.Now()
+	if err := srv.store.Update(func(data *settings.Settings) error {
+		data.HourlyUsage = map[string]settings.UsageStats{
+			now.Add(-2 * time.Hour).Format(settings.HourLayout):  {Upload: 1, Download: 2},
+			now.Add(-48 * time.Hour).Format(settings.HourLayout): {Upload: 10, Download: 20},
+		}
+		data.MonthlyUsage = map[string]settings.UsageStats{
+			now.Format(settings.MonthLayout): {Upload: 100, Download: 200},
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("seed usage: %v", err)
+	}
+
+	var hourly struct {
+		Buckets []usageBucketResponse `json:"buckets"`
+		Total   settings.UsageStats   `json:"total"`
+	}
+	if status := getJSON(t, httpSrv.URL+"/api/usage?granularity=hour", &hourly); status != http.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+	// The default hourly range is the last 24 hours.
+	if len(hourly.Buckets) != 1 || hourly.Total.Total != 3 {
+		t.Fatalf("unexpected hourly usage: %+v", hourly)
+	}
+
+	var monthly struct {
+		Buckets []usageBucketResponse `json:"buckets"`
+	}
+	getJSON(t, httpSrv.URL+"/api/usage?granularity=month", &monthly)
+	if len(monthly.Buckets) != 1 || monthly.Buckets[0].Total != 300 {
+		t.Fatalf("unexpected monthly usage: %+v", monthly)
+	}
+
+	if status := getJSON(t, httpSrv.URL+"/api/usage?granularity=week", nil); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown granularity, got %d", status)
+	}
+}
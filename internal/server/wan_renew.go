@@ -0,0 +1,422 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"nokia_modem/internal/config"
+	"nokia_modem/internal/router"
+)
+
+// The carrier hands out a new public IP when the modem re-attaches, so a
+// renewal switches to a throwaway APN and back. It used to run in the
+// browser; as a server job it always restores the original APN, even when
+// the tab that started it is closed.
+const (
+	wanRenewSwitchDelay  = time.Second
+	wanRenewPollInterval = 2 * time.Second
+	wanRenewRestoreGrace = 20 * time.Second
+	// wanRenewIPReadTimeout bounds reading the external IP before the first
+	// switch; without it a renewal could not be told apart from no change.
+	wanRenewIPReadTimeout = 10 * time.Second
+	wanRenewKeepJobs      = 20
+)
+
+const (
+	wanRenewRunning   = "running"
+	wanRenewSucceeded = "succeeded"
+	wanRenewFailed    = "failed"
+)
+
+type wanRenewEvent struct {
+	At      time.Time `json:"at"`
+	Stage   string    `json:"stage"`
+	Message string    `json:"message"`
+}
+
+type wanRenewJob struct {
+	ID          string          `json:"id"`
+	Source      string          `json:"source"`
+	Status      string          `json:"status"`
+	Stage       string          `json:"stage"`
+	Attempt     int             `json:"attempt"`
+	MaxAttempts int             `json:"max_attempts"`
+	OriginalAPN string          `json:"original_apn"`
+	TempAPN     string          `json:"temp_apn"`
+	OldIP       string          `json:"old_ip,omitempty"`
+	NewIP       string          `json:"new_ip,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	StartedAt   time.Time       `json:"started_at"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+	Events      []wanRenewEvent `json:"events"`
+
+	done chan struct{}
+}
+
+// wanRenewJobs tracks the running renewal and a short history of finished
+// ones. Only one renewal runs at a time; later requests join it.
+type wanRenewJobs struct {
+	mu     sync.Mutex
+	jobs   []*wanRenewJob
+	active *wanRenewJob
+}
+
+// start registers a job; the APNs are filled in once the job has read the
+// current one from the router.
+func (j *wanRenewJobs) start(source string, cfg config.WanRenewConfig) (*wanRenewJob, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.active != nil {
+		return j.active, false
+	}
+
+	job := &wanRenewJob{
+		ID:          newCommandID(),
+		Source:      source,
+		Status:      wanRenewRunning,
+		Stage:       "starting",
+		MaxAttempts: cfg.MaxAttempts,
+		TempAPN:     cfg.TempAPN,
+		StartedAt:   time.Now().UTC(),
+		Events:      []wanRenewEvent{},
+		done:        make(chan struct{}),
+	}
+	j.active = job
+	j.jobs = append(j.jobs, job)
+	if len(j.jobs) > wanRenewKeepJobs {
+		j.jobs = append([]*wanRenewJob(nil), j.jobs[len(j.jobs)-wanRenewKeepJobs:]...)
+	}
+	return job, true
+}
+
+func (j *wanRenewJobs) progress(job *wanRenewJob, stage, message string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job.Stage = stage
+	job.Events = append(job.Events, wanRenewEvent{At: time.Now().UTC(), Stage: stage, Message: message})
+}
+
+func (j *wanRenewJobs) update(job *wanRenewJob, fn func(*wanRenewJob)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(job)
+}
+
+func (j *wanRenewJobs) finish(job *wanRenewJob, newIP string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now().UTC()
+	job.FinishedAt = &now
+	job.Stage = "done"
+	if err != nil {
+		job.Status = wanRenewFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = wanRenewSucceeded
+		job.NewIP = newIP
+	}
+	if j.active == job {
+		j.active = nil
+	}
+	close(job.done)
+}
+
+func (j *wanRenewJobs) get(id string) (wanRenewJob, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, job := range j.jobs {
+		if job.ID == id {
+			return job.snapshotLocked(), true
+		}
+	}
+	return wanRenewJob{}, false
+}
+
+// running reports whether a renewal is switching APNs right now.
+func (j *wanRenewJobs) running() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.active != nil
+}
+
+// list returns the retained jobs, newest first.
+func (j *wanRenewJobs) list() []wanRenewJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	out := make([]wanRenewJob, 0, len(j.jobs))
+	for i := len(j.jobs) - 1; i >= 0; i-- {
+		out = append(out, j.jobs[i].snapshotLocked())
+	}
+	return out
+}
+
+func (job *wanRenewJob) snapshotLocked() wanRenewJob {
+	snap := *job
+	snap.Events = append([]wanRenewEvent(nil), job.Events...)
+	if job.FinishedAt != nil {
+		finished := *job.FinishedAt
+		snap.FinishedAt = &finished
+	}
+	return snap
+}
+
+// wanRenewDeadline bounds a whole job: reading the external IP, then each
+// attempt waits for the link twice.
+func wanRenewDeadline(cfg config.WanRenewConfig) time.Duration {
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	return wanRenewIPReadTimeout + time.Duration(cfg.MaxAttempts)*(2*timeout+2*wanRenewSwitchDelay+wanRenewRestoreGrace) + wanRenewRestoreGrace
+}
+
+// startWanRenew starts a renewal job, or returns the one already running.
+// The returned channel is closed when the job finishes.
+func (s *Server) startWanRenew(source string) (wanRenewJob, <-chan struct{}, bool) {
+	cfg := s.getConfig().WanRenew
+
+	job, started := s.wanRenew.start(source, cfg)
+	if started {
+		s.logger.Printf("wan renew: job %s started by %s", job.ID, source)
+		go s.runWanRenew(job, cfg)
+	}
+	snap, _ := s.wanRenew.get(job.ID)
+	return snap, job.done, started
+}
+
+// awaitWanRenew starts or joins a renewal and waits for it to finish.
+func (s *Server) awaitWanRenew(ctx context.Context, source string) (wanRenewJob, error) {
+	job, done, _ := s.startWanRenew(source)
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return job, ctx.Err()
+	}
+	final, _ := s.wanRenew.get(job.ID)
+	if final.Status == wanRenewFailed {
+		return final, errors.New(final.Error)
+	}
+	return final, nil
+}
+
+func (s *Server) runWanRenew(job *wanRenewJob, cfg config.WanRenewConfig) {
+	ctx, cancel := context.WithTimeout(context.Background(), wanRenewDeadline(cfg))
+	defer cancel()
+
+	newIP, err := s.renewWanIP(ctx, job, cfg)
+	s.wanRenew.finish(job, newIP, err)
+	if err != nil {
+		s.logger.Printf("wan renew: job %s failed: %v", job.ID, err)
+		return
+	}
+	s.logger.Printf("wan renew: job %s got new external IP %s", job.ID, newIP)
+}
+
+// renewWanIP cycles the APN until the external IP differs from the one seen
+// at the start, or the configured attempts run out.
+func (s *Server) renewWanIP(ctx context.Context, job *wanRenewJob, cfg config.WanRenewConfig) (string, error) {
+	original, err := s.readRouterAPN(ctx)
+	if err != nil {
+		// Restoring a guessed APN could leave the modem offline.
+		if cfg.APN == "" {
+			return "", fmt.Errorf("read current APN: %w (set wan_renew.apn to restore a fixed APN)", err)
+		}
+		s.wanRenew.progress(job, "checking", fmt.Sprintf("could not read the current APN (%v), will restore %s", err, cfg.APN))
+		original = cfg.APN
+	}
+	temp := cfg.TempAPN
+	if strings.EqualFold(temp, original) {
+		temp = cfg.APN
+	}
+	if temp == "" || strings.EqualFold(original, temp) {
+		return "", fmt.Errorf("temporary APN %q matches the current APN", cfg.TempAPN)
+	}
+	s.wanRenew.update(job, func(j *wanRenewJob) { j.OriginalAPN, j.TempAPN = original, temp })
+
+	oldIP, err := s.readExternalIP(ctx)
+	if err != nil {
+		return "", fmt.Errorf("read current external IP: %w", err)
+	}
+	s.wanRenew.update(job, func(j *wanRenewJob) { j.OldIP = oldIP })
+	s.wanRenew.progress(job, "checking", fmt.Sprintf("current external IP %s on APN %s", oldIP, original))
+
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	for attempt := 1; attempt <= cfg.MaxAttempts; attempt++ {
+		s.wanRenew.update(job, func(j *wanRenewJob) { j.Attempt = attempt })
+
+		ip, err := s.cycleAPN(ctx, job, original, temp, timeout)
+		if err != nil {
+			return "", err
+		}
+		if ip != oldIP {
+			return ip, nil
+		}
+		s.wanRenew.progress(job, "retrying", fmt.Sprintf("attempt %d: external IP unchanged (%s)", attempt, ip))
+	}
+	return "", fmt.Errorf("external IP did not change after %d attempts", cfg.MaxAttempts)
+}
+
+// cycleAPN switches to temp and back to original, waiting for the link each
+// time. If anything fails after the first switch it still tries to restore
+// original so the modem is never left on the temporary profile.
+func (s *Server) cycleAPN(ctx context.Context, job *wanRenewJob, original, temp string, timeout time.Duration) (ip string, err error) {
+	client := s.getClient()
+
+	s.wanRenew.progress(job, "switching", fmt.Sprintf("switching APN to %s", temp))
+	if _, err := client.PostSetAPN(ctx, temp); err != nil {
+		return "", fmt.Errorf("switch to %s: %w", temp, err)
+	}
+
+	restored := false
+	defer func() {
+		if restored {
+			return
+		}
+		restoreCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), wanRenewRestoreGrace)
+		defer cancel()
+		if _, rerr := client.PostSetAPN(restoreCtx, original); rerr != nil {
+			s.logger.Printf("wan renew: restoring APN %s failed: %v", original, rerr)
+			return
+		}
+		s.rememberAPN(original)
+		s.wanRenew.progress(job, "restoring", fmt.Sprintf("restored APN %s after error", original))
+	}()
+
+	if err := sleepContext(ctx, wanRenewSwitchDelay); err != nil {
+		return "", err
+	}
+	s.wanRenew.progress(job, "waiting", fmt.Sprintf("waiting for the link on %s", temp))
+	if _, err := s.waitWanLink(ctx, timeout); err != nil {
+		return "", fmt.Errorf("link on %s: %w", temp, err)
+	}
+
+	s.wanRenew.progress(job, "restoring", fmt.Sprintf("restoring APN %s", original))
+	if _, err := client.PostSetAPN(ctx, original); err != nil {
+		return "", fmt.Errorf("restore %s: %w", original, err)
+	}
+	restored = true
+	s.rememberAPN(original)
+
+	if err := sleepContext(ctx, wanRenewSwitchDelay); err != nil {
+		return "", err
+	}
+	s.wanRenew.progress(job, "waiting", fmt.Sprintf("waiting for the link on %s", original))
+	ip, err = s.waitWanLink(ctx, timeout)
+	if err != nil {
+		return "", fmt.Errorf("link on %s: %w", original, err)
+	}
+	return ip, nil
+}
+
+// readRouterAPN returns the APN the modem is configured with, bypassing the
+// cache, and remembers it as the current one.
+func (s *Server) readRouterAPN(ctx context.Context) (string, error) {
+	status, err := s.getClient().CellularStatus(router.WithFresh(ctx))
+	if err != nil {
+		return "", err
+	}
+	apn := status.CurrentAPN()
+	if apn == "" {
+		return "", errors.New("the router reports no APN")
+	}
+	s.rememberAPN(apn)
+	return apn, nil
+}
+
+// readExternalIP returns the current external IP, bypassing the cache and
+// retrying for up to wanRenewIPReadTimeout.
+func (s *Server) readExternalIP(ctx context.Context) (string, error) {
+	readCtx, cancel := context.WithTimeout(ctx, wanRenewIPReadTimeout)
+	defer cancel()
+	for {
+		wan, err := s.getClient().WanStatus(router.WithFresh(readCtx))
+		if err == nil {
+			if ip := wan.ExternalIP(); ip != "" {
+				return ip, nil
+			}
+			err = errors.New("the router reports no external IP")
+		}
+		if serr := sleepContext(readCtx, wanRenewPollInterval); serr != nil {
+			return "", err
+		}
+	}
+}
+
+// waitWanLink polls the WAN status until the primary connection is up with
+// an external address. Errors while the modem re-attaches are expected and
+// only reported if the link never comes back.
+func (s *Server) waitWanLink(ctx context.Context, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	var lastErr error
+	for {
+		// A cached status would hide the link coming back.
+		wan, err := s.getClient().WanStatus(router.WithFresh(ctx))
+		if err == nil {
+			if primary := wan.Primary(); primary.Connected() && wan.ExternalIP() != "" {
+				return wan.ExternalIP(), nil
+			}
+		} else {
+			lastErr = err
+		}
+		if time.Now().After(deadline) {
+			if lastErr != nil {
+				return "", fmt.Errorf("not connected after %s: %w", timeout, lastErr)
+			}
+			return "", fmt.Errorf("not connected after %s", timeout)
+		}
+		if err := sleepContext(ctx, wanRenewPollInterval); err != nil {
+			return "", err
+		}
+	}
+}
+
+func (s *Server) handleWanRenew(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"jobs": s.wanRenew.list()})
+	case http.MethodPost:
+		job, _, started := s.startWanRenew("api")
+		status := http.StatusAccepted
+		if !started {
+			status = http.StatusOK
+		}
+		writeJSON(w, status, job)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleWanRenewJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	job, ok := s.wanRenew.get(r.PathValue("job"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "job not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func valueOr(value, fallback string) string {
+	if strings.TrimSpace(value) == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWanRenewJobRestoresAPN(t *testing.T) {
+	srv, emu, httpSrv := newTestServer(t)
+
+	resp, err := http.Post(httpSrv.URL+"/api/wan/renew", "application/json", nil)
+	if err != nil {
+		t.Fatalf("post wan renew: %v", err)
+	}
+	var started wanRenewJob
+	if err := json.NewDecoder(resp.Body).Decode(&started); err != nil {
+		t.Fatalf("decode job: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted || started.ID == "" || started.Status != wanRenewRunning {
+		t.Fatalf("unexpected start response %d: %+v", resp.StatusCode, started)
+	}
+
+	// A second trigger joins the running job instead of starting another.
+	joined, done, ok := srv.startWanRenew("mqtt")
+	if ok || joined.ID != started.ID {
+		t.Fatalf("expected to join job %s, got %s (started=%v)", started.ID, joined.ID, ok)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(20 * time.Second):
+		t.Fatalf("job did not finish")
+	}
+
+	var job wanRenewJob
+	if status := getJSON(t, httpSrv.URL+"/api/wan/renew/"+started.ID, &job); status != http.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+	if job.Status != wanRenewSucceeded || job.OldIP != "10.20.30.40" || job.NewIP == "" || job.NewIP == job.OldIP {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+	if job.OriginalAPN != "xlunlimited" || emu.APN() != job.OriginalAPN {
+		t.Fatalf("expected the router's APN xlunlimited to be restored, got %s (job %s)", emu.APN(), job.OriginalAPN)
+	}
+	if len(job.Events) == 0 || job.FinishedAt == nil {
+		t.Fatalf("expected progress events and finish time: %+v", job)
+	}
+
+	if status := getJSON(t, httpSrv.URL+"/api/wan/renew/nope", nil); status != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown job, got %d", status)
+	}
+}
+
+func TestWanRenewRestoresAPNAfterFailure(t *testing.T) {
+	srv, emu, _ := newTestServer(t)
+
+	cfg := srv.getConfig()
+	cfg.WanRenew.TimeoutSeconds = 1
+	cfg.WanRenew.MaxAttempts = 1
+	srv.setConfig(cfg)
+
+	job, done, _ := srv.startWanRenew("test")
+	// Take the link down once the temporary APN is set.
+	for emu.Calls("service_function_web_app.cgi") == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	emu.FailNext("show_wan_status_web_app.cgi", 1000)
+	<-done
+
+	final, _ := srv.wanRenew.get(job.ID)
+	if final.Status != wanRenewFailed || final.Error == "" {
+		t.Fatalf("expected failure, got %+v", final)
+	}
+	if emu.APN() != final.OriginalAPN {
+		t.Fatalf("expected APN %s to be restored, got %s", final.OriginalAPN, emu.APN())
+	}
+}
+
+func TestWanRenewRefusesWithoutKnownAPN(t *testing.T) {
+	srv, emu, _ := newTestServer(t)
+	emu.FailNext("status_get_web_app.cgi", 1000)
+
+	job, done, _ := srv.startWanRenew("test")
+	<-done
+
+	final, _ := srv.wanRenew.get(job.ID)
+	if final.Status != wanRenewFailed || !strings.Contains(final.Error, "read current APN") {
+		t.Fatalf("expected the renewal to be refused, got %+v", final)
+	}
+	if emu.APN() != "xlunlimited" || emu.Calls("service_function_web_app.cgi") != 0 {
+		t.Fatalf("expected the APN to stay untouched, got %s", emu.APN())
+	}
+}
+
+func TestWanRenewRetriesReadingTheOldIP(t *testing.T) {
+	srv, emu, _ := newTestServer(t)
+	emu.FailNext("show_wan_status_web_app.cgi", 1)
+
+	job, done, _ := srv.startWanRenew("test")
+	<-done
+
+	final, _ := srv.wanRenew.get(job.ID)
+	if final.Status != wanRenewSucceeded || final.OldIP != "10.20.30.40" || final.NewIP == final.OldIP {
+		t.Fatalf("expected the old IP to be read on retry, got %+v", final)
+	}
+}
+
+func TestWanRenewRefusesWithoutKnownIP(t *testing.T) {
+	srv, emu, _ := newTestServer(t)
+	emu.FailNext("show_wan_status_web_app.cgi", 1000)
+
+	job, done, _ := srv.startWanRenew("test")
+	<-done
+
+	final, _ := srv.wanRenew.get(job.ID)
+	if final.Status != wanRenewFailed || !strings.Contains(final.Error, "read current external IP") {
+		t.Fatalf("expected the renewal to fail without the old IP, got %+v", final)
+	}
+	if emu.APN() != "xlunlimited" || emu.Calls("service_function_web_app.cgi") != 0 {
+		t.Fatalf("expected the APN to stay untouched, got %s", emu.APN())
+	}
+}
@@ -0,0 +1,462 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"nokia_modem/internal/config"
+	"nokia_modem/internal/router"
+	"nokia_modem/internal/settings"
+)
+
+var watchdogCheckTypes = []string{"http", "tcp", "dns"}
+
+// Kinds of watchdog history entries.
+const (
+	watchdogFailing   = "failing"
+	watchdogAPN       = "apn"
+	watchdogReboot    = "reboot"
+	watchdogRebootCap = "reboot_cap"
+	watchdogRecovered = "recovered"
+)
+
+const (
+	maxWatchdogHistory = 100
+	// maxWatchdogBackoff caps the doubling wait between recovery steps.
+	maxWatchdogBackoff = 6 * time.Hour
+)
+
+// watchdogResult is the outcome of one check in the latest round.
+type watchdogResult struct {
+	Type      string `json:"type"`
+	Target    string `json:"target"`
+	OK        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+// watchdogProbe keeps the latest round for /api/watchdog; the outage state
+// itself lives in settings.json.
+type watchdogProbe struct {
+	mu      sync.Mutex
+	results []watchdogResult
+	at      time.Time
+}
+
+// configureWatchdog runs the checks while the watchdog is enabled. Only an
+// interval change restarts the loop; the rest is read every round.
+func (s *Server) configureWatchdog(cfg config.Config) {
+	var (
+		start bool
+		stop  context.CancelFunc
+		ctx   context.Context
+	)
+	enabled := cfg.Watchdog.Enabled && len(cfg.Watchdog.Checks) > 0
+
+	s.watchdogMu.Lock()
+	running := s.watchdogCancel != nil
+	changed := s.watchdogInterval != watchdogInterval(cfg.Watchdog)
+
+	if running && (changed || !enabled) {
+		stop = s.watchdogCancel
+		s.watchdogCancel = nil
+		running = false
+	}
+	if enabled && !running {
+		ctx, s.watchdogCancel = context.WithCancel(context.Background())
+		s.watchdogWG.Add(1)
+		start = true
+	}
+	s.watchdogInterval = watchdogInterval(cfg.Watchdog)
+	s.watchdogMu.Unlock()
+
+	if stop != nil {
+		stop()
+		s.watchdogWG.Wait()
+		s.logger.Printf("watchdog: stopped")
+	}
+
+	if start {
+		interval := watchdogInterval(cfg.Watchdog)
+		go s.runWatchdog(ctx, interval)
+		s.logger.Printf("watchdog: started (%d checks, interval %s)", len(cfg.Watchdog.Checks), interval)
+	}
+}
+
+func watchdogInterval(cfg config.WatchdogConfig) time.Duration {
+	seconds := cfg.IntervalSeconds
+	if seconds < 10 {
+		seconds = 60
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func (s *Server) runWatchdog(ctx context.Context, interval time.Duration) {
+	defer s.watchdogWG.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runWatchdogRound(ctx, time.Now())
+		}
+	}
+}
+
+// runWatchdogRound probes once and, while the link stays down, takes the
+// next recovery step that is due. Rounds during a WAN IP renewal are not
+// counted, since the APN switch takes the link down on purpose.
+func (s *Server) runWatchdogRound(ctx context.Context, now time.Time) {
+	cfg := s.getConfig()
+	wcfg := cfg.Watchdog
+
+	results := s.probeConnectivity(ctx, wcfg.Checks)
+	if ctx.Err() != nil {
+		return
+	}
+	s.watchdog.mu.Lock()
+	s.watchdog.results = results
+	s.watchdog.at = now
+	s.watchdog.mu.Unlock()
+
+	if s.wanRenew.running() {
+		return
+	}
+	online := slices.ContainsFunc(results, func(r watchdogResult) bool { return r.OK })
+
+	state := s.store.Get().Watchdog
+	before := fmt.Sprintf("%d|%d|%v|%d", state.Failures, state.Step, state.NextActionAt, len(state.Reboots))
+	var events []settings.WatchdogEvent
+
+	if online {
+		if state.Failures >= wcfg.FailureThreshold {
+			events = append(events, settings.WatchdogEvent{
+				At:      now.UTC(),
+				Kind:    watchdogRecovered,
+				Message: fmt.Sprintf("connectivity restored after %d failed rounds and %d recovery actions", state.Failures, state.Step),
+			})
+		}
+		state.Failures, state.Step, state.NextActionAt = 0, 0, time.Time{}
+	} else {
+		state.Failures++
+		if state.Failures == wcfg.FailureThreshold {
+			events = append(events, settings.WatchdogEvent{
+				At:      now.UTC(),
+				Kind:    watchdogFailing,
+				Message: fmt.Sprintf("%d failed rounds in a row: %s", state.Failures, describeWatchdogFailures(results)),
+			})
+		}
+		if state.Failures >= wcfg.FailureThreshold && !now.Before(state.NextActionAt) {
+			events = append(events, s.watchdogRecover(ctx, cfg, &state, now))
+		}
+	}
+
+	state.Reboots = slices.DeleteFunc(state.Reboots, func(at time.Time) bool {
+		return now.Sub(at) >= 24*time.Hour
+	})
+	after := fmt.Sprintf("%d|%d|%v|%d", state.Failures, state.Step, state.NextActionAt, len(state.Reboots))
+	if len(events) == 0 && after == before {
+		return
+	}
+
+	state.History = append(state.History, events...)
+	if extra := len(state.History) - maxWatchdogHistory; extra > 0 {
+		state.History = slices.Clone(state.History[extra:])
+	}
+	err := s.store.Update(func(data *settings.Settings) error {
+		data.Watchdog = state
+		return nil
+	})
+	if err != nil {
+		s.logger.Printf("watchdog: persist state failed: %v", err)
+	}
+
+	for _, event := range events {
+		s.logger.Printf("watchdog: %s: %s", event.Kind, valueOr(event.Error, event.Message))
+		s.announceWatchdogEvent(ctx, cfg, event)
+	}
+}
+
+// watchdogRecover takes the next recovery step: the APN first, reboots
+// after that. Each step, failed or not, doubles the wait before the next
+// one, so a dead router is not hammered.
+func (s *Server) watchdogRecover(ctx context.Context, cfg config.Config, state *settings.WatchdogState, now time.Time) settings.WatchdogEvent {
+	wcfg := cfg.Watchdog
+	event := settings.WatchdogEvent{At: now.UTC()}
+	actionCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	apn := wcfg.APN
+	if apn == "" && state.Step == 0 {
+		// Re-apply what the router has; without an APN the step is skipped.
+		routerAPN, err := s.readRouterAPN(actionCtx)
+		if err != nil {
+			s.logger.Printf("watchdog: read APN from router failed: %v", err)
+		}
+		apn = routerAPN
+	}
+
+	switch {
+	case state.Step == 0 && apn != "":
+		event.Kind = watchdogAPN
+		event.Message = fmt.Sprintf("re-applied APN %s", apn)
+		if _, err := s.getClient().PostSetAPN(actionCtx, apn); err != nil {
+			event.Error = fmt.Sprintf("re-apply APN %s: %v", apn, err)
+		} else {
+			s.rememberAPN(apn)
+		}
+	case wcfg.MaxRebootsPerDay == 0:
+		// Reboots are disabled; report it once a day while still offline.
+		state.NextActionAt = now.Add(24 * time.Hour).UTC()
+		return settings.WatchdogEvent{
+			At:      now.UTC(),
+			Kind:    watchdogRebootCap,
+			Message: "reboot skipped: reboots are disabled (max_reboots_per_day is 0)",
+		}
+	default:
+		recent := slices.DeleteFunc(slices.Clone(state.Reboots), func(at time.Time) bool {
+			return now.Sub(at) >= 24*time.Hour
+		})
+		if len(recent) > 0 && len(recent) >= wcfg.MaxRebootsPerDay {
+			// Wait until the oldest reboot leaves the 24 hour window.
+			oldest := slices.MinFunc(recent, func(a, b time.Time) int { return a.Compare(b) })
+			state.NextActionAt = oldest.Add(24 * time.Hour)
+			return settings.WatchdogEvent{
+				At:      now.UTC(),
+				Kind:    watchdogRebootCap,
+				Message: fmt.Sprintf("reboot skipped: %d reboots in the last 24 hours, next possible at %s", len(recent), state.NextActionAt.Local().Format("2006-01-02 15:04")),
+			}
+		}
+		event.Kind = watchdogReboot
+		event.Message = "rebooted the router"
+		if _, err := s.getClient().Reboot(actionCtx); err != nil {
+			event.Error = fmt.Sprintf("reboot: %v", err)
+		}
+		state.Reboots = append(state.Reboots, now.UTC())
+	}
+
+	state.Step++
+	backoff := time.Duration(wcfg.BackoffMinutes) * time.Minute << (state.Step - 1)
+	if backoff <= 0 || backoff > maxWatchdogBackoff {
+		backoff = maxWatchdogBackoff
+	}
+	state.NextActionAt = now.Add(backoff).UTC()
+	return event
+}
+
+func describeWatchdogFailures(results []watchdogResult) string {
+	parts := make([]string, 0, len(results))
+	for _, r := range results {
+		parts = append(parts, fmt.Sprintf("%s %s: %s", r.Type, r.Target, r.Error))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// announceWatchdogEvent sends event to the notifiers that take alerts. MQTT
+// publishes the event itself to <topic_base>/watchdog.
+func (s *Server) announceWatchdogEvent(ctx context.Context, cfg config.Config, event settings.WatchdogEvent) {
+	notification := newAlertNotification("watchdog", "Watchdog: "+event.Kind, valueOr(event.Error, event.Message), event.At)
+	notification.Topic, notification.Details = "watchdog", event
+	s.notifyAlert(ctx, cfg, notification)
+}
+
+// probeConnectivity runs every check concurrently.
+func (s *Server) probeConnectivity(ctx context.Context, checks []config.WatchdogCheck) []watchdogResult {
+	results := make([]watchdogResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			timeout := time.Duration(check.TimeoutSeconds) * time.Second
+			if timeout <= 0 {
+				timeout = 5 * time.Second
+			}
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			started := time.Now()
+			err := s.runWatchdogCheck(checkCtx, check)
+			results[i] = watchdogResult{
+				Type:      check.Type,
+				Target:    check.Target,
+				OK:        err == nil,
+				LatencyMs: time.Since(started).Milliseconds(),
+			}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (s *Server) runWatchdogCheck(ctx context.Context, check config.WatchdogCheck) error {
+	switch check.Type {
+	case "http":
+		// A fresh connection every time: a pooled one says nothing about
+		// the link right now.
+		client := &http.Client{
+			Transport:     &http.Transport{DisableKeepAlives: true},
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, check.Target, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("status %s", resp.Status)
+		}
+		return nil
+	case "tcp":
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", check.Target)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case "dns":
+		return s.resolveThroughWan(ctx, check.Target)
+	}
+	return fmt.Errorf("unknown check type %q", check.Type)
+}
+
+// resolveThroughWan looks host up at each DNS server the router reports for
+// the WAN, so the check fails when the carrier's resolvers are unreachable
+// even if a LAN resolver still answers from its cache.
+func (s *Server) resolveThroughWan(ctx context.Context, host string) error {
+	wan, err := s.getClient().WanStatus(router.WithFresh(ctx))
+	if err != nil {
+		return fmt.Errorf("wan status: %w", err)
+	}
+	servers := wan.Primary().DNSServerList()
+	if len(servers) == 0 {
+		return errors.New("the router reports no WAN DNS servers")
+	}
+
+	var lastErr error
+	for _, server := range servers {
+		resolver := &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, net.JoinHostPort(server, "53"))
+			},
+		}
+		if _, err := resolver.LookupHost(ctx, host); err != nil {
+			lastErr = fmt.Errorf("%s: %w", server, err)
+			continue
+		}
+		return nil
+	}
+	return lastErr
+}
+
+func normalizeWatchdog(cfg config.WatchdogConfig) config.WatchdogConfig {
+	cfg.APN = strings.TrimSpace(cfg.APN)
+	checks := make([]config.WatchdogCheck, 0, len(cfg.Checks))
+	for _, check := range cfg.Checks {
+		check.Type = strings.ToLower(strings.TrimSpace(check.Type))
+		check.Target = strings.TrimSpace(check.Target)
+		checks = append(checks, check)
+	}
+	cfg.Checks = checks
+	return cfg
+}
+
+func validateWatchdog(cfg config.WatchdogConfig) error {
+	if cfg.Enabled && len(cfg.Checks) == 0 {
+		return errors.New("watchdog.checks needs at least one check when the watchdog is enabled")
+	}
+	if cfg.FailureThreshold < 1 || cfg.FailureThreshold > 100 {
+		return errors.New("watchdog.failure_threshold must be between 1 and 100")
+	}
+	if cfg.BackoffMinutes < 1 || cfg.BackoffMinutes > 1440 {
+		return errors.New("watchdog.backoff_minutes must be between 1 and 1440")
+	}
+	if cfg.MaxRebootsPerDay < 0 || cfg.MaxRebootsPerDay > 24 {
+		return errors.New("watchdog.max_reboots_per_day must be between 0 and 24")
+	}
+	for _, check := range cfg.Checks {
+		if !slices.Contains(watchdogCheckTypes, check.Type) {
+			return fmt.Errorf("watchdog.checks: type must be one of %s", strings.Join(watchdogCheckTypes, ", "))
+		}
+		if check.TimeoutSeconds < 0 || check.TimeoutSeconds > 60 {
+			return fmt.Errorf("watchdog.checks %s: timeout_seconds must be between 0 and 60", check.Target)
+		}
+		switch check.Type {
+		case "http":
+			parsed, err := url.ParseRequestURI(check.Target)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+				return fmt.Errorf("watchdog.checks: %q is not an http(s) URL", check.Target)
+			}
+		case "tcp":
+			if _, _, err := net.SplitHostPort(check.Target); err != nil {
+				return fmt.Errorf("watchdog.checks: %q is not host:port", check.Target)
+			}
+		case "dns":
+			if check.Target == "" || strings.ContainsAny(check.Target, " /:") {
+				return fmt.Errorf("watchdog.checks: %q is not a host name", check.Target)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) handleWatchdog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg := s.getConfig().Watchdog
+	state := s.store.Get().Watchdog
+
+	s.watchdog.mu.Lock()
+	results := slices.Clone(s.watchdog.results)
+	checkedAt := s.watchdog.at
+	s.watchdog.mu.Unlock()
+	if results == nil {
+		results = []watchdogResult{}
+	}
+
+	history := slices.Clone(state.History)
+	slices.Reverse(history)
+	if history == nil {
+		history = []settings.WatchdogEvent{}
+	}
+
+	payload := map[string]interface{}{
+		"enabled":             cfg.Enabled,
+		"failures":            state.Failures,
+		"failure_threshold":   cfg.FailureThreshold,
+		"step":                state.Step,
+		"reboots_24h":         len(state.Reboots),
+		"max_reboots_per_day": cfg.MaxRebootsPerDay,
+		"checks":              results,
+		"history":             history,
+	}
+	if !state.NextActionAt.IsZero() {
+		payload["next_action_at"] = state.NextActionAt.Format(time.RFC3339)
+	}
+	if !checkedAt.IsZero() {
+		payload["checked_at"] = checkedAt.UTC().Format(time.RFC3339)
+	}
+	writeJSON(w, http.StatusOK, payload)
+}
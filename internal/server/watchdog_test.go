@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nokia_modem/internal/config"
+	"nokia_modem/internal/router"
+	"nokia_modem/internal/settings"
+)
+
+func TestWatchdogEscalatesAndRecovers(t *testing.T) {
+	srv, emu, httpSrv := newTestServer(t)
+
+	online := true
+	probe := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !online {
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(probe.Close)
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	cfg := srv.getConfig()
+	cfg.RouterCache.Enabled = false
+	cfg.Watchdog = config.WatchdogConfig{
+		FailureThreshold: 2,
+		BackoffMinutes:   5,
+		MaxRebootsPerDay: 1,
+		APN:              "internet.test",
+		Checks: []config.WatchdogCheck{
+			{Type: "http", Target: probe.URL, TimeoutSeconds: 2},
+			{Type: "tcp", Target: closedAddr, TimeoutSeconds: 2},
+		},
+	}
+	srv.setConfig(cfg)
+	srv.setClient(router.NewClient(cfg))
+
+	ctx := context.Background()
+	start := time.Now()
+	round := func(minute int) settings.WatchdogState {
+		srv.runWatchdogRound(ctx, start.Add(time.Duration(minute)*time.Minute))
+		return srv.store.Get().Watchdog
+	}
+
+	if state := round(0); state.Failures != 0 || len(state.History) != 0 {
+		t.Fatalf("one passing check must count as online: %+v", state)
+	}
+
+	online = false
+	if state := round(1); state.Failures != 1 || emu.APN() == "internet.test" {
+		t.Fatalf("acted before the threshold: %+v", state)
+	}
+	state := round(2)
+	if emu.APN() != "internet.test" || state.Step != 1 || len(state.History) != 2 || state.History[1].Kind != watchdogAPN {
+		t.Fatalf("expected the APN to be re-applied: apn=%q %+v", emu.APN(), state)
+	}
+
+	// Inside the 5 minute backoff nothing happens.
+	round(4)
+	if emu.Reboots() != 0 {
+		t.Fatalf("rebooted inside the backoff")
+	}
+	state = round(7)
+	if emu.Reboots() != 1 || state.Step != 2 || state.History[len(state.History)-1].Kind != watchdogReboot {
+		t.Fatalf("expected a reboot after the backoff: %+v", state)
+	}
+
+	// The daily cap holds the next reboot back once, then stays quiet.
+	state = round(18)
+	if emu.Reboots() != 1 || state.History[len(state.History)-1].Kind != watchdogRebootCap {
+		t.Fatalf("expected the reboot cap to apply: %+v", state)
+	}
+	if !state.NextActionAt.Equal(start.Add(7*time.Minute + 24*time.Hour).UTC()) {
+		t.Fatalf("next action at %v, want 24h after the reboot", state.NextActionAt)
+	}
+	if before := len(state.History); len(round(30).History) != before {
+		t.Fatalf("the cap must not be reported every round")
+	}
+
+	online = true
+	state = round(31)
+	if state.Failures != 0 || state.Step != 0 || state.History[len(state.History)-1].Kind != watchdogRecovered {
+		t.Fatalf("expected recovery: %+v", state)
+	}
+
+	var payload struct {
+		Failures   int                      `json:"failures"`
+		Reboots24h int                      `json:"reboots_24h"`
+		Checks     []watchdogResult         `json:"checks"`
+		History    []settings.WatchdogEvent `json:"history"`
+	}
+	getJSON(t, httpSrv.URL+"/api/watchdog", &payload)
+	if payload.Reboots24h != 1 || len(payload.Checks) != 2 || !payload.Checks[0].OK || payload.Checks[1].OK {
+		t.Fatalf("unexpected watchdog status: %+v", payload)
+	}
+	if len(payload.History) != 5 || payload.History[0].Kind != watchdogRecovered || !strings.Contains(payload.History[4].Message, "failed rounds") {
+		t.Fatalf("unexpected history: %+v", payload.History)
+	}
+
+	for _, bad := range []config.WatchdogCheck{
+		{Type: "icmp", Target: "1.1.1.1"},
+		{Type: "http", Target: "ftp://example.com"},
+		{Type: "tcp", Target: "1.1.1.1"},
+		{Type: "dns", Target: ""},
+	} {
+		wcfg := cfg.Watchdog
+		wcfg.Checks = []config.WatchdogCheck{bad}
+		if err := validateWatchdog(wcfg); err == nil {
+			t.Fatalf("expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestWatchdogWithRebootsDisabled(t *testing.T) {
+	srv, emu, _ := newTestServer(t)
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	cfg := srv.getConfig()
+	cfg.RouterCache.Enabled = false
+	cfg.Watchdog = config.WatchdogConfig{
+		FailureThreshold: 1,
+		BackoffMinutes:   5,
+		MaxRebootsPerDay: 0,
+		Checks:           []config.WatchdogCheck{{Type: "tcp", Target: closedAddr, TimeoutSeconds: 2}},
+	}
+	srv.setConfig(cfg)
+	srv.setClient(router.NewClient(cfg))
+
+	ctx := context.Background()
+	start := time.Now()
+	round := func(minute int) settings.WatchdogState {
+		srv.runWatchdogRound(ctx, start.Add(time.Duration(minute)*time.Minute))
+		return srv.store.Get().Watchdog
+	}
+
+	// Without watchdog.apn the APN the router reports is re-applied.
+	state := round(0)
+	if last := state.History[len(state.History)-1]; last.Kind != watchdogAPN || last.Message != "re-applied APN xlunlimited" {
+		t.Fatalf("expected the router's APN to be re-applied: %+v", state)
+	}
+
+	// The reboot step must neither panic on the empty reboot list nor reboot.
+	state = round(10)
+	if emu.Reboots() != 0 || state.History[len(state.History)-1].Kind != watchdogRebootCap {
+		t.Fatalf("expected the reboot to be skipped: %+v", state)
+	}
+	if before := len(state.History); len(round(20).History) != before {
+		t.Fatalf("disabled reboots must not be reported every round")
+	}
+}
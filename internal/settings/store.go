@@ -6,8 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -34,17 +36,115 @@ type ResetTracker struct {
 	Active     bool  `json:"active"`
 }
 
+// QuotaAlertState remembers which thresholds of a data package already
+// notified in the cycle that started on CycleStart.
+type QuotaAlertState struct {
+	CycleStart string `json:"cycle_start"`
+	Notified   []int  `json:"notified"`
+}
+
+// SmsRuleHits counts the messages an SMS rule matched.
+type SmsRuleHits struct {
+	Count   int64     `json:"count"`
+	LastHit time.Time `json:"last_hit"`
+}
+
+// AlertRuleState is where an alert rule stands. Since is when its
+// condition started to hold; Notified tells whether the current firing was
+// announced, so its resolution is announced too.
+type AlertRuleState struct {
+	Status       string    `json:"status"`
+	Since        time.Time `json:"since,omitzero"`
+	FiredAt      time.Time `json:"fired_at,omitzero"`
+	ResolvedAt   time.Time `json:"resolved_at,omitzero"`
+	LastNotified time.Time `json:"last_notified,omitzero"`
+	Notified     bool      `json:"notified,omitempty"`
+}
+
+// AlertEvent is one entry of the alert history.
+type AlertEvent struct {
+	Rule     string    `json:"rule"`
+	Metric   string    `json:"metric"`
+	Status   string    `json:"status"`
+	Message  string    `json:"message"`
+	At       time.Time `json:"at"`
+	Notified bool      `json:"notified"`
+}
+
+// AlertsState is what the alerting engine keeps across restarts: the rule
+// states, the recent history and the baselines the event rules compare
+// against. KnownDevices maps LAN MAC addresses to the name first seen.
+type AlertsState struct {
+	Rules        map[string]AlertRuleState `json:"rules,omitempty"`
+	History      []AlertEvent              `json:"history,omitempty"`
+	WanIP        string                    `json:"wan_ip,omitempty"`
+	KnownDevices map[string]string         `json:"known_devices,omitempty"`
+}
+
+// WatchdogEvent is one entry of the watchdog history.
+type WatchdogEvent struct {
+	At      time.Time `json:"at"`
+	Kind    string    `json:"kind"`
+	Message string    `json:"message"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// WatchdogState is the connectivity watchdog's progress through an outage.
+// Step counts the recovery actions taken so far and Reboots holds the
+// reboots of the last 24 hours for the daily cap.
+type WatchdogState struct {
+	Failures     int             `json:"failures"`
+	Step         int             `json:"step"`
+	NextActionAt time.Time       `json:"next_action_at,omitzero"`
+	Reboots      []time.Time     `json:"reboots,omitempty"`
+	History      []WatchdogEvent `json:"history,omitempty"`
+}
+
+// ScheduleRun is the outcome of a schedule's latest run.
+type ScheduleRun struct {
+	At         time.Time `json:"at"`
+	DurationMs int64     `json:"duration_ms"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// QueuedAlert is an alert notification that some notifiers still have to
+// deliver. Pending names them, as Pending does for SMS in sms.json.
+type QueuedAlert struct {
+	ID    string    `json:"id"`
+	Kind  string    `json:"kind"`
+	Title string    `json:"title"`
+	Text  string    `json:"text"`
+	At    time.Time `json:"at"`
+	Topic string    `json:"topic,omitempty"`
+	// Details is the MQTT payload, kept encoded.
+	Details json.RawMessage `json:"details,omitempty"`
+	Pending []string        `json:"pending"`
+}
+
+// Settings is the persisted state. Usage is recorded at every granularity
+// at once, keyed in local time by HourLayout, DayLayout and MonthLayout, and
+// each granularity is pruned on its own by the store's Retention.
 type Settings struct {
-	DataExpired  int64                 `json:"data_expired"`
-	DailyUsage   map[string]UsageStats `json:"daily_usage"`
-	LastStats    LastStats             `json:"last_stats"`
-	PendingReset ResetTracker          `json:"pending_reset"`
+	DataExpired  int64                      `json:"data_expired"`
+	HourlyUsage  map[string]UsageStats      `json:"hourly_usage"`
+	DailyUsage   map[string]UsageStats      `json:"daily_usage"`
+	MonthlyUsage map[string]UsageStats      `json:"monthly_usage"`
+	LastStats    LastStats                  `json:"last_stats"`
+	PendingReset ResetTracker               `json:"pending_reset"`
+	QuotaAlerts  map[string]QuotaAlertState `json:"quota_alerts,omitempty"`
+	SmsRuleHits  map[string]SmsRuleHits     `json:"sms_rule_hits,omitempty"`
+	Alerts       AlertsState                `json:"alerts,omitzero"`
+	Watchdog     WatchdogState              `json:"watchdog,omitzero"`
+	ScheduleRuns map[string]ScheduleRun     `json:"schedule_runs,omitempty"`
+	AlertQueue   []QueuedAlert              `json:"alert_queue,omitempty"`
 }
 
 type Store struct {
-	path string
-	mu   sync.Mutex
-	data Settings
+	path      string
+	mu        sync.Mutex
+	data      Settings
+	retention Retention
 }
 
 func NewStore(path string) (*Store, error) {
@@ -66,8 +166,10 @@ func NewStore(path string) (*Store, error) {
 
 func defaultSettings() Settings {
 	return Settings{
-		DataExpired: 0,
-		DailyUsage:  map[string]UsageStats{},
+		DataExpired:  0,
+		HourlyUsage:  map[string]UsageStats{},
+		DailyUsage:   map[string]UsageStats{},
+		MonthlyUsage: map[string]UsageStats{},
 		LastStats: LastStats{
 			Upload:   0,
 			Download: 0,
@@ -95,9 +197,16 @@ func (s *Store) load() error {
 		return err
 	}
 
+	if settingsData.HourlyUsage == nil {
+		settingsData.HourlyUsage = map[string]UsageStats{}
+	}
 	if settingsData.DailyUsage == nil {
 		settingsData.DailyUsage = map[string]UsageStats{}
 	}
+	if settingsData.MonthlyUsage == nil {
+		// Files written before monthly totals existed only have days.
+		settingsData.MonthlyUsage = monthlyFromDaily(settingsData.DailyUsage)
+	}
 	s.data = settingsData
 	return nil
 }
@@ -158,15 +267,47 @@ func (s *Store) Get() Settings {
 }
 
 func copySettings(src Settings) Settings {
-	copyUsage := make(map[string]UsageStats, len(src.DailyUsage))
-	for k, v := range src.DailyUsage {
-		copyUsage[k] = v
+	var copyAlerts map[string]QuotaAlertState
+	if src.QuotaAlerts != nil {
+		copyAlerts = make(map[string]QuotaAlertState, len(src.QuotaAlerts))
+		for k, v := range src.QuotaAlerts {
+			v.Notified = slices.Clone(v.Notified)
+			copyAlerts[k] = v
+		}
+	}
+	var copyQueue []QueuedAlert
+	if src.AlertQueue != nil {
+		copyQueue = make([]QueuedAlert, 0, len(src.AlertQueue))
+		for _, alert := range src.AlertQueue {
+			alert.Pending = slices.Clone(alert.Pending)
+			alert.Details = slices.Clone(alert.Details)
+			copyQueue = append(copyQueue, alert)
+		}
 	}
 	return Settings{
 		DataExpired:  src.DataExpired,
-		DailyUsage:   copyUsage,
+		HourlyUsage:  maps.Clone(src.HourlyUsage),
+		DailyUsage:   maps.Clone(src.DailyUsage),
+		MonthlyUsage: maps.Clone(src.MonthlyUsage),
 		LastStats:    src.LastStats,
 		PendingReset: src.PendingReset,
+		QuotaAlerts:  copyAlerts,
+		SmsRuleHits:  maps.Clone(src.SmsRuleHits),
+		ScheduleRuns: maps.Clone(src.ScheduleRuns),
+		AlertQueue:   copyQueue,
+		Alerts: AlertsState{
+			Rules:        maps.Clone(src.Alerts.Rules),
+			History:      slices.Clone(src.Alerts.History),
+			WanIP:        src.Alerts.WanIP,
+			KnownDevices: maps.Clone(src.Alerts.KnownDevices),
+		},
+		Watchdog: WatchdogState{
+			Failures:     src.Watchdog.Failures,
+			Step:         src.Watchdog.Step,
+			NextActionAt: src.Watchdog.NextActionAt,
+			Reboots:      slices.Clone(src.Watchdog.Reboots),
+			History:      slices.Clone(src.Watchdog.History),
+		},
 	}
 }
 
@@ -199,7 +340,6 @@ func (s *Store) UpdateUsageFromStatus(status map[string]interface{}) error {
 		currentDownload := toInt64(statEntry["BytesReceived"])
 		currentTotal := currentUpload + currentDownload
 		now := time.Now()
-		currentDate := now.Format("2006-01-02")
 
 		lastUpload := settings.LastStats.Upload
 		lastDownload := settings.LastStats.Download
@@ -273,23 +413,9 @@ func (s *Store) UpdateUsageFromStatus(status map[string]interface{}) error {
 		if downloadDiff < 0 {
 			downloadDiff = 0
 		}
-		totalDiff := uploadDiff + downloadDiff
-
-		if settings.DailyUsage == nil {
-			settings.DailyUsage = make(map[string]UsageStats)
-		}
 
-		dayUsage := settings.DailyUsage[currentDate]
-		if uploadDiff > 0 {
-			dayUsage.Upload += uploadDiff
-		}
-		if downloadDiff > 0 {
-			dayUsage.Download += downloadDiff
-		}
-		if totalDiff > 0 {
-			dayUsage.Total += totalDiff
-		}
-		settings.DailyUsage[currentDate] = dayUsage
+		addUsage(settings, now, uploadDiff, downloadDiff)
+		s.retention.apply(settings, now)
 
 		settings.LastStats = LastStats{
 			Upload:   currentUpload,
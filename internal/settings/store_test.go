@@ -117,6 +117,56 @@ func TestNewStoreRecoversFromEmptyFile(t *testing.T) {
 	}
 }
 
+func TestUsageRetentionKeepsCoarserBuckets(t *testing.T) {
+	var data Settings
+	day := time.Date(2026, time.January, 31, 23, 30, 0, 0, time.Local)
+	addUsage(&data, day, 100, 200)
+	addUsage(&data, day.Add(time.Hour), 10, 20)
+
+	if got := data.HourlyUsage["2026-01-31T23"]; got.Total != 300 {
+		t.Fatalf("unexpected hour bucket: %+v", got)
+	}
+	if got := data.MonthlyUsage["2026-02"]; got.Upload != 10 || got.Download != 20 {
+		t.Fatalf("unexpected month bucket: %+v", got)
+	}
+
+	retention := Retention{HourlyDays: 1, DailyDays: 31}
+	if !retention.apply(&data, day.AddDate(0, 0, 20)) {
+		t.Fatalf("expected old hours to be pruned")
+	}
+	if len(data.HourlyUsage) != 0 || len(data.DailyUsage) != 2 {
+		t.Fatalf("unexpected buckets after pruning hours: %v %v", data.HourlyUsage, data.DailyUsage)
+	}
+	retention.apply(&data, day.AddDate(0, 0, 31))
+	if _, ok := data.DailyUsage["2026-01-31"]; ok {
+		t.Fatalf("expected January 31 to be pruned: %v", data.DailyUsage)
+	}
+	if got := data.MonthlyUsage["2026-01"]; got.Total != 300 {
+		t.Fatalf("monthly total must survive pruning, got %+v", got)
+	}
+
+	months, err := data.Usage(GranularityMonth, time.Time{}, time.Time{})
+	if err != nil || len(months) != 2 || months[0].Key != "2026-01" {
+		t.Fatalf("unexpected monthly series %v (%v)", months, err)
+	}
+}
+
+func TestNewStoreBackfillsMonthlyUsage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	legacy := `{"daily_usage":{"2026-03-01":{"upload":1,"download":2,"total":3},"2026-03-02":{"upload":4,"download":5,"total":9}}}`
+	if err := os.WriteFile(path, []byte(legacy), 0o644); err != nil {
+		t.Fatalf("write settings: %v", err)
+	}
+
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	if got := store.Get().MonthlyUsage["2026-03"]; got.Upload != 5 || got.Download != 7 || got.Total != 12 {
+		t.Fatalf("unexpected backfilled month: %+v", got)
+	}
+}
+
 func newTestStore(t *testing.T) *Store {
 	t.Helper()
 	path := filepath.Join(t.TempDir(), "settings.json")
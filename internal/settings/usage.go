@@ -0,0 +1,147 @@
+package settings
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Usage bucket key layouts, in local time.
+const (
+	HourLayout  = "2006-01-02T15"
+	DayLayout   = "2006-01-02"
+	MonthLayout = "2006-01"
+)
+
+// Usage granularities accepted by Settings.Usage.
+const (
+	GranularityHour  = "hour"
+	GranularityDay   = "day"
+	GranularityMonth = "month"
+)
+
+// Retention bounds how long each usage granularity is kept. Coarser buckets
+// are written alongside the fine ones, so dropping old hours or days loses
+// detail but never traffic. Zero keeps a granularity forever.
+type Retention struct {
+	HourlyDays    int
+	DailyDays     int
+	MonthlyMonths int
+}
+
+// UsageBucket is the traffic recorded in the bucket that starts at Start.
+type UsageBucket struct {
+	Key   string
+	Start time.Time
+	UsageStats
+}
+
+func addUsage(data *Settings, now time.Time, upload, download int64) {
+	if upload <= 0 && download <= 0 {
+		return
+	}
+	for _, bucket := range []struct {
+		usage *map[string]UsageStats
+		key   string
+	}{
+		{&data.HourlyUsage, now.Format(HourLayout)},
+		{&data.DailyUsage, now.Format(DayLayout)},
+		{&data.MonthlyUsage, now.Format(MonthLayout)},
+	} {
+		if *bucket.usage == nil {
+			*bucket.usage = map[string]UsageStats{}
+		}
+		stats := (*bucket.usage)[bucket.key]
+		stats.Upload += upload
+		stats.Download += download
+		stats.Total += upload + download
+		(*bucket.usage)[bucket.key] = stats
+	}
+}
+
+// apply drops the buckets that fell out of the retention window and reports
+// whether anything was removed.
+func (r Retention) apply(data *Settings, now time.Time) bool {
+	changed := false
+	prune := func(usage map[string]UsageStats, cutoff string) {
+		for key := range usage {
+			if key < cutoff {
+				delete(usage, key)
+				changed = true
+			}
+		}
+	}
+	if r.HourlyDays > 0 {
+		prune(data.HourlyUsage, now.AddDate(0, 0, -r.HourlyDays).Format(HourLayout))
+	}
+	if r.DailyDays > 0 {
+		// Today counts as one of the retained days.
+		prune(data.DailyUsage, now.AddDate(0, 0, 1-r.DailyDays).Format(DayLayout))
+	}
+	if r.MonthlyMonths > 0 {
+		firstOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		prune(data.MonthlyUsage, firstOfMonth.AddDate(0, 1-r.MonthlyMonths, 0).Format(MonthLayout))
+	}
+	return changed
+}
+
+// SetRetention changes the retention policy and prunes right away.
+func (s *Store) SetRetention(r Retention) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retention = r
+	if !r.apply(&s.data, time.Now()) {
+		return nil
+	}
+	return s.save()
+}
+
+func monthlyFromDaily(daily map[string]UsageStats) map[string]UsageStats {
+	monthly := map[string]UsageStats{}
+	for key, usage := range daily {
+		day, err := time.ParseInLocation(DayLayout, key, time.Local)
+		if err != nil {
+			continue
+		}
+		month := day.Format(MonthLayout)
+		stats := monthly[month]
+		stats.Upload += usage.Upload
+		stats.Download += usage.Download
+		stats.Total += usage.Total
+		monthly[month] = stats
+	}
+	return monthly
+}
+
+// Usage returns the buckets of the given granularity that start in
+// [from, to), oldest first. A zero from or to leaves that side open.
+func (s Settings) Usage(granularity string, from, to time.Time) ([]UsageBucket, error) {
+	var (
+		usage  map[string]UsageStats
+		layout string
+	)
+	switch granularity {
+	case GranularityHour:
+		usage, layout = s.HourlyUsage, HourLayout
+	case GranularityDay:
+		usage, layout = s.DailyUsage, DayLayout
+	case GranularityMonth:
+		usage, layout = s.MonthlyUsage, MonthLayout
+	default:
+		return nil, fmt.Errorf("unknown granularity %q", granularity)
+	}
+
+	buckets := make([]UsageBucket, 0, len(usage))
+	for key, stats := range usage {
+		start, err := time.ParseInLocation(layout, key, time.Local)
+		if err != nil {
+			continue
+		}
+		if (!from.IsZero() && start.Before(from)) || (!to.IsZero() && !start.Before(to)) {
+			continue
+		}
+		buckets = append(buckets, UsageBucket{Key: key, Start: start, UsageStats: stats})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start.Before(buckets[j].Start) })
+	return buckets, nil
+}
@@ -11,6 +11,9 @@ import (
 //go:embed web/**
 var content embed.FS
 
+//go:embed login.html
+var loginPage []byte
+
 var (
 	nextIndex    []byte
 	nextFS       fs.FS
@@ -36,6 +39,12 @@ func init() {
 	}
 }
 
+// LoginPage returns the standalone sign-in page template (html/template
+// syntax) shown when authentication is enabled.
+func LoginPage() []byte {
+	return loginPage
+}
+
 // NextIndex returns the embedded Next.js index page.
 func NextIndex() []byte {
 	return nextIndex